@@ -0,0 +1,95 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// nodeClient - RPC of a node whose address can change while in use, see ReplaceNode.
+type nodeClient struct {
+	current  atomic.Value // rpcHolder with the client for the current address
+	calls    int64        // Number of RPC calls in flight
+	stats    callStats    // Statistics of the calls made, see Status (64-bit aligned after calls)
+	paused   int32        // Set while the lock server reports granting paused, see Pause
+	ds       *Dsync       // Cluster the node belongs to
+
+	featuresMutex sync.Mutex
+	features      *Features // Features of the lock server, nil until negotiated
+}
+
+type rpcHolder struct{ RPC }
+
+func newNodeClient(ds *Dsync, c RPC) *nodeClient {
+	n := &nodeClient{ds: ds}
+	n.current.Store(rpcHolder{c})
+	return n
+}
+
+// rpc returns the client for the current address.
+func (n *nodeClient) rpc() RPC {
+	return n.current.Load().(rpcHolder).RPC
+}
+
+func (n *nodeClient) Call(serviceMethod string, args interface {
+	SetToken(token string)
+	SetTimestamp(tstamp time.Time)
+}, reply interface{}) error {
+	err := n.rpc().Call(serviceMethod, args, reply)
+	n.stats.record(err, n.ds.clock().Now())
+	return err
+}
+
+func (n *nodeClient) Node() string {
+	return n.rpc().Node()
+}
+
+func (n *nodeClient) RPCPath() string {
+	return n.rpc().RPCPath()
+}
+
+func (n *nodeClient) Close() error {
+	return n.rpc().Close()
+}
+
+// ReplaceNode switches the node at index over to a new address, eg. when the membership
+// layer announces that the node was rescheduled with a new IP. Requests issued from now
+// on go to c, while requests in flight complete over the client for the old address,
+// which is retired (closed) once retireAfter has passed.
+//
+// The lock server of the node keeps its locks, so locks held remain valid. Lock servers
+// record the address of the client holding a lock though: when the own node moves, report
+// the move to all lock servers (see NodeMoved of package lockserver) so that lock
+// maintenance keeps reaching the holders.
+func (ds *Dsync) ReplaceNode(index int, c RPC, retireAfter time.Duration) error {
+	n := ds.membership().client(index)
+	if n == nil {
+		return &ConfigError{"Index of node is out of range"}
+	}
+	old := n.rpc()
+	n.current.Store(rpcHolder{c})
+	ds.goBackground(func() {
+		select {
+		case <-ds.clock().After(retireAfter):
+		case <-ds.closed:
+		}
+		old.Close()
+	})
+	return nil
+}
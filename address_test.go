@@ -0,0 +1,73 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestReplaceNode(t *testing.T) {
+
+	// Serve the lock servers at a new address as well
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(l, nil)
+
+	var mutex sync.Mutex
+	called := make(map[string]bool)
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && a.Name == "test-replace-node" {
+			mutex.Lock()
+			called[c.Node()] = true
+			mutex.Unlock()
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	// Lock held while the last node moves remains valid
+	dm := NewDRWMutex("test-replace-node", ds)
+	dm.Lock()
+	if err := ds.ReplaceNode(N-1, newClient(l.Addr().String(), rpcPaths[N-1]), 0); err != nil {
+		t.Fatal(err)
+	}
+	defer ds.ReplaceNode(N-1, newClient(nodes[N-1], rpcPaths[N-1]), 0)
+	mutex.Lock()
+	called = make(map[string]bool)
+	mutex.Unlock()
+	dm.Unlock()
+
+	dm.Lock()
+	dm.Unlock()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !called[l.Addr().String()] || called[nodes[N-1]] {
+		t.Fatalf("expected requests to go to %s instead of %s, got %v", l.Addr(), nodes[N-1], called)
+	}
+
+	if err := ds.ReplaceNode(N, newClient(nodes[N-1], rpcPaths[N-1]), 0); err == nil {
+		t.Fatal("expected error for index out of range")
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AdminForceUnlockArgs - arguments for the AdminForceUnlock RPC.
+type AdminForceUnlockArgs struct {
+	AuthArgs
+	Name     string `json:"name"`     // Name of the lock to remove
+	Operator string `json:"operator"` // Operator performing the force unlock, for the audit log
+	Reason   string `json:"reason"`   // Reason for the force unlock, for the audit log
+	Override bool   `json:"override"` // Set when performed with less than a quorum of the nodes reachable
+}
+
+// AdminForceUnlock removes the lock on name (irrespective of write or read lock) at all
+// nodes on behalf of an operator, returning the locks removed per node. Unlike ForceUnlock
+// the request is delivered synchronously and recorded in the audit log of the lock servers.
+//
+// When less than a quorum of the nodes can be reached, eg. during a disaster, nothing is
+// changed and an error is returned, unless override is set. Overrides are recorded as
+// such in the audit log of the nodes that could be reached.
+func (ds *Dsync) AdminForceUnlock(name, operator, reason string, override bool) ([]NodeSnapshot, error) {
+
+	if operator == "" || reason == "" {
+		return nil, errors.New("Operator and reason are required for the audit log")
+	}
+
+	reachable := 0
+	for _, v := range ds.Versions() {
+		if v.Err == nil {
+			reachable++
+		}
+	}
+	if reachable == 0 {
+		return nil, errors.New("No nodes reachable")
+	}
+	m := ds.membership()
+	if reachable < m.quorum && !override {
+		return nil, fmt.Errorf("Only %d of %d nodes reachable, less than a quorum of %d (override required)", reachable, m.count, m.quorum)
+	}
+
+	nodes := m.nodes()
+	removed := make([]NodeSnapshot, len(nodes))
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			var reply SnapshotReply
+			args := AdminForceUnlockArgs{Name: name, Operator: operator, Reason: reason, Override: reachable < m.quorum}
+			removed[i].Node = m.node(index)
+			removed[i].Err = ds.call(index, "Dsync.AdminForceUnlock", &args, &reply)
+			removed[i].Entries = reply.Entries
+			ch <- i
+		}(i, index)
+	}
+	for range nodes {
+		<-ch
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,100 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"errors"
+	. "github.com/minio/dsync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdminForceUnlock(t *testing.T) {
+
+	// Lock that is never released by its holder
+	NewDRWMutex("test-admin-force-unlock", ds).Lock()
+
+	if _, err := ds.AdminForceUnlock("test-admin-force-unlock", "operator", "", false); err == nil {
+		t.Fatal("expected error without reason")
+	}
+
+	removed, err := ds.AdminForceUnlock("test-admin-force-unlock", "operator", "stuck lock", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range removed {
+		if r.Err != nil || len(r.Entries) != 1 || !r.Entries[0].Writer {
+			t.Fatalf("expected write lock to be removed at node %s, got %v (%v)", r.Node, r.Entries, r.Err)
+		}
+	}
+
+	// Lock can be acquired again once removed
+	dm := NewDRWMutex("test-admin-force-unlock", ds)
+	dm.Lock()
+	dm.Unlock()
+}
+
+func TestForceUnlockName(t *testing.T) {
+
+	// Locks that are never released by their holders
+	NewDRWMutex("test-force-unlock-name", ds).RLock()
+	NewDRWMutex("test-force-unlock-name", ds).RLock()
+
+	ds.ForceUnlock("test-force-unlock-name")
+
+	dm := NewDRWMutex("test-force-unlock-name", ds)
+	if !dm.LockWithTimeout(time.Second) {
+		t.Fatal("expected write lock to be granted once forcefully cleared")
+	}
+	dm.Unlock()
+}
+
+func TestAdminForceUnlockOverride(t *testing.T) {
+
+	// Make the last two nodes unreachable for admin operations, leaving less than a quorum
+	var overrides int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if (serviceMethod == "Dsync.Version" || serviceMethod == "Dsync.AdminForceUnlock") &&
+			(c.Node() == nodes[N-1] || c.Node() == nodes[N-2]) {
+			return errors.New("unreachable")
+		}
+		if a, ok := args.(*AdminForceUnlockArgs); ok && a.Override {
+			atomic.AddInt64(&overrides, 1)
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	if _, err := ds.AdminForceUnlock("test-admin-override", "operator", "disaster", false); err == nil {
+		t.Fatal("expected error for less than quorum without override")
+	}
+	if o := atomic.LoadInt64(&overrides); o != 0 {
+		t.Fatalf("expected no calls without override, got %d", o)
+	}
+
+	removed, err := ds.AdminForceUnlock("test-admin-override", "operator", "disaster", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := atomic.LoadInt64(&overrides); o != int64(N-2) {
+		t.Fatalf("expected %d overrides, got %d", N-2, o)
+	}
+	if removed[N-1].Err == nil {
+		t.Fatal("expected error for unreachable node")
+	}
+}
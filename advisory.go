@@ -0,0 +1,149 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// Prefix of the names of advisory locks at the lock servers, so that an advisory
+// lock never conflicts with a DRWMutex of the same name.
+const advisoryPrefix = "advisory" + NamespaceSeparator
+
+// An AdvisoryMutex is a best-effort distributed lock for low-stakes coordination,
+// eg. deciding which node rotates the logs.
+//
+// Unlike a DRWMutex it does not need a quorum: the lock is granted by a single lock
+// server, the first one that can be reached in an order that is the same for all
+// clients. When that lock server goes down (or is partitioned from some of the
+// clients) more than one client can hold the lock at the same time, so never use an
+// AdvisoryMutex to protect against corruption. For the same reason lock maintenance
+// may remove an advisory lock that is held longer than its validity interval.
+type AdvisoryMutex struct {
+	Name  string
+	ds    *Dsync
+	m     sync.Mutex
+	index int    // Lock server that granted the lock
+	uid   string // Uid of the lock granted, empty when not locked
+}
+
+// NewAdvisoryMutex returns an AdvisoryMutex for the given name, locked at one of the nodes of ds.
+func NewAdvisoryMutex(name string, ds *Dsync) *AdvisoryMutex {
+	return &AdvisoryMutex{Name: name, ds: ds}
+}
+
+// Lock holds am, blocking with a randomized back-off until it is available.
+func (am *AdvisoryMutex) Lock() {
+	am.LockContext(context.Background())
+}
+
+// LockContext holds am, like Lock, unless ctx is done before the lock is acquired
+// in which case false is returned.
+func (am *AdvisoryMutex) LockContext(ctx context.Context) bool {
+	runs, backOff := 1, 1
+	for ctx.Err() == nil {
+		if am.TryLock() {
+			return true
+		}
+		select {
+		case <-am.ds.clock().After(time.Duration(backOff) * time.Millisecond):
+		case <-ctx.Done():
+			return false
+		}
+		backOff += int(am.ds.random().Float64() * math.Pow(2, float64(runs)))
+		if backOff > 1024 {
+			backOff = backOff % 64
+			runs = 1
+		} else if runs < 10 {
+			runs++
+		}
+	}
+	return false
+}
+
+// TryLock tries to hold am once, returning false when it is held by another client
+// or when no lock server can be reached.
+func (am *AdvisoryMutex) TryLock() bool {
+	am.m.Lock()
+	defer am.m.Unlock()
+
+	name := advisoryPrefix + am.Name
+	if am.ds.singleNode {
+		uid, _ := am.ds.localTryLock(name, false)
+		am.index, am.uid = 0, uid
+		return isLocked(uid)
+	}
+
+	bytesUid := [16]byte{}
+	cryptorand.Read(bytesUid[:])
+	m := am.ds.membership()
+	args := LockArgs{Name: name, Node: m.clnts[m.ownNode].Node(), RPCPath: m.clnts[m.ownNode].RPCPath(),
+		UID: fmt.Sprintf("%X", bytesUid[:]), Mode: Exclusive}
+
+	// The first lock server that responds decides
+	for _, index := range advisoryNodes(m, am.Name) {
+		var resp LockResp
+		if err := am.ds.call(index, "Dsync.Lock", &args, &resp); err != nil {
+			am.ds.logMessage(dsyncLog, LevelDebug, "Unable to call Dsync.Lock", Fields{"name": name, "node": m.node(index), "error": err})
+			continue
+		}
+		if resp.Granted {
+			am.index, am.uid = index, args.UID
+		}
+		return resp.Granted
+	}
+	return false
+}
+
+// Unlock unlocks am.
+//
+// It is a run-time error if am is not locked on entry to Unlock.
+func (am *AdvisoryMutex) Unlock() {
+	am.m.Lock()
+	defer am.m.Unlock()
+
+	if !isLocked(am.uid) {
+		panic("Trying to Unlock() while no Lock() is active")
+	}
+	if am.ds.singleNode {
+		am.ds.localUnlock(advisoryPrefix+am.Name, false, false)
+	} else {
+		am.ds.sendRelease(am.index, advisoryPrefix+am.Name, am.uid, false)
+	}
+	am.uid = ""
+}
+
+// advisoryNodes returns the indexes of all lock servers of m in the order in which they
+// are asked for the advisory lock on name, starting at a lock server picked by hash
+// so that advisory locks are spread over the lock servers.
+func advisoryNodes(m *members, name string) []int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	nodes := m.nodes()
+	start := int(h.Sum32() % uint32(len(nodes)))
+	indexes := make([]int, len(nodes))
+	for i := range indexes {
+		indexes[i] = nodes[(start+i)%len(nodes)]
+	}
+	return indexes
+}
@@ -0,0 +1,71 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	"errors"
+	. "github.com/minio/dsync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdvisoryMutex(t *testing.T) {
+
+	var down, calls int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && a.Name == "advisory/test-advisory" && serviceMethod == "Dsync.Lock" {
+			atomic.AddInt64(&calls, 1)
+			if atomic.LoadInt64(&down) > 0 && c.Node() != nodes[N-1] {
+				return errors.New("unreachable")
+			}
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	am := NewAdvisoryMutex("test-advisory", ds)
+	if !am.TryLock() {
+		t.Fatal("expected advisory lock to be granted")
+	}
+	if c := atomic.LoadInt64(&calls); c != 1 {
+		t.Fatalf("expected advisory lock to be granted by a single node, got %d calls", c)
+	}
+
+	// Held by another client
+	if NewAdvisoryMutex("test-advisory", ds).TryLock() {
+		t.Fatal("expected advisory lock to be held")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if NewAdvisoryMutex("test-advisory", ds).LockContext(ctx) {
+		t.Fatal("expected advisory lock not to be acquired while held")
+	}
+
+	// Does not conflict with a DRWMutex of the same name
+	dm := NewDRWMutex("test-advisory", ds)
+	dm.Lock()
+	dm.Unlock()
+	am.Unlock()
+
+	// Granted by a single reachable node
+	atomic.StoreInt64(&down, 1)
+	am2 := NewAdvisoryMutex("test-advisory", ds)
+	am2.Lock()
+	am2.Unlock()
+}
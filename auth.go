@@ -0,0 +1,71 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenValidity - time a token is accepted for after it was issued (or before, to allow for
+// clock skew), which bounds the time a captured token can be replayed.
+const TokenValidity = 5 * time.Minute
+
+// NewToken returns a token signed with secret, for RPC clients to set on the arguments of
+// every call (see RPC) to lock servers that require authentication. The token carries the
+// time it was issued along with an HMAC-SHA256 of it, so secret itself never travels.
+func NewToken(secret []byte) string {
+	return newToken(secret, time.Now())
+}
+
+// newToken returns a token signed with secret, issued at the given time.
+func newToken(secret []byte, now time.Time) string {
+	issued := strconv.FormatInt(now.UnixNano(), 10)
+	return issued + "." + tokenSignature(secret, issued)
+}
+
+// VerifyToken returns an error unless token was signed with secret and issued within
+// TokenValidity of now, to be called by lock servers for every RPC.
+func VerifyToken(token string, secret []byte) error {
+	dot := strings.IndexByte(token, '.')
+	if dot < 0 {
+		return errors.New("Authentication failed: missing or malformed token")
+	}
+	issued, signature := token[:dot], token[dot+1:]
+	if !hmac.Equal([]byte(signature), []byte(tokenSignature(secret, issued))) {
+		return errors.New("Authentication failed: invalid signature")
+	}
+	nanos, err := strconv.ParseInt(issued, 10, 64)
+	if err != nil {
+		return errors.New("Authentication failed: malformed token")
+	}
+	if age := time.Since(time.Unix(0, nanos)); age > TokenValidity || age < -TokenValidity {
+		return errors.New("Authentication failed: token expired")
+	}
+	return nil
+}
+
+func tokenSignature(secret []byte, issued string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(issued))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,76 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToken(t *testing.T) {
+
+	secret := []byte("secret")
+	token := NewToken(secret)
+	if err := VerifyToken(token, secret); err != nil {
+		t.Fatalf("expected token to be valid, got %v", err)
+	}
+	if err := VerifyToken(token, []byte("other")); err == nil {
+		t.Fatal("expected token signed with another secret to be refused")
+	}
+	if err := VerifyToken("", secret); err == nil {
+		t.Fatal("expected missing token to be refused")
+	}
+	if err := VerifyToken("1"+token, secret); err == nil {
+		t.Fatal("expected tampered token to be refused")
+	}
+
+	old := NewTokenIssued(secret, time.Now().Add(-2*TokenValidity))
+	if err := VerifyToken(old, secret); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expected expired token to be refused, got %v", err)
+	}
+}
+
+func TestLockServerAuthentication(t *testing.T) {
+
+	secret := []byte("secret")
+	l := lockserver.New(lockserver.Options{AuthSecret: secret})
+	defer l.Close()
+
+	var resp LockResp
+	if err := l.Lock(&LockArgs{Name: "test", UID: "1"}, &resp); err == nil || resp.Granted {
+		t.Fatalf("expected unauthenticated lock to be refused, got %v (%v)", resp.Granted, err)
+	}
+	if err := l.ForceUnlock(&LockArgs{Name: "test", Token: NewToken([]byte("other"))}, &resp); err == nil {
+		t.Fatal("expected force unlock with a token of another secret to be refused")
+	}
+	var snapshot SnapshotReply
+	if err := l.Snapshot(&SnapshotArgs{}, &snapshot); err == nil {
+		t.Fatal("expected unauthenticated snapshot to be refused")
+	}
+
+	if err := l.Lock(&LockArgs{Name: "test", UID: "1", Token: NewToken(secret)}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected authenticated lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+	args := &SnapshotArgs{}
+	args.SetToken(NewToken(secret))
+	if err := l.Snapshot(args, &snapshot); err != nil || len(snapshot.Entries) != 1 {
+		t.Fatalf("expected authenticated snapshot to list the lock, got %v (%v)", snapshot.Entries, err)
+	}
+}
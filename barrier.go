@@ -0,0 +1,159 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"fmt"
+	"time"
+)
+
+// BarrierArgs - arguments for the barrier RPC.
+type BarrierArgs struct {
+	AuthArgs
+	Barrier    string `json:"barrier"`
+	Generation uint64 `json:"generation"`    // Phase of the barrier, counting from zero
+	Parties    int    `json:"parties"`       // Number of participants of the barrier
+	UID        string `json:"uid,omitempty"` // Participant arriving, empty to only list the arrivals
+}
+
+// BarrierReply - reply for the barrier RPC.
+type BarrierReply struct {
+	Granted bool     `json:"granted"`           // Whether the arrival was recorded, denied when the parties differ
+	Arrived []string `json:"arrived,omitempty"` // Uids of the participants arrived at the phase
+}
+
+// Maximum back-off between two polls of a barrier, in milliseconds.
+const maxBarrierBackOff = 100
+
+// A DBarrier blocks a fixed number of participants, possibly in different processes,
+// until all of them arrived, to synchronize the phases of distributed jobs.
+//
+// Every participant uses a DBarrier of its own, created with the same name and number of
+// parties. Arrivals are recorded by a quorum of the nodes, so that every quorum of the
+// nodes knows about every participant arrived, and the barrier opens once a quorum of
+// the nodes together know about all parties. The barrier is cyclic: each call of Await
+// waits for the next phase, so all participants must call it equally often.
+type DBarrier struct {
+	name       string
+	parties    int
+	uid        string // Identifies the participant
+	generation uint64 // Phase waited for by the next Await
+	ds         *Dsync
+}
+
+// NewDBarrier returns a participant of the barrier with the given name for parties
+// participants, stored by the nodes of ds.
+func NewDBarrier(name string, parties int, ds *Dsync) *DBarrier {
+	if parties <= 0 {
+		panic("Number of parties of a barrier must be positive")
+	}
+	bytesUid := [16]byte{}
+	cryptorand.Read(bytesUid[:])
+	return &DBarrier{name: name, parties: parties, uid: fmt.Sprintf("%X", bytesUid[:]), ds: ds}
+}
+
+// Generation returns the number of phases b passed so far.
+func (b *DBarrier) Generation() uint64 {
+	return b.generation
+}
+
+// Await arrives at the current phase of b, blocking until all parties arrived. An error
+// is returned when ctx is done before, in which case the arrival remains recorded and
+// the next Await waits for the same phase again.
+func (b *DBarrier) Await(ctx context.Context) error {
+	runs, backOff := 1, 1
+	arrived := false
+	for {
+		if !arrived {
+			arrived = b.arrive()
+		} else if b.complete() {
+			b.generation++
+			return nil
+		}
+		select {
+		case <-b.ds.clock().After(time.Duration(backOff) * time.Millisecond):
+		case <-ctx.Done():
+			return fmt.Errorf("Barrier %q left at phase %d: %v", b.name, b.generation, ctx.Err())
+		}
+		backOff += int(b.ds.random().Float64() * float64(runs))
+		if backOff > maxBarrierBackOff {
+			backOff = maxBarrierBackOff
+		} else if runs < 10 {
+			runs++
+		}
+	}
+}
+
+// arrive records the arrival of the participant at the current phase, returning whether
+// a quorum of the nodes recorded it. Recording is idempotent, so arrivals are retried.
+func (b *DBarrier) arrive() bool {
+	m := b.ds.membership()
+	replies, errs := b.ds.barrierBroadcast(m, b.args(b.uid))
+	granted := 0
+	for _, index := range m.nodes() {
+		if errs[index] == nil && replies[index].Granted {
+			granted++
+		}
+	}
+	return granted >= m.quorum
+}
+
+// complete returns whether a quorum of the nodes together know about the arrival of all
+// parties at the current phase.
+func (b *DBarrier) complete() bool {
+	m := b.ds.membership()
+	replies, errs := b.ds.barrierBroadcast(m, b.args(""))
+	arrived := make(map[string]struct{})
+	reached := 0
+	for _, index := range m.nodes() {
+		if errs[index] == nil {
+			reached++
+			for _, uid := range replies[index].Arrived {
+				arrived[uid] = struct{}{}
+			}
+		}
+	}
+	return reached >= m.quorum && len(arrived) >= b.parties
+}
+
+// args returns the arguments of the barrier RPC for the current phase.
+func (b *DBarrier) args(uid string) *BarrierArgs {
+	return &BarrierArgs{Barrier: b.name, Generation: b.generation, Parties: b.parties, UID: uid}
+}
+
+// barrierBroadcast sends the barrier RPC to the nodes of m and waits for all replies,
+// which are returned by the index of the node.
+func (ds *Dsync) barrierBroadcast(m *members, args *BarrierArgs) ([]BarrierReply, []error) {
+	replies := make([]BarrierReply, len(m.clnts))
+	errs := make([]error, len(m.clnts))
+
+	nodes := m.nodes()
+	ch := make(chan int, len(nodes))
+	for _, index := range nodes {
+		go func(index int) {
+			a := *args // A copy per node, as RPC clients set the token of the arguments
+			errs[index] = ds.call(index, "Dsync.Barrier", &a, &replies[index])
+			ch <- index
+		}(index)
+	}
+	for range nodes {
+		<-ch
+	}
+	return replies, errs
+}
@@ -0,0 +1,82 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	. "github.com/minio/dsync"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDBarrier(t *testing.T) {
+
+	const parties, phases = 3, 4
+	var arrivals [phases]int32
+	var wg sync.WaitGroup
+	errs := make(chan error, parties*phases)
+	for p := 0; p < parties; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			b := NewDBarrier("test-barrier", parties, ds)
+			for phase := 0; phase < phases; phase++ {
+				time.Sleep(time.Duration(p*5) * time.Millisecond) // Stagger the arrivals
+				atomic.AddInt32(&arrivals[phase], 1)
+				if err := b.Await(context.Background()); err != nil {
+					errs <- err
+					return
+				}
+				// Nobody passes a phase before all parties arrived
+				if n := atomic.LoadInt32(&arrivals[phase]); n != parties {
+					t.Errorf("passed phase %d with %d of %d parties arrived", phase, n, parties)
+				}
+			}
+			if g := b.Generation(); g != phases {
+				t.Errorf("expected generation %d, got %d", phases, g)
+			}
+		}(p)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestDBarrierContext(t *testing.T) {
+
+	b := NewDBarrier("test-barrier-context", 2, ds)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Await(ctx); err == nil {
+		t.Fatal("expected Await to fail while the other party is missing")
+	}
+	if g := b.Generation(); g != 0 {
+		t.Fatalf("expected to remain at generation 0, got %d", g)
+	}
+
+	// The arrival remains recorded, so the barrier opens once the other party arrives
+	if err := NewDBarrier("test-barrier-context", 2, ds).Await(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Await(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,389 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BatchArgs - arguments of the LockBatch RPC, requesting the locks on several names in a
+// single request (see FeatureBatching). The lock server grants either the locks on all
+// names, with the UID of LockArgs, or none. The Name of LockArgs is left empty.
+type BatchArgs struct {
+	LockArgs
+	Names []string `json:"names"` // Names of the resources, without duplicates
+}
+
+// MultiMutex - distributed write lock on several names at once, eg. on the source and the
+// destination of a rename. Every round requests the locks on all names with a single
+// request per node, and either acquires all of them or releases the locks granted again.
+// Since no lock is held while waiting for another one, acquisitions of overlapping sets
+// of names cannot deadlock.
+type MultiMutex struct {
+	Names []string // Names locked together, sorted
+
+	ds      *Dsync
+	owner   string
+	m       sync.Mutex
+	mutexes []*DRWMutex // Locks held per name, in the order of the names, nil when not locked
+}
+
+// NewMultiMutex returns a MultiMutex for the given names, locked at the nodes of ds.
+func NewMultiMutex(names []string, ds *Dsync) *MultiMutex {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	unique := sorted[:0]
+	for i, name := range sorted {
+		if i == 0 || name != sorted[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	return &MultiMutex{Names: unique, ds: ds, owner: newOwner()}
+}
+
+// Lock holds the write locks on all names of mm. If a lock on any of them is held by
+// another client, Lock blocks until all of them are available.
+func (mm *MultiMutex) Lock() {
+	mm.lockBlocking(context.Background(), time.Time{})
+}
+
+// LockWithTimeout holds the write locks on all names of mm, like Lock, unless they
+// cannot be acquired within d in which case false is returned.
+func (mm *MultiMutex) LockWithTimeout(d time.Duration) bool {
+	return mm.lockBlocking(context.Background(), mm.ds.clock().Now().Add(d))
+}
+
+// LockContext holds the write locks on all names of mm, like Lock, unless ctx is done
+// before they are acquired in which case false is returned.
+func (mm *MultiMutex) LockContext(ctx context.Context) bool {
+	deadline, _ := ctx.Deadline()
+	return mm.lockBlocking(ctx, deadline)
+}
+
+// lockBlocking acquires the write locks on all names of mm in rounds, backing off
+// between them according to the retry policy of the cluster, until successful or until
+// the deadline (if not zero) has passed or ctx is done.
+func (mm *MultiMutex) lockBlocking(ctx context.Context, deadline time.Time) bool {
+
+	if mm.ds.singleNode || mm.forwarded() {
+		return mm.lockOneByOne(ctx, deadline)
+	}
+
+	policy := mm.ds.clusterRetryPolicy()
+	mayGiveUp := ctx.Done() != nil || !deadline.IsZero() // Unlike Lock
+	source := callerSource()
+
+	// Traced and measured as a single acquisition of a write lock on all names
+	span := mm.ds.startSpan(ctx, "Lock", strings.Join(mm.Names, ","))
+	start, rounds, acquired := mm.ds.clock().Now(), 0, false
+	var roundErr error // Error of the last round
+	defer func() {
+		mm.ds.metrics.acquired(false, acquired, rounds, mm.ds.clock().Now().Sub(start))
+		if span != nil {
+			if !acquired && ctx.Err() != nil {
+				roundErr = ctx.Err()
+			}
+			span.End(acquired, rounds, roundErr)
+		}
+	}()
+
+	for attempt := 1; ; attempt++ {
+		if ctx.Err() != nil {
+			return false
+		}
+		timeout, ok := roundTimeout(mm.ds.clock().Now(), deadline)
+		if !ok {
+			return false
+		}
+		rounds++
+		locks, ok, err := mm.ds.lockBatch(ctx, mm.ds.membership(), mm.Names, timeout, mm.owner, source, span)
+		if ok {
+			mm.granted(locks)
+			acquired = true
+			return true
+		}
+		roundErr = err
+		mm.ds.logMessage(dsyncLogDenied, LevelInfo, "Failed to acquire locks", Fields{"names": mm.Names, "attempt": attempt, "error": err})
+
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts && mayGiveUp {
+			return false
+		}
+		sleep, ok := backOffBudget(mm.ds.clock().Now(), deadline, policy.delay(attempt, mm.ds.random()))
+		if !ok {
+			return false
+		}
+		select {
+		case <-mm.ds.clock().After(sleep):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// granted records the locks granted by a batch per name, like those of a DRWMutex, so
+// that the lock servers find them held (see HoldsLock) and revocations are reported.
+func (mm *MultiMutex) granted(locks map[string][]string) {
+	mutexes := make([]*DRWMutex, 0, len(mm.Names))
+	for _, name := range mm.Names {
+		dm := NewDRWMutex(name, mm.ds)
+		dm.owner = mm.owner
+		dm.granted(false, locks[name])
+		mutexes = append(mutexes, dm)
+	}
+	mm.m.Lock()
+	mm.mutexes = mutexes
+	mm.m.Unlock()
+}
+
+// forwarded returns true when the lock requests of ds are forwarded (see SetForwarding).
+func (mm *MultiMutex) forwarded() bool {
+	_, ok := mm.ds.forwardingNode()
+	return ok
+}
+
+// lockOneByOne acquires the write locks on the names of mm one after the other, in the
+// order of the names so that acquisitions of overlapping sets of names cannot deadlock,
+// for the modes in which a batch cannot be requested in a single round.
+func (mm *MultiMutex) lockOneByOne(ctx context.Context, deadline time.Time) bool {
+	mutexes := make([]*DRWMutex, 0, len(mm.Names))
+	for _, name := range mm.Names {
+		dm := NewDRWMutex(name, mm.ds)
+		if !dm.lockBlocking(ctx, false, deadline) {
+			for i := len(mutexes) - 1; i >= 0; i-- {
+				mutexes[i].Unlock()
+			}
+			return false
+		}
+		mutexes = append(mutexes, dm)
+	}
+	mm.m.Lock()
+	mm.mutexes = mutexes
+	mm.m.Unlock()
+	return true
+}
+
+// Unlock releases the write locks on all names of mm.
+//
+// It is a run-time error if mm is not locked on entry to Unlock.
+func (mm *MultiMutex) Unlock() {
+
+	mm.m.Lock()
+	mutexes := mm.mutexes
+	mm.mutexes = nil
+	mm.m.Unlock()
+
+	if mutexes == nil {
+		panic("Trying to Unlock() while no Lock() is active")
+	}
+	for i := len(mutexes) - 1; i >= 0; i-- {
+		mutexes[i].Unlock()
+	}
+}
+
+// batchGrant is the response of a node to the request of a batch of locks.
+type batchGrant struct {
+	Granted
+	names []string
+}
+
+// lockBatch tries to acquire the write locks on all names in a single round, sending a
+// single request to every node for the names placed on it. When a quorum of the nodes
+// of every name granted its lock, the uids of the locks per name and node are returned,
+// otherwise the locks granted are released again and the *MultiNodeError of the first
+// name that missed its quorum is returned. Like a round of a single lock, the round is
+// recorded in span (if not nil), the metrics and the quorum failure handler.
+func (ds *Dsync) lockBatch(ctx context.Context, m *members, names []string, timeout time.Duration, owner, source string, span Span) (map[string][]string, bool, error) {
+
+	node, rpcPath := m.clnts[m.ownNode].Node(), m.clnts[m.ownNode].RPCPath()
+	ttl := ds.requestedLeaseTTL()
+
+	// Names to request from every node
+	placements := make(map[string][]placement, len(names))
+	batches := make(map[int][]string)
+	for _, name := range names {
+		placements[name] = ds.lockPlacements(m, name, false)
+		for _, index := range placementNodes(placements[name]) {
+			batches[index] = append(batches[index], name)
+		}
+	}
+
+	start := ds.clock().Now()
+	ch := make(chan batchGrant, len(batches))
+	for index, batch := range batches {
+		atomic.AddInt64(&ds.lockRequests, 1)
+		go func(index int, batch []string) {
+			defer atomic.AddInt64(&ds.lockRequests, -1)
+
+			bytesUid := [16]byte{}
+			cryptorand.Read(bytesUid[:])
+			args := BatchArgs{LockArgs: LockArgs{Node: node, RPCPath: rpcPath, UID: fmt.Sprintf("%X", bytesUid[:]),
+				TTL: ttl, Wait: timeout, Intent: ds.writeIntent(false), Mode: Exclusive, Owner: owner, Source: source},
+				Names: batch}
+			g, leaseTTLs := ds.lockBatchAt(index, &args)
+			g.latency = ds.clock().Now().Sub(start)
+			if g.isLocked() {
+				// Keep the leases alive until the locks are released
+				for _, name := range batch {
+					if leaseTTL := leaseTTLs[name]; leaseTTL > 0 {
+						ds.startLease(index, name, args.UID, ttl, leaseTTL)
+					}
+				}
+			}
+			traceCall(span, m.node(index), "Dsync.LockBatch", start, g)
+			ch <- batchGrant{Granted: g, names: batch}
+		}(index, batch)
+	}
+
+	locks := make(map[string][]string, len(names))
+	for _, name := range names {
+		locks[name] = make([]string, len(m.clnts))
+	}
+	// Responses received before the outcome of this round was decided, kept for error reporting
+	responses := make([]*Granted, len(m.clnts))
+	expired := ds.clock().After(timeout)
+	received := 0
+collect:
+	for ; received < len(batches); received++ {
+		select {
+		case g := <-ch:
+			responses[g.index] = &g.Granted
+			if g.isLocked() {
+				for _, name := range g.names {
+					locks[name][g.index] = g.lockUid
+				}
+			}
+		case <-expired:
+			break collect
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	// Like for a single name, the local lock server has to participate (see lock)
+	var err *MultiNodeError
+	for _, name := range names {
+		nodes := locks[name]
+		if !quorumMet(&nodes, placements[name]) || isReplica(placementNodes(placements[name]), m.ownNode) && !isLocked(nodes[m.ownNode]) {
+			nameErr := ds.newLockError(m, name, false, placementNodes(placements[name]), responses)
+			if err == nil {
+				err = nameErr
+			}
+			if ctx.Err() == nil {
+				ds.quorumFailed(nameErr)
+			}
+		}
+	}
+	granted := err == nil && ctx.Err() == nil
+	if !granted {
+		for _, name := range names {
+			nodes := locks[name]
+			ds.releaseAll(&nodes, name, false)
+		}
+	}
+
+	if span != nil {
+		grants := 0
+		for _, r := range responses {
+			if r != nil && r.isLocked() {
+				grants++
+			}
+		}
+		span.Round(grants, len(batches), granted)
+	}
+
+	// Release the locks granted by nodes that responded too late
+	atomic.AddInt64(&ds.lockCollectors, 1)
+	go func(pending int) {
+		defer atomic.AddInt64(&ds.lockCollectors, -1)
+		for ; pending > 0; pending-- {
+			if g := <-ch; g.isLocked() {
+				for _, name := range g.names {
+					ds.sendRelease(g.index, name, g.lockUid, false)
+				}
+			}
+		}
+	}(len(batches) - received)
+
+	if !granted {
+		ds.metrics.quorumMissed(false)
+		if err == nil {
+			return locks, false, ctx.Err()
+		}
+		return locks, false, err
+	}
+	return locks, true, nil
+}
+
+// lockBatchAt requests the locks of a batch from the lock server at index, returning the
+// response of the node (granted with the UID of args when it granted all of them) along
+// with the lease of every name. Lock servers that do not support batching are asked name
+// by name, releasing the locks granted so far once a lock is denied.
+func (ds *Dsync) lockBatchAt(index int, args *BatchArgs) (Granted, map[string]time.Duration) {
+	g := Granted{index: index}
+	ttls := make(map[string]time.Duration, len(args.Names))
+	if ds.negotiatedFeatures(index).Has(FeatureBatching) {
+		var resp LockResp
+		if g.err = ds.call(index, "Dsync.LockBatch", args, &resp); g.err != nil {
+			ds.logMessage(dsyncLog, LevelDebug, "Unable to call Dsync.LockBatch", Fields{"names": args.Names, "node": ds.membership().node(index), "error": g.err})
+			return g, nil
+		}
+		ds.recordPaused(index, resp.Paused)
+		if !resp.Granted {
+			g.frozen = resp.Frozen
+			return g, nil
+		}
+		for _, name := range args.Names {
+			if resp.TTLs != nil {
+				ttls[name] = resp.TTLs[name]
+			} else {
+				ttls[name] = resp.TTL // Older lock server, or no lease granted at all
+			}
+		}
+		g.lockUid = args.UID
+		return g, ttls
+	}
+
+	for i, name := range args.Names {
+		single := args.LockArgs
+		single.Name = name
+		var resp LockResp
+		g.err = ds.call(index, "Dsync.Lock", &single, &resp)
+		if g.err == nil {
+			ds.recordPaused(index, resp.Paused)
+		}
+		if g.err != nil || !resp.Granted {
+			if g.err != nil {
+				ds.logMessage(dsyncLog, LevelDebug, "Unable to call Dsync.Lock", Fields{"name": name, "node": ds.membership().node(index), "error": g.err})
+			}
+			for _, granted := range args.Names[:i] {
+				ds.sendRelease(index, granted, args.UID, false)
+			}
+			g.frozen = resp.Frozen
+			return g, nil
+		}
+		ttls[name] = resp.TTL
+	}
+	g.lockUid = args.UID
+	return g, ttls
+}
@@ -0,0 +1,233 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/dsynctest"
+	"github.com/minio/dsync/lockserver"
+)
+
+func TestMultiMutex(t *testing.T) {
+
+	mm := NewMultiMutex([]string{"test-multi-b", "test-multi-a", "test-multi-b"}, ds)
+	if expected := []string{"test-multi-a", "test-multi-b"}; !reflect.DeepEqual(mm.Names, expected) {
+		t.Fatalf("expected names %v, got %v", expected, mm.Names)
+	}
+	if !mm.LockWithTimeout(5 * time.Second) {
+		t.Fatal("expected locks to be acquired")
+	}
+	for _, name := range mm.Names {
+		if NewDRWMutex(name, ds).TryLock() {
+			t.Fatalf("expected %s to be locked", name)
+		}
+	}
+
+	// Overlapping names cannot be acquired, and the locks granted meanwhile are released
+	other := NewMultiMutex([]string{"test-multi-b", "test-multi-c"}, ds)
+	if other.LockWithTimeout(100 * time.Millisecond) {
+		t.Fatal("expected overlapping locks not to be acquired")
+	}
+	free := NewDRWMutex("test-multi-c", ds)
+	if !free.LockWithTimeout(5 * time.Second) {
+		t.Fatal("expected lock on test-multi-c to be released after the failed acquisition")
+	}
+	free.Unlock()
+
+	mm.Unlock()
+	if !other.LockWithTimeout(5 * time.Second) {
+		t.Fatal("expected overlapping locks to be acquired after the release")
+	}
+	other.Unlock()
+}
+
+func TestMultiMutexNoDeadlock(t *testing.T) {
+
+	// Writers locking the same names in opposite orders all make progress
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		names := []string{"test-multi-x", "test-multi-y"}
+		if i%2 == 1 {
+			names[0], names[1] = names[1], names[0]
+		}
+		wg.Add(1)
+		go func(names []string) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				mm := NewMultiMutex(names, ds)
+				if !mm.LockWithTimeout(30 * time.Second) {
+					t.Error("expected locks to be acquired")
+					return
+				}
+				mm.Unlock()
+			}
+		}(names)
+	}
+	wg.Wait()
+}
+
+func TestMultiMutexUnlockPanic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("unlock of unlocked MultiMutex did not panic")
+		}
+	}()
+	NewMultiMutex([]string{"test-multi-panic"}, ds).Unlock()
+}
+
+func TestMultiMutexLeases(t *testing.T) {
+
+	var servers []*lockserver.LockServer
+	clnts := make([]RPC, 4)
+	for i := range clnts {
+		l := lockserver.New(lockserver.Options{LeaseTTLs: map[string]lockserver.LeaseTTL{"lease/": {Default: time.Minute}}})
+		defer l.Close()
+		servers = append(servers, l)
+		clnts[i] = NewLocalClient(nodes[i], l)
+	}
+	mds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mds.Close()
+	mds.Negotiate()
+
+	var lost []string
+	var lostMutex sync.Mutex
+	mds.SetLostHandler(func(name string) {
+		lostMutex.Lock()
+		lost = append(lost, name)
+		lostMutex.Unlock()
+	})
+
+	mm := NewMultiMutex([]string{"lease/test-multi-a", "lease/test-multi-b", "test-multi-c"}, mds)
+	if !mm.LockWithTimeout(5 * time.Second) {
+		t.Fatal("expected locks to be acquired")
+	}
+	// Every name granted with a lease has its own, though the names share a uid per node
+	if d := mds.Debug(); d.Leases != 8 {
+		t.Fatalf("expected 8 leases to be refreshed, got %d", d.Leases)
+	}
+
+	// The locks are known as held, so that losing one of them is reported
+	for _, l := range servers {
+		l.ForceUnlock(&LockArgs{Name: "lease/test-multi-b"}, &LockResp{})
+	}
+	mds.SetValidation(10 * time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lostMutex.Lock()
+		n := len(lost)
+		lostMutex.Unlock()
+		if n > 0 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("expected the lock forcefully cleared to be reported as lost")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mds.SetValidation(0)
+	lostMutex.Lock()
+	if !reflect.DeepEqual(lost, []string{"lease/test-multi-b"}) {
+		t.Fatalf("expected only lease/test-multi-b to be lost, got %v", lost)
+	}
+	lostMutex.Unlock()
+
+	// Unlocking stops refreshing the leases
+	mm.Unlock()
+	for deadline := time.Now().Add(2 * time.Second); mds.Debug().Leases > 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the leases to be stopped once unlocked, got %d", mds.Debug().Leases)
+		}
+	}
+}
+
+func TestMultiMutexObservability(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	mds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mds.Negotiate()
+
+	holder := NewDRWMutex("test-multi-obs-b", mds)
+	holder.Lock()
+
+	var mutex sync.Mutex
+	var failures []*MultiNodeError
+	mds.SetQuorumFailureHandler(func(err *MultiNodeError) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		failures = append(failures, err)
+	})
+	tracer := &recordingTracer{}
+	mds.SetTracer(tracer)
+
+	// Rounds missing the quorum are reported for every name that missed it, and since a
+	// node grants either all names of its batch or none, both names missed it
+	mm := NewMultiMutex([]string{"test-multi-obs-a", "test-multi-obs-b"}, mds)
+	if mm.LockWithTimeout(100 * time.Millisecond) {
+		t.Fatal("expected locks not to be acquired")
+	}
+	mutex.Lock()
+	if len(failures) == 0 || len(failures)%2 != 0 {
+		t.Fatalf("expected the failed rounds to be reported for both names, got %d", len(failures))
+	}
+	for i, f := range failures {
+		if name := mm.Names[i%2]; f.Operation != "Lock" || f.Name != name || len(f.Results) != 4 || f.Count(OutcomeDenied) != 4 {
+			t.Fatalf("expected all 4 nodes to deny %s, got %+v", name, f)
+		}
+	}
+	rounds := len(failures) / 2
+	mutex.Unlock()
+
+	m := mds.Metrics()
+	if m.Lock.Failures != 1 || m.Lock.QuorumMisses != uint64(rounds) || m.Lock.Retries != uint64(rounds-1) {
+		t.Fatalf("expected a failed acquisition with %d rounds missing the quorum, got %+v", rounds, m.Lock)
+	}
+	spans := tracer.ended()
+	if len(spans) != 1 || spans[0].operation != "Lock" || spans[0].name != "test-multi-obs-a,test-multi-obs-b" || spans[0].ok || spans[0].rounds != rounds {
+		t.Fatalf("expected a failed span over %d rounds on both names, got %+v", rounds, spans)
+	}
+	if _, ok := spans[0].err.(*MultiNodeError); !ok {
+		t.Fatalf("expected the span to end with the error of the last round, got %v", spans[0].err)
+	}
+
+	// Acquisitions are counted like those of a single lock
+	holder.Unlock()
+	mm.Lock()
+	if m := mds.Metrics(); m.Lock.Acquisitions != 2 || m.Lock.Active != 2 {
+		t.Fatalf("expected the acquisition to be counted with both locks held, got %+v", m.Lock)
+	}
+	if spans := tracer.ended(); len(spans) != 3 || spans[2].operation != "Lock" || !spans[2].ok || len(spans[2].calls) != 4*spans[2].rounds {
+		t.Fatalf("expected a span with the batch requested from all 4 nodes in every round, got %+v", spans)
+	}
+	mm.Unlock()
+
+	// The rounds run (and their late responses collected) by goroutines of mds only
+	mds.Close()
+	dsynctest.AssertNoLeaks(t, mds, 2*time.Second)
+}
@@ -0,0 +1,46 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/minio/dsync/lockserver"
+)
+
+// startAdminConsole serves an interactive debug console for the lock server on the admin port,
+// eg. connect with `nc localhost <port>`.
+func startAdminConsole(l *lockserver.LockServer, port int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		log.Fatal("admin console listen error:", err)
+	}
+	log.Println("Admin console listening at port", port)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Println("Admin console accept error:", err)
+			continue
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			l.ServeConsole(conn, conn)
+		}(conn)
+	}
+}
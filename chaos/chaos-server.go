@@ -19,13 +19,12 @@ package main
 import (
 	"fmt"
 	"github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
 	"log"
-	"math/rand"
 	"net"
 	"net/http"
 	"net/rpc"
 	"strconv"
-	"sync"
 	"time"
 )
 
@@ -43,19 +42,19 @@ func startRPCServer(port int) {
 	log.SetFlags(log.Lmicroseconds)
 
 	server := rpc.NewServer()
-	locker := &lockServer{
-		mutex:   sync.Mutex{},
-		lockMap: make(map[string][]lockRequesterInfo),
-		// timestamp: leave uninitialized for testing (set to real timestamp for actual usage)
+	locker := lockserver.New(lockserver.Options{
+		// Timestamp: leave uninitialized for testing (set to real timestamp for actual usage)
+		MaintenanceInterval: LockMaintenanceLoop,
+		ValidityInterval:    LockCheckValidityInterval,
+		NewClient: func(node, rpcPath string) dsync.RPC {
+			return newClient(node, rpcPath)
+		},
+		Invalidations: true,
+		Clock:         newSkewedClock(*skewFlag, *skewAfterFlag),
+	})
+	if *adminPortFlag != 0 {
+		go startAdminConsole(locker, *adminPortFlag)
 	}
-	go func() {
-		// Start with random sleep time, so as to avoid "synchronous checks" between servers
-		time.Sleep(time.Duration(rand.Float64() * float64(LockMaintenanceLoop)))
-		for {
-			time.Sleep(LockMaintenanceLoop)
-			locker.lockMaintenance(LockCheckValidityInterval)
-		}
-	}()
 	server.RegisterName("Dsync", locker)
 	// For some reason the registration paths need to be different (even for different server objs)
 	rpcPath := dsync.RpcPath + "-" + strconv.Itoa(port)
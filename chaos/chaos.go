@@ -34,9 +34,16 @@ var (
 	portFlag = flag.Int("p", portStart, "Port for server to listen on")
 	writeLockFlag = flag.String("w", "", "Name of write lock to acquire")
 	readLockFlag = flag.String("r", "", "Name of read lock to acquire")
+	adminPortFlag = flag.Int("a", 0, "Port for the admin console to listen on (disabled when 0)")
+	reportFlag = flag.String("report", "", "File to write the JSON report to (stdout when not set)")
+	skewFlag = flag.Duration("skew", 0, "Offset the clock of the lock server jumps ahead by once -skew-after has passed")
+	skewAfterFlag = flag.Duration("skew-after", 0, "Time after start at which the clock of the lock server jumps ahead")
 	servers  []*exec.Cmd
 )
 
+// Cluster of the lock servers.
+var ds *dsync.Dsync
+
 const chaosName = "chaos"
 const n = 4
 const portStart = 12345
@@ -49,6 +56,7 @@ func testNotEnoughServersForQuorum(wg *sync.WaitGroup) {
 
 	log.Println("")
 	log.Println("**STARTING** testNotEnoughServersForQuorum")
+	report.startTest("testNotEnoughServersForQuorum")
 
 	// first kill half the quorum of servers
 	for k := len(servers) - 1; k >= n/2; k-- {
@@ -64,10 +72,12 @@ func testNotEnoughServersForQuorum(wg *sync.WaitGroup) {
 		servers = append(servers, launchTestServers(n/2, 1)...)
 	}()
 
-	dm := dsync.NewDRWMutex("test")
+	dm := dsync.NewDRWMutex("test", ds)
 
 	log.Println("Trying to acquire lock but too few servers active...")
+	requested := time.Now()
 	dm.Lock()
+	report.lockAcquired("test", requested)
 	log.Println("Acquired lock")
 
 	time.Sleep(2 * time.Second)
@@ -89,7 +99,9 @@ func testNotEnoughServersForQuorum(wg *sync.WaitGroup) {
 	}()
 
 	log.Println("Trying to acquire lock again but too few servers active...")
+	requested = time.Now()
 	dm.Lock()
+	report.lockAcquired("test", requested)
 	log.Println("Acquired lock again")
 
 	dm.Unlock()
@@ -101,6 +113,7 @@ func testNotEnoughServersForQuorum(wg *sync.WaitGroup) {
 	}
 
 	log.Println("**PASSED** testNotEnoughServersForQuorum")
+	report.passTest()
 }
 
 // testServerGoingDown tests that a lock is granted when all servers are up, after too
@@ -111,8 +124,9 @@ func testServerGoingDown(wg *sync.WaitGroup) {
 
 	log.Println("")
 	log.Println("**STARTING** testServerGoingDown")
+	report.startTest("testServerGoingDown")
 
-	dm := dsync.NewDRWMutex("test")
+	dm := dsync.NewDRWMutex("test", ds)
 
 	dm.Lock()
 	log.Println("Acquired lock")
@@ -140,13 +154,16 @@ func testServerGoingDown(wg *sync.WaitGroup) {
 	}()
 
 	log.Println("Trying to acquire lock...")
+	requested := time.Now()
 	dm.Lock()
+	report.lockAcquired("test", requested)
 	log.Println("Acquired lock again")
 
 	dm.Unlock()
 	log.Println("Released lock")
 
 	log.Println("**PASSED** testServerGoingDown")
+	report.passTest()
 }
 
 // testServerDownDuringLock verifies that if a server goes down while a lock is held, and comes back later
@@ -157,6 +174,7 @@ func testSingleServerOverQuorumDownDuringLock(wg *sync.WaitGroup) {
 
 	log.Println("")
 	log.Println("**STARTING** testSingleServerOverQuorumDownDuringLock")
+	report.startTest("testSingleServerOverQuorumDownDuringLock")
 
 	// make sure that we just have enough quorum
 	// kill half the quorum of servers
@@ -167,7 +185,7 @@ func testSingleServerOverQuorumDownDuringLock(wg *sync.WaitGroup) {
 	}
 	log.Println("Killed just enough servers to keep quorum")
 
-	dm := dsync.NewDRWMutex("test")
+	dm := dsync.NewDRWMutex("test", ds)
 
 	// acquire lock
 	dm.Lock()
@@ -194,11 +212,13 @@ func testSingleServerOverQuorumDownDuringLock(wg *sync.WaitGroup) {
 		dm.Unlock()
 	}()
 
-	dm2 := dsync.NewDRWMutex("test")
+	dm2 := dsync.NewDRWMutex("test", ds)
 
 	// try to acquire same lock -- only granted after first lock released
 	log.Println("Trying to acquire new lock on same resource...")
+	requested := time.Now()
 	dm2.Lock()
+	report.lockAcquired("test", requested)
 	log.Println("New lock granted")
 
 	// release lock
@@ -206,6 +226,7 @@ func testSingleServerOverQuorumDownDuringLock(wg *sync.WaitGroup) {
 	log.Println("New lock released")
 
 	log.Println("**PASSED** testSingleServerOverQuorumDownDuringLock")
+	report.passTest()
 }
 
 // testMultipleServersOverQuorumDownDuringLockKnownError verifies that if multiple servers go down while a lock is held, and come back later
@@ -218,8 +239,9 @@ func testMultipleServersOverQuorumDownDuringLockKnownError(wg *sync.WaitGroup) {
 
 	log.Println("")
 	log.Println("**STARTING** testMultipleServersOverQuorumDownDuringLockKnownError")
+	report.startTest("testMultipleServersOverQuorumDownDuringLockKnownError")
 
-	dm := dsync.NewDRWMutex("test")
+	dm := dsync.NewDRWMutex("test", ds)
 
 	// acquire lock
 	dm.Lock()
@@ -248,12 +270,15 @@ func testMultipleServersOverQuorumDownDuringLockKnownError(wg *sync.WaitGroup) {
 		dm.Unlock()
 	}()
 
-	dm2 := dsync.NewDRWMutex("test")
+	dm2 := dsync.NewDRWMutex("test", ds)
 
 	// try to acquire same lock -- granted once killed servers are up again
 	log.Println("Trying to acquire new lock on same resource...")
+	requested := time.Now()
 	dm2.Lock()
+	report.lockAcquired("test", requested)
 	log.Println("New lock granted (too soon)")
+	report.knownViolation("testMultipleServersOverQuorumDownDuringLockKnownError: second write lock granted on same resource")
 
 	time.Sleep(6 * time.Second)
 	// release lock
@@ -261,6 +286,7 @@ func testMultipleServersOverQuorumDownDuringLockKnownError(wg *sync.WaitGroup) {
 	log.Println("New lock released")
 
 	log.Println("**PASSED WITH KNOWN ERROR** testMultipleServersOverQuorumDownDuringLockKnownError")
+	report.passTest()
 }
 
 // testSingleStaleLock verifies that, despite a single stale lock, a new lock can still be acquired on same resource
@@ -270,6 +296,7 @@ func testSingleStaleLock(wg *sync.WaitGroup, beforeMaintenanceKicksIn bool) {
 
 	log.Println("")
 	log.Println(fmt.Sprintf("**STARTING** testSingleStaleLock(beforeMaintenanceKicksIn: %v)", beforeMaintenanceKicksIn))
+	report.startTest(fmt.Sprintf("testSingleStaleLock(beforeMaintenanceKicksIn: %v)", beforeMaintenanceKicksIn))
 
 	time.Sleep(500 * time.Millisecond)
 
@@ -294,14 +321,16 @@ func testSingleStaleLock(wg *sync.WaitGroup, beforeMaintenanceKicksIn bool) {
 	time.Sleep(500 * time.Millisecond)
 
 	// lock on same resource can be acquired despite single server having a stale lock
-	dm := dsync.NewDRWMutex(lockName)
+	dm := dsync.NewDRWMutex(lockName, ds)
 
 	ch := make(chan struct{})
 
 	// try to acquire lock in separate routine (will not succeed)
 	go func() {
 		log.Println("Trying to get the lock")
+		requested := time.Now()
 		dm.Lock()
+		report.lockAcquired(lockName, requested)
 		ch <- struct{}{}
 	}()
 
@@ -313,7 +342,7 @@ func testSingleStaleLock(wg *sync.WaitGroup, beforeMaintenanceKicksIn bool) {
 	select {
 	case <-ch:
 		if beforeMaintenanceKicksIn {
-			log.Fatalln("Acquired lock -- SHOULD NOT HAPPEN")
+			report.violation("Acquired lock -- SHOULD NOT HAPPEN")
 		} else {
 			log.Println("Acquired lock")
 		}
@@ -324,11 +353,12 @@ func testSingleStaleLock(wg *sync.WaitGroup, beforeMaintenanceKicksIn bool) {
 		if beforeMaintenanceKicksIn {
 			log.Println("Timed out (expected)")
 		} else {
-			log.Fatalln("Timed out -- SHOULD NOT HAPPEN")
+			report.violation("Timed out -- SHOULD NOT HAPPEN")
 		}
 	}
 
 	log.Println(fmt.Sprintf("**PASSED** testSingleStaleLock(beforeMaintenanceKicksIn: %v)", beforeMaintenanceKicksIn))
+	report.passTest()
 }
 
 // testMultipleStaleLocks verifies that
@@ -340,6 +370,7 @@ func testMultipleStaleLocks(wg *sync.WaitGroup, beforeMaintenanceKicksIn bool) {
 
 	log.Println("")
 	log.Println(fmt.Sprintf("**STARTING** testMultipleStaleLocks(beforeMaintenanceKicksIn: %v)", beforeMaintenanceKicksIn))
+	report.startTest(fmt.Sprintf("testMultipleStaleLocks(beforeMaintenanceKicksIn: %v)", beforeMaintenanceKicksIn))
 
 	time.Sleep(500 * time.Millisecond)
 
@@ -363,14 +394,16 @@ func testMultipleStaleLocks(wg *sync.WaitGroup, beforeMaintenanceKicksIn bool) {
 	time.Sleep(500 * time.Millisecond)
 
 	// lock on same resource can not be acquired due to too many servers having a stale lock
-	dm := dsync.NewDRWMutex(lockName)
+	dm := dsync.NewDRWMutex(lockName, ds)
 
 	ch := make(chan struct{})
 
 	// try to acquire lock in separate routine (will not succeed)
 	go func() {
 		log.Println("Trying to get the lock")
+		requested := time.Now()
 		dm.Lock()
+		report.lockAcquired(lockName, requested)
 		ch <- struct{}{}
 	}()
 
@@ -382,7 +415,7 @@ func testMultipleStaleLocks(wg *sync.WaitGroup, beforeMaintenanceKicksIn bool) {
 	select {
 	case <-ch:
 		if beforeMaintenanceKicksIn {
-			log.Fatalln("Acquired lock -- SHOULD NOT HAPPEN")
+			report.violation("Acquired lock -- SHOULD NOT HAPPEN")
 		} else {
 			log.Println("Acquired lock")
 		}
@@ -393,11 +426,12 @@ func testMultipleStaleLocks(wg *sync.WaitGroup, beforeMaintenanceKicksIn bool) {
 		if beforeMaintenanceKicksIn {
 			log.Println("Timed out (expected)")
 		} else {
-			log.Fatalln("Timed out -- SHOULD NOT HAPPEN")
+			report.violation("Timed out -- SHOULD NOT HAPPEN")
 		}
 	}
 
 	log.Println(fmt.Sprintf("**PASSED** testMultipleStaleLocks(beforeMaintenanceKicksIn: %v)", beforeMaintenanceKicksIn))
+	report.passTest()
 }
 
 // testClientThatHasLockCrashes verifies that (after a lock maintenance loop)
@@ -408,6 +442,7 @@ func testClientThatHasLockCrashes(wg *sync.WaitGroup) {
 
 	log.Println("")
 	log.Println("**STARTING** testClientThatHasLockCrashes")
+	report.startTest("testClientThatHasLockCrashes")
 
 	time.Sleep(500 * time.Millisecond)
 
@@ -428,14 +463,16 @@ func testClientThatHasLockCrashes(wg *sync.WaitGroup) {
 	servers = append(servers, launchTestServers(len(servers), 1)...)
 	log.Println("Crashed server restarted")
 
-	dm := dsync.NewDRWMutex("test-stale")
+	dm := dsync.NewDRWMutex("test-stale", ds)
 
 	ch := make(chan struct{})
 
 	// try to acquire lock in separate routine (will not succeed)
 	go func() {
 		log.Println("Trying to get the lock again")
+		requested := time.Now()
 		dm.Lock()
+		report.lockAcquired("test-stale", requested)
 		ch <- struct{}{}
 	}()
 
@@ -446,10 +483,11 @@ func testClientThatHasLockCrashes(wg *sync.WaitGroup) {
 		time.Sleep(1 * time.Second) // Allow messages to get out
 
 	case <-time.After(60 * time.Second):
-		log.Fatalln("Timed out -- SHOULD NOT HAPPEN")
+		report.violation("Timed out -- SHOULD NOT HAPPEN")
 	}
 
 	log.Println("**PASSED** testClientThatHasLockCrashes")
+	report.passTest()
 }
 
 // Same as testClientThatHasLockCrashes but with two clients having read locks
@@ -459,6 +497,7 @@ func testTwoClientsThatHaveReadLocksCrash(wg *sync.WaitGroup) {
 
 	log.Println("")
 	log.Println("**STARTING** testTwoClientsThatHaveReadLocksCrash")
+	report.startTest("testTwoClientsThatHaveReadLocksCrash")
 
 	time.Sleep(500 * time.Millisecond)
 
@@ -481,14 +520,16 @@ func testTwoClientsThatHaveReadLocksCrash(wg *sync.WaitGroup) {
 	servers = append(servers, launchTestServers(len(servers), 2)...)
 	log.Println("Crashed servers restarted")
 
-	dm := dsync.NewDRWMutex("test-stale")
+	dm := dsync.NewDRWMutex("test-stale", ds)
 
 	ch := make(chan struct{})
 
 	// try to acquire lock in separate routine (will not succeed)
 	go func() {
 		log.Println("Trying to get the lock again")
+		requested := time.Now()
 		dm.Lock()
+		report.lockAcquired("test-stale", requested)
 		ch <- struct{}{}
 	}()
 
@@ -499,10 +540,11 @@ func testTwoClientsThatHaveReadLocksCrash(wg *sync.WaitGroup) {
 		time.Sleep(1 * time.Second) // Allow messages to get out
 
 	case <-time.After(60 * time.Second):
-		log.Fatalln("Timed out -- SHOULD NOT HAPPEN")
+		report.violation("Timed out -- SHOULD NOT HAPPEN")
 	}
 
 	log.Println("**PASSED** testTwoClientsThatHaveReadLocksCrash")
+	report.passTest()
 }
 
 type RWLocker interface {
@@ -519,8 +561,8 @@ type DRWMutexNoWriterStarvation struct {
 
 func NewDRWMutexNoWriterStarvation(name string) *DRWMutexNoWriterStarvation {
 	return &DRWMutexNoWriterStarvation{
-		excl: dsync.NewDRWMutex(name + "-excl-no-writer-starvation"),
-		rw: dsync.NewDRWMutex(name),
+		excl: dsync.NewDRWMutex(name + "-excl-no-writer-starvation", ds),
+		rw: dsync.NewDRWMutex(name, ds),
 	}
 }
 
@@ -554,6 +596,7 @@ func testWriterStarvation(wg *sync.WaitGroup, noWriterStarvation bool) {
 
 	log.Println("")
 	log.Println(fmt.Sprintf("**STARTING** testWriterStarvation(noWriterStarvation: %v)", noWriterStarvation))
+	report.startTest(fmt.Sprintf("testWriterStarvation(noWriterStarvation: %v)", noWriterStarvation))
 
 	start := time.Now()
 
@@ -561,7 +604,7 @@ func testWriterStarvation(wg *sync.WaitGroup, noWriterStarvation bool) {
 	if noWriterStarvation {
 		m = NewDRWMutexNoWriterStarvation("test") // sync.RWMutex{} behaves identical
 	} else {
-		m = dsync.NewDRWMutex("test")
+		m = dsync.NewDRWMutex("test", ds)
 	}
 
 	m.RLock()
@@ -603,14 +646,16 @@ func testWriterStarvation(wg *sync.WaitGroup, noWriterStarvation bool) {
 	if noWriterStarvation {
 		if noStarvation {
 			log.Println(fmt.Sprintf("**PASSED** testWriterStarvation(noWriterStarvation: %v)", noWriterStarvation))
+			report.passTest()
 		} else {
-			log.Fatalln("Second read lock got preference over write lock -- SHOULD NOT HAPPEN")
+			report.violation("Second read lock got preference over write lock -- SHOULD NOT HAPPEN")
 		}
 	} else {
 		if !noStarvation {
 			log.Println(fmt.Sprintf("**PASSED** testWriterStarvation(noWriterStarvation: %v)", noWriterStarvation))
+			report.passTest()
 		} else {
-			log.Fatalln("Second read lock did not get preference over write lock -- NOT EXPECTED")
+			report.violation("Second read lock did not get preference over write lock -- NOT EXPECTED")
 		}
 	}
 }
@@ -647,7 +692,8 @@ func main() {
 					clnts = append(clnts, newClient(fmt.Sprintf("127.0.0.1:%d", portStart+i), dsync.RpcPath+"-"+strconv.Itoa(portStart+i)))
 				}
 
-				if err := dsync.SetNodesWithClients(clnts, getSelfNode(clnts, *portFlag)); err != nil {
+				var err error
+				if ds, err = dsync.New(clnts, getSelfNode(clnts, *portFlag)); err != nil {
 					log.Fatalf("set nodes failed with %v", err)
 				}
 
@@ -655,12 +701,12 @@ func main() {
 				time.Sleep(100 * time.Millisecond)
 
 				if *writeLockFlag != "" {
-					lock := dsync.NewDRWMutex(*writeLockFlag)
+					lock := dsync.NewDRWMutex(*writeLockFlag, ds)
 					lock.Lock()
 					log.Println("Acquired write lock:", *writeLockFlag, "(never to be released)")
 				}
 				if *readLockFlag != "" {
-					lock := dsync.NewDRWMutex(*readLockFlag)
+					lock := dsync.NewDRWMutex(*readLockFlag, ds)
 					lock.RLock()
 					log.Println("Acquired read lock:", *readLockFlag, "(never to be released)")
 				}
@@ -686,6 +732,7 @@ func main() {
 	log.SetPrefix(fmt.Sprintf("[%s] ", chaosName))
 	log.SetFlags(log.Lmicroseconds)
 	servers = append(servers, &exec.Cmd{}) // Add fake process for first entry
+	report.live = 1
 	servers = append(servers, launchTestServers(1, n-1)...)
 
 	// Initialize net/rpc clients for dsync.
@@ -695,7 +742,8 @@ func main() {
 	}
 
 	// This process serves as the first server
-	if err := dsync.SetNodesWithClients(clnts, getSelfNode(clnts, *portFlag)); err != nil {
+	var err error
+	if ds, err = dsync.New(clnts, getSelfNode(clnts, *portFlag)); err != nil {
 		log.Fatalf("set nodes failed with %v", err)
 	}
 
@@ -747,6 +795,10 @@ func main() {
 	testMultipleStaleLocks(&wg, beforeMaintenanceKicksIn)
 	wg.Wait()
 
+	wg.Add(1)
+	testClockSkew(&wg)
+	wg.Wait()
+
 	wg.Add(1)
 	noWriterStarvation := true
 	testWriterStarvation(&wg, noWriterStarvation)
@@ -757,8 +809,13 @@ func main() {
 	testWriterStarvation(&wg, noWriterStarvation)
 	wg.Wait()
 
+	report.write()
+
 	// Kill any launched processes
-	killStaleProcesses(chaosName)
+	killServers()
+	if !report.Passed {
+		os.Exit(1)
+	}
 }
 
 func killStaleProcesses(name string) bool {
@@ -767,7 +824,7 @@ func killStaleProcesses(name string) bool {
 	cmb, _ := cmd.CombinedOutput()
 	procs := strings.Count(string(cmb), "\n")
 	if procs > 1 {
-		fmt.Println("Found more than one", name, "process. Killing all and exiting")
+		fmt.Fprintln(os.Stderr, "Found more than one", name, "process. Killing all and exiting")
 		cmd = exec.Command("pkill", "-SIGKILL", name)
 		cmb, _ = cmd.CombinedOutput()
 		return true
@@ -807,9 +864,14 @@ func launchProcess(port int, name string, writeLock bool) *exec.Cmd {
 	} else {
 		cmd = exec.Command("./"+chaosName, "-p", fmt.Sprintf("%d", port), "-r", name)
 	}
+	return startProcess(cmd)
+}
+
+func startProcess(cmd *exec.Cmd) *exec.Cmd {
 
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = os.Stderr // Keep stdout for the report
 	cmd.Stderr = os.Stderr
+	report.launched()
 	go func(cmd *exec.Cmd) {
 		err := cmd.Start()
 		if err != nil {
@@ -820,6 +882,15 @@ func launchProcess(port int, name string, writeLock bool) *exec.Cmd {
 	return cmd
 }
 
+// killServers kills all launched processes (but not the current process, unlike killStaleProcesses)
+func killServers() {
+	for _, cmd := range servers {
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+	}
+}
+
 func killLastServer() {
 	cmd := servers[len(servers)-1]
 	servers = servers[0 : len(servers)-1]
@@ -830,4 +901,5 @@ func killProcess(cmd *exec.Cmd) {
 	if err := cmd.Process.Kill(); err != nil {
 		log.Fatal("failed to kill: ", err)
 	}
+	report.killed()
 }
@@ -0,0 +1,170 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// chaosReport - final report of a chaos run, written as JSON for gating CI builds.
+type chaosReport struct {
+	mutex sync.Mutex
+
+	Kills             int            `json:"kills"`             // Servers killed
+	Launches          int            `json:"launches"`          // Servers (re)started
+	Partitions        int            `json:"partitions"`        // Network partitions injected (none so far)
+	Tests             []testResult   `json:"tests"`             // Tests in order of execution
+	Violations        []string       `json:"violations"`        // Invariant violations, fail the run
+	KnownViolations   []string       `json:"knownViolations"`   // Violations of known deficiencies, do not fail the run
+	MaxUnavailability time.Duration  `json:"maxUnavailability"` // Longest window without write quorum (ns)
+	LockRecoveries    []lockRecovery `json:"lockRecoveries"`    // Locks acquired after being blocked by a failure
+	MaxLockRecovery   time.Duration  `json:"maxLockRecovery"`   // Longest lock recovery after quorum was restored (ns)
+	Passed            bool           `json:"passed"`
+
+	live            int       // Servers currently running
+	unavailableFrom time.Time // Start of the current window without write quorum, zero when available
+	restoredAt      time.Time // End of the last window without write quorum
+}
+
+type testResult struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Duration time.Duration `json:"duration"` // ns
+
+	start time.Time
+}
+
+type lockRecovery struct {
+	Test        string        `json:"test"`
+	Lock        string        `json:"lock"`
+	Blocked     time.Duration `json:"blocked"`     // Total time the lock call was blocked (ns)
+	AfterQuorum time.Duration `json:"afterQuorum"` // Time blocked since write quorum was (last) restored (ns)
+}
+
+var report = &chaosReport{}
+
+// quorum returns whether enough servers are running to grant a write lock.
+func (r *chaosReport) quorum() bool {
+	return r.live >= n/2+1
+}
+
+// launched records that a server has been (re)started.
+func (r *chaosReport) launched() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Launches++
+	r.live++
+	if r.quorum() && !r.unavailableFrom.IsZero() {
+		r.restoredAt = time.Now()
+		if d := r.restoredAt.Sub(r.unavailableFrom); d > r.MaxUnavailability {
+			r.MaxUnavailability = d
+		}
+		r.unavailableFrom = time.Time{}
+	}
+}
+
+// killed records that a server has been killed.
+func (r *chaosReport) killed() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Kills++
+	r.live--
+	if !r.quorum() && r.unavailableFrom.IsZero() {
+		r.unavailableFrom = time.Now()
+	}
+}
+
+// startTest records the start of a test.
+func (r *chaosReport) startTest(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Tests = append(r.Tests, testResult{Name: name, start: time.Now()})
+}
+
+// passTest records that the test that was started last has passed.
+func (r *chaosReport) passTest() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	t := &r.Tests[len(r.Tests)-1]
+	t.Passed = true
+	t.Duration = time.Since(t.start)
+}
+
+// lockAcquired records the recovery of a lock that was requested at the given time.
+func (r *chaosReport) lockAcquired(lock string, requested time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := time.Now()
+	since := requested
+	if r.restoredAt.After(since) {
+		since = r.restoredAt
+	}
+	lr := lockRecovery{Lock: lock, Blocked: now.Sub(requested), AfterQuorum: now.Sub(since)}
+	if len(r.Tests) > 0 {
+		lr.Test = r.Tests[len(r.Tests)-1].Name
+	}
+	r.LockRecoveries = append(r.LockRecoveries, lr)
+	if lr.AfterQuorum > r.MaxLockRecovery {
+		r.MaxLockRecovery = lr.AfterQuorum
+	}
+}
+
+// knownViolation records a violation caused by a known deficiency.
+func (r *chaosReport) knownViolation(msg string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.KnownViolations = append(r.KnownViolations, msg)
+}
+
+// violation records an invariant violation and terminates the run, after writing the report.
+func (r *chaosReport) violation(msg string) {
+	r.mutex.Lock()
+	r.Violations = append(r.Violations, msg)
+	r.mutex.Unlock()
+
+	log.Println(msg)
+	r.write()
+	killServers()
+	os.Exit(1)
+}
+
+// write writes the report to the file passed with -report, or to stdout when not set.
+func (r *chaosReport) write() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Passed = len(r.Violations) == 0
+	for _, t := range r.Tests {
+		r.Passed = r.Passed && t.Passed
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		log.Fatalln("Failed to marshal report:", err)
+	}
+	b = append(b, '\n')
+	if *reportFlag == "" {
+		os.Stdout.Write(b)
+	} else if err = ioutil.WriteFile(*reportFlag, b, 0644); err != nil {
+		log.Fatalln("Failed to write report:", err)
+	}
+}
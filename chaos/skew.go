@@ -0,0 +1,122 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/minio/dsync"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Lease of the locks in testClockSkew, refreshed every third of it.
+const skewLeaseTTL = 3 * time.Second
+
+// skewedClock - clock of a lock server that jumps ahead by skew once after has passed since
+// start, so that the leases granted before expire early by the clock of the lock server.
+type skewedClock struct {
+	start time.Time
+	after time.Duration
+	skew  time.Duration
+}
+
+// newSkewedClock returns a skewedClock starting now, or nil (the real clock) without skew.
+func newSkewedClock(skew, after time.Duration) dsync.Clock {
+	if skew == 0 {
+		return nil
+	}
+	return skewedClock{start: time.Now(), after: after, skew: skew}
+}
+
+func (c skewedClock) Now() time.Time {
+	now := time.Now()
+	if now.Sub(c.start) >= c.after {
+		return now.Add(c.skew)
+	}
+	return now
+}
+
+func (c skewedClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (c skewedClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+// testClockSkew verifies that a lock with a lease remains held, and is not granted to another
+// client, when the clocks of a quorum of the servers jump ahead by just under the skew bound
+// documented for leases (half the lease) while the lock is held
+func testClockSkew(wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	log.Println("")
+	log.Println("**STARTING** testClockSkew")
+	report.startTest("testClockSkew")
+
+	// restart all servers but the first one (this process) with a clock that jumps ahead
+	skew, after := skewLeaseTTL/2-100*time.Millisecond, 2*time.Second
+	for len(servers) > 1 {
+		killLastServer()
+	}
+	servers = append(servers, launchSkewedServers(1, n-1, skew, after)...)
+	log.Println("Restarted servers with clocks jumping ahead by", skew, "after", after)
+
+	ds.SetLeaseTTL(skewLeaseTTL)
+	defer ds.SetLeaseTTL(0)
+
+	dm := dsync.NewDRWMutex("test-skew", ds)
+	dm.Lock()
+	log.Println("Acquired lock with lease of", skewLeaseTTL)
+	revoked := dm.Revoked()
+
+	// hold the lock across the jump and a couple of leases thereafter
+	time.Sleep(after + 2*skewLeaseTTL)
+
+	select {
+	case <-revoked:
+		report.violation(fmt.Sprintf("testClockSkew: lock revoked with clocks skewed by %v, within the bound of %v", skew, skewLeaseTTL/2))
+	default:
+	}
+	dm2 := dsync.NewDRWMutex("test-skew", ds)
+	if dm2.TryLock() {
+		report.violation(fmt.Sprintf("testClockSkew: lock granted twice with clocks skewed by %v, within the bound of %v", skew, skewLeaseTTL/2))
+	}
+	log.Println("Lock still held exclusively")
+
+	dm.Unlock()
+	log.Println("Released lock")
+
+	// restore the servers with a regular clock
+	for len(servers) > 1 {
+		killLastServer()
+	}
+	servers = append(servers, launchTestServers(1, n-1)...)
+
+	log.Println("**PASSED** testClockSkew")
+	report.passTest()
+}
+
+func launchSkewedServers(start, number int, skew, after time.Duration) []*exec.Cmd {
+
+	result := []*exec.Cmd{}
+
+	for p := portStart + start; p < portStart+start+number; p++ {
+		cmd := exec.Command("./"+chaosName, "-p", fmt.Sprintf("%d", p), "-skew", skew.String(), "-skew-after", after.String())
+		result = append(result, startProcess(cmd))
+	}
+
+	return result
+}
@@ -0,0 +1,116 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock - source of time for all timeouts, retries and expiries of a Dsync.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+type clockHolder struct{ Clock }
+
+// SetClock replaces the clock of ds, eg. by a *FakeClock for tests. Passing nil restores
+// the real clock. The clock can also be set when initializing ds, see Options.
+func (ds *Dsync) SetClock(c Clock) {
+	if c == nil {
+		c = realClock{}
+	}
+	ds.clockValue.Store(clockHolder{c})
+}
+
+// clock returns the clock of ds.
+func (ds *Dsync) clock() Clock {
+	return ds.clockValue.Load().(clockHolder).Clock
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+// FakeClock - manually advanced clock for deterministic tests of expiry and back-off logic.
+type FakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+// NewFakeClock returns a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current (fake) time.
+func (f *FakeClock) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// After returns a channel that fires once the clock has been advanced by d.
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, fakeWaiter{until: f.now.Add(d), ch: ch})
+	return ch
+}
+
+// Sleep blocks until the clock has been advanced by d.
+func (f *FakeClock) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// Advance moves the clock forward, waking up all sleepers and timers that are due.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.until.After(f.now) {
+			pending = append(pending, w)
+		} else {
+			w.ch <- f.now
+		}
+	}
+	f.waiters = pending
+}
+
+// Waiters returns the number of sleepers and timers that have not fired yet.
+func (f *FakeClock) Waiters() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.waiters)
+}
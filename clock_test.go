@@ -0,0 +1,112 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"testing"
+	"time"
+	. "github.com/minio/dsync"
+)
+
+func TestFakeClock(t *testing.T) {
+
+	start := time.Date(2016, 9, 2, 14, 50, 0, 0, time.UTC)
+	fc := NewFakeClock(start)
+
+	ch := fc.After(time.Second)
+	if fc.Waiters() != 1 {
+		t.Fatalf("expected 1 waiter, got %d", fc.Waiters())
+	}
+
+	fc.Advance(500 * time.Millisecond)
+	select {
+	case <-ch:
+		t.Fatal("timer fired too early")
+	default:
+	}
+
+	fc.Advance(500 * time.Millisecond)
+	select {
+	case now := <-ch:
+		if !now.Equal(start.Add(time.Second)) {
+			t.Fatalf("expected %v, got %v", start.Add(time.Second), now)
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+
+	if fc.Waiters() != 0 {
+		t.Fatalf("expected no waiters, got %d", fc.Waiters())
+	}
+}
+
+// waitForWaiters waits until n sleepers or timers are registered with the fake clock.
+func waitForWaiters(t *testing.T, fc *FakeClock, n int) {
+	for i := 0; fc.Waiters() < n; i++ {
+		if i == 500 {
+			t.Fatalf("expected %d waiters, got %d", n, fc.Waiters())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Test that a blocked lock only retries after its back-off time has passed on the clock.
+func TestLockBackOffWithFakeClock(t *testing.T) {
+
+	fc := NewFakeClock(time.Now())
+	ds.SetClock(fc)
+	defer ds.SetClock(nil)
+
+	dm1st := NewDRWMutex("fake-clock", ds)
+	dm2nd := NewDRWMutex("fake-clock", ds)
+
+	dm1st.Lock()
+
+	// Timers of earlier lock rounds stay registered as the fake clock is not advanced
+	waiters := fc.Waiters()
+
+	locked := make(chan struct{})
+	go func() {
+		dm2nd.Lock()
+		close(locked)
+	}()
+
+	// Second lock fails to get quorum (registering a timeout timer) and sleeps for its back-off time
+	waitForWaiters(t, fc, waiters+2)
+
+	dm1st.Unlock()
+	// Allow release messages to get out
+	time.Sleep(100 * time.Millisecond)
+
+	select {
+	case <-locked:
+		t.Fatal("lock acquired without the clock advancing")
+	default:
+	}
+
+	// Advance past the maximum back-off time, so the second lock retries
+	for i := 0; i < 10; i++ {
+		fc.Advance(time.Second)
+		select {
+		case <-locked:
+			dm2nd.Unlock()
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	t.Fatal("lock not acquired after advancing the clock")
+}
@@ -0,0 +1,89 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"time"
+)
+
+// LockResp - reply for all lock RPCs, shared by all transports.
+type LockResp struct {
+	Granted bool                     `json:"granted"`          // Whether the (un)lock request was granted
+	Frozen  bool                     `json:"frozen,omitempty"` // Set when a lock request was denied because the name is frozen (or granting is paused)
+	Paused  bool                     `json:"paused,omitempty"` // Set while granting new locks is paused at the lock server, see Dsync.Pause
+	TTL     time.Duration            `json:"ttl,omitempty"`    // Lease granted, zero when the lock does not expire
+	TTLs    map[string]time.Duration `json:"ttls,omitempty"`   // Lease granted per name by LockBatch, the shortest of them being in TTL
+	View    *LockView                `json:"view,omitempty"`   // View of the lock server on the lock after a grant, nil for older lock servers
+}
+
+// LockView - authoritative view of a lock server on a lock, returned with every grant
+// so that clients can detect protocol violations (see SetViolationHandler).
+type LockView struct {
+	Writer     bool  `json:"writer"`     // Whether the lock is write locked
+	Readers    int   `json:"readers"`    // Number of read locks held
+	QueueDepth int   `json:"queueDepth"` // Number of requests waiting for the lock, zero when the lock server does not queue requests
+	Epoch      int64 `json:"epoch"`      // Incarnation of the lock server, changes when it restarts
+}
+
+// Codec - serializes LockArgs and LockResp (or any other RPC message) for a transport.
+//
+// Transports that do not come with their own encoding (eg. a plain HTTP or
+// message queue transport) should use one of the codecs below so that all
+// transports share the same canonical schema.
+type Codec interface {
+	// Name of the codec, eg. to be used as content type.
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// GobCodec - encodes messages using encoding/gob, identical to what net/rpc sends.
+var GobCodec Codec = gobCodec{}
+
+// JSONCodec - encodes messages using encoding/json.
+var JSONCodec Codec = jsonCodec{}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
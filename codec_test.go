@@ -0,0 +1,62 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	. "github.com/minio/dsync"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+
+	args := LockArgs{
+		Token:     "token",
+		Timestamp: time.Date(2016, 9, 2, 14, 50, 0, 0, time.UTC),
+		Name:      "test",
+		Node:      "127.0.0.1:12345",
+		RPCPath:   RpcPath,
+		UID:       "0123456789ABCDEF",
+	}
+	resp := LockResp{Granted: true, TTL: time.Second, TTLs: map[string]time.Duration{"test": time.Second}}
+
+	for _, codec := range []Codec{GobCodec, JSONCodec} {
+		b, err := codec.Marshal(&args)
+		if err != nil {
+			t.Fatalf("%s: %v", codec.Name(), err)
+		}
+		var args2 LockArgs
+		if err = codec.Unmarshal(b, &args2); err != nil {
+			t.Fatalf("%s: %v", codec.Name(), err)
+		}
+		if !reflect.DeepEqual(args, args2) {
+			t.Fatalf("%s: expected %v, got %v", codec.Name(), args, args2)
+		}
+
+		if b, err = codec.Marshal(&resp); err != nil {
+			t.Fatalf("%s: %v", codec.Name(), err)
+		}
+		var resp2 LockResp
+		if err = codec.Unmarshal(b, &resp2); err != nil {
+			t.Fatalf("%s: %v", codec.Name(), err)
+		}
+		if !reflect.DeepEqual(resp, resp2) {
+			t.Fatalf("%s: expected %v, got %v", codec.Name(), resp, resp2)
+		}
+	}
+}
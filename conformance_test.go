@@ -0,0 +1,57 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"fmt"
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/dsynctest"
+	"github.com/minio/dsync/lockserver"
+	"testing"
+)
+
+// newLockServers starts n lock servers of package lockserver, returning clients created
+// with newClient.
+func newLockServers(n int, newClient func(l *lockserver.LockServer, node string) RPC) ([]RPC, func(), error) {
+	clnts := make([]RPC, n)
+	servers := make([]*lockserver.LockServer, n)
+	for i := range clnts {
+		servers[i] = lockserver.New(lockserver.Options{})
+		clnts[i] = newClient(servers[i], fmt.Sprintf("conformance-%d", i))
+	}
+	return clnts, func() {
+		for _, l := range servers {
+			l.Close()
+		}
+	}, nil
+}
+
+func TestConformanceLocalClient(t *testing.T) {
+	dsynctest.TestConformance(t, func(n int) ([]RPC, func(), error) {
+		return newLockServers(n, func(l *lockserver.LockServer, node string) RPC {
+			return NewLocalClient(node, l)
+		})
+	})
+}
+
+func TestConformanceNetLocker(t *testing.T) {
+	dsynctest.TestConformance(t, func(n int) ([]RPC, func(), error) {
+		return newLockServers(n, func(l *lockserver.LockServer, node string) RPC {
+			return NewNetLockerClient(netLocker{l}, node, DefaultPath)
+		})
+	})
+}
@@ -0,0 +1,56 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import "time"
+
+// MinRoundTimeout - minimum time to wait for the responses of a single lock round,
+// a round is not attempted anymore when less time than this is left before the deadline.
+const MinRoundTimeout = 5 * time.Millisecond
+
+// roundTimeout returns how long to wait for the responses of the next lock round given
+// the overall deadline (zero meaning no deadline), or false when no round fits anymore.
+//
+// The responses of all nodes are awaited in parallel, so this is the budget of every
+// single node as well.
+func roundTimeout(now, deadline time.Time) (time.Duration, bool) {
+	if deadline.IsZero() {
+		return DRWMutexAcquireTimeout, true
+	}
+	remaining := deadline.Sub(now)
+	if remaining < MinRoundTimeout {
+		return 0, false
+	} else if remaining < DRWMutexAcquireTimeout {
+		return remaining, true
+	}
+	return DRWMutexAcquireTimeout, true
+}
+
+// backOffBudget caps the back-off before the next lock round such that the round still
+// fits before the deadline (zero meaning no deadline), or returns false when it does not.
+func backOffBudget(now, deadline time.Time, backOff time.Duration) (time.Duration, bool) {
+	if deadline.IsZero() {
+		return backOff, true
+	}
+	remaining := deadline.Sub(now) - MinRoundTimeout
+	if remaining <= 0 {
+		return 0, false
+	} else if backOff > remaining {
+		return remaining, true
+	}
+	return backOff, true
+}
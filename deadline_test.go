@@ -0,0 +1,68 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"testing"
+	"time"
+)
+
+func TestRoundTimeout(t *testing.T) {
+
+	now := time.Now()
+	testCases := []struct {
+		deadline time.Time
+		timeout  time.Duration
+		ok       bool
+	}{
+		{time.Time{}, DRWMutexAcquireTimeout, true},          // No deadline
+		{now.Add(time.Second), DRWMutexAcquireTimeout, true}, // Plenty of time
+		{now.Add(10 * time.Millisecond), 10 * time.Millisecond, true},
+		{now.Add(MinRoundTimeout), MinRoundTimeout, true},
+		{now.Add(MinRoundTimeout - 1), 0, false}, // Below minimum
+		{now.Add(-time.Second), 0, false},        // Deadline passed
+	}
+	for i, tc := range testCases {
+		timeout, ok := RoundTimeout(now, tc.deadline)
+		if timeout != tc.timeout || ok != tc.ok {
+			t.Errorf("case %d: expected (%v, %v), got (%v, %v)", i, tc.timeout, tc.ok, timeout, ok)
+		}
+	}
+}
+
+func TestBackOffBudget(t *testing.T) {
+
+	now := time.Now()
+	testCases := []struct {
+		deadline time.Time
+		backOff  time.Duration
+		budget   time.Duration
+		ok       bool
+	}{
+		{time.Time{}, time.Second, time.Second, true},                               // No deadline
+		{now.Add(time.Minute), time.Second, time.Second, true},                      // Plenty of time
+		{now.Add(100 * time.Millisecond), time.Second, 95 * time.Millisecond, true}, // Leaves room for a round
+		{now.Add(MinRoundTimeout), time.Second, 0, false},                           // No room for a round
+	}
+	for i, tc := range testCases {
+		budget, ok := BackOffBudget(now, tc.deadline, tc.backOff)
+		if budget != tc.budget || ok != tc.ok {
+			t.Errorf("case %d: expected (%v, %v), got (%v, %v)", i, tc.budget, tc.ok, budget, ok)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"bytes"
+	"fmt"
+	"sync/atomic"
+)
+
+// DebugInfo - snapshot of the goroutines and RPC calls a Dsync has in flight.
+type DebugInfo struct {
+	LockRequests   int64           // Goroutines broadcasting a lock request to a node
+	LockCollectors int64           // Goroutines collecting (late) lock responses
+	Releases       int64           // Releases being delivered (or retried by the release worker)
+	Leases         int64           // Goroutines refreshing the lease of a lock
+	Background     int64           // Other goroutines, eg. collecting the acknowledgements of releases (see UnlockNotify) or retiring clients (see ReplaceNode)
+	Violations     int64           // Protocol violations detected since ds was initialized, see SetViolationHandler
+	Pending        int64           // Releases pending at the release worker, see SetReleaseLimits
+	Dropped        int64           // Releases dropped since ds was initialized because too many were pending
+	Expired        int64           // Releases given up on since ds was initialized because of their age
+	Nodes          []NodeDebugInfo // Per lock server details
+}
+
+// NodeDebugInfo - RPC calls in flight towards a single lock server.
+//
+// Connections themselves are owned by the RPC implementation, so calls in
+// flight are the closest dsync itself can get to auditing them.
+type NodeDebugInfo struct {
+	Node          string
+	RPCPath       string
+	CallsInFlight int64
+}
+
+// Goroutines returns the total number of goroutines started by ds that are still running.
+func (d DebugInfo) Goroutines() int64 {
+	return d.LockRequests + d.LockCollectors + d.Releases + d.Leases + d.Background
+}
+
+// CallsInFlight returns the total number of RPC calls in flight over all lock servers.
+func (d DebugInfo) CallsInFlight() (calls int64) {
+	for _, n := range d.Nodes {
+		calls += n.CallsInFlight
+	}
+	return calls
+}
+
+// String returns a human readable report.
+func (d DebugInfo) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "goroutines: %d (lock requests: %d, lock collectors: %d, releases: %d, leases: %d, background: %d)\n",
+		d.Goroutines(), d.LockRequests, d.LockCollectors, d.Releases, d.Leases, d.Background)
+	fmt.Fprintf(&b, "pending releases: %d (dropped: %d, expired: %d)\n", d.Pending, d.Dropped, d.Expired)
+	if d.Violations > 0 {
+		fmt.Fprintf(&b, "protocol violations: %d\n", d.Violations)
+	}
+	for _, n := range d.Nodes {
+		fmt.Fprintf(&b, "node %s%s: %d calls in flight\n", n.Node, n.RPCPath, n.CallsInFlight)
+	}
+	return b.String()
+}
+
+// Debug returns a report of the goroutines and RPC calls ds currently has in flight.
+// Every Dsync accounts for its own, so that other instances in the process (eg. of
+// other tests) do not show up in the report.
+func (ds *Dsync) Debug() DebugInfo {
+	d := DebugInfo{
+		LockRequests:   atomic.LoadInt64(&ds.lockRequests),
+		LockCollectors: atomic.LoadInt64(&ds.lockCollectors),
+		Releases:       atomic.LoadInt64(&ds.releases.goroutines),
+		Leases:         atomic.LoadInt64(&ds.leaseGoroutines),
+		Background:     atomic.LoadInt64(&ds.background),
+		Violations:     atomic.LoadInt64(&ds.violations),
+		Pending:        int64(ds.releases.pendingReleaseCount()),
+		Dropped:        atomic.LoadInt64(&ds.releases.dropped),
+		Expired:        atomic.LoadInt64(&ds.releases.expired),
+	}
+	m := ds.membership()
+	for _, index := range m.nodes() {
+		c := m.clnts[index]
+		d.Nodes = append(d.Nodes, NodeDebugInfo{
+			Node:          c.Node(),
+			RPCPath:       c.RPCPath(),
+			CallsInFlight: atomic.LoadInt64(&c.calls),
+		})
+	}
+	return d
+}
+
+// goBackground runs fn in a goroutine of its own, accounted for as background work of
+// ds in Debug.
+func (ds *Dsync) goBackground(fn func()) {
+	atomic.AddInt64(&ds.background, 1)
+	go func() {
+		defer atomic.AddInt64(&ds.background, -1)
+		fn()
+	}()
+}
+
+// call issues an RPC to the lock server at index through the chain of interceptors,
+// keeping track of the calls in flight.
+func (ds *Dsync) call(index int, serviceMethod string, args RPCArgs, reply interface{}) error {
+	c := ds.membership().client(index)
+	if c == nil {
+		return errNodeRemoved
+	}
+	atomic.AddInt64(&c.calls, 1)
+	defer atomic.AddInt64(&c.calls, -1)
+	return ds.invoker()(c, serviceMethod, args, reply)
+}
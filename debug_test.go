@@ -0,0 +1,95 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"testing"
+	"time"
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/dsynctest"
+	"github.com/minio/dsync/lockserver"
+)
+
+func TestDebugNoLeaks(t *testing.T) {
+
+	dm := NewDRWMutex("debug-no-leaks", ds)
+
+	dm.Lock()
+	dm.Unlock()
+
+	dm.RLock()
+	dm.RLock()
+	dm.RUnlock()
+	dm.RUnlock()
+
+	dsynctest.AssertNoLeaks(t, ds, 2*time.Second)
+}
+
+func TestDebugClose(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	cds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cds.SetLeaseTTL(time.Minute)
+	cds.SetValidation(10 * time.Millisecond)
+
+	dm := NewDRWMutex("debug-close", cds)
+	dm.Lock()
+	if d := cds.Debug(); d.Leases != 4 {
+		t.Fatalf("expected 4 leases to be refreshed, got %d", d.Leases)
+	}
+	if d := ds.Debug(); d.Leases != 0 {
+		t.Fatalf("expected the leases of another Dsync not to be reported, got %d", d.Leases)
+	}
+
+	// Locks held are left to expire at the lock servers
+	cds.Close()
+	dsynctest.AssertNoLeaks(t, cds, 2*time.Second)
+}
+
+func TestDebugBackground(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	cds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Retiring the client replaced, and expiring the cached read lock
+	if err := cds.ReplaceNode(3, clnts[3], time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cds.SetReadCache(time.Hour)
+	dm := NewDRWMutex("debug-background", cds)
+	dm.RLock()
+	dm.RUnlock()
+	if d := cds.Debug(); d.Background != 2 || d.Goroutines() != 2 {
+		t.Fatalf("expected 2 goroutines in the background, got %v", d)
+	}
+
+	// Both give up once closed
+	cds.Close()
+	dsynctest.AssertNoLeaks(t, cds, 2*time.Second)
+}
@@ -17,23 +17,27 @@
 package dsync
 
 import (
+	"context"
 	cryptorand "crypto/rand"
 	"fmt"
-	"log"
-	"math"
-	"math/rand"
-	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Indicator if logging is enabled.
 var dsyncLog bool
 
+// Indicator if logging of failed lock acquisitions is enabled.
+var dsyncLogDenied bool
+
 func init() {
 	// Check for DSYNC_LOG env variable, if set logging will be enabled for failed RPC operations.
 	dsyncLog = os.Getenv("DSYNC_LOG") == "1"
+	// Check for DSYNC_LOG_DENIED env variable, if set every failed acquisition round will be logged
+	// along with the nodes that granted, denied or failed to respond to the lock request.
+	dsyncLogDenied = os.Getenv("DSYNC_LOG_DENIED") == "1"
 }
 
 // DRWMutexAcquireTimeout - tolerance limit to wait for lock acquisition before.
@@ -42,31 +46,65 @@ const DRWMutexAcquireTimeout = 25 * time.Millisecond // 25ms.
 // A DRWMutex is a distributed mutual exclusion lock.
 type DRWMutex struct {
 	Name         string
-	writeLocks   []string   // Array of nodes that granted a write lock
-	readersLocks [][]string // Array of array of nodes that granted reader locks
-	m            sync.Mutex // Mutex to prevent multiple simultaneous locks from this node
+	ds           *Dsync        // Cluster the lock is requested from
+	writeLocks   []string      // Array of nodes that granted a write lock
+	readersLocks [][]string    // Array of array of nodes that granted reader locks
+	m            sync.Mutex    // Mutex to prevent multiple simultaneous locks from this node
+	revoked      chan struct{} // Closed when a lock server revokes a lock held, see Revoked
+	reentrant    bool          // Set when the write lock may be re-acquired by its holder, see Reentrant
+	holds        int           // Number of nested write locks held on top of the first one
+	owner        string        // Uid passed along with all lock requests, see Owner
+	retry        *RetryPolicy  // Timing of the rounds of acquisitions overriding the one of ds, see WithRetryPolicy
 }
 
 type Granted struct {
 	index   int
-	lockUid string // Locked if set with UID string, unlocked if empty
+	lockUid string        // Locked if set with UID string, unlocked if empty
+	frozen  bool          // Set when denied because the name is frozen
+	err     error         // Set when the lock request failed to be delivered
+	latency time.Duration // Time it took for the response to come in
 }
 
 func (g *Granted) isLocked() bool {
 	return isLocked(g.lockUid)
 }
 
+// outcome returns the outcome of the lock request at the node.
+func (g *Granted) outcome() Outcome {
+	switch {
+	case g.isLocked():
+		return OutcomeGranted
+	case g.err != nil:
+		return OutcomeError
+	case g.frozen:
+		return OutcomeFrozen
+	default:
+		return OutcomeDenied
+	}
+}
+
 func isLocked(uid string) bool {
 	return len(uid) > 0
 }
 
+// LockArgs - arguments for all lock RPCs, shared by all transports.
 type LockArgs struct {
-	Token     string
-	Timestamp time.Time
-	Name      string
-	Node      string
-	RPCPath   string
-	UID       string
+	Token     string            `json:"token,omitempty"`    // Authentication token
+	Timestamp time.Time         `json:"timestamp"`          // Timestamp of the lock server as known by the client
+	Name      string            `json:"name"`               // Name of the resource
+	Node      string            `json:"node,omitempty"`     // Network address of the client requesting the lock
+	RPCPath   string            `json:"rpcPath,omitempty"`  // RPC path of the client requesting the lock
+	UID       string            `json:"uid,omitempty"`      // Uid to uniquely identify the request of the client
+	Priority  int               `json:"priority,omitempty"` // Priority of the request, see PriorityKey
+	Tenant    string            `json:"tenant,omitempty"`   // Tenant on whose behalf the request is made, see TenantKey
+	TTL       time.Duration     `json:"ttl,omitempty"`      // Lease requested, zero leaves it to the lock server, see SetLeaseTTL
+	Wait      time.Duration     `json:"wait,omitempty"`     // Time the client waits for the response, zero when unknown
+	Intent    time.Duration     `json:"intent,omitempty"`   // Time read locks are refused for the sake of this write request, see SetLocalReads
+	Mode      LockMode          `json:"mode,omitempty"`     // Mode the lock is requested (or released) in, empty for older clients
+	DryRun    bool              `json:"dryRun,omitempty"`   // Only check whether the lock would be granted, see DRWMutex.DryRunLock
+	Owner     string            `json:"owner,omitempty"`    // Uid of the DRWMutex requesting the lock, the same at all nodes
+	Source    string            `json:"source,omitempty"`   // File:line of the caller requesting the lock
+	Tags      map[string]string `json:"tags,omitempty"`     // Tags of the request, see TagsKey
 }
 
 func (l *LockArgs) SetToken(token string) {
@@ -77,11 +115,19 @@ func (l *LockArgs) SetTimestamp(tstamp time.Time) {
 	l.Timestamp = tstamp
 }
 
-func NewDRWMutex(name string) *DRWMutex {
-	return &DRWMutex{
+// NewDRWMutex returns a DRWMutex for name, locked at the nodes of ds, configured
+// with the options given (if any).
+func NewDRWMutex(name string, ds *Dsync, opts ...MutexOption) *DRWMutex {
+	dm := &DRWMutex{
 		Name:       name,
-		writeLocks: make([]string, dnodeCount),
+		ds:         ds,
+		owner:      newOwner(),
+		writeLocks: make([]string, len(ds.membership().clnts)),
 	}
+	for _, opt := range opts {
+		opt(dm)
+	}
+	return dm
 }
 
 // Lock holds a write lock on dm.
@@ -91,7 +137,19 @@ func NewDRWMutex(name string) *DRWMutex {
 func (dm *DRWMutex) Lock() {
 
 	isReadLock := false
-	dm.lockBlocking(isReadLock)
+	dm.lockBlocking(context.Background(), isReadLock, time.Time{})
+}
+
+// LockContext holds a write lock on dm, like Lock, unless ctx is done or its
+// deadline passes before the lock is acquired in which case false is returned.
+//
+// Request-scoped metadata stored in ctx under PriorityKey and TenantKey is
+// passed on to the lock servers.
+func (dm *DRWMutex) LockContext(ctx context.Context) bool {
+
+	isReadLock := false
+	deadline, _ := ctx.Deadline()
+	return dm.lockBlocking(ctx, isReadLock, deadline)
 }
 
 // RLock holds a read lock on dm.
@@ -101,132 +159,474 @@ func (dm *DRWMutex) Lock() {
 func (dm *DRWMutex) RLock() {
 
 	isReadLock := true
-	dm.lockBlocking(isReadLock)
+	dm.lockBlocking(context.Background(), isReadLock, time.Time{})
+}
+
+// RLockContext holds a read lock on dm, like RLock, unless ctx is done or its
+// deadline passes before the lock is acquired in which case false is returned.
+//
+// Request-scoped metadata stored in ctx under PriorityKey and TenantKey is
+// passed on to the lock servers.
+func (dm *DRWMutex) RLockContext(ctx context.Context) bool {
+
+	isReadLock := true
+	deadline, _ := ctx.Deadline()
+	return dm.lockBlocking(ctx, isReadLock, deadline)
+}
+
+// LockUntilDone holds a write lock on dm, like LockContext, and releases it once ctx is
+// done, tying the lifetime of the lock to eg. the request of an HTTP handler or a job.
+// Returns false when ctx is done before the lock is acquired.
+//
+// The lock must not be released with Unlock, and is held until the process exits when
+// ctx is never done. Once the Dsync of dm is closed, the lock is no longer released but
+// left to expire at the lock servers, like all locks held (see Dsync.Close).
+func (dm *DRWMutex) LockUntilDone(ctx context.Context) bool {
+
+	if !dm.LockContext(ctx) {
+		return false
+	}
+	dm.ds.goBackground(func() {
+		select {
+		case <-ctx.Done():
+			dm.Unlock()
+		case <-dm.ds.closed:
+		}
+	})
+	return true
+}
+
+// RLockUntilDone holds a read lock on dm, like RLockContext, and releases it once ctx is
+// done, like LockUntilDone.
+func (dm *DRWMutex) RLockUntilDone(ctx context.Context) bool {
+
+	if !dm.RLockContext(ctx) {
+		return false
+	}
+	dm.ds.goBackground(func() {
+		select {
+		case <-ctx.Done():
+			dm.RUnlock()
+		case <-dm.ds.closed:
+		}
+	})
+	return true
+}
+
+// LockWithTimeout holds a write lock on dm, like Lock, unless it cannot be acquired
+// within d in which case false is returned (and no more attempts are made).
+func (dm *DRWMutex) LockWithTimeout(d time.Duration) bool {
+
+	isReadLock := false
+	return dm.lockBlocking(context.Background(), isReadLock, dm.ds.clock().Now().Add(d))
+}
+
+// RLockWithTimeout holds a read lock on dm, like RLock, unless it cannot be acquired
+// within d in which case false is returned (and no more attempts are made).
+func (dm *DRWMutex) RLockWithTimeout(d time.Duration) bool {
+
+	isReadLock := true
+	return dm.lockBlocking(context.Background(), isReadLock, dm.ds.clock().Now().Add(d))
+}
+
+// TryLock tries to hold a write lock on dm in a single round, returning false right
+// away when the lock cannot be acquired (eg. because it is held by another client)
+// instead of retrying until it is available.
+func (dm *DRWMutex) TryLock() bool {
+
+	isReadLock := false
+	return dm.tryLock(isReadLock)
+}
+
+// TryRLock tries to hold a read lock on dm in a single round, like TryLock.
+func (dm *DRWMutex) TryRLock() bool {
+
+	isReadLock := true
+	return dm.tryLock(isReadLock)
+}
+
+// tryLock attempts to acquire either a read or a write lock in a single round
+func (dm *DRWMutex) tryLock(isReadLock bool) bool {
+
+	if !isReadLock && dm.reenter() {
+		return true
+	}
+
+	if isReadLock {
+		if dm.shareCachedRLock() {
+			return true
+		}
+	} else {
+		dm.ds.InvalidateReadCache(dm.Name)
+	}
+
+	if dm.ds.singleNode {
+		uid, changed := dm.ds.localTryLock(dm.Name, isReadLock)
+		if changed != nil {
+			return false
+		}
+		m := dm.ds.membership()
+		locks := make([]string, len(m.clnts))
+		locks[m.ownNode] = uid
+		dm.granted(isReadLock, locks)
+		return true
+	}
+
+	// do not wait for other goroutines of this process trying to acquire the same name
+	leaveGate, ok := dm.ds.enterGate(context.Background(), dm.Name, dm.ds.clock().Now())
+	if !ok {
+		return false
+	}
+	defer leaveGate()
+
+	m := dm.ds.membership()
+	locks := make([]string, len(m.clnts))
+	meta := lockMetadata{owner: dm.owner, source: callerSource()}
+	operation := "Lock"
+	if isReadLock {
+		operation = "RLock"
+	}
+	meta.span = dm.ds.startSpan(context.Background(), operation, dm.Name)
+	start := dm.ds.clock().Now()
+	success, err := dm.ds.lock(context.Background(), m, &locks, dm.Name, isReadLock, DRWMutexAcquireTimeout, meta)
+	dm.ds.metrics.acquired(isReadLock, success, 1, dm.ds.clock().Now().Sub(start))
+	if meta.span != nil {
+		meta.span.End(success, 1, err)
+	}
+	if !success {
+		dm.ds.logMessage(dsyncLogDenied, LevelInfo, "Failed to acquire lock (single attempt)", Fields{"name": dm.Name, "error": err})
+		return false
+	}
+	dm.granted(isReadLock, locks)
+	return true
+}
+
+// shareCachedRLock shares a cached read lock on the name of dm when available.
+func (dm *DRWMutex) shareCachedRLock() bool {
+	locks, ok := dm.ds.cachedRLock(dm.Name)
+	if !ok {
+		return false
+	}
+	dm.m.Lock()
+	defer dm.m.Unlock()
+	dm.readersLocks = append(dm.readersLocks, append([]string(nil), locks...))
+	dm.ds.metrics.held(true, 1)
+	return true
 }
 
 // lockBlocking will acquire either a read or a write lock
 //
-// The call will block until the lock is granted using a built-in
-// timing randomized back-off algorithm to try again until successful
-func (dm *DRWMutex) lockBlocking(isReadLock bool) {
+// The call will block until the lock is granted using a randomized
+// exponential back-off (see RetryPolicy) to try again until successful,
+// or until the deadline (if not zero) has passed or ctx is done in which case
+// false is returned. Once ctx is done, both a round in progress and the back-off
+// are cut short and all locks granted meanwhile are released
+func (dm *DRWMutex) lockBlocking(ctx context.Context, isReadLock bool, deadline time.Time) bool {
+
+	policy := dm.retryPolicy()
+	mayGiveUp := ctx.Done() != nil || !deadline.IsZero() // Unlike Lock and RLock
+	meta := metadataFromContext(ctx)
+	meta.owner, meta.source = dm.owner, callerSource()
+	operation := "Lock"
+	if isReadLock {
+		operation = "RLock"
+	}
+	meta = meta.traceFor(operation, dm.Name)
+	start := dm.ds.clock().Now()
 
-	runs, backOff := 1, 1
+	if !isReadLock && dm.reenter() {
+		meta.tracef("re-entered write lock held")
+		return true
+	}
 
-	for {
-		// create temp array on stack
-		locks := make([]string, dnodeCount)
+	if isReadLock {
+		// share a cached read lock when available
+		if dm.shareCachedRLock() {
+			meta.tracef("shared cached read lock")
+			return true
+		}
+	} else {
+		// a cached read lock of this process would block the write lock
+		dm.ds.InvalidateReadCache(dm.Name)
+	}
 
-		// try to acquire the lock
-		success := lock(clnts, &locks, dm.Name, isReadLock)
-		if success {
-			dm.m.Lock()
-			defer dm.m.Unlock()
-
-			// if success, copy array to object
-			if isReadLock {
-				// append new array of strings at the end
-				dm.readersLocks = append(dm.readersLocks, make([]string, dnodeCount))
-				// and copy stack array into last spot
-				copy(dm.readersLocks[len(dm.readersLocks)-1], locks[:])
+	if dm.ds.singleNode {
+		meta.tracef("acquiring in single-node mode")
+		return dm.lockLocal(ctx, isReadLock, deadline)
+	}
+
+	latency := &Latency{}
+	meta.latency = latency
+	defer func() {
+		dm.ds.observeLatency(meta, operation, dm.Name, *latency)
+	}()
+	meta.span = dm.ds.startSpan(ctx, operation, dm.Name)
+	var roundErr error // Error of the last round
+	if meta.span != nil {
+		defer func() {
+			if !latency.Acquired && ctx.Err() != nil {
+				roundErr = ctx.Err()
+			}
+			meta.span.End(latency.Acquired, latency.Rounds, roundErr)
+		}()
+	}
+
+	for attempt := 1; ; attempt++ {
+		if ctx.Err() != nil {
+			meta.tracef("gave up after %d rounds in %v: %v", attempt-1, dm.ds.clock().Now().Sub(start), ctx.Err())
+			return false
+		}
+
+		// wait for other goroutines of this process trying to acquire the same name
+		waitStart := dm.ds.clock().Now()
+		leaveGate, ok := dm.ds.enterGate(ctx, dm.Name, deadline)
+		latency.Wait += dm.ds.clock().Now().Sub(waitStart)
+		if !ok {
+			if ctx.Err() != nil {
+				meta.tracef("gave up after %d rounds in %v: %v waiting for the local gate", attempt-1, dm.ds.clock().Now().Sub(start), ctx.Err())
 			} else {
-				copy(dm.writeLocks, locks[:])
+				meta.tracef("gave up after %d rounds in %v: deadline passed waiting for the local gate", attempt-1, dm.ds.clock().Now().Sub(start))
 			}
+			return false
+		}
 
-			return
+		// split the time left until the deadline into a budget for this round
+		timeout, ok := roundTimeout(dm.ds.clock().Now(), deadline)
+		if !ok {
+			leaveGate()
+			meta.tracef("gave up after %d rounds in %v: deadline passed", attempt-1, dm.ds.clock().Now().Sub(start))
+			return false
 		}
 
-		// We timed out on the previous lock, incrementally wait for a longer back-off time,
-		// and try again afterwards
-		time.Sleep(time.Duration(backOff) * time.Millisecond)
+		// create temp array on stack
+		m := dm.ds.membership()
+		locks := make([]string, len(m.clnts))
+
+		// try to acquire the lock
+		meta.tracef("round %d: requesting lock from %d nodes with a timeout of %v", attempt, len(placementNodes(dm.ds.lockPlacements(m, dm.Name, isReadLock))), timeout)
+		latency.Rounds++
+		success, err := dm.ds.lock(ctx, m, &locks, dm.Name, isReadLock, timeout, meta)
+		leaveGate()
+		if success {
+			meta.tracef("acquired in round %d after %v", attempt, dm.ds.clock().Now().Sub(start))
+			dm.granted(isReadLock, locks)
+			latency.Acquired = true
+			return true
+		}
+		meta.tracef("round %d: %v", attempt, err)
+		roundErr = err
+		if ctx.Err() != nil {
+			meta.tracef("gave up after %d rounds in %v: %v", attempt, dm.ds.clock().Now().Sub(start), ctx.Err())
+			return false
+		}
 
-		backOff += int(rand.Float64() * math.Pow(2, float64(runs)))
-		if backOff > 1024 {
-			backOff = backOff % 64
+		dm.ds.logMessage(dsyncLogDenied, LevelInfo, "Failed to acquire lock", Fields{"name": dm.Name, "attempt": attempt, "error": err})
 
-			runs = 1 // reset runs
-		} else if runs < 10 {
-			runs++
+		// We timed out on the previous lock, wait for an exponentially growing, randomized
+		// back-off time (so that contending clients do not retry in lockstep) and try again
+		// afterwards (provided another round fits before the deadline)
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts && mayGiveUp {
+			meta.tracef("gave up after %d rounds in %v: maximum number of rounds reached", attempt, dm.ds.clock().Now().Sub(start))
+			return false
+		}
+		sleep, ok := backOffBudget(dm.ds.clock().Now(), deadline, policy.delay(attempt, dm.ds.random()))
+		if !ok {
+			meta.tracef("gave up after %d rounds in %v: no time left for another round", attempt, dm.ds.clock().Now().Sub(start))
+			return false
+		}
+		meta.tracef("backing off for %v", sleep)
+		backOffStart := dm.ds.clock().Now()
+		select {
+		case <-dm.ds.clock().After(sleep):
+			latency.Wait += dm.ds.clock().Now().Sub(backOffStart)
+		case <-ctx.Done():
+			latency.Wait += dm.ds.clock().Now().Sub(backOffStart)
+			meta.tracef("gave up after %d rounds in %v: %v", attempt, dm.ds.clock().Now().Sub(start), ctx.Err())
+			return false
 		}
 	}
 }
 
+// granted records the locks of a successful acquisition in dm.
+func (dm *DRWMutex) granted(isReadLock bool, locks []string) {
+	dm.m.Lock()
+	defer dm.m.Unlock()
+
+	// if success, copy array to object
+	if isReadLock {
+		// append new array of strings at the end
+		dm.readersLocks = append(dm.readersLocks, make([]string, len(locks)))
+		// and copy stack array into last spot
+		copy(dm.readersLocks[len(dm.readersLocks)-1], locks[:])
+		dm.ds.cacheRLock(dm.Name, locks)
+	} else {
+		// sized anew, as nodes may have been added since dm was created
+		dm.writeLocks = make([]string, len(locks))
+		copy(dm.writeLocks, locks[:])
+	}
+	dm.ds.metrics.held(isReadLock, 1)
+	dm.ds.registerHolder(dm, locks)
+}
+
 // lock tries to acquire the distributed lock, returning true or false
-//
-func lock(clnts []RPC, locks *[]string, lockName string, isReadLock bool) bool {
+// (along with a *MultiNodeError detailing the responses of all nodes).
+// The round is aborted (releasing the locks granted) once ctx is done.
+func (ds *Dsync) lock(ctx context.Context, m *members, locks *[]string, lockName string, isReadLock bool, timeout time.Duration, meta lockMetadata) (bool, error) {
+
+	if index, ok := ds.forwardingNode(); ok && meta.node == "" && !meta.dryRun {
+		return ds.forwardLock(ctx, index, m, locks, lockName, isReadLock, timeout, meta)
+	}
+
+	// The lock is held by the client the request is forwarded for, if any
+	node, rpcPath := m.clnts[m.ownNode].Node(), m.clnts[m.ownNode].RPCPath()
+	if meta.node != "" {
+		node, rpcPath = meta.node, meta.rpcPath
+	}
+
+	// Nodes to request the lock from, and how many of them have to grant it
+	placements := ds.lockPlacements(m, lockName, isReadLock)
+	nodes := placementNodes(placements)
+
+	// Lease requested for the lock, if any
+	ttl := meta.ttl
+	if ttl == 0 {
+		ttl = ds.requestedLeaseTTL()
+	}
 
 	// Create buffered channel of quorum size
-	ch := make(chan Granted, dnodeCount)
+	ch := make(chan Granted, len(nodes))
 
-	for index, c := range clnts {
+	serviceMethod := "Dsync.Lock"
+	if isReadLock {
+		serviceMethod = "Dsync.RLock"
+	}
+
+	start := ds.clock().Now()
+
+	for _, index := range nodes {
 
 		// broadcast lock request to all nodes
-		go func(index int, isReadLock bool, c RPC) {
+		atomic.AddInt64(&ds.lockRequests, 1)
+		go func(index int, isReadLock bool) {
+			defer atomic.AddInt64(&ds.lockRequests, -1)
+
 			// All client methods issuing RPCs are thread-safe and goroutine-safe,
 			// i.e. it is safe to call them from multiple concurrently running go routines.
-			var locked bool
+			var resp LockResp
+			var err error
 			bytesUid := [16]byte{}
 			cryptorand.Read(bytesUid[:])
 			uid := fmt.Sprintf("%X", bytesUid[:])
-			args := LockArgs{Name: lockName, Node: clnts[ownNode].Node(), RPCPath: clnts[ownNode].RPCPath(), UID: uid}
-			if isReadLock {
-				if err := c.Call("Dsync.RLock", &args, &locked); err != nil {
-					if dsyncLog {
-						log.Println("Unable to call Dsync.RLock", err)
-					}
+			args := LockArgs{Name: lockName, Node: node, RPCPath: rpcPath, UID: uid,
+				Priority: meta.priority, Tenant: meta.tenant, TTL: ttl, Wait: timeout,
+				Intent: ds.writeIntent(isReadLock), Mode: ModeOf(!isReadLock), DryRun: meta.dryRun,
+				Owner: meta.owner, Source: meta.source, Tags: meta.tags}
+			if meta.dryRun && !ds.negotiatedFeatures(index).Has(FeatureDryRun) {
+				// Older lock servers would grant the lock for real
+				err = errDryRunUnsupported
+			} else if isReadLock {
+				if err = ds.call(index, "Dsync.RLock", &args, &resp); err != nil {
+					ds.logMessage(dsyncLog, LevelDebug, "Unable to call Dsync.RLock", Fields{"name": lockName, "node": m.node(index), "error": err})
 				}
 			} else {
-				if err := c.Call("Dsync.Lock", &args, &locked); err != nil {
-					if dsyncLog {
-						log.Println("Unable to call Dsync.Lock", err)
-					}
+				if err = ds.call(index, "Dsync.Lock", &args, &resp); err != nil {
+					ds.logMessage(dsyncLog, LevelDebug, "Unable to call Dsync.Lock", Fields{"name": lockName, "node": m.node(index), "error": err})
 				}
 			}
 
-			g := Granted{index: index}
-			if locked {
+			if err == nil {
+				ds.recordPaused(index, resp.Paused)
+			}
+			g := Granted{index: index, err: err, frozen: resp.Frozen, latency: ds.clock().Now().Sub(start)}
+			if resp.Granted {
 				g.lockUid = args.UID
+				ds.checkView(index, lockName, isReadLock, resp.View)
+				if resp.TTL > 0 {
+					// Keep the lease alive until the lock is released
+					ds.startLease(index, lockName, args.UID, args.TTL, resp.TTL)
+				}
 			}
+			if err != nil {
+				meta.tracef("node %s: %s after %v: %v", m.node(index), g.outcome(), g.latency, err)
+			} else {
+				meta.tracef("node %s: %s after %v", m.node(index), g.outcome(), g.latency)
+			}
+			traceCall(meta.span, m.node(index), serviceMethod, start, g)
 			ch <- g
 
-		}(index, isReadLock, c)
+		}(index, isReadLock)
 	}
 
-	quorum := false
+	granted := false
+
+	// Responses received before the outcome of this round was decided, kept for error reporting
+	responses := make([]*Granted, len(m.clnts))
+
+	// Timing of the phases of the round, see Latency
+	var firstResponse, decided time.Time
+	var rollback, rollbackDecided time.Duration
+	rollBack := func() {
+		rollbackStart := ds.clock().Now()
+		if meta.dryRun {
+			// Nothing was granted, so there is nothing to release
+			for index := range *locks {
+				(*locks)[index] = ""
+			}
+		} else {
+			ds.releaseAll(locks, lockName, isReadLock)
+		}
+		rollback += ds.clock().Now().Sub(rollbackStart)
+	}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
+	atomic.AddInt64(&ds.lockCollectors, 1)
 	go func(isReadLock bool) {
+		defer atomic.AddInt64(&ds.lockCollectors, -1)
 
 		// Wait until we have either a) received all lock responses, b) received too many 'non-'locks for quorum to be or c) time out
-		i, locksFailed := 0, 0
+		i := 0
+		denied := make([]bool, len(m.clnts))
 		done := false
-		timeout := time.After(DRWMutexAcquireTimeout)
+		timeout := ds.clock().After(timeout)
 
-		for ; i < dnodeCount; i++ { // Loop until we acquired all locks
+		for ; i < len(nodes); i++ { // Loop until we acquired all locks
 
 			select {
 			case grant := <-ch:
+				if i == 0 {
+					firstResponse = ds.clock().Now()
+				}
+				responses[grant.index] = &grant
 				if grant.isLocked() {
 					// Mark that this node has acquired the lock
 					(*locks)[grant.index] = grant.lockUid
 				} else {
-					locksFailed++
-					if !isReadLock && locksFailed > dnodeCount-dquorum ||
-						isReadLock && locksFailed > dnodeCount-dquorumReads {
+					denied[grant.index] = true
+					if quorumLost(denied, placements) {
 						// We know that we are not going to get the lock anymore, so exit out
 						// and release any locks that did get acquired
 						done = true
-						releaseAll(clnts, locks, lockName, isReadLock)
+						rollBack()
+						// Account for the response just received (the loop is left before i is incremented)
+						i++
 					}
 				}
 
 			case <-timeout:
+				meta.tracef("round timed out after %v with %d of %d responses", ds.clock().Now().Sub(start), i, len(nodes))
 				done = true
 				// timeout happened, maybe one of the nodes is slow, count
 				// number of locks to check whether we have quorum or not
-				if !quorumMet(locks, isReadLock) {
-					releaseAll(clnts, locks, lockName, isReadLock)
+				if !quorumMet(locks, placements) {
+					rollBack()
 				}
+
+			case <-ctx.Done():
+				meta.tracef("round aborted after %v with %d of %d responses: %v", ds.clock().Now().Sub(start), i, len(nodes), ctx.Err())
+				done = true
+				// the caller gives up, so release whatever has been granted so far
+				rollBack()
 			}
 
 			if done {
@@ -235,7 +635,8 @@ func lock(clnts []RPC, locks *[]string, lockName string, isReadLock bool) bool {
 		}
 
 		// Count locks in order to determine whterh we have quorum or not
-		quorum = quorumMet(locks, isReadLock)
+		granted = quorumMet(locks, placements)
+		decided, rollbackDecided = ds.clock().Now(), rollback
 
 		// Signal that we have the quorum
 		wg.Done()
@@ -243,61 +644,179 @@ func lock(clnts []RPC, locks *[]string, lockName string, isReadLock bool) bool {
 		// Wait for the other responses and immediately release the locks
 		// (do not add them to the locks array because the DRWMutex could
 		//  already has been unlocked again by the original calling thread)
-		for ; i < dnodeCount; i++ {
+		for ; i < len(nodes); i++ {
 			grantToBeReleased := <-ch
-			if grantToBeReleased.isLocked() {
+			if grantToBeReleased.isLocked() && !meta.dryRun {
 				// release lock
-				sendRelease(clnts[grantToBeReleased.index], lockName, grantToBeReleased.lockUid, isReadLock)
+				ds.sendRelease(grantToBeReleased.index, lockName, grantToBeReleased.lockUid, isReadLock)
 			}
 		}
 	}(isReadLock)
 
 	wg.Wait()
 
-	// Verify that localhost server is actively participating in the lock (the lock maintenance relies on this fact)
-	if quorum && !isLocked((*locks)[ownNode]) {
+	// Verify that localhost server is actively participating in the lock (the lock maintenance relies on this fact),
+	// unless it is not among the nodes the lock is placed on (see SetReplication)
+	if granted && isReplica(nodes, m.ownNode) && !isLocked((*locks)[m.ownNode]) {
 		// If not, release lock (and try again later)
-		releaseAll(clnts, locks, lockName, isReadLock)
-		quorum = false
+		rollBack()
+		granted = false
 	}
 
-	return quorum
-}
+	if meta.span != nil {
+		grants := 0
+		for _, r := range responses {
+			if r != nil && r.isLocked() {
+				grants++
+			}
+		}
+		meta.span.Round(grants, len(nodes), granted)
+	}
 
-// quorumMet determines whether we have acquired the required quorum of underlying locks or not
-func quorumMet(locks *[]string, isReadLock bool) bool {
+	if meta.latency != nil {
+		// Split the round into the wait for the first response and for the outcome
+		round := decided.Sub(start) - rollbackDecided
+		fanOut := round
+		if !firstResponse.IsZero() && firstResponse.Sub(start) < round {
+			fanOut = firstResponse.Sub(start)
+		}
+		meta.latency.FanOut += fanOut
+		meta.latency.QuorumWait += round - fanOut
+		meta.latency.Rollback += rollback
+	}
 
-	count := 0
-	for _, uid := range *locks {
-		if isLocked(uid) {
-			count++
+	if !granted {
+		err := ds.newLockError(m, lockName, isReadLock, nodes, responses)
+		if !meta.dryRun {
+			ds.metrics.quorumMissed(isReadLock)
+			if ctx.Err() == nil {
+				ds.quorumFailed(err)
+			}
 		}
+		return false, err
 	}
 
+	return true, nil
+}
+
+// newLockError converts the responses of the nodes the lock was requested from into a *MultiNodeError
+func (ds *Dsync) newLockError(m *members, lockName string, isReadLock bool, nodes []int, responses []*Granted) *MultiNodeError {
+
+	err := &MultiNodeError{Operation: "Lock", Name: lockName, quorum: ds.lockQuorum(m, isReadLock)}
 	if isReadLock {
-		return count >= dquorumReads
-	} else {
-		return count >= dquorum
+		err.Operation = "RLock"
+	}
+	for _, index := range nodes {
+		grant := responses[index]
+		r := NodeResult{Node: m.node(index), Outcome: OutcomeNoResponse}
+		if grant != nil {
+			r.Latency, r.Outcome, r.Err = grant.latency, grant.outcome(), grant.err
+		}
+		err.Results = append(err.Results, r)
+	}
+	return err
+}
+
+// quorumMet determines whether we have acquired the required quorum of underlying locks or not
+// (for every placement of the lock, see lockPlacements)
+func quorumMet(locks *[]string, placements []placement) bool {
+
+	for _, p := range placements {
+		count := 0
+		for _, index := range p.nodes {
+			if isLocked((*locks)[index]) {
+				count++
+			}
+		}
+		if count < p.quorum {
+			return false
+		}
+	}
+	return true
+}
+
+// quorumLost determines whether the nodes that denied the lock rule out the quorum of
+// any placement of the lock
+func quorumLost(denied []bool, placements []placement) bool {
+
+	for _, p := range placements {
+		count := 0
+		for _, index := range p.nodes {
+			if denied[index] {
+				count++
+			}
+		}
+		if count > len(p.nodes)-p.quorum {
+			return true
+		}
 	}
+	return false
 }
 
 // releaseAll releases all locks that are marked as locked
-func releaseAll(clnts []RPC, locks *[]string, lockName string, isReadLock bool) {
-	for lock := 0; lock < dnodeCount; lock++ {
+func (ds *Dsync) releaseAll(locks *[]string, lockName string, isReadLock bool) {
+	for lock := range *locks {
 		if isLocked((*locks)[lock]) {
-			sendRelease(clnts[lock], lockName, (*locks)[lock], isReadLock)
+			ds.sendRelease(lock, lockName, (*locks)[lock], isReadLock)
 			(*locks)[lock] = ""
 		}
 	}
 }
 
-// Unlock unlocks the write lock.
+// Unlock unlocks the write lock. When dm is Reentrant, only the Unlock matching the
+// outermost Lock releases the lock.
 //
 // It is a run-time error if dm is not locked on entry to Unlock.
 func (dm *DRWMutex) Unlock() {
 
-	// create temp array on stack
-	locks := make([]string, dnodeCount)
+	if dm.leave() {
+		return
+	}
+	locks := dm.takeWriteLocks()
+	isReadLock := false
+	dm.ds.unlock(locks, dm.Name, isReadLock)
+}
+
+// UnlockAsync unlocks the write lock like Unlock, returning as soon as the local
+// bookkeeping is done. The channel returned receives the outcome of the release
+// once known: nil when a quorum of the nodes acknowledged it, or a *MultiNodeError
+// otherwise. Failed releases are retried in the background either way.
+//
+// It is a run-time error if dm is not locked on entry to UnlockAsync.
+func (dm *DRWMutex) UnlockAsync() <-chan error {
+
+	if dm.leave() {
+		ch := make(chan error, 1)
+		ch <- nil
+		close(ch)
+		return ch
+	}
+	locks := dm.takeWriteLocks()
+	isReadLock := false
+	return dm.ds.unlockNotify(locks, dm.Name, isReadLock)
+}
+
+// UnlockContext unlocks the write lock like Unlock, waiting until a quorum of the nodes
+// acknowledged the release, for callers that must know that the resource is free before
+// proceeding. It returns nil once acknowledged, a *MultiNodeError when a quorum of the
+// nodes can no longer acknowledge it, or the error of ctx when ctx is done first. The
+// lock is released locally either way, and failed releases are retried in the background.
+//
+// It is a run-time error if dm is not locked on entry to UnlockContext.
+func (dm *DRWMutex) UnlockContext(ctx context.Context) error {
+
+	select {
+	case err := <-dm.UnlockAsync():
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// takeWriteLocks clears the write lock held on dm, returning the locks to release.
+func (dm *DRWMutex) takeWriteLocks() []string {
+
+	var locks []string
 
 	{
 		dm.m.Lock()
@@ -316,13 +835,15 @@ func (dm *DRWMutex) Unlock() {
 		}
 
 		// Copy write locks to stack array
+		locks = make([]string, len(dm.writeLocks))
 		copy(locks, dm.writeLocks[:])
 		// Clear write locks array
-		dm.writeLocks = make([]string, dnodeCount)
+		dm.writeLocks = make([]string, len(locks))
 	}
 
-	isReadLock := false
-	unlock(locks, dm.Name, isReadLock)
+	dm.ds.metrics.held(false, -1)
+	dm.ds.unregisterHolder(dm.Name, locks)
+	return locks
 }
 
 // RUnlock releases a read lock held on dm.
@@ -330,8 +851,7 @@ func (dm *DRWMutex) Unlock() {
 // It is a run-time error if dm is not locked on entry to RUnlock.
 func (dm *DRWMutex) RUnlock() {
 
-	// create temp array on stack
-	locks := make([]string, dnodeCount)
+	var locks []string
 
 	{
 		dm.m.Lock()
@@ -340,27 +860,120 @@ func (dm *DRWMutex) RUnlock() {
 			panic("Trying to RUnlock() while no RLock() is active")
 		}
 		// Copy out first element to release it first (FIFO)
+		locks = make([]string, len(dm.readersLocks[0]))
 		copy(locks, dm.readersLocks[0][:])
 		// Drop first element from array
 		dm.readersLocks = dm.readersLocks[1:]
 	}
+	dm.ds.metrics.held(true, -1)
+
+	dm.ds.unregisterHolder(dm.Name, locks)
+	if dm.ds.cachedRUnlock(dm.Name, locks) {
+		// Cached read lock is kept (or has been released when no longer valid)
+		return
+	}
 
 	isReadLock := true
-	unlock(locks, dm.Name, isReadLock)
+	dm.ds.unlock(locks, dm.Name, isReadLock)
 }
 
-func unlock(locks []string, name string, isReadLock bool) {
+func (ds *Dsync) unlock(locks []string, name string, isReadLock bool) {
+
+	if ds.singleNode {
+		ds.localUnlock(name, isReadLock, false)
+		return
+	}
+
+	if index, ok := ds.forwardingNode(); ok {
+		ds.goBackground(func() { ds.forwardRelease(index, locks, name, isReadLock, false) })
+		return
+	}
 
 	// We don't need to synchronously wait until we have released all the locks (or the quorum)
 	// (a subsequent lock will retry automatically in case it would fail to get quorum)
 
-	for index, c := range clnts {
+	trace := ds.traceRelease(locks, name, isReadLock)
+	for index := range locks {
 
 		if isLocked(locks[index]) {
 			// broadcast lock release to all nodes that granted the lock
-			sendRelease(c, name, locks[index], isReadLock)
+			ds.sendReleaseNotify(index, name, locks[index], isReadLock, trace.done(index, nil))
+		}
+	}
+}
+
+// unlockNotify releases the locks like unlock, returning a channel that receives nil
+// once a quorum of the nodes acknowledged the release or an error once that is no
+// longer possible.
+func (ds *Dsync) unlockNotify(locks []string, name string, isReadLock bool) <-chan error {
+
+	ch := make(chan error, 1)
+	if ds.singleNode {
+		ds.localUnlock(name, isReadLock, false)
+		ch <- nil
+		close(ch)
+		return ch
+	}
+	if index, ok := ds.forwardingNode(); ok {
+		ds.goBackground(func() {
+			ch <- ds.forwardRelease(index, locks, name, isReadLock, false)
+			close(ch)
+		})
+		return ch
+	}
+
+	m := ds.membership()
+	quorum := ds.lockQuorum(m, isReadLock)
+
+	// Collect the outcome of the first attempt of every release
+	released := make(chan Granted, len(locks))
+	start := ds.clock().Now()
+	pending := 0
+	trace := ds.traceRelease(locks, name, isReadLock)
+	for index := range locks {
+		if isLocked(locks[index]) {
+			pending++
+			index := index
+			ds.sendReleaseNotify(index, name, locks[index], isReadLock, trace.done(index, func(err error) {
+				released <- Granted{index: index, err: err, latency: ds.clock().Now().Sub(start)}
+			}))
 		}
 	}
+
+	ds.goBackground(func() {
+		defer close(ch)
+		err := &MultiNodeError{Operation: "Unlock", Name: name}
+		if isReadLock {
+			err.Operation = "RUnlock"
+		}
+		results := make([]NodeResult, len(locks))
+		for index := range results {
+			results[index] = NodeResult{Node: m.node(index), Outcome: OutcomeNoResponse}
+		}
+		acked := 0
+		for pending > 0 && acked+pending >= quorum {
+			r := <-released
+			pending--
+			results[r.index].Latency = r.latency
+			if r.err == nil {
+				acked++
+				results[r.index].Outcome = OutcomeGranted
+			} else {
+				results[r.index].Outcome, results[r.index].Err = OutcomeError, r.err
+			}
+			if acked >= quorum {
+				ch <- nil
+				return
+			}
+		}
+		for index, r := range results {
+			if m.client(index) != nil { // Leave out the nodes removed
+				err.Results = append(err.Results, r)
+			}
+		}
+		ch <- err
+	})
+	return ch
 }
 
 // ForceUnlock will forcefully clear a write or read lock.
@@ -370,83 +983,82 @@ func (dm *DRWMutex) ForceUnlock() {
 		dm.m.Lock()
 		defer dm.m.Unlock()
 
-		// Clear write locks array
-		dm.writeLocks = make([]string, dnodeCount)
+		for _, uid := range dm.writeLocks {
+			if isLocked(uid) {
+				dm.ds.metrics.held(false, -1)
+				break
+			}
+		}
+		dm.ds.metrics.held(true, -len(dm.readersLocks))
+
+		// Forget the holder of the locks (and stop refreshing their leases)
+		dm.ds.unregisterHolder(dm.Name, dm.writeLocks)
+		dm.ds.stopLeases(dm.Name, dm.writeLocks)
+		for _, locks := range dm.readersLocks {
+			dm.ds.unregisterHolder(dm.Name, locks)
+			dm.ds.stopLeases(dm.Name, locks)
+		}
+
+		// Clear write locks array (including the nested write locks)
+		dm.writeLocks = make([]string, len(dm.writeLocks))
+		dm.holds = 0
 		// Clear read locks array
 		dm.readersLocks = nil
 	}
+	dm.ds.ForceUnlock(dm.Name)
+}
+
+// ForceUnlock forcefully clears the write or read locks on name at all nodes, like
+// DRWMutex.ForceUnlock, for callers that do not hold a DRWMutex of name (eg. cleaning
+// up after a crashed process). DRWMutexes of name are not notified. See AdminForceUnlock
+// for an audited variant.
+func (ds *Dsync) ForceUnlock(name string) {
+	ds.dropReadCache(name)
+
+	if ds.singleNode {
+		ds.localUnlock(name, false, true)
+		return
+	}
+	if index, ok := ds.forwardingNode(); ok {
+		ds.forwardRelease(index, nil, name, false, true)
+		return
+	}
 
-	for _, c := range clnts {
+	for _, index := range ds.membership().nodes() {
 		// broadcast lock release to all nodes that granted the lock
-		sendRelease(c, dm.Name, "", false)
+		ds.sendRelease(index, name, "", false)
 	}
 }
 
 // sendRelease sends a release message to a node that previously granted a lock
-func sendRelease(c RPC, name, uid string, isReadLock bool) {
-
-	backOffArray := []time.Duration{
-		30 * time.Second, // 30secs.
-		1 * time.Minute,  // 1min.
-		3 * time.Minute,  // 3min.
-		10 * time.Minute, // 10min.
-		30 * time.Minute, // 30min.
-		1 * time.Hour,    // 1hr.
-	}
+func (ds *Dsync) sendRelease(index int, name, uid string, isReadLock bool) {
+	ds.sendReleaseNotify(index, name, uid, isReadLock, nil)
+}
 
-	go func(c RPC, name string) {
+// sendReleaseNotify sends a release message like sendRelease, calling done (when set)
+// with the outcome of the first attempt to deliver it. A failed release is handed to
+// the release worker, which retries it in the background.
+func (ds *Dsync) sendReleaseNotify(index int, name, uid string, isReadLock bool, done func(err error)) {
 
-		for _, backOff := range backOffArray {
+	ds.stopLease(name, uid)
 
-			// All client methods issuing RPCs are thread-safe and goroutine-safe,
-			// i.e. it is safe to call them from multiple concurrently running goroutines.
-			var unlocked bool
-			args := LockArgs{Name: name, UID: uid} // Just send name & uid (and leave out node and rpcPath; unimportant for unlocks)
-			if len(uid) == 0 {
-				if err := c.Call("Dsync.ForceUnlock", &args, &unlocked); err == nil {
-					// ForceUnlock delivered, exit out
-					return
-				} else if err != nil {
-					if dsyncLog {
-						log.Println("Unable to call Dsync.ForceUnlock", err)
-					}
-					if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
-						// ForceUnlock possibly failed with server timestamp mismatch, server may have restarted.
-						return
-					}
-				}
-			} else if isReadLock {
-				if err := c.Call("Dsync.RUnlock", &args, &unlocked); err == nil {
-					// RUnlock delivered, exit out
-					return
-				} else if err != nil {
-					if dsyncLog {
-						log.Println("Unable to call Dsync.RUnlock", err)
-					}
-					if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
-						// RUnlock possibly failed with server timestamp mismatch, server may have restarted.
-						return
-					}
-				}
-			} else {
-				if err := c.Call("Dsync.Unlock", &args, &unlocked); err == nil {
-					// Unlock delivered, exit out
-					return
-				} else if err != nil {
-					if dsyncLog {
-						log.Println("Unable to call Dsync.Unlock", err)
-					}
-					if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
-						// Unlock possibly failed with server timestamp mismatch, server may have restarted.
-						return
-					}
-				}
-			}
+	r := &pendingRelease{ds: ds, index: index, name: name, uid: uid, isReadLock: isReadLock, since: ds.clock().Now()}
 
-			// Wait..
-			time.Sleep(backOff)
+	atomic.AddInt64(&ds.releases.goroutines, 1)
+	go func() {
+		err := r.deliver()
+		if err == nil {
+			ds.metrics.released(isReadLock, ds.clock().Now().Sub(r.since))
+		}
+		if done != nil {
+			done(err)
+		}
+		if err == nil || !r.retryable(err) {
+			atomic.AddInt64(&ds.releases.goroutines, -1)
+			return
 		}
-	}(c, name)
+		ds.retryRelease(r)
+	}()
 }
 
 // DRLocker returns a sync.Locker interface that implements
@@ -19,18 +19,21 @@
 package dsync_test
 
 import (
+	"context"
 	"fmt"
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/dsynctest"
+	"github.com/minio/dsync/lockserver"
 	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
-	. "github.com/minio/dsync"
 )
 
 func TestSimpleWriteLock(t *testing.T) {
 
-	drwm := NewDRWMutex("resource")
+	drwm := NewDRWMutex("resource", ds)
 
 	drwm.RLock()
 	// fmt.Println("1st read lock acquired, waiting...")
@@ -59,6 +62,170 @@ func TestSimpleWriteLock(t *testing.T) {
 	drwm.Unlock()
 }
 
+func TestLockContextDone(t *testing.T) {
+
+	dm := NewDRWMutex("test-context-done", ds)
+	dm.Lock()
+	defer dm.Unlock()
+
+	// Deadline passes while waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if NewDRWMutex("test-context-done", ds).RLockContext(ctx) {
+		t.Fatal("expected read lock not to be acquired before deadline")
+	}
+
+	// Already canceled
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if NewDRWMutex("test-context-done", ds).LockContext(ctx) {
+		t.Fatal("expected lock not to be acquired with canceled context")
+	}
+}
+
+func TestLockContextCancel(t *testing.T) {
+
+	// Rounds and back-offs do not end by themselves as long as the fake clock is not advanced
+	fc := NewFakeClock(time.Now())
+	ds.SetClock(fc)
+	defer ds.SetClock(nil)
+
+	// The last node does not respond until unblocked
+	unblock := make(chan struct{})
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && serviceMethod == "Dsync.Lock" && a.Name == "test-context-cancel" && c.Node() == nodes[N-1] {
+			<-unblock
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	lockContext := func(ctx context.Context) <-chan bool {
+		result := make(chan bool, 1)
+		go func() { result <- NewDRWMutex("test-context-cancel", ds).LockContext(ctx) }()
+		return result
+	}
+	expectAborted := func(result <-chan bool) {
+		select {
+		case locked := <-result:
+			if locked {
+				t.Fatal("expected lock not to be acquired with canceled context")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected lock attempt to be aborted once the context was canceled")
+		}
+	}
+
+	// Canceling aborts the round in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	result := lockContext(ctx)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	expectAborted(result)
+	close(unblock)
+
+	// The locks granted meanwhile are released, including the one granted after the round was aborted
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		held := false
+		for _, s := range ds.Snapshots() {
+			for _, e := range s.Entries {
+				held = held || e.Name == "test-context-cancel"
+			}
+		}
+		if !held {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("expected the locks of the aborted round to be released")
+		}
+	}
+
+	// Canceling interrupts the back-off
+	dm := NewDRWMutex("test-context-cancel", ds)
+	dm.Lock()
+	defer dm.Unlock()
+	waiters := fc.Waiters()
+	ctx, cancel = context.WithCancel(context.Background())
+	result = lockContext(ctx)
+	// Denied round (registering a timeout timer) followed by the back-off
+	waitForWaiters(t, fc, waiters+2)
+	cancel()
+	expectAborted(result)
+}
+
+func TestLockUntilDone(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if !NewDRWMutex("test-until-done", ds).LockUntilDone(ctx) {
+		t.Fatal("expected lock to be acquired")
+	}
+	rctx, rcancel := context.WithCancel(context.Background())
+	if !NewDRWMutex("test-until-done-read", ds).RLockUntilDone(rctx) {
+		t.Fatal("expected read lock to be acquired")
+	}
+	other := NewDRWMutex("test-until-done", ds)
+	if other.TryLock() || NewDRWMutex("test-until-done-read", ds).TryLock() {
+		t.Fatal("expected locks to be held until the contexts are done")
+	}
+
+	// Released once the context is done (asynchronously)
+	cancel()
+	rcancel()
+	if !other.LockWithTimeout(time.Second) {
+		t.Fatal("expected lock to be released once the context is done")
+	}
+	other.Unlock()
+	read := NewDRWMutex("test-until-done-read", ds)
+	if !read.LockWithTimeout(time.Second) {
+		t.Fatal("expected read lock to be released once the context is done")
+	}
+	read.Unlock()
+
+	// Not acquired with a context that is done already
+	if NewDRWMutex("test-until-done", ds).LockUntilDone(ctx) {
+		t.Fatal("expected lock not to be acquired with canceled context")
+	}
+}
+
+func TestLockUntilDoneClose(t *testing.T) {
+
+	var unlocks int64
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	cds, err := NewWithOptions(clnts, 0, Options{
+		Interceptors: []Interceptor{func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+			if serviceMethod == "Dsync.Unlock" || serviceMethod == "Dsync.RUnlock" {
+				atomic.AddInt64(&unlocks, 1)
+			}
+			return invoke(c, serviceMethod, args, reply)
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if !NewDRWMutex("test-until-done-close", cds).LockUntilDone(ctx) ||
+		!NewDRWMutex("test-until-done-close-read", cds).RLockUntilDone(ctx) {
+		t.Fatal("expected locks to be acquired")
+	}
+	if d := cds.Debug(); d.Background != 2 {
+		t.Fatalf("expected 2 goroutines waiting to release the locks, got %v", d)
+	}
+
+	// Closing gives up on releasing the locks, which are left to expire
+	cds.Close()
+	dsynctest.AssertNoLeaks(t, cds, 2*time.Second)
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt64(&unlocks); n != 0 {
+		t.Fatalf("expected no releases once closed, got %d", n)
+	}
+}
+
 // Test cases below are copied 1 to 1 from sync/rwmutex_test.go (adapted to use DRWMutex)
 
 // Borrowed from rwmutex_test.go
@@ -73,7 +240,7 @@ func parallelReader(m *DRWMutex, clocked, cunlock, cdone chan bool) {
 // Borrowed from rwmutex_test.go
 func doTestParallelReaders(numReaders, gomaxprocs int) {
 	runtime.GOMAXPROCS(gomaxprocs)
-	m := NewDRWMutex("test-parallel")
+	m := NewDRWMutex("test-parallel", ds)
 
 	clocked := make(chan bool)
 	cunlock := make(chan bool)
@@ -139,7 +306,7 @@ func HammerRWMutex(gomaxprocs, numReaders, num_iterations int) {
 	runtime.GOMAXPROCS(gomaxprocs)
 	// Number of active readers + 10000 * number of active writers.
 	var activity int32
-	rwm := NewDRWMutex("test")
+	rwm := NewDRWMutex("test", ds)
 	cdone := make(chan bool)
 	go writer(rwm, num_iterations, &activity, cdone)
 	var i int
@@ -177,7 +344,7 @@ func TestRWMutex(t *testing.T) {
 
 // Borrowed from rwmutex_test.go
 func TestDRLocker(t *testing.T) {
-	wl := NewDRWMutex("test")
+	wl := NewDRWMutex("test", ds)
 	var rl sync.Locker
 	wlocked := make(chan bool, 1)
 	rlocked := make(chan bool, 1)
@@ -218,7 +385,7 @@ func TestUnlockPanic(t *testing.T) {
 			t.Fatalf("unlock of unlocked RWMutex did not panic")
 		}
 	}()
-	mu := NewDRWMutex("test")
+	mu := NewDRWMutex("test", ds)
 	mu.Unlock()
 }
 
@@ -229,7 +396,7 @@ func TestUnlockPanic2(t *testing.T) {
 			t.Fatalf("unlock of unlocked RWMutex did not panic")
 		}
 	}()
-	mu := NewDRWMutex("test-unlock-panic-2")
+	mu := NewDRWMutex("test-unlock-panic-2", ds)
 	mu.RLock()
 	mu.Unlock()
 }
@@ -241,7 +408,7 @@ func TestRUnlockPanic(t *testing.T) {
 			t.Fatalf("read unlock of unlocked RWMutex did not panic")
 		}
 	}()
-	mu  := NewDRWMutex("test")
+	mu := NewDRWMutex("test", ds)
 	mu.RUnlock()
 }
 
@@ -252,14 +419,14 @@ func TestRUnlockPanic2(t *testing.T) {
 			t.Fatalf("read unlock of unlocked RWMutex did not panic")
 		}
 	}()
-	mu := NewDRWMutex("test-runlock-panic-2")
+	mu := NewDRWMutex("test-runlock-panic-2", ds)
 	mu.Lock()
 	mu.RUnlock()
 }
 
 // Borrowed from rwmutex_test.go
 func benchmarkRWMutex(b *testing.B, localWork, writeRatio int) {
-	rwm := NewDRWMutex("test")
+	rwm := NewDRWMutex("test", ds)
 	b.RunParallel(func(pb *testing.PB) {
 		foo := 0
 		for pb.Next() {
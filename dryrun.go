@@ -0,0 +1,56 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"errors"
+)
+
+// errDryRunUnsupported - reported for lock servers that do not support FeatureDryRun.
+var errDryRunUnsupported = errors.New("Lock server does not support dry runs")
+
+// DryRunLock returns whether a write lock on dm would be granted, eg. for preflight checks
+// in orchestration tools. It runs a full round of lock requests like TryLock, but the lock
+// servers only check whether they would grant the lock without recording the grant, so
+// nothing is held (or needs to be released) afterwards. When the lock would not be granted
+// the error tells which nodes would deny it.
+//
+// The outcome only holds for the moment of the check, as other clients may take the lock
+// right after. Lock servers that do not support dry runs (see FeatureDryRun) count as
+// denying the lock.
+func (dm *DRWMutex) DryRunLock() (bool, error) {
+
+	isReadLock := false
+	return dm.dryRun(isReadLock)
+}
+
+// DryRunRLock returns whether a read lock on dm would be granted, like DryRunLock.
+func (dm *DRWMutex) DryRunRLock() (bool, error) {
+
+	isReadLock := true
+	return dm.dryRun(isReadLock)
+}
+
+func (dm *DRWMutex) dryRun(isReadLock bool) (bool, error) {
+	if dm.ds.singleNode {
+		return dm.ds.localWouldLock(dm.Name, isReadLock), nil
+	}
+	m := dm.ds.membership()
+	locks := make([]string, len(m.clnts))
+	return dm.ds.lock(context.Background(), m, &locks, dm.Name, isReadLock, DRWMutexAcquireTimeout, lockMetadata{dryRun: true})
+}
@@ -0,0 +1,56 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"testing"
+	"time"
+)
+
+func TestDryRun(t *testing.T) {
+
+	dm := NewDRWMutex("test-dry-run", ds)
+	if ok, err := dm.DryRunLock(); !ok || err != nil {
+		t.Fatalf("expected dry run of free lock to succeed, got %v (%v)", ok, err)
+	}
+	// Nothing is held after a dry run
+	if !dm.TryLock() {
+		t.Fatal("expected lock to be available after dry run")
+	}
+
+	other := NewDRWMutex("test-dry-run", ds)
+	if ok, err := other.DryRunLock(); ok || err == nil {
+		t.Fatalf("expected dry run of write lock to fail while locked, got %v (%v)", ok, err)
+	}
+	if ok, _ := other.DryRunRLock(); ok {
+		t.Fatal("expected dry run of read lock to fail while locked")
+	}
+	dm.Unlock()
+
+	// Releases are asynchronous
+	if !other.RLockWithTimeout(time.Second) {
+		t.Fatal("expected read lock to be granted")
+	}
+	if ok, err := dm.DryRunRLock(); !ok || err != nil {
+		t.Fatalf("expected dry run of read lock to succeed while read locked, got %v (%v)", ok, err)
+	}
+	if ok, _ := dm.DryRunLock(); ok {
+		t.Fatal("expected dry run of write lock to fail while read locked")
+	}
+	other.RUnlock()
+}
@@ -20,6 +20,8 @@ import (
 	"errors"
 	"fmt"
 	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"strings"
 	"sync"
 	"time"
 )
@@ -34,6 +36,10 @@ type lockServer struct {
 	// Map of locks, with negative value indicating (exclusive) write lock
 	// and positive values indicating number of read locks
 	lockMap   map[string]int64
+	frozen    map[string]bool // Names for which all lock requests are denied
+	sequences map[string]uint64 // High-water mark per sequence
+	intents   map[string]time.Time // Expiry of the write intents by name
+	queues    *lockserver.LockServer // Lock server of package lockserver handling the queue and barrier RPCs
 	timestamp time.Time // Timestamp set at the time of initialization. Resets naturally on minio server restart.
 }
 
@@ -44,12 +50,27 @@ func (l *lockServer) verifyArgs(args *LockArgs) error {
 	return nil
 }
 
-func (l *lockServer) Lock(args *LockArgs, reply *bool) error {
+func (l *lockServer) Lock(args *LockArgs, resp *LockResp) error {
+	reply := &resp.Granted // Set to true when lock is granted
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 	if err := l.verifyArgs(args); err != nil {
 		return err
 	}
+	if resp.Frozen = l.frozen[args.Name]; resp.Frozen {
+		return nil
+	}
+	if args.DryRun {
+		_, locked := l.lockMap[args.Name]
+		*reply = !locked
+		return nil
+	}
+	if args.Intent > 0 {
+		if l.intents == nil {
+			l.intents = make(map[string]time.Time)
+		}
+		l.intents[args.Name] = time.Now().Add(args.Intent)
+	}
 	if _, *reply = l.lockMap[args.Name]; !*reply {
 		l.lockMap[args.Name] = WriteLock // No locks held on the given name, so claim write lock
 	}
@@ -57,7 +78,8 @@ func (l *lockServer) Lock(args *LockArgs, reply *bool) error {
 	return nil
 }
 
-func (l *lockServer) Unlock(args *LockArgs, reply *bool) error {
+func (l *lockServer) Unlock(args *LockArgs, resp *LockResp) error {
+	reply := &resp.Granted // Set to true when lock is released
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 	if err := l.verifyArgs(args); err != nil {
@@ -71,17 +93,50 @@ func (l *lockServer) Unlock(args *LockArgs, reply *bool) error {
 		return fmt.Errorf("Unlock attempted on a read locked entity: %s (%d read locks active)", args.Name, locksHeld)
 	}
 	delete(l.lockMap, args.Name) // Remove the write lock
+	delete(l.intents, args.Name)
+	return nil
+}
+
+func (l *lockServer) LockBatch(args *BatchArgs, resp *LockResp) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.verifyArgs(&args.LockArgs); err != nil {
+		return err
+	}
+	for _, name := range args.Names {
+		if resp.Frozen = l.frozen[name]; resp.Frozen {
+			return nil
+		}
+		if _, locked := l.lockMap[name]; locked {
+			return nil
+		}
+	}
+	for _, name := range args.Names {
+		l.lockMap[name] = WriteLock // Claim the write locks on all names
+	}
+	resp.Granted = true
 	return nil
 }
 
 const ReadLock = 1
 
-func (l *lockServer) RLock(args *LockArgs, reply *bool) error {
+func (l *lockServer) RLock(args *LockArgs, resp *LockResp) error {
+	reply := &resp.Granted // Set to true when lock is granted
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 	if err := l.verifyArgs(args); err != nil {
 		return err
 	}
+	if resp.Frozen = l.frozen[args.Name]; resp.Frozen {
+		return nil
+	}
+	if time.Now().Before(l.intents[args.Name]) { // A writer is waiting for the read locks to drain
+		return nil
+	}
+	if args.DryRun {
+		*reply = l.lockMap[args.Name] != WriteLock
+		return nil
+	}
 	var locksHeld int64
 	if locksHeld, *reply = l.lockMap[args.Name]; !*reply {
 		l.lockMap[args.Name] = ReadLock // No locks held on the given name, so claim (first) read lock
@@ -94,7 +149,8 @@ func (l *lockServer) RLock(args *LockArgs, reply *bool) error {
 	return nil
 }
 
-func (l *lockServer) RUnlock(args *LockArgs, reply *bool) error {
+func (l *lockServer) RUnlock(args *LockArgs, resp *LockResp) error {
+	reply := &resp.Granted // Set to true when lock is released
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 	if err := l.verifyArgs(args); err != nil {
@@ -115,7 +171,51 @@ func (l *lockServer) RUnlock(args *LockArgs, reply *bool) error {
 	return nil
 }
 
-func (l *lockServer) ForceUnlock(args *LockArgs, reply *bool) error {
+// Upgrade converts the read lock when it is the only lock held, as uids are not tracked
+func (l *lockServer) Upgrade(args *LockArgs, resp *LockResp) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.verifyArgs(args); err != nil {
+		return err
+	}
+	if resp.Frozen = l.frozen[args.Name]; resp.Frozen {
+		return nil
+	}
+	locksHeld, ok := l.lockMap[args.Name]
+	if !ok || locksHeld == WriteLock {
+		return fmt.Errorf("Upgrade attempted on an entity that is not read locked: %s", args.Name)
+	}
+	if resp.Granted = locksHeld == ReadLock; resp.Granted {
+		l.lockMap[args.Name] = WriteLock
+	}
+	return nil
+}
+
+// Downgrade converts the write lock into a read lock
+func (l *lockServer) Downgrade(args *LockArgs, resp *LockResp) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.verifyArgs(args); err != nil {
+		return err
+	}
+	if resp.Granted = l.lockMap[args.Name] == WriteLock; !resp.Granted {
+		return fmt.Errorf("Downgrade attempted on an entity that is not write locked: %s", args.Name)
+	}
+	l.lockMap[args.Name] = ReadLock
+	delete(l.intents, args.Name)
+	return nil
+}
+
+// Validate replies whether name is locked, as uids are not tracked
+func (l *lockServer) Validate(args *LockArgs, resp *LockResp) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, resp.Granted = l.lockMap[args.Name]
+	return nil
+}
+
+func (l *lockServer) ForceUnlock(args *LockArgs, resp *LockResp) error {
+	reply := &resp.Granted // Set to true when lock is released
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 	if err := l.verifyArgs(args); err != nil {
@@ -130,3 +230,142 @@ func (l *lockServer) ForceUnlock(args *LockArgs, reply *bool) error {
 	*reply = true
 	return nil
 }
+
+func (l *lockServer) Snapshot(args *SnapshotArgs, reply *SnapshotReply) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for name, locksHeld := range l.lockMap {
+		if locksHeld == WriteLock {
+			reply.Entries = append(reply.Entries, LockEntry{Name: name, Writer: true})
+			continue
+		}
+		for ; locksHeld > 0; locksHeld -= ReadLock {
+			reply.Entries = append(reply.Entries, LockEntry{Name: name})
+		}
+	}
+	reply.Checksum = ChecksumEntries(reply.Entries)
+	return nil
+}
+
+func (l *lockServer) Adopt(args *AdoptArgs, reply *SnapshotReply) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, e := range args.Entries {
+		// Read locks are counted rather than recorded by uid, so only adopt names without locks
+		if _, ok := l.lockMap[e.Name]; !ok && !e.Writer {
+			l.lockMap[e.Name] = ReadLock
+			reply.Entries = append(reply.Entries, e)
+		}
+	}
+	return nil
+}
+
+func (l *lockServer) Forward(args *ForwardArgs, reply *ForwardReply) error {
+	return ds.Forward(args, reply)
+}
+
+func (l *lockServer) ExpirePrefix(args *ExpirePrefixArgs, reply *SnapshotReply) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for name, locksHeld := range l.lockMap {
+		if !strings.HasPrefix(name, args.Prefix) {
+			continue
+		}
+		if locksHeld == WriteLock {
+			reply.Entries = append(reply.Entries, LockEntry{Name: name, Writer: true})
+		} else {
+			for ; locksHeld > 0; locksHeld -= ReadLock {
+				reply.Entries = append(reply.Entries, LockEntry{Name: name})
+			}
+		}
+		if !args.DryRun {
+			delete(l.lockMap, name)
+		}
+	}
+	return nil
+}
+
+func (l *lockServer) AdminForceUnlock(args *AdminForceUnlockArgs, reply *SnapshotReply) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if locksHeld, ok := l.lockMap[args.Name]; ok {
+		if locksHeld == WriteLock {
+			reply.Entries = append(reply.Entries, LockEntry{Name: args.Name, Writer: true})
+		} else {
+			for ; locksHeld > 0; locksHeld -= ReadLock {
+				reply.Entries = append(reply.Entries, LockEntry{Name: args.Name})
+			}
+		}
+		delete(l.lockMap, args.Name)
+	}
+	return nil
+}
+
+func (l *lockServer) Version(args *VersionArgs, reply *VersionInfo) error {
+	*reply = LocalVersion()
+	return nil
+}
+
+func (l *lockServer) Freeze(args *FreezeArgs, reply *FreezeReply) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.frozen == nil {
+		l.frozen = make(map[string]bool)
+	}
+	if args.Name != "" {
+		if args.Unfreeze {
+			delete(l.frozen, args.Name)
+		} else {
+			l.frozen[args.Name] = true
+		}
+	}
+	for name := range l.frozen {
+		reply.Names = append(reply.Names, name)
+	}
+	return nil
+}
+
+func (l *lockServer) Sequence(args *SequenceArgs, reply *SequenceReply) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.sequences == nil {
+		l.sequences = make(map[string]uint64)
+	}
+	if args.Value > l.sequences[args.Name] {
+		l.sequences[args.Name] = args.Value
+		reply.Accepted = true
+	}
+	reply.HighWater = l.sequences[args.Name]
+	return nil
+}
+
+// queueServer returns the lock server handling the queue and barrier RPCs, the logic of
+// package lockserver is not duplicated here.
+func (l *lockServer) queueServer() *lockserver.LockServer {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.queues == nil {
+		l.queues = lockserver.New(lockserver.Options{})
+	}
+	return l.queues
+}
+
+func (l *lockServer) QueuePush(args *QueueArgs, reply *QueueReply) error {
+	return l.queueServer().QueuePush(args, reply)
+}
+
+func (l *lockServer) QueueList(args *QueueArgs, reply *QueueReply) error {
+	return l.queueServer().QueueList(args, reply)
+}
+
+func (l *lockServer) QueueClaim(args *QueueArgs, reply *QueueReply) error {
+	return l.queueServer().QueueClaim(args, reply)
+}
+
+func (l *lockServer) QueueAck(args *QueueArgs, reply *QueueReply) error {
+	return l.queueServer().QueueAck(args, reply)
+}
+
+func (l *lockServer) Barrier(args *BarrierArgs, reply *BarrierReply) error {
+	return l.queueServer().Barrier(args, reply)
+}
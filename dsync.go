@@ -16,54 +16,188 @@
 
 package dsync
 
-import "errors"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 const RpcPath = "/dsync"
 const DebugPath = "/debug"
 
 const DefaultPath = "/rpc/dsync"
 
-// Number of nodes participating in the distributed locking.
-var dnodeCount int
+// ConfigError - returned when dsync is initialized with an invalid configuration.
+type ConfigError struct {
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return e.Reason
+}
+
+// Dsync - a cluster of lock servers (nodes) along with the configuration of the clients
+// in this process using them. Every lock is requested from the nodes of the Dsync it was
+// created with (see NewDRWMutex), so that a process can take part in multiple independent
+// clusters, each with its own Dsync.
+type Dsync struct {
+	leaseTTL          int64 // Lease requested for every lock, zero leaves it to the lock servers
+	localGateLimit    int64 // Maximum number of concurrent lock attempts per name, zero for no limit
+	readCacheValidity int64 // Validity of cached read locks (as time.Duration), zero when disabled
+	lockRequests      int64 // Goroutines currently broadcasting a lock request to a node, see Debug
+	lockCollectors    int64 // Goroutines currently collecting (late) lock responses, see Debug
+	leaseGoroutines   int64 // Goroutines currently refreshing a lease, see Debug
+	background        int64 // Other goroutines currently working on behalf of ds, see Debug
+	violations        int64 // Protocol violations detected since ds was initialized, see Debug
+
+	replicationFactor int32      // Number of nodes every lock is placed on, zero for all nodes
+	localReads        int32      // Set to 1 when read locks are granted by the own node only
+	protocolMutex     sync.Mutex // Serializes SetReplication and SetLocalReads, which exclude each other
+
+	membersValue    atomic.Value // Current members
+	forwarding      atomic.Value // Coordinators lock requests are forwarded to, see SetCoordinators
+	membershipMutex sync.Mutex   // Serializes membership changes
+
+	// Set in single-node mode, when initialized with a single node. As there is no quorum
+	// to be had, locks are then granted in-process like a sync.RWMutex, without any RPCs
+	// to the lock server.
+	singleNode bool
+	localMutex sync.Mutex
+	localLocks map[string]*localLock // Locks held in single-node mode by name
 
-// List of rpc client objects, one per lock server.
-var clnts []RPC
+	gatesMutex sync.Mutex
+	gates      map[string]*gate // Gates by name, removed once no goroutine is using them anymore
 
-// Index into rpc client array for server running on localhost
-var ownNode int
+	readCacheMutex sync.Mutex
+	readCache      map[string]*cachedRead // Cached read locks by name
 
-// Simple majority based quorum, set to dNodeCount/2+1
-var dquorum int
-// Simple quorum for read operations, set to dNodeCount/2
-var dquorumReads int
+	sequencesMutex sync.Mutex
+	lastSequences  map[string]uint64 // Last value taken (or high-water mark seen) per sequence
+
+	validationMutex sync.Mutex
+	validationStop  chan struct{} // Stops the validation of the locks held, nil when disabled
+	lostHandler     atomic.Value  // Handler of lost locks (wrapped in a lostHandler), if any
+
+	latencyHandler       atomic.Value  // Handler of the latency breakdowns (wrapped in a latencyHandler), if any
+	quorumFailureHandler atomic.Value  // Handler of the rounds missing the quorum (wrapped in a quorumFailureHandler), if any
+	tracer               atomic.Value  // Tracer of the lock operations (wrapped in a tracerValue), if any
+	retryPolicy          atomic.Value  // Timing of the rounds of acquisitions (wrapped in a retryPolicyHolder), if any
+	metrics              *lockMetrics  // See Metrics
+	rand                 Rand          // Source of randomness for the retry jitter, see Options.Rand
+	releases             *releaseQueue // Releases retried by the release worker
+	clockValue           atomic.Value  // Clock in use (wrapped in a clockHolder), see SetClock
+	invokerValue         atomic.Value  // Chain of interceptors (wrapped in an invokerHolder), see SetInterceptors
+	loggerValue          atomic.Value  // Logger of the diagnostics (wrapped in a logger), see SetLogger
+	violationHandler     atomic.Value  // Handler of protocol violations (wrapped in a violationHandler), if any
+
+	holdersMutex sync.Mutex
+	holders      map[string]map[string]*DRWMutex // DRWMutex holding the lock per name, for every uid granted to a client of ds
+
+	leasesMutex sync.Mutex
+	leases      map[leaseKey]*lease // Refreshes of the lease, for every lock granted with a lease
+
+	closeOnce sync.Once
+	closed    chan struct{} // Closed by Close, stops the background goroutines waiting for time to pass
+}
 
-// SetNodesWithPath - initializes package-level global state variables such as clnts.
-// N B - This function should be called only once inside any program that uses
-// dsync.
-func SetNodesWithClients(rpcClnts []RPC, rpcOwnNode int) (err error) {
+// Options - optional configuration of a Dsync, see NewWithOptions. Every Dsync has its
+// own, so that independent clusters in one process do not affect each other.
+type Options struct {
+	// Source of time for all timeouts, retries and expiries, eg. a *FakeClock for tests.
+	// Defaults to the real clock, see SetClock.
+	Clock Clock
+
+	// Source of randomness for the retry jitter, eg. a seeded one (see NewSeededRand)
+	// for reproducible tests. Defaults to a source seeded from the current time.
+	Rand Rand
+
+	// Bounds of the releases the release worker retries, see SetReleaseLimits. Zero
+	// applies the defaults: 10000 releases pending, expiring after a day, dropped beyond.
+	MaxPendingReleases int
+	ReleaseMaxAge      time.Duration
+	ReleaseOverflow    ReleaseOverflow
+
+	// Chain of interceptors around all RPCs, the first one being the outermost, see
+	// SetInterceptors.
+	Interceptors []Interceptor
+
+	// Logger receiving the diagnostics, by default they are logged with the log package,
+	// see SetLogger.
+	Logger Logger
+}
+
+// New - initializes a cluster of the nodes of rpcClnts, rpcOwnNode being the index of
+// the node running on localhost.
+//
+// Dsync is designed for 4 to 16 nodes (an even number). A single node is supported as
+// well, eg. for development, in which case locks are granted in-process like a
+// sync.RWMutex without any RPCs (single-node mode). Once initialized, nodes can be
+// added and removed one at a time, see AddNode and RemoveNode.
+func New(rpcClnts []RPC, rpcOwnNode int) (*Dsync, error) {
+	return NewWithOptions(rpcClnts, rpcOwnNode, Options{})
+}
+
+// NewWithOptions - initializes a cluster like New, with the configuration of opts.
+func NewWithOptions(rpcClnts []RPC, rpcOwnNode int, opts Options) (*Dsync, error) {
 
 	// Validate if number of nodes is within allowable range.
-	if dnodeCount != 0 {
-		return errors.New("Cannot reinitialize dsync package")
+	if len(rpcClnts) == 0 {
+		return nil, &ConfigError{"No nodes given"}
+	} else if len(rpcClnts) == 1 {
+		// Single-node mode
 	} else if len(rpcClnts) < 4 {
-		return errors.New("Dsync not designed for less than 4 nodes")
+		return nil, &ConfigError{"Dsync not designed for less than 4 nodes"}
 	} else if len(rpcClnts) > 16 {
-		return errors.New("Dsync not designed for more than 16 nodes")
+		return nil, &ConfigError{"Dsync not designed for more than 16 nodes"}
 	} else if len(rpcClnts)&1 == 1 {
-		return errors.New("Dsync not designed for an uneven number of nodes")
+		return nil, &ConfigError{"Dsync not designed for an uneven number of nodes"}
 	}
 
-	if rpcOwnNode > len(rpcClnts) {
-		return errors.New("Index for own node is too large")
+	if rpcOwnNode < 0 || rpcOwnNode >= len(rpcClnts) {
+		return nil, &ConfigError{"Index for own node is out of range"}
 	}
 
-	dnodeCount = len(rpcClnts)
-	dquorum = dnodeCount/2 + 1
-	dquorumReads = dnodeCount/2
+	ds := &Dsync{
+		singleNode:    len(rpcClnts) == 1,
+		localLocks:    make(map[string]*localLock),
+		gates:         make(map[string]*gate),
+		readCache:     make(map[string]*cachedRead),
+		lastSequences: make(map[string]uint64),
+		metrics:       &lockMetrics{},
+		rand:          opts.Rand,
+		releases:      newReleaseQueue(newReleaseLimits(opts.MaxPendingReleases, opts.ReleaseMaxAge, opts.ReleaseOverflow)),
+		holders:       make(map[string]map[string]*DRWMutex),
+		leases:        make(map[leaseKey]*lease),
+		closed:        make(chan struct{}),
+	}
+	ds.SetClock(opts.Clock)
+	ds.SetInterceptors(opts.Interceptors...)
+	ds.SetLogger(opts.Logger)
+	if ds.rand == nil {
+		ds.rand = NewSeededRand(time.Now().UTC().UnixNano())
+	}
 	// Initialize node name and rpc path for each RPCClient object.
-	clnts = make([]RPC, dnodeCount)
-	copy(clnts, rpcClnts)
+	clnts := make([]*nodeClient, len(rpcClnts))
+	ids := make([]string, len(rpcClnts))
+	for index, c := range rpcClnts {
+		clnts[index] = newNodeClient(ds, c)
+		ids[index] = ringID(c)
+	}
+	ds.membersValue.Store(newMembers(clnts, ids, rpcOwnNode))
+	go ds.releaseWorker()
+	return ds, nil
+}
 
-	ownNode = rpcOwnNode
-	return nil
+// Close stops the background work of ds: the validation of the locks held (see
+// SetValidation) and the refreshes of their leases stop, and the release worker gives
+// up on the releases it still retries, leaving the locks to expire at the lock servers
+// (or to be removed as stale by lock maintenance). The RPC clients ds was initialized
+// with are left open, as they may be shared, whereas those retired by ReplaceNode are
+// closed right away. Locks are not to be acquired or released through ds anymore
+// afterwards. Use Debug to check that nothing is left running.
+func (ds *Dsync) Close() {
+	ds.closeOnce.Do(func() { close(ds.closed) })
+	ds.SetValidation(0)
+	ds.stopAllLeases()
+	ds.releases.close()
 }
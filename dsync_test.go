@@ -36,6 +36,7 @@ import (
 const N = 4           // number of lock servers for tests.
 var nodes []string    // list of node IP addrs or hostname with ports.
 var rpcPaths []string // list of rpc paths where lock server is serving.
+var ds *Dsync         // cluster of the lock servers.
 
 func startRPCServers(nodes []string) {
 
@@ -78,7 +79,8 @@ func TestMain(m *testing.M) {
 	}
 
 	rpcOwnNodeFakeForTest := 0
-	if err := SetNodesWithClients(clnts, rpcOwnNodeFakeForTest); err != nil {
+	var err error
+	if ds, err = New(clnts, rpcOwnNodeFakeForTest); err != nil {
 		log.Fatalf("set nodes failed with %v", err)
 	}
 	startRPCServers(nodes)
@@ -88,7 +90,7 @@ func TestMain(m *testing.M) {
 
 func TestSimpleLock(t *testing.T) {
 
-	dm := NewDRWMutex("test")
+	dm := NewDRWMutex("test", ds)
 
 	dm.Lock()
 
@@ -100,7 +102,7 @@ func TestSimpleLock(t *testing.T) {
 
 func TestSimpleLockUnlockMultipleTimes(t *testing.T) {
 
-	dm := NewDRWMutex("test")
+	dm := NewDRWMutex("test", ds)
 
 	dm.Lock()
 	time.Sleep(time.Duration(10+(rand.Float32()*50)) * time.Millisecond)
@@ -126,8 +128,8 @@ func TestSimpleLockUnlockMultipleTimes(t *testing.T) {
 // Test two locks for same resource, one succeeds, one fails (after timeout)
 func TestTwoSimultaneousLocksForSameResource(t *testing.T) {
 
-	dm1st := NewDRWMutex("aap")
-	dm2nd := NewDRWMutex("aap")
+	dm1st := NewDRWMutex("aap", ds)
+	dm2nd := NewDRWMutex("aap", ds)
 
 	dm1st.Lock()
 
@@ -150,9 +152,9 @@ func TestTwoSimultaneousLocksForSameResource(t *testing.T) {
 // Test three locks for same resource, one succeeds, one fails (after timeout)
 func TestThreeSimultaneousLocksForSameResource(t *testing.T) {
 
-	dm1st := NewDRWMutex("aap")
-	dm2nd := NewDRWMutex("aap")
-	dm3rd := NewDRWMutex("aap")
+	dm1st := NewDRWMutex("aap", ds)
+	dm2nd := NewDRWMutex("aap", ds)
+	dm3rd := NewDRWMutex("aap", ds)
 
 	dm1st.Lock()
 
@@ -215,8 +217,8 @@ func TestThreeSimultaneousLocksForSameResource(t *testing.T) {
 // Test two locks for different resources, both succeed
 func TestTwoSimultaneousLocksForDifferentResources(t *testing.T) {
 
-	dm1 := NewDRWMutex("aap")
-	dm2 := NewDRWMutex("noot")
+	dm1 := NewDRWMutex("aap", ds)
+	dm2 := NewDRWMutex("noot", ds)
 
 	dm1.Lock()
 	dm2.Lock()
@@ -242,7 +244,7 @@ func HammerMutex(m *DRWMutex, loops int, cdone chan bool) {
 // Borrowed from mutex_test.go
 func TestMutex(t *testing.T) {
 	c := make(chan bool)
-	m := NewDRWMutex("test")
+	m := NewDRWMutex("test", ds)
 	for i := 0; i < 10; i++ {
 		go HammerMutex(m, 1000, c)
 	}
@@ -266,7 +268,7 @@ func BenchmarkMutexUncontended(b *testing.B) {
 }
 
 func benchmarkMutex(b *testing.B, slack, work bool) {
-	mu := NewDRWMutex("")
+	mu := NewDRWMutex("", ds)
 	if slack {
 		b.SetParallelism(10)
 	}
@@ -309,7 +311,7 @@ func BenchmarkMutexNoSpin(b *testing.B) {
 	// These goroutines yield during local work, so that switching from
 	// a blocked goroutine to other goroutines is profitable.
 	// As a matter of fact, this benchmark still triggers some spinning in the mutex.
-	m := NewDRWMutex("")
+	m := NewDRWMutex("", ds)
 	var acc0, acc1 uint64
 	b.SetParallelism(4)
 	b.RunParallel(func(pb *testing.PB) {
@@ -341,7 +343,7 @@ func BenchmarkMutexSpin(b *testing.B) {
 	// profitable. To achieve this we create a goroutine per-proc.
 	// These goroutines access considerable amount of local data so that
 	// unnecessary rescheduling is penalized by cache misses.
-	m := NewDRWMutex("")
+	m := NewDRWMutex("", ds)
 	var acc0, acc1 uint64
 	b.RunParallel(func(pb *testing.PB) {
 		var data [16 << 10]uint64
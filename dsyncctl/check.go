@@ -0,0 +1,139 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// check runs live checks of the invariants of the cluster, returning a non-zero exit
+// code when any invariant is violated or not all nodes could be reached:
+//   - no name is write locked on some, but fewer than a quorum of the nodes
+//   - no name is both write and read locked (at a single node, or with a quorum each)
+//   - the clocks of the nodes are within the maximum skew of each other and of this host
+//
+// Note that the snapshots of the nodes are not taken at exactly the same moment, so locks
+// that are being (un)locked while checking can show up as a violation. Repeat the check
+// before acting on it.
+func check(args []string) int {
+
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	maxSkew := fs.Duration("max-skew", time.Second, "Maximum clock skew between the nodes")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: check [-max-skew <duration>]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	exitCode := 0
+	violations := 0
+
+	// Write locks held by a quorum, and read locks held by enough nodes for a read lock
+	snapshots := ds.Snapshots()
+	quorum, readQuorum := len(snapshots)/2+1, len(snapshots)/2
+	if len(snapshots) == 1 {
+		readQuorum = 1
+	}
+
+	writers := make(map[string]int)
+	readers := make(map[string]int)
+	for _, s := range snapshots {
+		if s.Err != nil {
+			fmt.Printf("%-24s error: %v\n", s.Node, s.Err)
+			exitCode = 1
+			continue
+		}
+		w, r := make(map[string]int), make(map[string]int)
+		for _, e := range s.Entries {
+			if e.Writer {
+				w[e.Name]++
+			} else {
+				r[e.Name]++
+			}
+		}
+		for name, n := range w {
+			if n > 1 || r[name] > 0 {
+				fmt.Printf("%s: %d write and %d read locks held at %s\n", name, n, r[name], s.Node)
+				violations++
+			}
+			writers[name]++
+		}
+		for name := range r {
+			readers[name]++
+		}
+	}
+
+	var names []string
+	for name := range writers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if writers[name] < quorum {
+			fmt.Printf("%s: write locked on %d nodes, fewer than a quorum of %d\n", name, writers[name], quorum)
+			violations++
+		}
+		if writers[name] >= quorum && readers[name] >= readQuorum {
+			fmt.Printf("%s: write locked on %d nodes and read locked on %d nodes\n", name, writers[name], readers[name])
+			violations++
+		}
+	}
+
+	// Clock skew relative to this host, and thereby between the nodes
+	var minSkew, maxSkewSeen time.Duration
+	reached := 0
+	for _, v := range ds.Versions() {
+		if v.Err != nil {
+			fmt.Printf("%-24s error: %v\n", v.Node, v.Err)
+			exitCode = 1
+			continue
+		}
+		if v.Time.IsZero() {
+			fmt.Printf("%-24s does not report its time, skipping clock skew\n", v.Node)
+			continue
+		}
+		if v.Skew > *maxSkew || v.Skew < -*maxSkew {
+			fmt.Printf("%s: clock skew of %v relative to this host\n", v.Node, v.Skew)
+			violations++
+		}
+		if reached == 0 || v.Skew < minSkew {
+			minSkew = v.Skew
+		}
+		if reached == 0 || v.Skew > maxSkewSeen {
+			maxSkewSeen = v.Skew
+		}
+		reached++
+	}
+	if maxSkewSeen-minSkew > *maxSkew {
+		fmt.Printf("clock skew of %v between the nodes\n", maxSkewSeen-minSkew)
+		violations++
+	}
+
+	fmt.Printf("%d write locked names checked over %d nodes, %d violations\n", len(names), len(snapshots), violations)
+	if violations > 0 {
+		exitCode = 1
+	}
+	return exitCode
+}
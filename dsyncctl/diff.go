@@ -0,0 +1,114 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/minio/dsync"
+)
+
+// holders returns a description of the holders of a lock per name. Uids are left out
+// since every node hands out a different uid for the same lock request.
+func holders(entries []dsync.LockEntry) map[string]string {
+	perName := make(map[string][]string)
+	for _, e := range entries {
+		mode := "R"
+		if e.Writer {
+			mode = "W"
+		}
+		perName[e.Name] = append(perName[e.Name], mode+" "+e.Node+e.RPCPath)
+	}
+	h := make(map[string]string, len(perName))
+	for name, hs := range perName {
+		sort.Strings(hs)
+		h[name] = strings.Join(hs, ", ")
+	}
+	return h
+}
+
+// diff prints the locks for which the nodes disagree, either because the lock is
+// present on some nodes only or because it is held by different clients. Returns a
+// non-zero exit code when any divergence is found or not all nodes could be reached.
+func diff() int {
+
+	exitCode := 0
+
+	var nodes []string
+	var perNode []map[string]string
+	names := make(map[string]bool)
+	for _, s := range ds.Snapshots() {
+		if s.Err != nil {
+			fmt.Printf("%-24s error: %v\n", s.Node, s.Err)
+			exitCode = 1
+			continue
+		}
+		h := holders(s.Entries)
+		for name := range h {
+			names[name] = true
+		}
+		nodes = append(nodes, s.Node)
+		perNode = append(perNode, h)
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	divergences := 0
+	for _, name := range sorted {
+		var missing []string
+		mismatch := false
+		first := ""
+		for i, h := range perNode {
+			hs, ok := h[name]
+			if !ok {
+				missing = append(missing, nodes[i])
+				continue
+			}
+			if first == "" {
+				first = hs
+			} else if hs != first {
+				mismatch = true
+			}
+		}
+
+		switch {
+		case len(missing) > 0:
+			fmt.Printf("%s: present on %d of %d nodes, missing on %s\n",
+				name, len(nodes)-len(missing), len(nodes), strings.Join(missing, ", "))
+		case mismatch:
+			fmt.Printf("%s: mismatched holders\n", name)
+			for i, h := range perNode {
+				fmt.Printf("  %-24s %s\n", nodes[i], h[name])
+			}
+		default:
+			continue
+		}
+		divergences++
+	}
+
+	fmt.Printf("%d locks compared over %d nodes, %d divergences\n", len(sorted), len(nodes), divergences)
+	if divergences > 0 {
+		exitCode = 1
+	}
+	return exitCode
+}
@@ -0,0 +1,67 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// expire releases all locks under a prefix at all nodes (or lists them with -dry-run),
+// returning a non-zero exit code when not all nodes could be reached.
+func expire(args []string) int {
+
+	fs := flag.NewFlagSet("expire", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Only list the locks that would be expired")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: expire [-dry-run] <prefix>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	exitCode := 0
+	expired, err := ds.ExpirePrefix(fs.Arg(0), *dryRun)
+	for _, e := range expired {
+		if e.Err != nil {
+			fmt.Printf("%-24s error: %v\n", e.Node, e.Err)
+			exitCode = 1
+			continue
+		}
+		for _, entry := range e.Entries {
+			mode := "read"
+			if entry.Writer {
+				mode = "write"
+			}
+			fmt.Printf("%-24s %-5s %s  held by: %s%s\n", e.Node, mode, entry.Name, entry.Node, entry.RPCPath)
+		}
+		if *dryRun {
+			fmt.Printf("%-24s %d locks would be expired\n", e.Node, len(e.Entries))
+		} else {
+			fmt.Printf("%-24s %d locks expired\n", e.Node, len(e.Entries))
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		exitCode = 1
+	}
+	return exitCode
+}
@@ -0,0 +1,60 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// forceUnlock removes the lock on a name at all nodes on behalf of an operator, which
+// is recorded in the audit log of the lock servers. Returns a non-zero exit code when
+// not all nodes could be reached.
+func forceUnlock(args []string) int {
+
+	fs := flag.NewFlagSet("force-unlock", flag.ExitOnError)
+	operator := fs.String("operator", os.Getenv("USER"), "Operator performing the force unlock (for the audit log)")
+	reason := fs.String("reason", "", "Reason for the force unlock (for the audit log)")
+	override := fs.Bool("override", false, "Proceed when less than a quorum of the nodes can be reached (emergencies only)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: force-unlock -reason <reason> [-operator <name>] [-override] <name>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *reason == "" {
+		fs.Usage()
+		return 2
+	}
+
+	removed, err := ds.AdminForceUnlock(fs.Arg(0), *operator, *reason, *override)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	exitCode := 0
+	for _, r := range removed {
+		if r.Err != nil {
+			fmt.Printf("%-24s error: %v\n", r.Node, r.Err)
+			exitCode = 1
+			continue
+		}
+		fmt.Printf("%-24s %d locks removed\n", r.Node, len(r.Entries))
+	}
+	return exitCode
+}
@@ -0,0 +1,74 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// freeze freezes (or with unfreeze set, unfreezes) a name at all nodes on behalf of
+// an operator, returning a non-zero exit code when this failed.
+func freeze(args []string, unfreeze bool) int {
+
+	command := "freeze"
+	if unfreeze {
+		command = "unfreeze"
+	}
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	operator := fs.String("operator", os.Getenv("USER"), "Operator (un)freezing the name (for the audit log)")
+	reason := fs.String("reason", "", "Reason for (un)freezing the name (for the audit log)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -reason <reason> [-operator <name>] <name>\n", command)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *reason == "" {
+		fs.Usage()
+		return 2
+	}
+
+	var err error
+	if unfreeze {
+		err = ds.Unfreeze(fs.Arg(0), *operator, *reason)
+	} else {
+		err = ds.Freeze(fs.Arg(0), *operator, *reason)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// frozen lists the frozen names of all nodes, returning a non-zero exit code when
+// not all nodes could be reached.
+func frozen() int {
+
+	exitCode := 0
+	for _, f := range ds.FrozenNames() {
+		if f.Err != nil {
+			fmt.Printf("%-24s error: %v\n", f.Node, f.Err)
+			exitCode = 1
+			continue
+		}
+		fmt.Printf("%-24s %s\n", f.Node, strings.Join(f.Names, " "))
+	}
+	return exitCode
+}
@@ -0,0 +1,82 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// hotspots shows the most contended lock names of all nodes, returning a non-zero
+// exit code when not all nodes could be reached.
+func hotspots(args []string) int {
+
+	fs := flag.NewFlagSet("hotspots", flag.ExitOnError)
+	count := fs.Int("n", 10, "Number of names to show per node")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: hotspots [-n <count>]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	exitCode := 0
+	for _, h := range ds.Hotspots(*count) {
+		if h.Err != nil {
+			fmt.Printf("%-24s error: %v\n", h.Node, h.Err)
+			exitCode = 1
+			continue
+		}
+		fmt.Printf("%-24s last %s\n", h.Node, h.Window)
+		for _, hs := range h.Hotspots {
+			fmt.Printf("  %-40s requests: %-8d denies: %-8d avg wait: %s\n", hs.Name, hs.Requests, hs.Denies, hs.AvgWait.Truncate(time.Millisecond))
+		}
+	}
+	return exitCode
+}
+
+// stats shows the contention of the names with a prefix and/or of the given names of
+// all nodes, returning a non-zero exit code when not all nodes could be reached.
+func stats(args []string) int {
+
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "Show all names starting with prefix")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: stats [-prefix <prefix>] [<name> ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	exitCode := 0
+	for _, s := range ds.Stats(*prefix, fs.Args()...) {
+		if s.Err != nil {
+			fmt.Printf("%-24s error: %v\n", s.Node, s.Err)
+			exitCode = 1
+			continue
+		}
+		fmt.Printf("%-24s last %s\n", s.Node, s.Window)
+		for _, hs := range s.Stats {
+			fmt.Printf("  %-40s requests: %-8d denies: %-8d avg wait: %s\n", hs.Name, hs.Requests, hs.Denies, hs.AvgWait.Truncate(time.Millisecond))
+		}
+	}
+	return exitCode
+}
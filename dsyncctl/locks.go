@@ -0,0 +1,67 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// locks lists the locks held in the cluster, aggregated from the lock tables of all nodes:
+// per name the holders with their owner, the caller that requested the lock, its tags and since
+// when it is held. Returns a non-zero exit code when not all nodes could be reached.
+func locks(args []string) int {
+
+	fs := flag.NewFlagSet("locks", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "Show all names starting with prefix")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: locks [-prefix <prefix>] [<name> ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	exitCode := 0
+	infos, err := ds.Inspect(*prefix, fs.Args()...)
+	if err != nil {
+		fmt.Println("error:", err)
+		exitCode = 1
+	}
+	for _, li := range infos {
+		fmt.Println(li.Name)
+		for _, h := range li.Holders {
+			mode := "read"
+			if h.Mode.IsExclusive() {
+				mode = "write"
+			}
+			fmt.Printf("  %-5s held by: %s%s  owner: %s  source: %s  since: %s (%s)  granted by: %s\n", mode, h.Node, h.RPCPath,
+				h.Owner, h.Source, h.Since.Format(time.RFC3339), h.Held.Truncate(time.Millisecond), strings.Join(h.Nodes, ", "))
+			if len(h.Tags) > 0 {
+				pairs := make([]string, 0, len(h.Tags))
+				for k, v := range h.Tags {
+					pairs = append(pairs, k+"="+v)
+				}
+				sort.Strings(pairs)
+				fmt.Printf("        tags: %s\n", strings.Join(pairs, " "))
+			}
+		}
+	}
+	return exitCode
+}
@@ -0,0 +1,164 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/minio/dsync"
+)
+
+var (
+	nodesFlag  = flag.String("nodes", "", "Comma separated list of lock servers as host:port[/rpc/path]")
+	ownFlag    = flag.Int("own", 0, "Index of the lock server running on this host")
+	tlsFlag    = flag.Bool("tls", false, "Connect to the lock servers over TLS")
+	certFlag   = flag.String("tls-cert", "", "PEM client certificate to present to the lock servers over TLS")
+	keyFlag    = flag.String("tls-key", "", "PEM private key of -tls-cert")
+	caFlag     = flag.String("tls-ca", "", "PEM certificates of the CAs to verify the lock servers with, defaults to the system roots")
+	secretFlag = flag.String("secret-file", "", "File holding the secret to authenticate requests to the lock servers with")
+)
+
+// Cluster of the lock servers given with -nodes.
+var ds *dsync.Dsync
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s -nodes host:port[/rpc/path],... <command>\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  check      [-max-skew <duration>]: check the invariants of the cluster")
+	fmt.Fprintln(os.Stderr, "  diff       compare the locks held by all nodes and show divergences")
+	fmt.Fprintln(os.Stderr, "  expire     [-dry-run] <prefix>: release all locks with names starting with prefix")
+	fmt.Fprintln(os.Stderr, "  force-unlock -reason <reason> [-operator <name>] [-override] <name>: remove the lock on name")
+	fmt.Fprintln(os.Stderr, "  freeze     -reason <reason> [-operator <name>] <name>: deny all lock requests for name")
+	fmt.Fprintln(os.Stderr, "  frozen     list the frozen names of all nodes")
+	fmt.Fprintln(os.Stderr, "  hotspots   [-n <count>]: show the most contended names of all nodes")
+	fmt.Fprintln(os.Stderr, "  locks      [-prefix <prefix>] [<name> ...]: list the holders of the locks with their owner, source and age")
+	fmt.Fprintln(os.Stderr, "  pause      -reason <reason> [-operator <name>]: deny all new lock requests, eg. during maintenance")
+	fmt.Fprintln(os.Stderr, "  paused     show whether granting is paused at all nodes")
+	fmt.Fprintln(os.Stderr, "  placement  [-replication <r>] <name> ...: show the nodes the locks on names are placed on")
+	fmt.Fprintln(os.Stderr, "  resume     -reason <reason> [-operator <name>]: resume granting new locks after a pause")
+	fmt.Fprintln(os.Stderr, "  stats      [-prefix <prefix>] [<name> ...]: show the contention of many names of all nodes")
+	fmt.Fprintln(os.Stderr, "  unfreeze   -reason <reason> [-operator <name>] <name>: lift the freeze of name")
+	fmt.Fprintln(os.Stderr, "  version    show protocol version, build commit and features of all nodes")
+	fmt.Fprintln(os.Stderr, "")
+	flag.PrintDefaults()
+}
+
+// parseNodes converts the -nodes flag into RPC clients, the RPC path defaults to dsync.DefaultPath.
+// Clients are created with the security settings of config.
+func parseNodes(nodes string, config ClientConfig) []dsync.RPC {
+	var clnts []dsync.RPC
+	for _, node := range strings.Split(nodes, ",") {
+		rpcPath := dsync.DefaultPath
+		if i := strings.Index(node, "/"); i != -1 {
+			node, rpcPath = node[:i], node[i:]
+		}
+		clnts = append(clnts, newClientWithConfig(node, rpcPath, config))
+	}
+	return clnts
+}
+
+func main() {
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if *nodesFlag == "" || flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	var config ClientConfig
+	var err error
+	if *tlsFlag || *certFlag != "" || *caFlag != "" {
+		if config.TLS, err = tlsConfig(*certFlag, *keyFlag, *caFlag); err != nil {
+			log.Fatalf("TLS configuration failed with %v", err)
+		}
+	}
+	if *secretFlag != "" {
+		if config.Secret, err = ioutil.ReadFile(*secretFlag); err != nil {
+			log.Fatalf("reading secret failed with %v", err)
+		}
+		config.Secret = bytes.TrimSpace(config.Secret)
+	}
+
+	if ds, err = dsync.New(parseNodes(*nodesFlag, config), *ownFlag); err != nil {
+		log.Fatalf("set nodes failed with %v", err)
+	}
+
+	switch flag.Arg(0) {
+	case "check":
+		os.Exit(check(flag.Args()[1:]))
+	case "diff":
+		os.Exit(diff())
+	case "expire":
+		os.Exit(expire(flag.Args()[1:]))
+	case "force-unlock":
+		os.Exit(forceUnlock(flag.Args()[1:]))
+	case "freeze":
+		os.Exit(freeze(flag.Args()[1:], false))
+	case "frozen":
+		os.Exit(frozen())
+	case "hotspots":
+		os.Exit(hotspots(flag.Args()[1:]))
+	case "locks":
+		os.Exit(locks(flag.Args()[1:]))
+	case "pause":
+		os.Exit(pause(flag.Args()[1:], false))
+	case "paused":
+		os.Exit(paused())
+	case "placement":
+		os.Exit(placement(flag.Args()[1:]))
+	case "resume":
+		os.Exit(pause(flag.Args()[1:], true))
+	case "stats":
+		os.Exit(stats(flag.Args()[1:]))
+	case "unfreeze":
+		os.Exit(freeze(flag.Args()[1:], true))
+	case "version":
+		os.Exit(version())
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// version prints the version information of all nodes, returning a non-zero
+// exit code when not all nodes speak the same protocol version.
+func version() int {
+
+	exitCode := 0
+	for _, v := range ds.Versions() {
+		if v.Err != nil {
+			fmt.Printf("%-24s error: %v\n", v.Node, v.Err)
+			exitCode = 1
+			continue
+		}
+		fmt.Printf("%-24s protocol: %d  commit: %s  features: %s\n", v.Node, v.ProtocolVersion, v.Commit, v.Features)
+	}
+
+	if err := ds.CheckVersions(); err != nil {
+		fmt.Println(err)
+		exitCode = 1
+	}
+	return exitCode
+}
@@ -0,0 +1,77 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// pause pauses (or with resume set, resumes) granting new locks at all nodes on behalf
+// of an operator, returning a non-zero exit code when this failed.
+func pause(args []string, resume bool) int {
+
+	command := "pause"
+	if resume {
+		command = "resume"
+	}
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	operator := fs.String("operator", os.Getenv("USER"), "Operator pausing or resuming granting (for the audit log)")
+	reason := fs.String("reason", "", "Reason for pausing or resuming granting (for the audit log)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -reason <reason> [-operator <name>]\n", command)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *reason == "" {
+		fs.Usage()
+		return 2
+	}
+
+	var err error
+	if resume {
+		err = ds.Resume(*operator, *reason)
+	} else {
+		err = ds.Pause(*operator, *reason)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// paused shows whether granting is paused at all nodes, returning a non-zero exit code
+// when not all nodes could be reached.
+func paused() int {
+
+	exitCode := 0
+	for _, p := range ds.PauseStatus() {
+		switch {
+		case p.Err != nil:
+			fmt.Printf("%-24s error: %v\n", p.Node, p.Err)
+			exitCode = 1
+		case p.Paused:
+			fmt.Printf("%-24s paused since %s\n", p.Node, p.Since.Format(time.RFC3339))
+		default:
+			fmt.Printf("%-24s granting\n", p.Node)
+		}
+	}
+	return exitCode
+}
@@ -0,0 +1,50 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// placement shows the nodes the locks on the given names are placed on for a
+// replication factor.
+func placement(args []string) int {
+
+	fs := flag.NewFlagSet("placement", flag.ExitOnError)
+	replication := fs.Int("replication", 0, "Number of nodes every lock is placed on (0 for all nodes)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: placement [-replication <r>] <name> ...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := ds.SetReplication(*replication); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	for _, name := range fs.Args() {
+		fmt.Printf("%-40s %s\n", name, strings.Join(ds.Placement(name), " "))
+	}
+	return 0
+}
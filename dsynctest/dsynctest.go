@@ -0,0 +1,267 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package dsynctest implements a conformance test suite for RPC implementations and lock
+// server backends of dsync, so that third-party transports and backends can prove that
+// they are compatible:
+//
+//	func TestConformance(t *testing.T) {
+//		dsynctest.TestConformance(t, func(n int) ([]dsync.RPC, func(), error) {
+//			// Start n fresh lock servers and return clients reaching them
+//		})
+//	}
+//
+// AssertNoLeaks checks that a Dsync left no goroutines or RPC calls behind, eg. at the end
+// of the tests of an application.
+package dsynctest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// Number of lock servers of the clusters the suite runs against.
+const nodes = 4
+
+// Time the suite waits for a lock that is expected to be granted, as releases are
+// delivered asynchronously.
+const grantTimeout = 5 * time.Second
+
+// MakeCluster starts n fresh lock servers (holding no locks) and returns clients of them,
+// in the order of the nodes, along with a function that stops the lock servers again.
+type MakeCluster func(n int) (clnts []dsync.RPC, stop func(), err error)
+
+// TestConformance tests the RPC implementation and lock servers returned by makeCluster,
+// running every test of the suite as a subtest against a fresh cluster: the lock RPCs
+// proper and the lock semantics of DRWMutex on top of them.
+func TestConformance(t *testing.T, makeCluster MakeCluster) {
+	for _, test := range []struct {
+		name string
+		fn   func(t *testing.T, clnts []dsync.RPC)
+	}{
+		{"LockRPCs", testLockRPCs},
+		{"Exclusive", testExclusive},
+		{"Shared", testShared},
+		{"MutualExclusion", testMutualExclusion},
+		{"Context", testContext},
+		{"ForceUnlock", testForceUnlock},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			clnts, stop, err := makeCluster(nodes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stop()
+			if len(clnts) != nodes {
+				t.Fatalf("expected %d clients, got %d", nodes, len(clnts))
+			}
+			test.fn(t, clnts)
+		})
+	}
+}
+
+// newCluster returns a client of the cluster for a process running on the node at index,
+// closed once the test is done.
+func newCluster(t *testing.T, clnts []dsync.RPC, index int) *dsync.Dsync {
+	ds, err := dsync.New(clnts, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ds.Close)
+	return ds
+}
+
+// AssertNoLeaks fails the test when goroutines or RPC calls started by ds are still
+// running once the grace period passed, eg. after ds was closed (see Dsync.Close),
+// reporting what was left (see Dsync.Debug).
+func AssertNoLeaks(t testing.TB, ds *dsync.Dsync, grace time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(grace)
+	for {
+		d := ds.Debug()
+		if d.Goroutines() == 0 && d.CallsInFlight() == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dsync leaked resources:\n%s", d)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// call issues a lock RPC on c, returning whether it was granted.
+func call(c dsync.RPC, serviceMethod, name, uid string, mode dsync.LockMode) (bool, error) {
+	var resp dsync.LockResp
+	err := c.Call(serviceMethod, &dsync.LockArgs{Name: name, Node: c.Node(), RPCPath: c.RPCPath(), UID: uid, Mode: mode}, &resp)
+	return resp.Granted, err
+}
+
+// testLockRPCs tests the lock RPCs of a single lock server, including the errors returned.
+func testLockRPCs(t *testing.T, clnts []dsync.RPC) {
+	c := clnts[0]
+	expect := func(serviceMethod, uid string, mode dsync.LockMode, granted bool) {
+		t.Helper()
+		if g, err := call(c, serviceMethod, "test", uid, mode); err != nil || g != granted {
+			t.Fatalf("expected %s (uid %s) to return %v, got %v (%v)", serviceMethod, uid, granted, g, err)
+		}
+	}
+
+	expect("Dsync.Lock", "1", dsync.Exclusive, true)
+	expect("Dsync.Lock", "2", dsync.Exclusive, false)
+	expect("Dsync.RLock", "3", dsync.Shared, false)
+	if _, err := call(c, "Dsync.RUnlock", "test", "1", dsync.Shared); err == nil {
+		t.Fatal("expected RUnlock of a write lock to fail")
+	}
+	expect("Dsync.Unlock", "1", dsync.Exclusive, true)
+	if _, err := call(c, "Dsync.Unlock", "test", "1", dsync.Exclusive); err == nil {
+		t.Fatal("expected Unlock of an unlocked name to fail")
+	}
+
+	expect("Dsync.RLock", "4", dsync.Shared, true)
+	expect("Dsync.RLock", "5", dsync.Shared, true)
+	expect("Dsync.Lock", "6", dsync.Exclusive, false)
+	if _, err := call(c, "Dsync.Unlock", "test", "4", dsync.Exclusive); err == nil {
+		t.Fatal("expected Unlock of a read lock to fail")
+	}
+	expect("Dsync.RUnlock", "4", dsync.Shared, true)
+	expect("Dsync.Lock", "6", dsync.Exclusive, false)
+	expect("Dsync.RUnlock", "5", dsync.Shared, true)
+	expect("Dsync.Lock", "6", dsync.Exclusive, true)
+
+	expect("Dsync.ForceUnlock", "", "", true)
+	expect("Dsync.RLock", "7", dsync.Shared, true)
+	expect("Dsync.ForceUnlock", "", "", true)
+
+	// Requests of older clients come without mode
+	expect("Dsync.Lock", "8", "", true)
+	expect("Dsync.Unlock", "8", "", true)
+}
+
+// testExclusive tests that a write lock excludes all other locks until released.
+func testExclusive(t *testing.T, clnts []dsync.RPC) {
+	ds, other := newCluster(t, clnts, 0), newCluster(t, clnts, 1)
+
+	dm := dsync.NewDRWMutex("test", ds)
+	if !dm.LockWithTimeout(grantTimeout) {
+		t.Fatal("expected write lock to be granted")
+	}
+	om := dsync.NewDRWMutex("test", other)
+	if om.TryLock() {
+		t.Fatal("expected write lock of another process to be denied")
+	}
+	if om.TryRLock() {
+		t.Fatal("expected read lock of another process to be denied")
+	}
+	if !dsync.NewDRWMutex("other", other).TryLock() {
+		t.Fatal("expected write lock on another name to be granted")
+	}
+	dm.Unlock()
+
+	if !om.LockWithTimeout(grantTimeout) {
+		t.Fatal("expected write lock to be granted once released")
+	}
+	om.Unlock()
+}
+
+// testShared tests that read locks are shared, while excluding write locks until all
+// of them are released.
+func testShared(t *testing.T, clnts []dsync.RPC) {
+	ds, other := newCluster(t, clnts, 0), newCluster(t, clnts, 1)
+
+	first, second := dsync.NewDRWMutex("test", ds), dsync.NewDRWMutex("test", other)
+	if !first.RLockWithTimeout(grantTimeout) || !second.RLockWithTimeout(grantTimeout) {
+		t.Fatal("expected read locks to be granted")
+	}
+	writer := dsync.NewDRWMutex("test", other)
+	if writer.TryLock() {
+		t.Fatal("expected write lock to be denied while read locked")
+	}
+	first.RUnlock()
+	if writer.TryLock() {
+		t.Fatal("expected write lock to be denied while read locked")
+	}
+	second.RUnlock()
+	if !writer.LockWithTimeout(grantTimeout) {
+		t.Fatal("expected write lock to be granted once all read locks are released")
+	}
+	writer.Unlock()
+}
+
+// testMutualExclusion tests that concurrent writers from several processes never hold the
+// lock at the same time.
+func testMutualExclusion(t *testing.T, clnts []dsync.RPC) {
+	const writers, rounds = 4, 5
+
+	var holders, violations int64
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(ds *dsync.Dsync) {
+			defer wg.Done()
+			dm := dsync.NewDRWMutex("test", ds)
+			for j := 0; j < rounds; j++ {
+				dm.Lock()
+				if atomic.AddInt64(&holders, 1) != 1 {
+					atomic.AddInt64(&violations, 1)
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt64(&holders, -1)
+				dm.Unlock()
+			}
+		}(newCluster(t, clnts, i%nodes))
+	}
+	wg.Wait()
+
+	if violations > 0 {
+		t.Fatalf("expected writers to exclude each other, got %d violations", violations)
+	}
+}
+
+// testContext tests that a lock request is given up on once its context is done.
+func testContext(t *testing.T, clnts []dsync.RPC) {
+	ds, other := newCluster(t, clnts, 0), newCluster(t, clnts, 1)
+
+	dm := dsync.NewDRWMutex("test", ds)
+	if !dm.LockWithTimeout(grantTimeout) {
+		t.Fatal("expected write lock to be granted")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if dsync.NewDRWMutex("test", other).LockContext(ctx) {
+		t.Fatal("expected write lock to be given up on once the context is done")
+	}
+	dm.Unlock()
+}
+
+// testForceUnlock tests that a lock is cleared by another process.
+func testForceUnlock(t *testing.T, clnts []dsync.RPC) {
+	ds, other := newCluster(t, clnts, 0), newCluster(t, clnts, 1)
+
+	if !dsync.NewDRWMutex("test", ds).LockWithTimeout(grantTimeout) {
+		t.Fatal("expected write lock to be granted")
+	}
+	om := dsync.NewDRWMutex("test", other)
+	om.ForceUnlock()
+	if !om.LockWithTimeout(grantTimeout) {
+		t.Fatal("expected write lock to be granted once forcefully cleared")
+	}
+	om.Unlock()
+}
@@ -0,0 +1,116 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Outcome - result of a request sent to a single node.
+type Outcome string
+
+const (
+	OutcomeGranted    Outcome = "granted"     // Node granted the request
+	OutcomeDenied     Outcome = "denied"      // Node responded but refused the request
+	OutcomeError      Outcome = "error"       // Request could not be delivered or failed at the node
+	OutcomeNoResponse Outcome = "no response" // Node did not respond in time
+	OutcomeFrozen     Outcome = "frozen"      // Node refused the request because the name is frozen (see Freeze)
+)
+
+// NodeResult - outcome of a request for a single node.
+type NodeResult struct {
+	Node    string        // Network address of the node
+	Outcome Outcome       // Outcome of the request
+	Latency time.Duration // Time until the response came in (zero when no response)
+	Err     error         // Error when Outcome is OutcomeError
+}
+
+// MarshalJSON - encodes the error as a string and the latency in a human readable form.
+func (r NodeResult) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Node    string  `json:"node"`
+		Outcome Outcome `json:"outcome"`
+		Latency string  `json:"latency,omitempty"`
+		Error   string  `json:"error,omitempty"`
+	}{Node: r.Node, Outcome: r.Outcome}
+	if r.Outcome != OutcomeNoResponse {
+		v.Latency = r.Latency.String()
+	}
+	if r.Err != nil {
+		v.Error = r.Err.Error()
+	}
+	return json.Marshal(v)
+}
+
+// MultiNodeError - returned when an operation failed to get the required
+// number of nodes to agree, with a breakdown of what every node responded.
+type MultiNodeError struct {
+	Operation string       `json:"operation"` // Operation that failed, eg. "Lock" or "RLock"
+	Name      string       `json:"name"`      // Name of the resource
+	Results   []NodeResult `json:"results"`   // Outcome per node
+	quorum    int          // Number of the nodes that had to agree, zero when unknown
+}
+
+// Count returns the number of nodes with the given outcome.
+func (e *MultiNodeError) Count(outcome Outcome) (n int) {
+	for _, r := range e.Results {
+		if r.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+func (e *MultiNodeError) Error() string {
+	var granted, denied, frozen, errored, missing []string
+	for _, r := range e.Results {
+		switch r.Outcome {
+		case OutcomeGranted:
+			granted = append(granted, r.Node)
+		case OutcomeDenied:
+			denied = append(denied, r.Node)
+		case OutcomeFrozen:
+			frozen = append(frozen, r.Node)
+		case OutcomeError:
+			errored = append(errored, fmt.Sprintf("%s (%v)", r.Node, r.Err))
+		default:
+			missing = append(missing, r.Node)
+		}
+	}
+	if len(frozen) > 0 {
+		denied = append(denied, fmt.Sprintf("(frozen: %s)", strings.Join(frozen, " ")))
+	}
+	return fmt.Sprintf("%s %q failed: granted [%s], denied [%s], errored [%s], no response [%s]", e.Operation, e.Name,
+		strings.Join(granted, " "), strings.Join(denied, " "), strings.Join(errored, " "), strings.Join(missing, " "))
+}
+
+// Frozen returns true when the request was refused because the name is frozen,
+// that is when too many nodes reported the name as frozen for a quorum to be possible.
+func (e *MultiNodeError) Frozen() bool {
+	quorum := e.quorum
+	if quorum == 0 {
+		// Assume a quorum of the nodes responding
+		quorum = len(e.Results)/2 + 1
+		if e.Operation == "RLock" {
+			quorum = (len(e.Results) + 1) / 2
+		}
+	}
+	return len(e.Results)-e.Count(OutcomeFrozen) < quorum
+}
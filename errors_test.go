@@ -0,0 +1,56 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	. "github.com/minio/dsync"
+)
+
+func TestMultiNodeErrorJSON(t *testing.T) {
+
+	err := &MultiNodeError{
+		Operation: "Lock",
+		Name:      "test",
+		Results: []NodeResult{
+			{Node: "127.0.0.1:12345", Outcome: OutcomeGranted, Latency: 2 * time.Millisecond},
+			{Node: "127.0.0.1:12346", Outcome: OutcomeDenied, Latency: time.Millisecond},
+			{Node: "127.0.0.1:12347", Outcome: OutcomeError, Latency: time.Millisecond, Err: errors.New("connection refused")},
+			{Node: "127.0.0.1:12348", Outcome: OutcomeNoResponse},
+		},
+	}
+
+	if err.Count(OutcomeGranted) != 1 || err.Count(OutcomeNoResponse) != 1 {
+		t.Fatalf("unexpected counts for %v", err)
+	}
+
+	b, e := json.Marshal(err)
+	if e != nil {
+		t.Fatal(e)
+	}
+	expected := `{"operation":"Lock","name":"test","results":[` +
+		`{"node":"127.0.0.1:12345","outcome":"granted","latency":"2ms"},` +
+		`{"node":"127.0.0.1:12346","outcome":"denied","latency":"1ms"},` +
+		`{"node":"127.0.0.1:12347","outcome":"error","latency":"1ms","error":"connection refused"},` +
+		`{"node":"127.0.0.1:12348","outcome":"no response"}]}`
+	if string(b) != expected {
+		t.Fatalf("expected %s, got %s", expected, b)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Escalation - action to take once a lock has been waited for a given time.
+//
+// Multiple escalations can be registered for a single lock call, eg. to log a
+// warning after 1s, raise an alert after 10s and give up after 60s, so that
+// applications can degrade gracefully in stages rather than all-or-nothing.
+type Escalation struct {
+	After  time.Duration                           // Time waited after which the escalation fires
+	Func   func(name string, waited time.Duration) // Called when the escalation fires (optional)
+	GiveUp bool                                    // Stop trying to acquire the lock once fired
+}
+
+// LockWithEscalation holds a write lock on dm, firing the escalations as long as
+// the lock is not acquired. Returns false when an escalation gave up.
+func (dm *DRWMutex) LockWithEscalation(escalations ...Escalation) bool {
+
+	isReadLock := false
+	return dm.lockEscalating(isReadLock, escalations)
+}
+
+// RLockWithEscalation holds a read lock on dm, firing the escalations as long as
+// the lock is not acquired. Returns false when an escalation gave up.
+func (dm *DRWMutex) RLockWithEscalation(escalations ...Escalation) bool {
+
+	isReadLock := true
+	return dm.lockEscalating(isReadLock, escalations)
+}
+
+// lockEscalating acquires the lock with the earliest escalation that gives up as
+// deadline, while firing the escalations in the background.
+func (dm *DRWMutex) lockEscalating(isReadLock bool, escalations []Escalation) bool {
+
+	escalations = append([]Escalation(nil), escalations...)
+	sort.SliceStable(escalations, func(i, j int) bool { return escalations[i].After < escalations[j].After })
+
+	// only escalations up to the first one giving up will ever fire
+	start := dm.ds.clock().Now()
+	var deadline time.Time
+	for i, e := range escalations {
+		if e.GiveUp {
+			deadline = start.Add(e.After)
+			escalations = escalations[:i+1]
+			break
+		}
+	}
+
+	done := make(chan struct{})
+	fired := make(chan int)
+	dm.ds.goBackground(func() {
+		n := 0
+		defer func() { fired <- n }()
+		for _, e := range escalations {
+			select {
+			case <-done:
+				return
+			case <-dm.ds.clock().After(e.After - dm.ds.clock().Now().Sub(start)):
+				e.fire(dm.Name)
+				n++
+			}
+		}
+	})
+
+	locked := dm.lockBlocking(context.Background(), isReadLock, deadline)
+	close(done)
+
+	// a lock round does not start when it does not fit before the deadline, so
+	// make sure all escalations up to the one giving up have fired
+	if n := <-fired; !locked {
+		for _, e := range escalations[n:] {
+			e.fire(dm.Name)
+		}
+	}
+	return locked
+}
+
+func (e Escalation) fire(name string) {
+	if e.Func != nil {
+		e.Func(name, e.After)
+	}
+}
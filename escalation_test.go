@@ -0,0 +1,62 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockWithEscalation(t *testing.T) {
+
+	var mutex sync.Mutex
+	var fired []string
+	escalate := func(level string) func(string, time.Duration) {
+		return func(name string, waited time.Duration) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			fired = append(fired, level)
+		}
+	}
+	escalations := []Escalation{
+		{After: 150 * time.Millisecond, Func: escalate("give up"), GiveUp: true},
+		{After: 10 * time.Millisecond, Func: escalate("warn")},
+		{After: 50 * time.Millisecond, Func: escalate("alert")},
+		{After: time.Second, Func: escalate("never")},
+	}
+
+	// Lock is available, nothing fires
+	dm := NewDRWMutex("test-escalation", ds)
+	if !dm.LockWithEscalation(escalations...) {
+		t.Fatal("expected lock to be acquired")
+	}
+
+	// Lock is held, escalations fire in order up to giving up
+	dm2 := NewDRWMutex("test-escalation", ds)
+	if dm2.RLockWithEscalation(escalations...) {
+		t.Fatal("expected read lock not to be acquired")
+	}
+	dm.Unlock()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(fired) != 3 || fired[0] != "warn" || fired[1] != "alert" || fired[2] != "give up" {
+		t.Fatalf("expected warn, alert and give up to fire, got %v", fired)
+	}
+}
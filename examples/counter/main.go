@@ -0,0 +1,121 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Single-writer counter: writers increment a counter using a non-atomic
+// read-modify-write while readers verify that they never see a write in progress.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/dsync"
+	"github.com/minio/dsync/examples/internal/cluster"
+)
+
+var (
+	writersFlag    = flag.Int("writers", 4, "Number of writers")
+	readersFlag    = flag.Int("readers", 4, "Number of readers")
+	incrementsFlag = flag.Int("increments", 25, "Number of increments per writer")
+)
+
+// counter simulates a value in shared storage, updating it takes some time.
+type counter struct {
+	value   int64
+	writing int32 // Set while a write is in progress
+}
+
+func (c *counter) increment() bool {
+	if !atomic.CompareAndSwapInt32(&c.writing, 0, 1) {
+		return false // Another writer is active
+	}
+	v := atomic.LoadInt64(&c.value)
+	time.Sleep(time.Millisecond)
+	atomic.StoreInt64(&c.value, v+1)
+	atomic.StoreInt32(&c.writing, 0)
+	return true
+}
+
+func (c *counter) read() (int64, bool) {
+	return atomic.LoadInt64(&c.value), atomic.LoadInt32(&c.writing) == 0
+}
+
+func main() {
+
+	flag.Parse()
+
+	ds, err := cluster.Start(4)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	c := &counter{}
+	var violations int32
+	done := make(chan struct{})
+
+	var writers, readers sync.WaitGroup
+	for i := 0; i < *writersFlag; i++ {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			dm := dsync.NewDRWMutex("counter", ds)
+			for n := 0; n < *incrementsFlag; n++ {
+				dm.Lock()
+				if !c.increment() {
+					atomic.AddInt32(&violations, 1)
+				}
+				dm.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < *readersFlag; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			dm := dsync.NewDRWMutex("counter", ds)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				dm.RLock()
+				if _, consistent := c.read(); !consistent {
+					atomic.AddInt32(&violations, 1)
+				}
+				dm.RUnlock()
+				// Leave room for writers, as dsync does not prevent writer starvation
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+	}
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	expected := int64(*writersFlag * *incrementsFlag)
+	value, _ := c.read()
+	log.Printf("counter: %d (expected %d), violations: %d", value, expected, violations)
+	if value != expected || violations != 0 {
+		log.Println("SHOULD NOT HAPPEN")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Distributed cron: several scheduler instances fire the same job on every tick,
+// but the job must run exactly once per tick across all of them.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/minio/dsync"
+	"github.com/minio/dsync/examples/internal/cluster"
+)
+
+var (
+	instancesFlag = flag.Int("instances", 3, "Number of scheduler instances")
+	ticksFlag     = flag.Int("ticks", 10, "Number of ticks to run")
+	intervalFlag  = flag.Duration("interval", 200*time.Millisecond, "Interval between ticks")
+)
+
+// jobStore simulates storage shared by all instances, recording for which tick the job last ran.
+type jobStore struct {
+	mutex   sync.Mutex
+	lastRun int
+	runs    map[int][]int // instances that ran the job, per tick
+}
+
+func (s *jobStore) get() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastRun
+}
+
+func (s *jobStore) set(tick, instance int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastRun = tick
+	s.runs[tick] = append(s.runs[tick], instance)
+}
+
+// scheduler fires the job on every tick, the distributed lock makes sure that checking
+// and updating the last run in the store is atomic across all instances.
+func scheduler(ds *dsync.Dsync, instance int, store *jobStore, start time.Time, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	dm := dsync.NewDRWMutex("cron/cleanup", ds)
+	for tick := 1; tick <= *ticksFlag; tick++ {
+		time.Sleep(start.Add(time.Duration(tick) * *intervalFlag).Sub(time.Now()))
+
+		dm.Lock()
+		if store.get() < tick {
+			log.Printf("tick %2d: job run by instance %d", tick, instance)
+			store.set(tick, instance)
+		}
+		dm.Unlock()
+	}
+}
+
+func main() {
+
+	flag.Parse()
+
+	ds, err := cluster.Start(4)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	store := &jobStore{runs: make(map[int][]int)}
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < *instancesFlag; i++ {
+		wg.Add(1)
+		go scheduler(ds, i, store, start, &wg)
+	}
+	wg.Wait()
+
+	// Verify that the job ran exactly once per tick
+	failed := false
+	for tick := 1; tick <= *ticksFlag; tick++ {
+		if len(store.runs[tick]) != 1 {
+			log.Printf("tick %2d: job ran %d times (instances %v) -- SHOULD NOT HAPPEN", tick, len(store.runs[tick]), store.runs[tick])
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+	log.Printf("job ran exactly once for each of the %d ticks", *ticksFlag)
+}
@@ -0,0 +1,81 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cluster starts an in-process cluster of lock servers for the examples.
+package cluster
+
+import (
+	"crypto/tls"
+	"flag"
+	"net"
+	"net/http"
+	"net/rpc"
+
+	"github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+)
+
+var (
+	standaloneFlag = flag.Bool("standalone", false, "Call the lock servers directly instead of over the network")
+	secretFlag     = flag.String("secret", "", "Secret to authenticate the lock requests with, optional")
+	connsFlag      = flag.Int("conns", 2, "Connections to each lock server, see Pool")
+)
+
+// Start launches n lock servers listening on random local ports and returns the
+// cluster with a client for each of them, the first one being the own node.
+// With -standalone the lock servers are called directly instead, with -tls-cert
+// they are reached over TLS and with -secret they require authenticated requests.
+// Each lock server is reached over a Pool of -conns persistent connections.
+func Start(n int) (*dsync.Dsync, error) {
+
+	if *standaloneFlag {
+		return lockserver.Standalone(n, lockserver.Options{})
+	}
+
+	var serverTLS *tls.Config
+	var config ClientConfig
+	if *tlsCertFlag != "" {
+		var err error
+		if serverTLS, config.TLS, err = TLSConfigs(*tlsCertFlag, *tlsKeyFlag, *tlsCAFlag); err != nil {
+			return nil, err
+		}
+	}
+	opts := lockserver.Options{}
+	if *secretFlag != "" {
+		opts.AuthSecret, config.Secret = []byte(*secretFlag), []byte(*secretFlag)
+	}
+
+	var clnts []dsync.RPC
+	for i := 0; i < n; i++ {
+		server := rpc.NewServer()
+		server.RegisterName("Dsync", lockserver.New(opts))
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		addr := l.Addr().String()
+		if serverTLS != nil {
+			l = tls.NewListener(l, serverTLS)
+		}
+		// Serve the RPC server directly (instead of registering it at http.DefaultServeMux)
+		// so that each lock server gets its own listener.
+		go http.Serve(l, server)
+
+		clnts = append(clnts, NewPool(addr, dsync.DefaultPath, *connsFlag, config))
+	}
+
+	return dsync.New(clnts, 0)
+}
@@ -0,0 +1,280 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// RPCClient is a wrapper type for rpc.Client which provides reconnect on first failure.
+type RPCClient struct {
+	// Statistics (see Stats), first for 64-bit alignment
+	calls         int64
+	errors        int64
+	dials         int64
+	bytesSent     int64
+	bytesReceived int64
+
+	mu            sync.Mutex
+	rpcPrivate    *rpc.Client
+	node          string
+	rpcPath       string
+	config        ClientConfig
+	lastCall      time.Time // Protected by mu, like the last error
+	lastError     string
+	lastErrorTime time.Time
+}
+
+// ClientConfig - optional security settings of a RPCClient, and the health checks of a Pool.
+type ClientConfig struct {
+	TLS    *tls.Config // Configuration to connect over TLS, nil for plain TCP
+	Secret []byte      // Secret to sign the token of every call with (see dsync.NewToken), nil for none
+
+	// HealthCheck is the interval at which a Pool checks its connections, 0 for the
+	// default of 10 seconds.
+	HealthCheck time.Duration
+}
+
+// NewClient constructs a RPCClient object with node and rpcPath initialized.
+// It _doesn't_ connect to the remote endpoint. See Call method to see when the
+// connect happens.
+func NewClient(node, rpcPath string) *RPCClient {
+	return &RPCClient{
+		node:    node,
+		rpcPath: rpcPath,
+	}
+}
+
+// NewClientWithConfig constructs a RPCClient like NewClient with the security settings of config.
+func NewClientWithConfig(node, rpcPath string, config ClientConfig) *RPCClient {
+	return &RPCClient{
+		node:    node,
+		rpcPath: rpcPath,
+		config:  config,
+	}
+}
+
+// clearRPCClient clears the pointer to the rpc.Client object in a safe manner
+func (rpcClient *RPCClient) clearRPCClient() {
+	rpcClient.mu.Lock()
+	rpcClient.rpcPrivate = nil
+	rpcClient.mu.Unlock()
+}
+
+// dropRPCClient clears the pointer to the rpc.Client object like clearRPCClient when it
+// still points to c, and closes c.
+func (rpcClient *RPCClient) dropRPCClient(c *rpc.Client) {
+	rpcClient.mu.Lock()
+	if rpcClient.rpcPrivate == c {
+		rpcClient.rpcPrivate = nil
+	}
+	rpcClient.mu.Unlock()
+	c.Close()
+}
+
+// getRPCClient gets the pointer to the rpc.Client object in a safe manner
+func (rpcClient *RPCClient) getRPCClient() *rpc.Client {
+	rpcClient.mu.Lock()
+	rpcLocalStack := rpcClient.rpcPrivate
+	rpcClient.mu.Unlock()
+	return rpcLocalStack
+}
+
+// dialRPCClient tries to establish a connection to the server in a safe manner
+func (rpcClient *RPCClient) dialRPCClient() (*rpc.Client, error) {
+	rpcClient.mu.Lock()
+	defer rpcClient.mu.Unlock()
+	// After acquiring lock, check whether another thread may not have already dialed and established connection
+	if rpcClient.rpcPrivate != nil {
+		return rpcClient.rpcPrivate, nil
+	}
+	rpc, err := rpcClient.dialHTTPPath()
+	if err != nil {
+		return nil, err
+	} else if rpc == nil {
+		return nil, errors.New("No valid RPC Client created after dial")
+	}
+	rpcClient.rpcPrivate = rpc
+	return rpcClient.rpcPrivate, nil
+}
+
+// dialHTTPPath connects to the RPC server at the node listening on the rpcPath like
+// rpc.DialHTTPPath, over TLS when configured, counting the bytes transferred.
+func (rpcClient *RPCClient) dialHTTPPath() (*rpc.Client, error) {
+	var conn net.Conn
+	var err error
+	if rpcClient.config.TLS == nil {
+		conn, err = net.Dial("tcp", rpcClient.node)
+	} else {
+		conn, err = tls.Dial("tcp", rpcClient.node, rpcClient.config.TLS)
+	}
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&rpcClient.dials, 1)
+	conn = &countingConn{Conn: conn, sent: &rpcClient.bytesSent, received: &rpcClient.bytesReceived}
+	io.WriteString(conn, "CONNECT "+rpcClient.rpcPath+" HTTP/1.0\n\n")
+
+	// Require successful HTTP response before switching to RPC protocol
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err == nil && resp.Status == "200 Connected to Go RPC" {
+		return rpc.NewClient(conn), nil
+	}
+	if err == nil {
+		err = errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	conn.Close()
+	return nil, err
+}
+
+// countingConn - connection counting the bytes written and read.
+type countingConn struct {
+	net.Conn
+	sent     *int64
+	received *int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(c.received, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(c.sent, int64(n))
+	return n, err
+}
+
+// Call makes a RPC call to the remote endpoint using the default codec, namely encoding/gob.
+func (rpcClient *RPCClient) Call(serviceMethod string, args interface {
+	SetTimestamp(time.Time)
+	SetToken(string)
+}, reply interface{}) error {
+	err := rpcClient.call(serviceMethod, args, reply)
+
+	atomic.AddInt64(&rpcClient.calls, 1)
+	now := time.Now()
+	rpcClient.mu.Lock()
+	rpcClient.lastCall = now
+	if err != nil {
+		atomic.AddInt64(&rpcClient.errors, 1)
+		rpcClient.lastError, rpcClient.lastErrorTime = err.Error(), now
+	}
+	rpcClient.mu.Unlock()
+	return err
+}
+
+func (rpcClient *RPCClient) call(serviceMethod string, args interface {
+	SetTimestamp(time.Time)
+	SetToken(string)
+}, reply interface{}) error {
+	// Make a copy below so that we can safely (continue to) work with the rpc.Client.
+	// Even in the case the two threads would simultaneously find that the connection is not initialised,
+	// they would both attempt to dial and only one of them would succeed in doing so.
+	rpcLocalStack := rpcClient.getRPCClient()
+
+	// If the rpc.Client is nil, we attempt to (re)connect with the remote endpoint.
+	if rpcLocalStack == nil {
+		var err error
+		rpcLocalStack, err = rpcClient.dialRPCClient()
+		if err != nil {
+			return err
+		}
+	}
+
+	if rpcClient.config.Secret != nil {
+		args.SetToken(dsync.NewToken(rpcClient.config.Secret))
+	}
+
+	// If the RPC fails due to a network-related error, then we reset
+	// rpc.Client for a subsequent reconnect.
+	err := rpcLocalStack.Call(serviceMethod, args, reply)
+	if err != nil {
+		if err.Error() == rpc.ErrShutdown.Error() {
+			// Reset rpcClient.rpc to nil to trigger a reconnect in future
+			// and close the underlying connection.
+			rpcClient.clearRPCClient()
+
+			// Close the underlying connection.
+			rpcLocalStack.Close()
+
+			// Set rpc error as rpc.ErrShutdown type.
+			err = rpc.ErrShutdown
+		} else if err == io.ErrUnexpectedEOF || err == io.EOF {
+			// The connection broke while the call was in flight: reconnect on the
+			// next call instead of failing it with rpc.ErrShutdown first. Other calls
+			// in flight fail likewise, only drop the connection when no call has
+			// reconnected meanwhile.
+			rpcClient.dropRPCClient(rpcLocalStack)
+		}
+	}
+	return err
+}
+
+// Close closes the underlying socket file descriptor.
+func (rpcClient *RPCClient) Close() error {
+	// See comment above for making a copy on local stack
+	rpcLocalStack := rpcClient.getRPCClient()
+
+	// If rpc client has not connected yet there is nothing to close.
+	if rpcLocalStack == nil {
+		return nil
+	}
+
+	// Reset rpcClient.rpc to allow for subsequent calls to use a new
+	// (socket) connection.
+	rpcClient.clearRPCClient()
+	return rpcLocalStack.Close()
+}
+
+func (rpcClient *RPCClient) Node() string {
+	return rpcClient.node
+}
+
+func (rpcClient *RPCClient) RPCPath() string {
+	return rpcClient.rpcPath
+}
+
+// Stats returns a snapshot of the statistics of the calls made and of the connections to
+// the remote endpoint, see dsync.StatsReporter.
+func (rpcClient *RPCClient) Stats() dsync.ClientStats {
+	s := dsync.ClientStats{
+		Calls:         atomic.LoadInt64(&rpcClient.calls),
+		Errors:        atomic.LoadInt64(&rpcClient.errors),
+		BytesSent:     atomic.LoadInt64(&rpcClient.bytesSent),
+		BytesReceived: atomic.LoadInt64(&rpcClient.bytesReceived),
+	}
+	if dials := atomic.LoadInt64(&rpcClient.dials); dials > 1 {
+		s.Reconnects = dials - 1
+	}
+	rpcClient.mu.Lock()
+	s.LastCall, s.LastError, s.LastErrorTime = rpcClient.lastCall, rpcClient.lastError, rpcClient.lastErrorTime
+	rpcClient.mu.Unlock()
+	return s
+}
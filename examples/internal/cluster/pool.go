@@ -0,0 +1,187 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// defaultHealthCheck - interval of the health checks of a Pool when not configured.
+const defaultHealthCheck = 10 * time.Second
+
+// Pool - dsync.RPC spreading the calls to a lock server round-robin over a pool of
+// persistent connections, each of them a RPCClient. The connections are checked in the
+// background with the Version RPC: a connection that does not answer within the
+// interval of the health checks is closed and dialed again, and is skipped by the calls
+// until it answers again, so that the lock requests neither wait on a dial nor on a
+// connection that silently hangs.
+type Pool struct {
+	clients []*RPCClient
+	healthy []int32 // Per connection, 1 when it answered its last health check
+	next    uint32
+	closed  int32
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     sync.WaitGroup
+}
+
+// NewPool returns a Pool of size connections to the lock server at node and rpcPath with
+// the settings of config. The connections are dialed by the first health check, which is
+// made right away; the health checks stop on Close.
+func NewPool(node, rpcPath string, size int, config ClientConfig) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	interval := config.HealthCheck
+	if interval <= 0 {
+		interval = defaultHealthCheck
+	}
+	p := &Pool{healthy: make([]int32, size), stop: make(chan struct{})}
+	for i := 0; i < size; i++ {
+		p.clients = append(p.clients, NewClientWithConfig(node, rpcPath, config))
+		p.healthy[i] = 1 // Until proven otherwise, the calls dial on demand
+	}
+	p.done.Add(1)
+	go p.healthChecks(interval)
+	return p
+}
+
+// healthChecks checks all connections of the pool every interval until the pool is closed.
+func (p *Pool) healthChecks(interval time.Duration) {
+	defer p.done.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for i := range p.clients {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				p.check(i, interval)
+			}(i)
+		}
+		wg.Wait()
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check checks the i-th connection of the pool, (re)connecting it when needed, and
+// closes it when it does not answer within timeout so that it is dialed again.
+func (p *Pool) check(i int, timeout time.Duration) {
+	c := p.clients[i]
+	errc := make(chan error, 1)
+	go func() {
+		var v dsync.VersionInfo
+		errc <- c.call("Dsync.Version", &dsync.VersionArgs{}, &v)
+	}()
+	var err error
+	select {
+	case err = <-errc:
+	case <-time.After(timeout):
+		err = rpc.ErrShutdown
+		// Fail the calls stuck on the connection, the next call reconnects
+		if conn := c.getRPCClient(); conn != nil {
+			c.dropRPCClient(conn)
+		}
+	case <-p.stop:
+		// Do not leave a connection dialed by the check behind once the pool is closed
+		go func() {
+			<-errc
+			c.Close()
+		}()
+		return
+	}
+	if err != nil {
+		atomic.StoreInt32(&p.healthy[i], 0)
+	} else {
+		atomic.StoreInt32(&p.healthy[i], 1)
+	}
+}
+
+// Call makes the RPC call on the next healthy connection of the pool, or on the next
+// connection when none is healthy. It fails with rpc.ErrShutdown once the pool is closed.
+func (p *Pool) Call(serviceMethod string, args interface {
+	SetTimestamp(time.Time)
+	SetToken(string)
+}, reply interface{}) error {
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return rpc.ErrShutdown
+	}
+	n := uint32(len(p.clients))
+	start := atomic.AddUint32(&p.next, 1)
+	i := start % n
+	for j := uint32(0); j < n; j++ {
+		if atomic.LoadInt32(&p.healthy[(start+j)%n]) == 1 {
+			i = (start + j) % n
+			break
+		}
+	}
+	return p.clients[i].Call(serviceMethod, args, reply)
+}
+
+// Close stops the health checks and closes all connections of the pool.
+func (p *Pool) Close() error {
+	atomic.StoreInt32(&p.closed, 1)
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.done.Wait()
+	var err error
+	for _, c := range p.clients {
+		if e := c.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (p *Pool) Node() string {
+	return p.clients[0].Node()
+}
+
+func (p *Pool) RPCPath() string {
+	return p.clients[0].RPCPath()
+}
+
+// Stats returns the statistics of all connections of the pool added up, see
+// dsync.StatsReporter.
+func (p *Pool) Stats() dsync.ClientStats {
+	var s dsync.ClientStats
+	for _, c := range p.clients {
+		cs := c.Stats()
+		s.Calls += cs.Calls
+		s.Errors += cs.Errors
+		s.Reconnects += cs.Reconnects
+		s.BytesSent += cs.BytesSent
+		s.BytesReceived += cs.BytesReceived
+		if cs.LastCall.After(s.LastCall) {
+			s.LastCall = cs.LastCall
+		}
+		if cs.LastErrorTime.After(s.LastErrorTime) {
+			s.LastError, s.LastErrorTime = cs.LastError, cs.LastErrorTime
+		}
+	}
+	return s
+}
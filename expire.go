@@ -0,0 +1,69 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ExpirePrefixArgs - arguments for the ExpirePrefix RPC.
+type ExpirePrefixArgs struct {
+	AuthArgs
+	Prefix string `json:"prefix"` // Expire all locks with names starting with prefix
+	DryRun bool   `json:"dryRun"` // Only list the locks that would be expired
+}
+
+// ExpirePrefix releases all locks (irrespective of write or read lock) with names
+// starting with prefix at all nodes, eg. to clean up after deleting a bucket. With
+// dryRun set no locks are released, only listed. Returns the locks expired per node
+// and an error when less than a quorum of the nodes could be reached.
+//
+// Locks are expired underneath their holders, so this should only be used for names
+// that are no longer in use.
+func (ds *Dsync) ExpirePrefix(prefix string, dryRun bool) ([]NodeSnapshot, error) {
+
+	if prefix == "" {
+		return nil, errors.New("Refusing to expire locks for empty prefix")
+	}
+
+	m := ds.membership()
+	nodes := m.nodes()
+	expired := make([]NodeSnapshot, len(nodes))
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			var reply SnapshotReply
+			expired[i].Node = m.node(index)
+			expired[i].Err = ds.call(index, "Dsync.ExpirePrefix", &ExpirePrefixArgs{Prefix: prefix, DryRun: dryRun}, &reply)
+			expired[i].Entries = reply.Entries
+			ch <- i
+		}(i, index)
+	}
+	reached := 0
+	for range nodes {
+		if i := <-ch; expired[i].Err == nil {
+			reached++
+		}
+	}
+
+	if reached < m.quorum {
+		return expired, fmt.Errorf("Expiring locks for prefix %s reached only %d of %d nodes", prefix, reached, m.count)
+	}
+	return expired, nil
+}
@@ -0,0 +1,55 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"testing"
+)
+
+func TestExpirePrefix(t *testing.T) {
+
+	// Locks that are never released by their holders
+	NewDRWMutex("test-expire/a", ds).Lock()
+	NewDRWMutex("test-expire/b", ds).RLock()
+	NewDRWMutex("test-expire-not/c", ds).Lock()
+
+	if _, err := ds.ExpirePrefix("", false); err == nil {
+		t.Fatal("expected error for empty prefix")
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		expired, err := ds.ExpirePrefix("test-expire/", dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range expired {
+			if e.Err != nil || len(e.Entries) != 2 {
+				t.Fatalf("dry run %v: expected 2 locks expired at node %s, got %v (%v)", dryRun, e.Node, e.Entries, e.Err)
+			}
+		}
+	}
+
+	if expired, _ := ds.ExpirePrefix("test-expire/", true); len(expired[0].Entries) != 0 {
+		t.Fatalf("expected no locks left, got %v", expired[0].Entries)
+	}
+
+	// Locks can be acquired again once expired
+	dm := NewDRWMutex("test-expire/a", ds)
+	dm.Lock()
+	dm.Unlock()
+}
@@ -0,0 +1,51 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import "time"
+
+// Internals exported for the tests in package dsync_test.
+var (
+	RoundTimeout  = roundTimeout
+	BackOffBudget = backOffBudget
+)
+
+// RetryDelay returns the back-off of p after the given (failed) round.
+func RetryDelay(p RetryPolicy, round int) time.Duration {
+	return p.delay(round, NewSeededRand(time.Now().UnixNano()))
+}
+
+// NewTokenIssued returns a token signed with secret like NewToken, issued at the given time.
+func NewTokenIssued(secret []byte, issued time.Time) string {
+	return newToken(secret, issued)
+}
+
+// Random returns the source of randomness of ds.
+func (ds *Dsync) Random() Rand {
+	return ds.random()
+}
+
+// ReplicaNodes returns the indices of the nodes the lock on name is placed on.
+func (ds *Dsync) ReplicaNodes(name string) []int {
+	return ds.replicaNodes(ds.membership(), name)
+}
+
+// NewRing returns a function returning the n nodes name is placed on by a hash ring
+// of the nodes with ids.
+func NewRing(ids []string) func(name string, n int) []int {
+	return newRing(ids).replicas
+}
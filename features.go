@@ -0,0 +1,114 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import "strings"
+
+// Features - bitmap of optional capabilities of the lock protocol.
+//
+// Clients and lock servers exchange their features through the Version RPC;
+// a client only relies on a capability when the lock server supports it too.
+type Features uint64
+
+const (
+	FeatureTTL      Features = 1 << iota // Grants expire unless refreshed by the client
+	FeatureQueueing                      // Lock requests can wait in a queue at the lock server
+	FeatureBatching                      // Multiple names can be (un)locked in a single request
+	FeatureDryRun                        // Lock requests can be checked without granting the lock
+)
+
+var featureNames = []struct {
+	f    Features
+	name string
+}{
+	{FeatureTTL, "ttl"},
+	{FeatureQueueing, "queueing"},
+	{FeatureBatching, "batching"},
+	{FeatureDryRun, "dryrun"},
+}
+
+// Features supported by this version of the library.
+var supportedFeatures = FeatureTTL | FeatureBatching | FeatureDryRun
+
+// Has returns true when all features in f2 are set in f.
+func (f Features) Has(f2 Features) bool {
+	return f&f2 == f2
+}
+
+// String returns a comma separated list of the names of the features.
+func (f Features) String() string {
+	var names []string
+	for _, fn := range featureNames {
+		if f.Has(fn.f) {
+			names = append(names, fn.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+func (ds *Dsync) setNodeFeatures(index int, f Features) {
+	c := ds.membership().client(index)
+	if c == nil {
+		return
+	}
+	c.featuresMutex.Lock()
+	defer c.featuresMutex.Unlock()
+	c.features = &f
+}
+
+// Negotiate (re)queries all lock servers for their features, eg. after a rolling
+// upgrade, and returns the features that each server shares with this client.
+func (ds *Dsync) Negotiate() []Features {
+	versions := ds.Versions()
+	features := make([]Features, len(versions))
+	for index, v := range versions {
+		if v.Err == nil {
+			features[index] = v.Features & supportedFeatures
+		}
+	}
+	return features
+}
+
+// negotiatedFeatures returns the features both this client and the lock server at
+// index support. Features are negotiated lazily when first needed, so lock servers
+// that cannot be reached (yet) are assumed to support no optional features at all.
+func (ds *Dsync) negotiatedFeatures(index int) Features {
+	c := ds.membership().client(index)
+	if c == nil {
+		return 0
+	}
+	c.featuresMutex.Lock()
+	f := c.features
+	c.featuresMutex.Unlock()
+	if f != nil {
+		return *f & supportedFeatures
+	}
+
+	var v VersionInfo
+	if err := ds.call(index, "Dsync.Version", &VersionArgs{Features: supportedFeatures}, &v); err != nil {
+		if strings.Contains(err.Error(), "can't find method") {
+			// Older lock server that predates the Version RPC
+			ds.setNodeFeatures(index, 0)
+		}
+		return 0
+	}
+	ds.setNodeFeatures(index, v.Features)
+	return v.Features & supportedFeatures
+}
@@ -0,0 +1,57 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"testing"
+	. "github.com/minio/dsync"
+)
+
+func TestFeaturesString(t *testing.T) {
+
+	testCases := []struct {
+		f        Features
+		expected string
+	}{
+		{0, "none"},
+		{FeatureTTL, "ttl"},
+		{FeatureTTL | FeatureBatching, "ttl,batching"},
+	}
+	for _, tc := range testCases {
+		if tc.f.String() != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, tc.f.String())
+		}
+	}
+
+	if !(FeatureTTL | FeatureQueueing).Has(FeatureQueueing) || FeatureTTL.Has(FeatureTTL|FeatureQueueing) {
+		t.Error("Has returned unexpected result")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+
+	features := ds.Negotiate()
+	if len(features) != N {
+		t.Fatalf("expected %d feature sets, got %d", N, len(features))
+	}
+	for i, f := range features {
+		// Test servers run the same version of the library, so they share all features
+		if f != LocalVersion().Features {
+			t.Errorf("node %d: expected %s, got %s", i, LocalVersion().Features, f)
+		}
+	}
+}
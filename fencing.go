@@ -0,0 +1,95 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"time"
+)
+
+// Prefix of the names of the sequences fencing tokens are taken from, so that they
+// never collide with a sequence of the same name taken with NextSequence.
+const fencePrefix = "fence" + NamespaceSeparator
+
+// Maximum back-off between attempts to take a fencing token.
+const maxFenceBackOff = time.Second
+
+// LockFenced holds a write lock on dm, like Lock, and returns a fencing token: a number
+// strictly greater than the tokens returned to all previous holders of the lock, in this
+// or any other process. Pass the token along with every write to a downstream storage
+// system that rejects writes carrying a lower token than the highest one it has seen, so
+// that a holder that lost the lock without noticing (eg. paused by garbage collection
+// while its lease expired) can no longer overwrite the writes of the next holder.
+//
+// The token is taken from a sequence of the name (see NextSequence) once the lock is
+// held, which costs another round to the nodes. When the lock is revoked meanwhile, it
+// is released and acquired anew.
+func (dm *DRWMutex) LockFenced() uint64 {
+
+	isReadLock := false
+	return dm.lockFenced(isReadLock)
+}
+
+// RLockFenced holds a read lock on dm, like RLock, and returns a fencing token like
+// LockFenced. Concurrent readers get distinct tokens, all greater than the token of the
+// writer before them and lower than the token of the writer after them.
+func (dm *DRWMutex) RLockFenced() uint64 {
+
+	isReadLock := true
+	return dm.lockFenced(isReadLock)
+}
+
+func (dm *DRWMutex) lockFenced(isReadLock bool) uint64 {
+	for {
+		if isReadLock {
+			dm.RLock()
+		} else {
+			dm.Lock()
+		}
+		revoked := dm.Revoked()
+
+		token := dm.ds.fencingToken(dm.Name)
+
+		select {
+		case <-revoked:
+			// Another client may have been granted the lock (and a token) meanwhile
+			if isReadLock {
+				dm.RUnlock()
+			} else {
+				dm.Unlock()
+			}
+		default:
+			return token
+		}
+	}
+}
+
+// fencingToken takes the next fencing token of the lock on name, retrying with a
+// randomized back-off until a quorum of the nodes can be reached.
+func (ds *Dsync) fencingToken(name string) uint64 {
+	backOff := time.Millisecond
+	for {
+		token, err := ds.NextSequence(fencePrefix + name)
+		if err == nil {
+			return token
+		}
+		ds.logMessage(dsyncLog, LevelDebug, "Unable to take fencing token", Fields{"name": name, "error": err})
+		ds.clock().Sleep(time.Duration(ds.random().Float64() * float64(backOff)))
+		if backOff < maxFenceBackOff {
+			backOff *= 2
+		}
+	}
+}
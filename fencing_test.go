@@ -0,0 +1,72 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/minio/dsync"
+)
+
+func TestLockFenced(t *testing.T) {
+
+	// Tokens increase in the order the lock is held, whichever mutex holds it
+	var tokens []uint64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dm := NewDRWMutex("test-fenced", ds)
+			for j := 0; j < 5; j++ {
+				token := dm.LockFenced()
+				tokens = append(tokens, token)
+				dm.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i] <= tokens[i-1] {
+			t.Fatalf("expected tokens to increase, got %d after %d", tokens[i], tokens[i-1])
+		}
+	}
+
+	// Concurrent readers get distinct tokens, between those of the writers around them
+	dm := NewDRWMutex("test-fenced", ds)
+	before := dm.LockFenced()
+	dm.Unlock()
+
+	first, second := dm.RLockFenced(), dm.RLockFenced()
+	if first == second || first <= before || second <= before {
+		t.Fatalf("expected distinct read tokens above %d, got %d and %d", before, first, second)
+	}
+	dm.RUnlock()
+	dm.RUnlock()
+
+	if after := dm.LockFenced(); after <= first || after <= second {
+		t.Fatalf("expected write token above %d and %d, got %d", first, second, after)
+	}
+	dm.Unlock()
+
+	// Fencing tokens are not taken from the sequence of the same name
+	if v, err := ds.NextSequence("test-fenced"); err != nil || v != 1 {
+		t.Fatalf("expected sequence to start at 1, got %d (%v)", v, err)
+	}
+}
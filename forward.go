@@ -0,0 +1,250 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ForwardArgs - arguments for the Forward RPC, a lock request a client forwards to a lock
+// server which requests the lock from the nodes it is placed on (see SetForwarding).
+type ForwardArgs struct {
+	AuthArgs
+	Name     string            `json:"name"`               // Name of the resource
+	Node     string            `json:"node,omitempty"`     // Network address of the client requesting the lock
+	RPCPath  string            `json:"rpcPath,omitempty"`  // RPC path of the client requesting the lock
+	ReadLock bool              `json:"readLock"`           // Read rather than write lock
+	Mode     LockMode          `json:"mode,omitempty"`     // Mode of the lock, empty for older clients (see ReadLock)
+	Priority int               `json:"priority,omitempty"` // Priority of the request, see PriorityKey
+	Tenant   string            `json:"tenant,omitempty"`   // Tenant on whose behalf the request is made, see TenantKey
+	Wait     time.Duration     `json:"wait,omitempty"`     // Timeout of the lock round, zero for the default
+	Release  []string          `json:"release,omitempty"`  // Locks to release (by index of the node) instead of acquiring the lock
+	Force    bool              `json:"force,omitempty"`    // Forcefully clear the lock instead of acquiring it
+	Owner    string            `json:"owner,omitempty"`    // Uid of the DRWMutex requesting the lock
+	Source   string            `json:"source,omitempty"`   // File:line of the caller requesting the lock
+	Tags     map[string]string `json:"tags,omitempty"`     // Tags of the request, see TagsKey
+}
+
+// ForwardReply - reply for the Forward RPC.
+type ForwardReply struct {
+	Granted bool     `json:"granted"`         // Whether the lock was granted by a quorum of the nodes
+	Locks   []string `json:"locks,omitempty"` // Uids of the locks granted, by index of the node
+	Err     string   `json:"err,omitempty"`   // Responses of the nodes when the lock was not granted
+}
+
+// SetForwarding forwards the lock requests of this process to the lock server at index,
+// which requests the locks from the nodes they are placed on and replies with the outcome
+// (see Forward), instead of requesting them from all nodes directly. Clients behind
+// restrictive networks thus only need to reach a single lock server to acquire and release
+// locks, at the expense of an extra hop. Passing -1 disables forwarding again.
+//
+// Lock servers still record the client as the holder of a forwarded lock, so that lock
+// maintenance checks back with the client's node, whereas the leases of forwarded locks
+// are refreshed by the node the request was forwarded to.
+func (ds *Dsync) SetForwarding(index int) error {
+	if index == -1 {
+		return ds.SetCoordinators()
+	}
+	return ds.SetCoordinators(index)
+}
+
+// SetCoordinators forwards the lock requests of this process to the first of the lock
+// servers at indexes (the coordinator) like SetForwarding, failing over to the next one
+// whenever the coordinator cannot be reached. In huge fleets clients thereby only connect
+// to the coordinators (provided their RPC clients connect lazily), which execute the quorum
+// fan-out on their behalf. Calling it without any index disables forwarding again.
+//
+// A lock request that fails over may have been granted by the unreachable coordinator
+// nonetheless, in which case its locks are reclaimed by lock maintenance, as the client
+// does not know of them.
+func (ds *Dsync) SetCoordinators(indexes ...int) error {
+	m := ds.membership()
+	for _, index := range indexes {
+		if m.client(index) == nil {
+			return &ConfigError{"Index of node is out of range"}
+		}
+	}
+	var c *coordinators
+	if len(indexes) > 0 {
+		c = &coordinators{nodes: append([]int(nil), indexes...)}
+	}
+	ds.forwarding.Store(c)
+	return nil
+}
+
+// coordinators - the nodes lock requests are forwarded to, in order of preference.
+type coordinators struct {
+	nodes   []int
+	current int32 // Position in nodes of the coordinator requests are forwarded to
+}
+
+// forwardingNode returns the index of the node that lock requests are forwarded to.
+func (ds *Dsync) forwardingNode() (int, bool) {
+	c, _ := ds.forwarding.Load().(*coordinators)
+	if c == nil {
+		return -1, false
+	}
+	return c.nodes[atomic.LoadInt32(&c.current)], true
+}
+
+// failover moves on to the next coordinator when the one at index could not be reached,
+// returning the index of the node to forward to instead or false if there is none. Calls
+// that failed concurrently only move on once.
+func (ds *Dsync) failover(index int) (int, bool) {
+	c, _ := ds.forwarding.Load().(*coordinators)
+	if c == nil || len(c.nodes) < 2 {
+		return -1, false
+	}
+	current := atomic.LoadInt32(&c.current)
+	if c.nodes[current] == index {
+		atomic.CompareAndSwapInt32(&c.current, current, (current+1)%int32(len(c.nodes)))
+	}
+	next := c.nodes[atomic.LoadInt32(&c.current)]
+	ds.logMessage(dsyncLog, LevelWarn, "Failing over to another coordinator", Fields{"from": index, "to": next})
+	return next, next != index
+}
+
+// Forward executes a lock request forwarded by a client: it requests the lock from the
+// nodes it is placed on, on behalf of the client, and replies with the locks granted (or
+// releases the locks given). To be called by the lock server of this node, see the Forward
+// RPC and Options.Client of package lockserver.
+func (ds *Dsync) Forward(args *ForwardArgs, reply *ForwardReply) error {
+	if ds.singleNode {
+		return errors.New("Forwarding is not supported in single-node mode")
+	}
+	if args.Name == "" {
+		return errors.New("Name is required")
+	}
+	if err := CheckMode(args.Mode, ModeOf(!args.ReadLock)); err != nil {
+		return err
+	}
+
+	m := ds.membership()
+	switch {
+	case args.Force:
+		for _, index := range m.nodes() {
+			ds.sendRelease(index, args.Name, "", false)
+		}
+		reply.Granted = true
+		return nil
+	case len(args.Release) > 0:
+		for index, uid := range args.Release {
+			if isLocked(uid) {
+				ds.sendRelease(index, args.Name, uid, args.ReadLock)
+			}
+		}
+		reply.Granted = true
+		return nil
+	}
+
+	timeout := args.Wait
+	if timeout <= 0 || timeout > DRWMutexAcquireTimeout {
+		timeout = DRWMutexAcquireTimeout
+	}
+	meta := lockMetadata{priority: args.Priority, tenant: args.Tenant, node: args.Node, rpcPath: args.RPCPath,
+		owner: args.Owner, source: args.Source, tags: args.Tags}
+	locks := make([]string, len(m.clnts))
+	granted, err := ds.lock(context.Background(), m, &locks, args.Name, args.ReadLock, timeout, meta)
+	reply.Granted = granted
+	if granted {
+		reply.Locks = locks
+	} else if err != nil {
+		reply.Err = err.Error()
+	}
+	return nil
+}
+
+// forwardLock forwards the lock request to the node at index, or the coordinators failed
+// over to, see lock.
+func (ds *Dsync) forwardLock(ctx context.Context, index int, m *members, locks *[]string, lockName string, isReadLock bool, timeout time.Duration, meta lockMetadata) (bool, error) {
+
+	args := ForwardArgs{Name: lockName, Node: m.clnts[m.ownNode].Node(), RPCPath: m.clnts[m.ownNode].RPCPath(),
+		ReadLock: isReadLock, Mode: ModeOf(!isReadLock), Priority: meta.priority, Tenant: meta.tenant, Wait: timeout,
+		Owner: meta.owner, Source: meta.source, Tags: meta.tags}
+	var reply ForwardReply
+	start := ds.clock().Now()
+	if meta.latency != nil {
+		// The round of the coordinator is opaque to the client, so it counts as fan-out
+		defer func() {
+			meta.latency.FanOut += ds.clock().Now().Sub(start)
+		}()
+	}
+	for attempt := 0; ; attempt++ {
+		callStart := ds.clock().Now()
+		err := ds.call(index, "Dsync.Forward", &args, &reply)
+		if meta.span != nil {
+			outcome := OutcomeDenied
+			if err != nil {
+				outcome = OutcomeError
+			} else if reply.Granted {
+				outcome = OutcomeGranted
+			}
+			meta.span.Call(m.node(index), "Dsync.Forward", callStart, ds.clock().Now().Sub(callStart), outcome, err)
+		}
+		if err == nil {
+			break
+		}
+		meta.tracef("forwarded to node %s: error after %v: %v", m.node(index), ds.clock().Now().Sub(start), err)
+		next, ok := ds.failover(index)
+		if !ok || attempt+1 >= len(m.clnts) || ctx.Err() != nil {
+			return false, err
+		}
+		index = next
+	}
+	meta.tracef("forwarded to node %s: granted=%v after %v", m.node(index), reply.Granted, ds.clock().Now().Sub(start))
+	if !reply.Granted {
+		return false, fmt.Errorf("Lock request for %s forwarded to %s was not granted: %s", lockName, m.node(index), reply.Err)
+	}
+	if len(reply.Locks) != len(*locks) {
+		// The coordinator knows other nodes than this process, so the locks granted
+		// cannot be released through them: have the coordinator release them right away
+		ds.forwardRelease(index, reply.Locks, lockName, isReadLock, false)
+		return false, fmt.Errorf("Lock request for %s forwarded to %s was granted by %d nodes, expected %d: membership differs",
+			lockName, m.node(index), len(reply.Locks), len(*locks))
+	}
+	copy(*locks, reply.Locks)
+
+	if ctx.Err() != nil {
+		// The caller gave up meanwhile, so release the locks granted
+		ds.forwardRelease(index, *locks, lockName, isReadLock, false)
+		return false, ctx.Err()
+	}
+	return true, nil
+}
+
+// forwardRelease forwards the release of the locks (or a forced unlock) to the node at index,
+// or the coordinators failed over to.
+func (ds *Dsync) forwardRelease(index int, locks []string, name string, isReadLock, force bool) error {
+	args := ForwardArgs{Name: name, ReadLock: isReadLock, Mode: ModeOf(!isReadLock), Release: locks, Force: force}
+	var reply ForwardReply
+	for attempt := 0; ; attempt++ {
+		err := ds.call(index, "Dsync.Forward", &args, &reply)
+		if err == nil {
+			return nil
+		}
+		ds.logMessage(dsyncLog, LevelDebug, "Unable to call Dsync.Forward", Fields{"name": name, "node": ds.membership().node(index), "error": err})
+		next, ok := ds.failover(index)
+		if !ok || attempt+1 >= len(ds.membership().clnts) {
+			return err
+		}
+		index = next
+	}
+}
@@ -0,0 +1,154 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"errors"
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForwarding(t *testing.T) {
+
+	var mutex sync.Mutex
+	called := make(map[string]int)
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*ForwardArgs); ok && a.Name == "test-forwarding" {
+			mutex.Lock()
+			called[c.Node()]++
+			mutex.Unlock()
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	if err := ds.SetForwarding(N); err == nil {
+		t.Fatal("expected forwarding to a node out of range to fail")
+	}
+	if err := ds.SetForwarding(N - 1); err != nil {
+		t.Fatal(err)
+	}
+	defer ds.SetForwarding(-1)
+
+	dm := NewDRWMutex("test-forwarding", ds)
+	dm.Lock()
+
+	mutex.Lock()
+	if len(called) != 1 || called[nodes[N-1]] != 1 {
+		t.Fatalf("expected the lock request to be forwarded to %s, got %v", nodes[N-1], called)
+	}
+	mutex.Unlock()
+
+	if NewDRWMutex("test-forwarding", ds).TryLock() {
+		t.Fatal("expected forwarded lock to be held")
+	}
+	dm.Unlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for dm2 := NewDRWMutex("test-forwarding", ds); !dm2.TryLock(); {
+		if time.Now().After(deadline) {
+			t.Fatal("expected forwarded lock to be released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	dm.ForceUnlock()
+}
+
+func TestCoordinatorFailover(t *testing.T) {
+
+	var mutex sync.Mutex
+	called := make(map[string]int)
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*ForwardArgs); ok && a.Name == "test-coordinators" {
+			mutex.Lock()
+			called[c.Node()]++
+			mutex.Unlock()
+			if c.Node() == nodes[0] {
+				return errors.New("coordinator unreachable")
+			}
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	if err := ds.SetCoordinators(0, N); err == nil {
+		t.Fatal("expected a coordinator out of range to fail")
+	}
+	if err := ds.SetCoordinators(0, N-1); err != nil {
+		t.Fatal(err)
+	}
+	defer ds.SetCoordinators()
+
+	dm := NewDRWMutex("test-coordinators", ds)
+	if !dm.LockWithTimeout(time.Second) {
+		t.Fatal("expected lock to be granted by the second coordinator")
+	}
+	dm.Unlock()
+
+	// Once failed over, requests go to the second coordinator right away
+	dm = NewDRWMutex("test-coordinators", ds)
+	if !dm.LockWithTimeout(time.Second) {
+		t.Fatal("expected lock to be granted by the second coordinator")
+	}
+	dm.ForceUnlock()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if called[nodes[0]] != 1 {
+		t.Fatalf("expected a single request to the first coordinator, got %v", called)
+	}
+	if called[nodes[N-1]] < 3 {
+		t.Fatalf("expected lock and unlock requests to fail over to %s, got %v", nodes[N-1], called)
+	}
+}
+
+func TestForwardingMembershipMismatch(t *testing.T) {
+
+	// The coordinator has two more nodes than the client forwarding to it
+	clnts, stop, _ := newLockServers(6, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	cds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cds.Close()
+	coordinator := lockserver.New(lockserver.Options{Client: cds})
+	defer coordinator.Close()
+
+	fds, err := New(append([]RPC{NewLocalClient("coordinator", coordinator)}, clnts[1:4]...), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fds.Close()
+	if err := fds.SetForwarding(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if NewDRWMutex("test-forwarding-mismatch", fds).TryLock() {
+		t.Fatal("expected lock granted by other nodes than known to be refused")
+	}
+
+	// The locks granted were released rather than left until lock maintenance
+	if !NewDRWMutex("test-forwarding-mismatch", cds).TryLock() {
+		t.Fatal("expected the locks granted by the coordinator to be released")
+	}
+}
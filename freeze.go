@@ -0,0 +1,126 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"errors"
+	"fmt"
+)
+
+// FreezeArgs - arguments for the Freeze RPC.
+type FreezeArgs struct {
+	AuthArgs
+	Name     string `json:"name,omitempty"` // Name to (un)freeze, leave empty to only list the frozen names
+	Unfreeze bool   `json:"unfreeze"`       // Unfreeze rather than freeze the name
+	Operator string `json:"operator"`       // Operator (un)freezing the name, for the audit log
+	Reason   string `json:"reason"`         // Reason for (un)freezing the name, for the audit log
+}
+
+// FreezeReply - reply for the Freeze RPC, all names frozen at a lock server.
+type FreezeReply struct {
+	Names []string `json:"names"`
+}
+
+// NodeFrozen - the names frozen at (or the error retrieving them from) a single node.
+type NodeFrozen struct {
+	Node  string
+	Names []string
+	Err   error
+}
+
+// Freeze administratively freezes name at all nodes on behalf of an operator, eg. while
+// investigating corruption of the protected resource. All lock requests for a frozen name
+// are denied (with OutcomeFrozen) until it is unfrozen; locks already held are not affected.
+// Lock servers persist the frozen names and record the change in their audit log.
+//
+// An error is returned when less than a quorum of the nodes froze the name, in which case
+// locks on name can still be granted.
+func (ds *Dsync) Freeze(name, operator, reason string) error {
+	return ds.freeze(name, false, operator, reason)
+}
+
+// Unfreeze lifts a freeze of name (see Freeze) at all nodes on behalf of an operator.
+//
+// An error is returned when not all nodes unfroze the name, in which case lock requests
+// can still be refused until the remaining nodes are unfrozen.
+func (ds *Dsync) Unfreeze(name, operator, reason string) error {
+	return ds.freeze(name, true, operator, reason)
+}
+
+func (ds *Dsync) freeze(name string, unfreeze bool, operator, reason string) error {
+
+	if name == "" {
+		return errors.New("Name is required")
+	}
+	if operator == "" || reason == "" {
+		return errors.New("Operator and reason are required for the audit log")
+	}
+
+	m := ds.membership()
+	nodes := m.nodes()
+	errs := make([]error, len(nodes))
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			var reply FreezeReply
+			args := FreezeArgs{Name: name, Unfreeze: unfreeze, Operator: operator, Reason: reason}
+			errs[i] = ds.call(index, "Dsync.Freeze", &args, &reply)
+			ch <- i
+		}(i, index)
+	}
+	for range nodes {
+		<-ch
+	}
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", m.node(nodes[i]), err))
+		}
+	}
+	if unfreeze && len(failed) > 0 {
+		return fmt.Errorf("Unfreeze of %q failed at %d of %d nodes: %v", name, len(failed), m.count, failed)
+	} else if m.count-len(failed) < m.quorum {
+		return fmt.Errorf("Freeze of %q reached less than a quorum of %d nodes: %v", name, m.quorum, failed)
+	}
+	return nil
+}
+
+// FrozenNames retrieves the frozen names of all nodes.
+func (ds *Dsync) FrozenNames() []NodeFrozen {
+
+	m := ds.membership()
+	nodes := m.nodes()
+	frozen := make([]NodeFrozen, len(nodes))
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			var reply FreezeReply
+			frozen[i].Node = m.node(index)
+			frozen[i].Err = ds.call(index, "Dsync.Freeze", &FreezeArgs{}, &reply)
+			frozen[i].Names = reply.Names
+			ch <- i
+		}(i, index)
+	}
+	for range nodes {
+		<-ch
+	}
+
+	return frozen
+}
@@ -0,0 +1,84 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	. "github.com/minio/dsync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFreeze(t *testing.T) {
+
+	if err := ds.Freeze("test-freeze", "operator", ""); err == nil {
+		t.Fatal("expected error without reason")
+	}
+	if err := ds.Freeze("test-freeze", "operator", "investigating corruption"); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range ds.FrozenNames() {
+		if f.Err != nil || len(f.Names) != 1 || f.Names[0] != "test-freeze" {
+			t.Fatalf("expected test-freeze to be frozen at node %s, got %v (%v)", f.Node, f.Names, f.Err)
+		}
+	}
+
+	// Lock requests are denied as frozen
+	var frozen int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		err := invoke(c, serviceMethod, args, reply)
+		if resp, ok := reply.(*LockResp); ok && resp.Frozen {
+			atomic.AddInt64(&frozen, 1)
+		}
+		return err
+	})
+	defer ds.SetInterceptors()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if NewDRWMutex("test-freeze", ds).LockContext(ctx) {
+		t.Fatal("expected lock on frozen name not to be acquired")
+	}
+	if atomic.LoadInt64(&frozen) < int64(N) {
+		t.Fatalf("expected at least %d frozen responses, got %d", N, atomic.LoadInt64(&frozen))
+	}
+
+	if err := ds.Unfreeze("test-freeze", "operator", "resource restored"); err != nil {
+		t.Fatal(err)
+	}
+	dm := NewDRWMutex("test-freeze", ds)
+	dm.Lock()
+	dm.Unlock()
+}
+
+func TestMultiNodeErrorFrozen(t *testing.T) {
+
+	for frozen, expected := range []bool{false, false, true, true, true} {
+		err := &MultiNodeError{Operation: "Lock", Name: "test"}
+		for i := 0; i < N; i++ {
+			outcome := OutcomeDenied
+			if i < frozen {
+				outcome = OutcomeFrozen
+			}
+			err.Results = append(err.Results, NodeResult{Node: nodes[i], Outcome: outcome})
+		}
+		if err.Frozen() != expected {
+			t.Fatalf("expected frozen: %v with %d of %d nodes frozen, got %v", expected, frozen, N, err.Frozen())
+		}
+	}
+}
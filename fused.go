@@ -0,0 +1,96 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import "sync"
+
+// A FusedDRWMutex is a distributed read/write lock fused with a local sync.RWMutex.
+//
+// Goroutines of the same process synchronize on the local mutex first, so only the
+// winner touches the network: a writer acquires the distributed write lock while holding
+// the local write lock, and concurrent local readers share a single distributed read lock
+// that is acquired by the first reader and released by the last one. All goroutines of a
+// process must use the same FusedDRWMutex for a name, just like with a sync.RWMutex.
+type FusedDRWMutex struct {
+	local   sync.RWMutex
+	m       sync.Mutex // Protects readers and the distributed read lock
+	readers int        // Number of local readers sharing the distributed read lock
+	dm      *DRWMutex
+}
+
+// NewFusedDRWMutex returns a FusedDRWMutex for the given name, locked at the nodes of ds.
+func NewFusedDRWMutex(name string, ds *Dsync) *FusedDRWMutex {
+	return &FusedDRWMutex{dm: NewDRWMutex(name, ds)}
+}
+
+// Lock holds a write lock on fm, blocking until both the local and the distributed
+// lock are available.
+func (fm *FusedDRWMutex) Lock() {
+	fm.local.Lock()
+	fm.dm.Lock()
+}
+
+// Unlock unlocks the write lock.
+//
+// It is a run-time error if fm is not locked on entry to Unlock.
+func (fm *FusedDRWMutex) Unlock() {
+	fm.dm.Unlock()
+	fm.local.Unlock()
+}
+
+// RLock holds a read lock on fm. Only the first of the concurrent local readers
+// acquires the distributed read lock, the others share it.
+func (fm *FusedDRWMutex) RLock() {
+	fm.local.RLock()
+
+	fm.m.Lock()
+	defer fm.m.Unlock()
+	if fm.readers == 0 {
+		fm.dm.RLock()
+	}
+	fm.readers++
+}
+
+// RUnlock releases a read lock held on fm, the last local reader releases the
+// distributed read lock.
+//
+// It is a run-time error if fm is not locked on entry to RUnlock.
+func (fm *FusedDRWMutex) RUnlock() {
+	{
+		fm.m.Lock()
+		defer fm.m.Unlock()
+		if fm.readers == 0 {
+			panic("Trying to RUnlock() while no RLock() is active")
+		}
+		if fm.readers--; fm.readers == 0 {
+			fm.dm.RUnlock()
+		}
+	}
+
+	fm.local.RUnlock()
+}
+
+// RLocker returns a sync.Locker interface that implements
+// the Lock and Unlock methods by calling fm.RLock and fm.RUnlock.
+func (fm *FusedDRWMutex) RLocker() sync.Locker {
+	return (*fusedRLocker)(fm)
+}
+
+type fusedRLocker FusedDRWMutex
+
+func (fr *fusedRLocker) Lock()   { (*FusedDRWMutex)(fr).RLock() }
+func (fr *fusedRLocker) Unlock() { (*FusedDRWMutex)(fr).RUnlock() }
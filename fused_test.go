@@ -0,0 +1,84 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFusedDRWMutex(t *testing.T) {
+
+	var readRequests, writeRequests int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && a.Name == "test-fused" {
+			switch serviceMethod {
+			case "Dsync.RLock":
+				atomic.AddInt64(&readRequests, 1)
+			case "Dsync.Lock":
+				atomic.AddInt64(&writeRequests, 1)
+			}
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	fm := NewFusedDRWMutex("test-fused", ds)
+
+	// Concurrent local readers share a single distributed read lock
+	var locked sync.WaitGroup
+	var wg sync.WaitGroup
+	release := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		locked.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fm.RLock()
+			locked.Done()
+			<-release
+			fm.RUnlock()
+		}()
+	}
+	locked.Wait()
+	if r := atomic.LoadInt64(&readRequests); r != int64(N) {
+		t.Fatalf("expected %d read lock requests, got %d", N, r)
+	}
+	close(release)
+	wg.Wait()
+
+	// Writers exclude each other (and get the distributed lock one at a time)
+	counter := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fm.Lock()
+			counter++
+			fm.Unlock()
+		}()
+	}
+	wg.Wait()
+	if counter != 10 {
+		t.Fatalf("expected counter of 10, got %d", counter)
+	}
+	if w := atomic.LoadInt64(&writeRequests); w < int64(10*N) {
+		t.Fatalf("expected at least %d write lock requests, got %d", 10*N, w)
+	}
+}
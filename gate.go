@@ -0,0 +1,89 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// SetLocalGate limits the number of goroutines of this process that concurrently try
+// to acquire a lock on the same name (zero removes the limit, which is the default).
+//
+// Goroutines beyond the limit wait at a local gate before going to the network, so a
+// hot lock contended by many local goroutines results in only a few quorum attempts at
+// a time instead of one per goroutine. The gate is only held for the duration of an
+// attempt, not while the lock is held.
+func (ds *Dsync) SetLocalGate(limit int) {
+	atomic.StoreInt64(&ds.localGateLimit, int64(limit))
+}
+
+type gate struct {
+	slots chan struct{} // Buffered to the limit, one element per attempt in progress
+	refs  int           // Number of goroutines in or waiting at the gate
+}
+
+// enterGate waits for a slot at the gate for name, or until the deadline (if not zero)
+// has passed or ctx is done in which case false is returned. On success the returned
+// function must be called to leave the gate once the attempt is done.
+func (ds *Dsync) enterGate(ctx context.Context, name string, deadline time.Time) (leave func(), ok bool) {
+	limit := atomic.LoadInt64(&ds.localGateLimit)
+	if limit <= 0 {
+		return func() {}, true
+	}
+
+	ds.gatesMutex.Lock()
+	g, found := ds.gates[name]
+	if !found {
+		g = &gate{slots: make(chan struct{}, limit)}
+		ds.gates[name] = g
+	}
+	g.refs++
+	ds.gatesMutex.Unlock()
+
+	release := func() {
+		ds.gatesMutex.Lock()
+		defer ds.gatesMutex.Unlock()
+		if g.refs--; g.refs == 0 {
+			delete(ds.gates, name)
+		}
+	}
+
+	select {
+	case g.slots <- struct{}{}:
+	default:
+		var expired <-chan time.Time // Never fires without a deadline
+		if !deadline.IsZero() {
+			expired = ds.clock().After(deadline.Sub(ds.clock().Now()))
+		}
+		select {
+		case g.slots <- struct{}{}:
+		case <-expired:
+			release()
+			return nil, false
+		case <-ctx.Done():
+			release()
+			return nil, false
+		}
+	}
+
+	return func() {
+		<-g.slots
+		release()
+	}, true
+}
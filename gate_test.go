@@ -0,0 +1,113 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLocalGate(t *testing.T) {
+
+	ds.SetLocalGate(1)
+	defer ds.SetLocalGate(0)
+
+	// Slow down read lock requests and keep track of how many are in flight
+	var inFlight, maxInFlight int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && serviceMethod == "Dsync.RLock" && a.Name == "test-local-gate" {
+			n := atomic.AddInt64(&inFlight, 1)
+			defer atomic.AddInt64(&inFlight, -1)
+			for m := atomic.LoadInt64(&maxInFlight); n > m; m = atomic.LoadInt64(&maxInFlight) {
+				if atomic.CompareAndSwapInt64(&maxInFlight, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dm := NewDRWMutex("test-local-gate", ds)
+			dm.RLock()
+			dm.RUnlock()
+		}()
+	}
+
+	wg.Wait()
+
+	// A single attempt at a time, apart from late responses of the previous attempt
+	if m := atomic.LoadInt64(&maxInFlight); m >= int64(2*N) {
+		t.Fatalf("expected less than %d read lock requests in flight, got %d", 2*N, m)
+	}
+}
+
+func TestLocalGateContext(t *testing.T) {
+
+	// Keep the attempt holding the gate busy: its RPCs block, and its round does not time
+	// out as the clock stands still
+	entered, proceed := make(chan struct{}, N), make(chan struct{})
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	gds, err := NewWithOptions(clnts, 0, Options{
+		Clock: NewFakeClock(time.Now()),
+		Interceptors: []Interceptor{func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+			if serviceMethod == "Dsync.Lock" {
+				entered <- struct{}{}
+				<-proceed
+			}
+			return invoke(c, serviceMethod, args, reply)
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gds.Close()
+	gds.SetLocalGate(1)
+
+	holder := NewDRWMutex("test-local-gate-ctx", gds)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		holder.Lock()
+	}()
+	<-entered
+
+	// Waiting at the gate is given up on once the context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if NewDRWMutex("test-local-gate-ctx", gds).LockContext(ctx) {
+		t.Fatal("expected lock not to be acquired once the context is canceled")
+	}
+
+	close(proceed)
+	<-done
+	holder.Unlock()
+}
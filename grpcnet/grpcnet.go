@@ -0,0 +1,184 @@
+//go:build grpc
+// +build grpc
+
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpcnet is a reference gRPC transport for dsync, for deployments where lock
+// servers are reached through HTTP/2 load balancers rather than over net/rpc.
+//
+// Every RPC of the lock server is carried by a single unary gRPC method, with the
+// arguments and reply encoded by dsync.JSONCodec, so no generated code is needed:
+//
+//	s := grpc.NewServer()
+//	grpcnet.Register(s, lockServer)
+//
+//	c, err := grpcnet.Dial("lock1:9000", grpc.WithInsecure())
+//	clnt := dsync.NewNetLockerClient(c, "lock1:9000", dsync.DefaultPath)
+//
+// A load balancer in front of the lock servers must route every client to a fixed lock
+// server per node (eg. with a target per lock server), as dsync counts the grants of the
+// nodes towards a quorum.
+//
+// The package depends on google.golang.org/grpc and is therefore only built with the grpc
+// build tag.
+package grpcnet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/minio/dsync"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	encoding.RegisterCodec(dsync.JSONCodec)
+}
+
+// Full name of the gRPC method carrying all RPCs.
+const callMethod = "/dsync.Locker/Call"
+
+// request - RPC of the lock server as sent over gRPC.
+type request struct {
+	Method string          `json:"method"` // Name of the method of the lock server, eg. "Dsync.Lock"
+	Args   json.RawMessage `json:"args"`
+}
+
+// response - reply of the lock server as sent over gRPC.
+type response struct {
+	Reply json.RawMessage `json:"reply"`
+}
+
+// Register registers rcvr (eg. a *lockserver.LockServer) with s, calling its methods
+// following the net/rpc conventions (see dsync.Serve).
+func Register(s *grpc.Server, rcvr interface{}) {
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "dsync.Locker",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Call",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(request)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					r := req.(*request)
+					reply, err := dsync.Serve(srv, r.Method, r.Args, dsync.JSONCodec)
+					if err != nil {
+						return nil, err
+					}
+					return &response{Reply: reply}, nil
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: callMethod}, handler)
+			},
+		}},
+		Metadata: "grpcnet",
+	}, rcvr)
+}
+
+// Client - client of a single lock server over gRPC, implementing dsync.NetLocker and
+// dsync.Caller, see dsync.NewNetLockerClient.
+type Client struct {
+	conn *grpc.ClientConn
+
+	// Timeout of every call, zero for none. Lock requests are given up on once the
+	// client stopped waiting for them (the Wait of their arguments) if that is sooner.
+	Timeout time.Duration
+}
+
+// Dial returns a Client for the lock server at target.
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Call calls the method of the lock server named by serviceMethod ("Dsync.<method>").
+func (c *Client) Call(serviceMethod string, args dsync.RPCArgs, reply interface{}) error {
+	b, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if timeout := c.timeout(args); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var resp response
+	if err = c.conn.Invoke(ctx, callMethod, &request{Method: serviceMethod, Args: b}, &resp, grpc.CallContentSubtype(dsync.JSONCodec.Name())); err != nil {
+		// Keep the message of the lock server, eg. for dsync to detect unknown methods
+		return errors.New(status.Convert(err).Message())
+	}
+	return json.Unmarshal(resp.Reply, reply)
+}
+
+// timeout returns the deadline of a call with args: the time the client waits for the
+// response of a lock request, capped by Timeout.
+func (c *Client) timeout(args dsync.RPCArgs) time.Duration {
+	var wait time.Duration
+	switch a := args.(type) {
+	case *dsync.LockArgs:
+		wait = a.Wait
+	case *dsync.BatchArgs:
+		wait = a.Wait
+	}
+	if wait > 0 && (c.Timeout <= 0 || wait < c.Timeout) {
+		return wait
+	}
+	return c.Timeout
+}
+
+// Lock - write lock operation.
+func (c *Client) Lock(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	return c.Call("Dsync.Lock", args, resp)
+}
+
+// Unlock - write unlock operation.
+func (c *Client) Unlock(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	return c.Call("Dsync.Unlock", args, resp)
+}
+
+// RLock - read lock operation.
+func (c *Client) RLock(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	return c.Call("Dsync.RLock", args, resp)
+}
+
+// RUnlock - read unlock operation.
+func (c *Client) RUnlock(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	return c.Call("Dsync.RUnlock", args, resp)
+}
+
+// ForceUnlock - force unlock operation.
+func (c *Client) ForceUnlock(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	return c.Call("Dsync.ForceUnlock", args, resp)
+}
+
+// Close closes the connection to the lock server.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
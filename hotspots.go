@@ -0,0 +1,118 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import "time"
+
+// HotspotsArgs - arguments for the Hotspots RPC.
+type HotspotsArgs struct {
+	AuthArgs
+	Count int `json:"count"` // Maximum number of names to return
+}
+
+// Hotspot - contention of a single lock name as seen by a lock server.
+type Hotspot struct {
+	Name     string        `json:"name"`
+	Requests int64         `json:"requests"` // Number of lock requests
+	Denies   int64         `json:"denies"`   // Number of lock requests that were denied
+	AvgWait  time.Duration `json:"avgWait"`  // Average time from the first denied request of a client until it was granted
+}
+
+// HotspotsReply - reply for the Hotspots RPC, the most contended names of a lock
+// server over the sliding window, most contended first.
+type HotspotsReply struct {
+	Window   time.Duration `json:"window"`
+	Hotspots []Hotspot     `json:"hotspots"`
+}
+
+// NodeHotspots - the most contended names of (or the error retrieving them from) a single node.
+type NodeHotspots struct {
+	Node string
+	HotspotsReply
+	Err error
+}
+
+// Hotspots retrieves the count most contended lock names of all nodes, as tracked
+// by the lock servers themselves (without client cooperation).
+func (ds *Dsync) Hotspots(count int) []NodeHotspots {
+
+	m := ds.membership()
+	nodes := m.nodes()
+	hotspots := make([]NodeHotspots, len(nodes))
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			hotspots[i].Node = m.node(index)
+			hotspots[i].Err = ds.call(index, "Dsync.Hotspots", &HotspotsArgs{Count: count}, &hotspots[i].HotspotsReply)
+			ch <- i
+		}(i, index)
+	}
+	for range nodes {
+		<-ch
+	}
+
+	return hotspots
+}
+
+// StatsArgs - arguments for the Stats RPC, selecting the names with the given prefix
+// as well as the given names.
+type StatsArgs struct {
+	AuthArgs
+	Prefix string   `json:"prefix,omitempty"`
+	Names  []string `json:"names,omitempty"`
+}
+
+// StatsReply - reply for the Stats RPC, the contention of the selected names of a lock
+// server over the sliding window, sorted by name.
+type StatsReply struct {
+	Window time.Duration `json:"window"`
+	Stats  []Hotspot     `json:"stats"`
+}
+
+// NodeStats - the contention of the selected names of (or the error retrieving it from) a single node.
+type NodeStats struct {
+	Node string
+	StatsReply
+	Err error
+}
+
+// Stats retrieves the contention of all names with the given prefix as well as of the
+// given names from all nodes in a single request per node, so that monitoring a large
+// namespace does not burden the lock servers with a request per name. An empty prefix
+// selects all names, unless names are given. Names without any requests over the
+// sliding window are only included when given explicitly.
+func (ds *Dsync) Stats(prefix string, names ...string) []NodeStats {
+
+	m := ds.membership()
+	nodes := m.nodes()
+	stats := make([]NodeStats, len(nodes))
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			stats[i].Node = m.node(index)
+			stats[i].Err = ds.call(index, "Dsync.Stats", &StatsArgs{Prefix: prefix, Names: names}, &stats[i].StatsReply)
+			ch <- i
+		}(i, index)
+	}
+	for range nodes {
+		<-ch
+	}
+
+	return stats
+}
@@ -0,0 +1,177 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ListArgs - arguments for the List RPC, selecting the locks held on all names with the
+// prefix as well as on the given names. An empty prefix selects all names, unless names
+// are given.
+type ListArgs struct {
+	AuthArgs
+	Prefix string   `json:"prefix,omitempty"`
+	Names  []string `json:"names,omitempty"`
+}
+
+// LockHolder - a client holding a lock, as reported by the nodes that granted it.
+type LockHolder struct {
+	Owner   string            // Uid of the DRWMutex holding the lock, empty for older clients
+	Node    string            // Network address of the client holding the lock
+	RPCPath string            // RPC path of the client holding the lock
+	Source  string            // File:line of the caller that requested the lock, empty for older clients
+	Tags    map[string]string // Tags of the request, see TagsKey
+	Mode    LockMode          // Exclusive for a write lock, Shared for a read lock
+	Since   time.Time         // Time of the earliest grant, by the clocks of the nodes
+	Held    time.Duration     // Time the lock is held for since
+	Nodes   []string          // Nodes that granted the lock
+}
+
+// LockInfo - a lock held in the cluster, aggregated from the lock tables of all nodes.
+type LockInfo struct {
+	Name    string
+	Holders []LockHolder // In order of Since
+}
+
+// Writer returns true when the lock is held as a write lock.
+func (li LockInfo) Writer() bool {
+	for _, h := range li.Holders {
+		if h.Mode.IsExclusive() {
+			return true
+		}
+	}
+	return false
+}
+
+// Inspect lists the locks held on all names with the given prefix as well as on the given
+// names, aggregating the lock tables of all nodes into the holders of each lock (along
+// with their owner, mode and hold duration), eg. to debug stuck workloads. An empty
+// prefix selects all names, unless names are given.
+//
+// The grants of a holder are told apart by its owner (see DRWMutex.Owner), so the read
+// locks of older clients without owner that are held by the same client are reported as a
+// single holder. The nodes that could not be reached are reported in the error, along
+// with the locks held at the other nodes.
+func (ds *Dsync) Inspect(prefix string, names ...string) ([]LockInfo, error) {
+
+	m := ds.membership()
+	nodes := m.nodes()
+	entries := make([][]LockEntry, len(nodes))
+	errs := make([]error, len(nodes))
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			entries[i], errs[i] = ds.list(index, prefix, names)
+			ch <- i
+		}(i, index)
+	}
+	for range nodes {
+		<-ch
+	}
+
+	type holderKey struct {
+		name, owner, node, rpcPath, source string
+		mode                               LockMode
+	}
+	holders := make(map[holderKey]*LockHolder)
+	var keys []holderKey
+	var failed []string
+	for i, index := range nodes {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", m.node(index), errs[i]))
+			continue
+		}
+		for _, e := range entries[i] {
+			k := holderKey{name: e.Name, owner: e.Owner, node: e.Node, rpcPath: e.RPCPath, source: e.Source, mode: e.Mode}
+			h, ok := holders[k]
+			if !ok {
+				h = &LockHolder{Owner: e.Owner, Node: e.Node, RPCPath: e.RPCPath, Source: e.Source, Tags: e.Tags, Mode: e.Mode, Since: e.Since}
+				holders[k] = h
+				keys = append(keys, k)
+			}
+			if e.Since.Before(h.Since) {
+				h.Since = e.Since
+			}
+			if len(h.Nodes) == 0 || h.Nodes[len(h.Nodes)-1] != m.node(index) {
+				h.Nodes = append(h.Nodes, m.node(index))
+			}
+		}
+	}
+
+	now := ds.clock().Now()
+	byName := make(map[string]*LockInfo)
+	var infos []*LockInfo
+	for _, k := range keys {
+		h := holders[k]
+		h.Held = now.Sub(h.Since)
+		li, ok := byName[k.name]
+		if !ok {
+			li = &LockInfo{Name: k.name}
+			byName[k.name] = li
+			infos = append(infos, li)
+		}
+		li.Holders = append(li.Holders, *h)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	locks := make([]LockInfo, len(infos))
+	for i, li := range infos {
+		sort.SliceStable(li.Holders, func(a, b int) bool { return li.Holders[a].Since.Before(li.Holders[b].Since) })
+		locks[i] = *li
+	}
+
+	if len(failed) > 0 {
+		return locks, fmt.Errorf("Inspect failed at %d of %d nodes: %s", len(failed), len(nodes), strings.Join(failed, ", "))
+	}
+	return locks, nil
+}
+
+// list retrieves the grants selected by prefix and names held by the node at index. Older
+// lock servers without the List RPC are asked for a snapshot of all grants instead.
+func (ds *Dsync) list(index int, prefix string, names []string) ([]LockEntry, error) {
+	entries, err := ds.entries(index, "Dsync.List", &ListArgs{Prefix: prefix, Names: names})
+	if err == nil || !strings.Contains(err.Error(), "can't find method") {
+		return entries, err
+	}
+	if entries, err = ds.snapshot(index); err != nil {
+		return nil, err
+	}
+	selected := entries[:0]
+	for _, e := range entries {
+		if listed(e.Name, prefix, names) {
+			selected = append(selected, e)
+		}
+	}
+	return selected, nil
+}
+
+// listed returns whether name is selected by prefix and names, see ListArgs.
+func listed(name, prefix string, names []string) bool {
+	if (prefix != "" || len(names) == 0) && strings.HasPrefix(name, prefix) {
+		return true
+	}
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	ids, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := NewDRWMutex("inspect/a", ids)
+	writer.Lock()
+	defer writer.Unlock()
+	readers := []*DRWMutex{NewDRWMutex("inspect/b", ids), NewDRWMutex("inspect/b", ids)}
+	for _, dm := range readers {
+		dm.RLock()
+		defer dm.RUnlock()
+	}
+	other := NewDRWMutex("other", ids)
+	other.Lock()
+	defer other.Unlock()
+
+	infos, err := ids.Inspect("inspect/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Name != "inspect/a" || infos[1].Name != "inspect/b" {
+		t.Fatalf("expected the locks with the prefix, got %+v", infos)
+	}
+
+	// Grants of all nodes are aggregated per holder
+	if !infos[0].Writer() || len(infos[0].Holders) != 1 {
+		t.Fatalf("expected a single write lock holder, got %+v", infos[0])
+	}
+	if h := infos[0].Holders[0]; h.Owner != writer.Owner() || h.Mode != Exclusive || len(h.Nodes) < 3 || h.Held < 0 {
+		t.Fatalf("expected write lock held by %s at a quorum of the nodes, got %+v", writer.Owner(), h)
+	}
+	if infos[1].Writer() || len(infos[1].Holders) != len(readers) {
+		t.Fatalf("expected a holder per read lock, got %+v", infos[1])
+	}
+	for _, h := range infos[1].Holders {
+		if h.Mode != Shared || (h.Owner != readers[0].Owner() && h.Owner != readers[1].Owner()) || len(h.Nodes) < 2 {
+			t.Fatalf("expected read lock held at a quorum of the nodes, got %+v", h)
+		}
+	}
+
+	// Names only
+	if infos, err = ids.Inspect("", "other"); err != nil || len(infos) != 1 || infos[0].Holders[0].Owner != other.Owner() {
+		t.Fatalf("expected only the given name, got %+v (%v)", infos, err)
+	}
+}
+
+func TestInspectSnapshot(t *testing.T) {
+
+	// The lock servers of the tests have no List RPC, so the snapshots are filtered
+	dm := NewDRWMutex("test-inspect-snapshot", ds)
+	dm.Lock()
+	defer dm.Unlock()
+
+	infos, err := ds.Inspect("", "test-inspect-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || !infos[0].Writer() || len(infos[0].Holders[0].Nodes) < 3 {
+		t.Fatalf("expected the write lock, got %+v", infos)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"time"
+)
+
+// RPCArgs - arguments of an RPC, as passed to RPC.Call.
+type RPCArgs interface {
+	SetToken(token string)
+	SetTimestamp(tstamp time.Time)
+}
+
+// Invoker - issues an RPC, either by calling the next Interceptor in the chain
+// or (at the end of the chain) by calling RPC.Call.
+type Invoker func(c RPC, serviceMethod string, args RPCArgs, reply interface{}) error
+
+// Interceptor - wraps every RPC that a Dsync issues to a lock server, eg. for logging,
+// metrics, authentication or fault injection. An interceptor either calls invoke to
+// continue with the RPC (possibly after modifying args) or returns without doing so.
+type Interceptor func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error
+
+type invokerHolder struct{ Invoker }
+
+// SetInterceptors installs a chain of interceptors around all RPCs of ds, the first one
+// being the outermost. Calling it without interceptors removes the chain. The chain can
+// also be installed when initializing ds, see Options.
+func (ds *Dsync) SetInterceptors(interceptors ...Interceptor) {
+	ds.invokerValue.Store(invokerHolder{chainInterceptors(interceptors)})
+}
+
+// chainInterceptors folds the chain of interceptors into a single Invoker.
+func chainInterceptors(interceptors []Interceptor) Invoker {
+	invoke := Invoker(callRPC)
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoke
+		invoke = func(c RPC, serviceMethod string, args RPCArgs, reply interface{}) error {
+			return interceptor(c, serviceMethod, args, reply, next)
+		}
+	}
+	return invoke
+}
+
+// invoker returns the invoker for the chain of interceptors of ds.
+func (ds *Dsync) invoker() Invoker {
+	return ds.invokerValue.Load().(invokerHolder).Invoker
+}
+
+func callRPC(c RPC, serviceMethod string, args RPCArgs, reply interface{}) error {
+	return c.Call(serviceMethod, args, reply)
+}
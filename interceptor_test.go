@@ -0,0 +1,97 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	. "github.com/minio/dsync"
+)
+
+func TestInterceptors(t *testing.T) {
+
+	var calls, faults int64
+	var order atomic.Value
+
+	counter := func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		atomic.AddInt64(&calls, 1)
+		order.Store("counter")
+		return invoke(c, serviceMethod, args, reply)
+	}
+	// Fail all lock requests to the last node (not the own node), quorum should still be reached
+	faultInjector := func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if order.Load() != "counter" {
+			t.Error("expected counter to be called before fault injector")
+		}
+		if serviceMethod == "Dsync.Lock" && c.Node() == nodes[N-1] {
+			atomic.AddInt64(&faults, 1)
+			return errors.New("injected fault")
+		}
+		return invoke(c, serviceMethod, args, reply)
+	}
+
+	ds.SetInterceptors(counter, faultInjector)
+	defer ds.SetInterceptors()
+
+	dm := NewDRWMutex("test-interceptors", ds)
+	dm.Lock()
+	dm.Unlock()
+
+	if atomic.LoadInt64(&faults) != 1 {
+		t.Fatalf("expected 1 injected fault, got %d", atomic.LoadInt64(&faults))
+	}
+	if atomic.LoadInt64(&calls) < int64(N) {
+		t.Fatalf("expected at least %d calls, got %d", N, atomic.LoadInt64(&calls))
+	}
+}
+
+func TestInterceptorsPerInstance(t *testing.T) {
+
+	var calls, otherCalls int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && a.Name == "test-interceptors-per-instance" {
+			atomic.AddInt64(&calls, 1)
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	var clnts []RPC
+	for i := range nodes {
+		clnts = append(clnts, newClient(nodes[i], rpcPaths[i]))
+	}
+	other, err := NewWithOptions(clnts, 0, Options{Interceptors: []Interceptor{
+		func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+			if a, ok := args.(*LockArgs); ok && a.Name == "test-interceptors-per-instance" {
+				atomic.AddInt64(&otherCalls, 1)
+			}
+			return invoke(c, serviceMethod, args, reply)
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	dm := NewDRWMutex("test-interceptors-per-instance", other)
+	dm.Lock()
+	if atomic.LoadInt64(&otherCalls) == 0 || atomic.LoadInt64(&calls) != 0 {
+		t.Fatalf("expected the calls to pass the interceptors of their own instance only, got %d and %d", otherCalls, calls)
+	}
+	dm.Unlock()
+}
@@ -0,0 +1,68 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"fmt"
+	"time"
+)
+
+// Latency - breakdown of the time it took to acquire a lock (or to give up on it) into
+// phases, so that it is obvious whether slowness comes from contention, the network or
+// slow lock servers.
+type Latency struct {
+	Wait       time.Duration // Waiting for the local gate and backing off between rounds (contention)
+	FanOut     time.Duration // Until the first node responded, summed over all rounds (network)
+	QuorumWait time.Duration // From the first response until the outcome of the round was decided, summed over all rounds (slow nodes)
+	Rollback   time.Duration // Releasing the locks granted by rounds that failed
+	Rounds     int           // Number of rounds
+	Acquired   bool          // Whether the lock was acquired
+}
+
+// Total returns the sum of all phases.
+func (l Latency) Total() time.Duration {
+	return l.Wait + l.FanOut + l.QuorumWait + l.Rollback
+}
+
+// String returns a human readable breakdown.
+func (l Latency) String() string {
+	return fmt.Sprintf("%v in %d rounds (wait: %v, fan-out: %v, quorum wait: %v, rollback: %v)",
+		l.Total(), l.Rounds, l.Wait, l.FanOut, l.QuorumWait, l.Rollback)
+}
+
+// latencyHandler wraps the handler of the latency breakdowns (see SetLatencyHandler).
+type latencyHandler struct {
+	fn func(operation, name string, l Latency)
+}
+
+// SetLatencyHandler sets a function that is called with the breakdown of the latency of
+// every lock acquisition from the lock servers of ds, with operation "Lock" or "RLock",
+// eg. to record the phases in histograms of the metrics of the application. It is called
+// for acquisitions that are given up on as well. Passing nil removes the handler. The
+// breakdown is traced regardless, when tracing is requested (see TraceKey).
+func (ds *Dsync) SetLatencyHandler(fn func(operation, name string, l Latency)) {
+	ds.latencyHandler.Store(latencyHandler{fn})
+}
+
+// observeLatency traces the latency of an acquisition and passes it on to the handler.
+func (ds *Dsync) observeLatency(meta lockMetadata, operation, name string, l Latency) {
+	meta.tracef("latency: %v", l)
+	ds.metrics.acquired(operation == "RLock", l.Acquired, l.Rounds, l.Total())
+	if h, ok := ds.latencyHandler.Load().(latencyHandler); ok && h.fn != nil {
+		h.fn(operation, name, l)
+	}
+}
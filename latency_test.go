@@ -0,0 +1,81 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/minio/dsync"
+)
+
+func TestLatencyHandler(t *testing.T) {
+
+	var mutex sync.Mutex
+	var latencies []Latency
+	ds.SetLatencyHandler(func(operation, name string, l Latency) {
+		if operation == "Lock" && name == "test-latency" {
+			mutex.Lock()
+			latencies = append(latencies, l)
+			mutex.Unlock()
+		}
+	})
+	defer ds.SetLatencyHandler(nil)
+
+	last := func() Latency {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if len(latencies) == 0 {
+			t.Fatal("expected latency to be reported")
+		}
+		return latencies[len(latencies)-1]
+	}
+
+	// A slow node shows up as waiting for the quorum
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if serviceMethod == "Dsync.Lock" && c.Node() == nodes[0] {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	dm := NewDRWMutex("test-latency", ds)
+	dm.Lock()
+	ds.SetInterceptors()
+
+	l := last()
+	if !l.Acquired || l.Rounds != 1 || l.QuorumWait < 15*time.Millisecond || l.FanOut >= l.QuorumWait {
+		t.Fatalf("expected quorum wait to dominate, got %v", l)
+	}
+
+	// Contention shows up as waiting between rounds
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if NewDRWMutex("test-latency", ds).LockContext(ctx) {
+		t.Fatal("expected lock not to be acquired while held")
+	}
+	dm.Unlock()
+
+	l = last()
+	if l.Acquired || l.Rounds < 2 || l.Wait <= 0 {
+		t.Fatalf("expected rounds and waiting for a contended lock, got %v", l)
+	}
+	if total := l.Total(); total > 200*time.Millisecond {
+		t.Fatalf("expected breakdown to add up to the time spent, got %v", total)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Prefix of the names of the locks leaders are elected with, so that they never collide
+// with a lock of the same name taken by the application.
+const leaderPrefix = "leader" + NamespaceSeparator
+
+// Time a leader that resigned waits before campaigning again when no lease is set, so
+// that other candidates get the chance to take over.
+const defaultResignDelay = time.Second
+
+// LeaderElector - campaigns for leadership of a named role among all processes sharing
+// the nodes, of which a single one is elected at a time: the leader holds the write lock
+// of the role, granted by a quorum of the nodes like any other lock.
+//
+// With a lease (see NewLeaderElector) the lock is granted with that lease and renewed in
+// the background, so that leadership passes on to another candidate once the leader
+// crashed or got cut off from the nodes, and a leader whose lease could not be renewed
+// at a quorum of the nodes within the lease (or whose lock is revoked otherwise) loses
+// leadership. As a leader may only learn about
+// that after its successor got elected, pass the term of the leadership (see Term) along
+// with the writes of the leader, for storage systems to reject writes of earlier terms.
+type LeaderElector struct {
+	Role string
+
+	ds    *Dsync
+	lease time.Duration
+
+	mutex     sync.Mutex
+	term      uint64              // Term of the leadership held, zero when not leader
+	observers []func(leader bool) // Called on leadership gain and loss, see Observe
+	resign    chan struct{}       // Signaled to give up leadership, see Resign
+}
+
+// NewLeaderElector returns a LeaderElector for role among the processes sharing the nodes
+// of ds, requesting the leadership with the given lease (zero leaves the lease to
+// SetLeaseTTL and the lock servers).
+func NewLeaderElector(role string, ds *Dsync, lease time.Duration) *LeaderElector {
+	return &LeaderElector{
+		Role:   role,
+		ds:     ds,
+		lease:  lease,
+		resign: make(chan struct{}, 1),
+	}
+}
+
+// Observe registers fn to be called with true when leadership is gained and with false
+// when it is lost or given up. Observers are called in order from the goroutine running
+// Run, which waits for them to return.
+func (le *LeaderElector) Observe(fn func(leader bool)) {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+	le.observers = append(le.observers, fn)
+}
+
+// IsLeader returns whether the elector currently holds the leadership.
+func (le *LeaderElector) IsLeader() bool {
+	return le.Term() > 0
+}
+
+// Term returns the term of the leadership held, zero when not leader. Terms are fencing
+// tokens (see LockFenced): every leader of the role gets a greater term than the leaders
+// before it, in this or any other process.
+func (le *LeaderElector) Term() uint64 {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+	return le.term
+}
+
+// Resign gives up the leadership (if held) gracefully, releasing it right away so that
+// another candidate can take over instead of waiting for the lease to expire. The
+// elector campaigns again after the lease (or a second without lease) has passed.
+func (le *LeaderElector) Resign() {
+	select {
+	case le.resign <- struct{}{}:
+	default:
+	}
+}
+
+// Run campaigns for the leadership until ctx is done, blocking meanwhile: once elected it
+// holds the leadership until it is lost, given up with Resign or ctx is done, and then
+// campaigns again. The leadership is given up when Run returns.
+func (le *LeaderElector) Run(ctx context.Context) {
+
+	dm := NewDRWMutex(leaderPrefix+le.Role, le.ds)
+	lockCtx := ctx
+	if le.lease > 0 {
+		lockCtx = context.WithValue(ctx, LeaseTTLKey, le.lease)
+	}
+
+	for {
+		// Drop a resignation requested while not leader
+		select {
+		case <-le.resign:
+		default:
+		}
+
+		if !dm.LockContext(lockCtx) {
+			return
+		}
+		revoked := dm.Revoked()
+		term := le.ds.fencingToken(dm.Name)
+
+		select {
+		case <-revoked:
+			// Lost before the term started, another candidate may have been elected meanwhile
+			dm.Unlock()
+			continue
+		default:
+		}
+		le.elected(term)
+
+		resigned := false
+		select {
+		case <-revoked:
+		case <-le.resign:
+			resigned = true
+		case <-ctx.Done():
+		}
+		dm.Unlock()
+		le.elected(0)
+
+		if resigned {
+			delay := le.lease
+			if delay <= 0 {
+				delay = defaultResignDelay
+			}
+			select {
+			case <-le.ds.clock().After(delay):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// elected records the term of the leadership gained (or zero when lost) and notifies
+// the observers.
+func (le *LeaderElector) elected(term uint64) {
+	le.mutex.Lock()
+	le.term = term
+	observers := make([]func(leader bool), len(le.observers))
+	copy(observers, le.observers)
+	le.mutex.Unlock()
+
+	for _, fn := range observers {
+		fn(term > 0)
+	}
+}
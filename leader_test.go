@@ -0,0 +1,184 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/minio/dsync"
+)
+
+func TestLeaderElector(t *testing.T) {
+
+	var mutex sync.Mutex
+	var events []string
+	electors := make([]*LeaderElector, 3)
+	cancels := make([]context.CancelFunc, len(electors))
+	var wg sync.WaitGroup
+	for i := range electors {
+		le := NewLeaderElector("test-leader", ds, 0)
+		le.Observe(func(leader bool) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if leader {
+				events = append(events, "elected")
+			} else {
+				events = append(events, "lost")
+			}
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		electors[i], cancels[i] = le, cancel
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			le.Run(ctx)
+		}()
+	}
+
+	// A single leader is elected at a time, with a greater term than the leaders before
+	leader := func() int {
+		for i := 0; i < 500; i++ {
+			var leaders []int
+			for j, le := range electors {
+				if le.IsLeader() {
+					leaders = append(leaders, j)
+				}
+			}
+			if len(leaders) > 1 {
+				t.Fatalf("expected a single leader, got %v", leaders)
+			}
+			if len(leaders) == 1 {
+				return leaders[0]
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("expected a leader to be elected")
+		return -1
+	}
+	first := leader()
+	term := electors[first].Term()
+
+	// Leadership passes on after a resignation
+	electors[first].Resign()
+	second := leader()
+	for second == first {
+		time.Sleep(10 * time.Millisecond)
+		second = leader()
+	}
+	if electors[second].Term() <= term {
+		t.Fatalf("expected term to increase beyond %d, got %d", term, electors[second].Term())
+	}
+	term = electors[second].Term()
+
+	// And once the leader stops campaigning
+	cancels[second]()
+	third := leader()
+	for third == second {
+		time.Sleep(10 * time.Millisecond)
+		third = leader()
+	}
+	if electors[third].Term() <= term {
+		t.Fatalf("expected term to increase beyond %d, got %d", term, electors[third].Term())
+	}
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+	wg.Wait()
+	for i, le := range electors {
+		if le.IsLeader() {
+			t.Fatalf("expected elector %d to give up leadership once stopped", i)
+		}
+	}
+
+	// Every leadership gained has been given up again
+	mutex.Lock()
+	defer mutex.Unlock()
+	elected := 0
+	for _, e := range events {
+		if e == "elected" {
+			elected++
+		} else {
+			elected--
+		}
+	}
+	if elected != 0 || len(events) < 6 {
+		t.Fatalf("expected leadership to be gained and lost in turn, got %v", events)
+	}
+}
+
+func TestLeaderElectorLeaseLost(t *testing.T) {
+
+	var failing int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		a, ok := args.(*LockArgs)
+		if !ok || a.Name != "leader/test-leader-lease" {
+			return invoke(c, serviceMethod, args, reply)
+		}
+		switch serviceMethod {
+		case "Dsync.Lock":
+			err := invoke(c, serviceMethod, args, reply)
+			if resp := reply.(*LockResp); resp.Granted {
+				resp.TTL = 60 * time.Millisecond
+			}
+			return err
+		case "Dsync.Refresh":
+			// The test lock servers do not implement leases
+			if atomic.LoadInt64(&failing) == 1 {
+				return errors.New("unreachable")
+			}
+			reply.(*LockResp).Granted = true
+			return nil
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	le := NewLeaderElector("test-leader-lease", ds, time.Minute)
+	events := make(chan bool, 16)
+	le.Observe(func(leader bool) { events <- leader })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		le.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if leader := <-events; !leader {
+		t.Fatal("expected leadership to be gained")
+	}
+
+	// A leader whose lease cannot be refreshed at a quorum loses leadership
+	atomic.StoreInt64(&failing, 1)
+	select {
+	case leader := <-events:
+		if leader {
+			t.Fatal("expected leadership to be lost")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected leadership to be lost once the lease passed without being refreshed")
+	}
+}
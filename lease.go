@@ -0,0 +1,205 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SetLeaseTTL sets the lease requested for every lock granted from now on. A lock with
+// a lease expires at a lock server unless it is refreshed in time, which dsync does in
+// the background (every third of the lease) until the lock is released. Lock servers
+// may apply a default lease and cap the lease requested, see Options.LeaseTTLs of
+// package lockserver. Zero (the default) leaves the lease to the lock servers.
+//
+// Leases expire by the clock of the lock servers, so a lock server clock jumping ahead
+// by less than half the lease while the lock is held does not make the lock expire.
+func (ds *Dsync) SetLeaseTTL(ttl time.Duration) {
+	atomic.StoreInt64(&ds.leaseTTL, int64(ttl))
+}
+
+func (ds *Dsync) requestedLeaseTTL() time.Duration {
+	return time.Duration(atomic.LoadInt64(&ds.leaseTTL))
+}
+
+// lease - refreshes of the lease a lock server granted for a lock.
+type lease struct {
+	stop    chan struct{} // Closed to stop refreshing the lease
+	expired bool          // Set once the lease expired at the lock server, or was not refreshed in time
+}
+
+// startLease keeps refreshing the lease of ttl the lock server at index granted for
+// the lock on name with uid, until stopLease is called. The lease expires when the lock
+// server no longer knows about the lock, or when it could not be refreshed within the
+// lease. Once the leases at the nodes still holding the lock no longer make up a quorum,
+// the lock is reported as revoked (see Revoked).
+func (ds *Dsync) startLease(index int, name, uid string, requested, ttl time.Duration) {
+	l := &lease{stop: make(chan struct{})}
+	ds.leasesMutex.Lock()
+	ds.leases[leaseKey{uid, name}] = l
+	ds.leasesMutex.Unlock()
+
+	atomic.AddInt64(&ds.leaseGoroutines, 1)
+	go func() {
+		defer atomic.AddInt64(&ds.leaseGoroutines, -1)
+
+		refreshed := ds.clock().Now()
+		for {
+			select {
+			case <-ds.clock().After(ttl / 3):
+			case <-l.stop:
+				return
+			}
+
+			var resp LockResp
+			now := ds.clock().Now()
+			err := ds.call(index, "Dsync.Refresh", &LockArgs{Name: name, UID: uid, TTL: requested}, &resp)
+			if err == errNodeRemoved {
+				// Node is no longer a member (see RemoveNode), so the lease no longer matters
+				ds.stopLease(name, uid)
+				return
+			} else if err != nil {
+				ds.logMessage(dsyncLog, LevelDebug, "Unable to call Dsync.Refresh", Fields{"name": name, "node": ds.membership().node(index), "error": err})
+				if ds.clock().Now().Sub(refreshed) < ttl {
+					continue // Try again at the next refresh, the lease does not expire before
+				}
+			} else if resp.Granted {
+				refreshed = now
+				if resp.TTL > 0 {
+					ttl = resp.TTL
+				}
+				continue
+			}
+			// The lease expired (or the lock was removed otherwise) at this lock server
+			ds.leaseExpired(name, uid)
+			return
+		}
+	}()
+}
+
+// leaseExpired records that the lease of the lock on name with uid expired, revoking the
+// lock once the nodes with a lease left no longer make up a quorum.
+func (ds *Dsync) leaseExpired(name, uid string) {
+	ds.holdersMutex.Lock()
+	dm := ds.holders[uid][name]
+	ds.holdersMutex.Unlock()
+
+	var locks []string
+	isReadLock := false
+	if dm != nil {
+		locks, isReadLock = dm.locksWith(uid)
+	}
+
+	ds.leasesMutex.Lock()
+	l, ok := ds.leases[leaseKey{uid, name}]
+	if !ok || l.expired {
+		ds.leasesMutex.Unlock()
+		return // Released meanwhile
+	}
+	held := ds.leaseQuorum(name, locks, isReadLock)
+	l.expired = true
+	lost := held && !ds.leaseQuorum(name, locks, isReadLock)
+	ds.leasesMutex.Unlock()
+
+	if lost {
+		ds.logMessage(dsyncLog, LevelWarn, "Lost the leases of a quorum", Fields{"name": name})
+		ds.NotifyRevoked(name, uid)
+	}
+}
+
+// locksWith returns a copy of the locks of the acquisition of dm a node granted with uid,
+// nil when no longer held, along with whether they are read locks.
+func (dm *DRWMutex) locksWith(uid string) ([]string, bool) {
+	dm.m.Lock()
+	defer dm.m.Unlock()
+	for _, held := range dm.writeLocks {
+		if held == uid {
+			return append([]string(nil), dm.writeLocks...), false
+		}
+	}
+	for _, locks := range dm.readersLocks {
+		for _, held := range locks {
+			if held == uid {
+				return append([]string(nil), locks...), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// leaseQuorum returns whether the nodes the locks on name have not expired at make up a
+// quorum of every placement of the lock, the caller must hold ds.leasesMutex.
+func (ds *Dsync) leaseQuorum(name string, locks []string, isReadLock bool) bool {
+	if locks == nil {
+		return false // No longer held
+	}
+	for _, p := range ds.lockPlacements(ds.membership(), name, isReadLock) {
+		count := 0
+		for _, index := range p.nodes {
+			if index >= len(locks) || !isLocked(locks[index]) {
+				continue
+			}
+			if l, ok := ds.leases[leaseKey{locks[index], name}]; !ok || !l.expired {
+				count++
+			}
+		}
+		if count < p.quorum {
+			return false
+		}
+	}
+	return true
+}
+
+// leaseKey - lock a lease is refreshed for. The locks of a batch share their uid at a
+// node (see MultiMutex), so leases are kept per name as well.
+type leaseKey struct {
+	uid, name string
+}
+
+// stopLease stops refreshing the lease of the lock on name with uid, if any, returning
+// false when there was none (anymore).
+func (ds *Dsync) stopLease(name, uid string) bool {
+	ds.leasesMutex.Lock()
+	defer ds.leasesMutex.Unlock()
+	key := leaseKey{uid, name}
+	l, ok := ds.leases[key]
+	if ok {
+		close(l.stop)
+		delete(ds.leases, key)
+	}
+	return ok
+}
+
+// stopLeases stops refreshing the leases of the locks on name.
+func (ds *Dsync) stopLeases(name string, locks []string) {
+	for _, uid := range locks {
+		if isLocked(uid) {
+			ds.stopLease(name, uid)
+		}
+	}
+}
+
+// stopAllLeases stops refreshing the leases of all locks, see Close.
+func (ds *Dsync) stopAllLeases() {
+	ds.leasesMutex.Lock()
+	defer ds.leasesMutex.Unlock()
+	for key, l := range ds.leases {
+		close(l.stop)
+		delete(ds.leases, key)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	"errors"
+	. "github.com/minio/dsync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLeaseRefresh(t *testing.T) {
+
+	ds.SetLeaseTTL(time.Minute)
+	defer ds.SetLeaseTTL(0)
+
+	var refreshes, lost int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		a, ok := args.(*LockArgs)
+		if !ok || a.Name != "test-lease" {
+			return invoke(c, serviceMethod, args, reply)
+		}
+		switch serviceMethod {
+		case "Dsync.Lock":
+			if a.TTL != time.Minute {
+				t.Errorf("expected lease of %v to be requested, got %v", time.Minute, a.TTL)
+			}
+			err := invoke(c, serviceMethod, args, reply)
+			if resp := reply.(*LockResp); resp.Granted {
+				resp.TTL = 30 * time.Millisecond // Capped by the lock server
+			}
+			return err
+		case "Dsync.Refresh":
+			// The test lock servers do not implement leases
+			// The last nodes lose the lease one after the other
+			atomic.AddInt64(&refreshes, 1)
+			l := atomic.LoadInt64(&lost)
+			reply.(*LockResp).Granted = !(l > 0 && c.Node() == nodes[N-1]) && !(l > 1 && c.Node() == nodes[N-2])
+			return nil
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	dm := NewDRWMutex("test-lease", ds)
+	dm.Lock()
+	time.Sleep(100 * time.Millisecond)
+	if r := atomic.LoadInt64(&refreshes); r < int64(N) {
+		t.Fatalf("expected leases to be refreshed, got %d refreshes", r)
+	}
+	dm.Unlock()
+
+	// No more refreshes once unlocked
+	time.Sleep(20 * time.Millisecond)
+	r := atomic.LoadInt64(&refreshes)
+	time.Sleep(50 * time.Millisecond)
+	if r2 := atomic.LoadInt64(&refreshes); r2 != r {
+		t.Fatalf("expected no refreshes after unlock, got %d", r2-r)
+	}
+	if l := ds.Debug().Leases; l != 0 {
+		t.Fatalf("expected no lease goroutines after unlock, got %d", l)
+	}
+
+	// Losing a lease at a single node leaves the lock held at a quorum
+	dm.Lock()
+	revoked := dm.Revoked()
+	atomic.StoreInt64(&lost, 1)
+	select {
+	case <-revoked:
+		t.Fatal("expected lock not to be revoked while a quorum holds its lease")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Losing the lease at another one revokes the lock
+	atomic.StoreInt64(&lost, 2)
+	select {
+	case <-revoked:
+	case <-time.After(time.Second):
+		t.Fatal("expected lock to be revoked once its lease is lost at a quorum")
+	}
+	dm.Unlock()
+}
+
+func TestLeaseRefreshFailing(t *testing.T) {
+
+	ds.SetLeaseTTL(time.Minute)
+	defer ds.SetLeaseTTL(0)
+
+	var failing int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		a, ok := args.(*LockArgs)
+		if !ok || a.Name != "test-lease-failing" {
+			return invoke(c, serviceMethod, args, reply)
+		}
+		switch serviceMethod {
+		case "Dsync.Lock":
+			err := invoke(c, serviceMethod, args, reply)
+			if resp := reply.(*LockResp); resp.Granted {
+				resp.TTL = 60 * time.Millisecond
+			}
+			return err
+		case "Dsync.Refresh":
+			if c.Node() != nodes[0] && atomic.LoadInt64(&failing) == 1 {
+				return errors.New("unreachable")
+			}
+			reply.(*LockResp).Granted = true
+			return nil
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	// Leases that cannot be refreshed at a quorum expire after their lease
+	start := time.Now()
+	atomic.StoreInt64(&failing, 1)
+	dm := NewDRWMutex("test-lease-failing", ds)
+	dm.Lock()
+	defer dm.Unlock()
+	revoked := dm.Revoked()
+	select {
+	case <-revoked:
+		if d := time.Since(start); d < 60*time.Millisecond {
+			t.Fatalf("expected lock to be revoked once the lease passed, got revoked after %v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected lock to be revoked once its lease could not be refreshed at a quorum")
+	}
+}
+
+func TestLeaseTTLKey(t *testing.T) {
+
+	ds.SetLeaseTTL(time.Minute)
+	defer ds.SetLeaseTTL(0)
+
+	var requested int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && a.Name == "test-lease-key" && serviceMethod == "Dsync.Lock" {
+			atomic.StoreInt64(&requested, int64(a.TTL))
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	// The lease in the context overrides the lease of the cluster for a single acquisition
+	dm := NewDRWMutex("test-lease-key", ds)
+	if !dm.LockContext(context.WithValue(context.Background(), LeaseTTLKey, time.Hour)) {
+		t.Fatal("expected lock to be granted")
+	}
+	dm.Unlock()
+	if d := time.Duration(atomic.LoadInt64(&requested)); d != time.Hour {
+		t.Fatalf("expected lease of %v to be requested, got %v", time.Hour, d)
+	}
+
+	dm.Lock()
+	dm.Unlock()
+	if d := time.Duration(atomic.LoadInt64(&requested)); d != time.Minute {
+		t.Fatalf("expected lease of %v to be requested, got %v", time.Minute, d)
+	}
+}
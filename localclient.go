@@ -0,0 +1,110 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// localClient - RPC implementation calling the methods of an in-process lock server.
+type localClient struct {
+	node string
+	rcvr reflect.Value
+}
+
+// NewLocalClient returns an RPC client for a lock server running in the same process,
+// calling its methods directly (following the net/rpc conventions) instead of going
+// over the network. Using local clients for all nodes runs dsync entirely in-process
+// while exercising the same code paths, eg. for development or tests.
+func NewLocalClient(node string, rcvr interface{}) RPC {
+	return &localClient{node: node, rcvr: reflect.ValueOf(rcvr)}
+}
+
+// Call calls the method of the lock server named by serviceMethod ("Dsync.<method>").
+func (c *localClient) Call(serviceMethod string, args interface {
+	SetToken(token string)
+	SetTimestamp(tstamp time.Time)
+}, reply interface{}) error {
+	method, err := lookupMethod(c.rcvr, serviceMethod)
+	if err != nil {
+		return err
+	}
+	in := []reflect.Value{reflect.ValueOf(args), reflect.ValueOf(reply)}
+	mt := method.Type()
+	if !in[0].Type().AssignableTo(mt.In(0)) || !in[1].Type().AssignableTo(mt.In(1)) {
+		return errors.New("rpc: wrong arguments for method " + serviceMethod)
+	}
+	out := method.Call(in)
+	if err, _ := out[0].Interface().(error); err != nil {
+		return err
+	}
+	return nil
+}
+
+// lookupMethod returns the method of rcvr named by serviceMethod ("Dsync.<method>"),
+// provided that it follows the net/rpc conventions.
+func lookupMethod(rcvr reflect.Value, serviceMethod string) (reflect.Value, error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return reflect.Value{}, errors.New("rpc: service/method request ill-formed: " + serviceMethod)
+	}
+	method := rcvr.MethodByName(serviceMethod[dot+1:])
+	if !method.IsValid() {
+		return reflect.Value{}, errors.New("rpc: can't find method " + serviceMethod)
+	}
+	mt := method.Type()
+	if mt.NumIn() != 2 || mt.NumOut() != 1 || mt.In(0).Kind() != reflect.Ptr || mt.In(1).Kind() != reflect.Ptr {
+		return reflect.Value{}, errors.New("rpc: wrong arguments for method " + serviceMethod)
+	}
+	return method, nil
+}
+
+// Serve calls the method of the lock server rcvr named by serviceMethod ("Dsync.<method>")
+// with the arguments in data and returns the encoded reply, both encoded with codec. It
+// serves transports that carry the RPCs as messages (eg. gRPC or NATS) on the side of the
+// lock server, like NewLocalClient on the side of the client.
+func Serve(rcvr interface{}, serviceMethod string, data []byte, codec Codec) ([]byte, error) {
+	method, err := lookupMethod(reflect.ValueOf(rcvr), serviceMethod)
+	if err != nil {
+		return nil, err
+	}
+	mt := method.Type()
+	args, reply := reflect.New(mt.In(0).Elem()), reflect.New(mt.In(1).Elem())
+	if err = codec.Unmarshal(data, args.Interface()); err != nil {
+		return nil, err
+	}
+	out := method.Call([]reflect.Value{args, reply})
+	if err, _ := out[0].Interface().(error); err != nil {
+		return nil, err
+	}
+	return codec.Marshal(reply.Interface())
+}
+
+func (c *localClient) Node() string {
+	return c.node
+}
+
+func (c *localClient) RPCPath() string {
+	return DefaultPath
+}
+
+func (c *localClient) Close() error {
+	return nil
+}
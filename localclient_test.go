@@ -0,0 +1,103 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalClient(t *testing.T) {
+
+	l := lockserver.New(lockserver.Options{})
+	defer l.Close()
+	c := NewLocalClient("local", l)
+
+	var resp LockResp
+	if err := c.Call("Dsync.Lock", &LockArgs{Name: "test", UID: "1"}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected write lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+	if err := c.Call("Dsync.RLock", &LockArgs{Name: "test", UID: "2"}, &resp); err != nil || resp.Granted {
+		t.Fatalf("expected read lock to be denied, got %v (%v)", resp.Granted, err)
+	}
+	if err := c.Call("Dsync.RUnlock", &LockArgs{Name: "test", UID: "2"}, &resp); err == nil {
+		t.Fatal("expected error from lock server to be returned")
+	}
+
+	var snapshot SnapshotReply
+	if err := c.Call("Dsync.Snapshot", &SnapshotArgs{}, &snapshot); err != nil || len(snapshot.Entries) != 1 {
+		t.Fatalf("expected a single lock, got %v (%v)", snapshot.Entries, err)
+	}
+
+	if err := c.Call("Dsync.Unknown", &LockArgs{}, &resp); err == nil || !strings.Contains(err.Error(), "can't find method") {
+		t.Fatalf("expected unknown method error, got %v", err)
+	}
+	if err := c.Call("Dsync.Lock", &SnapshotArgs{}, &resp); err == nil {
+		t.Fatal("expected error for wrong arguments")
+	}
+}
+
+func TestServe(t *testing.T) {
+
+	l := lockserver.New(lockserver.Options{})
+	defer l.Close()
+
+	data, err := JSONCodec.Marshal(&LockArgs{Name: "test", UID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = Serve(l, "Dsync.Lock", data, JSONCodec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp LockResp
+	if err = JSONCodec.Unmarshal(data, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected write lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+
+	if _, err = Serve(l, "Dsync.Unknown", data, JSONCodec); err == nil || !strings.Contains(err.Error(), "can't find method") {
+		t.Fatalf("expected unknown method error, got %v", err)
+	}
+	if _, err = Serve(l, "Dsync.Lock", []byte("{"), JSONCodec); err == nil {
+		t.Fatal("expected error for malformed arguments")
+	}
+}
+
+func TestMultipleClusters(t *testing.T) {
+
+	other, err := lockserver.Standalone(4, lockserver.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dm := NewDRWMutex("test-clusters", ds)
+	dm.Lock()
+	defer dm.Unlock()
+
+	// The same name is locked independently in the other cluster
+	om := NewDRWMutex("test-clusters", other)
+	if !om.LockWithTimeout(time.Second) {
+		t.Fatal("expected lock in other cluster to be granted")
+	}
+	if NewDRWMutex("test-clusters", other).TryLock() {
+		t.Fatal("expected second lock in other cluster to be denied")
+	}
+	om.Unlock()
+}
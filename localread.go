@@ -0,0 +1,93 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Time a write intent keeps lock servers from granting read locks, comfortably longer
+// than the back-off between two rounds of a writer.
+const writeIntentValidity = 2 * time.Second
+
+// SetLocalReads enables (or disables) the read-mostly protocol, in which a read lock is
+// granted by the lock server of this node only, whereas a write lock has to be granted
+// by all nodes (instead of a quorum).
+//
+// Read locks thus cost a single (local) request, at the expense of writers: a write lock
+// can only be acquired while all nodes are reachable. Writers broadcast their intent with
+// every write request, upon which lock servers refuse new read locks for a while so that
+// the read locks held drain and the writer is not starved by a steady stream of readers.
+//
+// The protocol must be enabled by all processes sharing locks before any lock is acquired,
+// mixing both protocols on the same names breaks mutual exclusion. It cannot be combined
+// with a replication factor (see SetReplication): enabling it then returns a *ConfigError,
+// as write locks might not be placed on the node granting the read locks.
+func (ds *Dsync) SetLocalReads(enabled bool) error {
+	ds.protocolMutex.Lock()
+	defer ds.protocolMutex.Unlock()
+	var v int32
+	if enabled {
+		if atomic.LoadInt32(&ds.replicationFactor) > 0 {
+			return &ConfigError{"Local reads cannot be combined with replication"}
+		}
+		v = 1
+	}
+	atomic.StoreInt32(&ds.localReads, v)
+	return nil
+}
+
+func (ds *Dsync) localReadsEnabled() bool {
+	return atomic.LoadInt32(&ds.localReads) == 1
+}
+
+// lockNodes returns the indices of the nodes of m to request a lock on name from.
+func (ds *Dsync) lockNodes(m *members, name string, isReadLock bool) []int {
+	if isReadLock && ds.localReadsEnabled() {
+		return []int{m.ownNode}
+	}
+	return ds.replicaNodes(m, name)
+}
+
+// lockQuorum returns the number of the nodes of m that have to grant a lock.
+func (ds *Dsync) lockQuorum(m *members, isReadLock bool) int {
+	replicas := ds.replicaCount(m)
+	switch {
+	case isReadLock && ds.localReadsEnabled():
+		return 1
+	case ds.localReadsEnabled():
+		return replicas
+	case replicas == m.count && isReadLock:
+		return m.quorumReads
+	case replicas == m.count:
+		return m.quorum
+	case isReadLock:
+		return (replicas + 1) / 2 // Rounded up, so that it overlaps with every write quorum
+	default:
+		return replicas/2 + 1
+	}
+}
+
+// writeIntent returns the validity of the write intent to pass with a lock request,
+// zero when none.
+func (ds *Dsync) writeIntent(isReadLock bool) time.Duration {
+	if isReadLock || !ds.localReadsEnabled() {
+		return 0
+	}
+	return writeIntentValidity
+}
@@ -0,0 +1,117 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	. "github.com/minio/dsync"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalReads(t *testing.T) {
+
+	var mutex sync.Mutex
+	rlocks := make(map[string]int)
+	intent := make(chan struct{}, 1)
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		err := invoke(c, serviceMethod, args, reply)
+		if a, ok := args.(*LockArgs); ok && a.Name == "test-local-reads" {
+			switch serviceMethod {
+			case "Dsync.RLock":
+				mutex.Lock()
+				rlocks[c.Node()]++
+				mutex.Unlock()
+			case "Dsync.Lock":
+				// Signal once the lock server of this node has received the intent
+				if a.Intent > 0 && c.Node() == nodes[0] {
+					select {
+					case intent <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+		return err
+	})
+	defer ds.SetInterceptors()
+
+	if err := ds.SetLocalReads(true); err != nil {
+		t.Fatal(err)
+	}
+	defer ds.SetLocalReads(false)
+
+	// Read locks are granted by the lock server of this node only
+	dm1 := NewDRWMutex("test-local-reads", ds)
+	dm1.RLock()
+	mutex.Lock()
+	if len(rlocks) != 1 || rlocks[nodes[0]] != 1 {
+		t.Fatalf("expected a single read lock request to %s, got %v", nodes[0], rlocks)
+	}
+	mutex.Unlock()
+
+	// A writer broadcasts its intent and waits for the read lock to drain
+	dm2 := NewDRWMutex("test-local-reads", ds)
+	locked := make(chan struct{})
+	go func() {
+		dm2.Lock()
+		close(locked)
+	}()
+	<-intent
+
+	// Meanwhile new readers are refused
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	dm3 := NewDRWMutex("test-local-reads", ds)
+	if dm3.RLockContext(ctx) {
+		t.Fatal("expected read lock to be refused while a writer is waiting")
+	}
+	select {
+	case <-locked:
+		t.Fatal("expected writer to wait for the read lock to drain")
+	default:
+	}
+
+	dm1.RUnlock()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected writer to get the lock once the read lock drained")
+	}
+	dm2.Unlock()
+
+	// Readers are welcome again once the writer is done
+	dm3.RLock()
+	dm3.RUnlock()
+}
+
+func TestLocalReadsReplication(t *testing.T) {
+
+	if err := ds.SetReplication(3); err != nil {
+		t.Fatal(err)
+	}
+	defer ds.SetReplication(0)
+
+	// Write locks might not be placed on the own node, which grants the read locks
+	if _, ok := ds.SetLocalReads(true).(*ConfigError); !ok {
+		t.Fatal("expected local reads to be refused while a replication factor is set")
+	}
+	if err := ds.SetLocalReads(false); err != nil {
+		t.Fatal(err)
+	}
+}
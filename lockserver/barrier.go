@@ -0,0 +1,101 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"sort"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// Time after which a phase of a barrier that no participant arrived at or polled is
+// dropped, so that abandoned barriers do not accumulate.
+const barrierExpiry = 24 * time.Hour
+
+// barrierPhase - participants arrived at a phase of a barrier (see dsync.DBarrier).
+type barrierPhase struct {
+	parties int
+	arrived map[string]struct{}
+	touched time.Time // Time of the last arrival or poll
+}
+
+// Barrier - rpc handler for arriving at a phase of a barrier, or listing the participants
+// arrived at it when no uid is given.
+func (l *LockServer) Barrier(args *dsync.BarrierArgs, reply *dsync.BarrierReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	l.barrierMutex.Lock()
+	defer l.barrierMutex.Unlock()
+	now := time.Now()
+	l.expireBarriers(now, barrierExpiry)
+
+	phases := l.barriers[args.Barrier]
+	p, ok := phases[args.Generation]
+	if args.UID != "" {
+		if !ok {
+			if phases == nil {
+				if l.barriers == nil {
+					l.barriers = make(map[string]map[uint64]*barrierPhase)
+				}
+				phases = make(map[uint64]*barrierPhase)
+				l.barriers[args.Barrier] = phases
+			}
+			p = &barrierPhase{parties: args.Parties, arrived: make(map[string]struct{})}
+			phases[args.Generation] = p
+		}
+		if p.parties != args.Parties {
+			return nil // Denied, the participant disagrees about the number of parties
+		}
+		p.arrived[args.UID] = struct{}{}
+		if len(p.arrived) >= p.parties {
+			// All parties passed the earlier phases, nobody polls them anymore
+			for generation := range phases {
+				if generation < args.Generation {
+					delete(phases, generation)
+				}
+			}
+		}
+		reply.Granted = true
+	} else if !ok {
+		return nil
+	}
+	p.touched = now
+	for uid := range p.arrived {
+		reply.Arrived = append(reply.Arrived, uid)
+	}
+	sort.Strings(reply.Arrived)
+	return nil
+}
+
+// expireBarriers drops the phases of barriers that have not been touched for expiry at
+// the given time, returning the number of phases dropped. The caller must hold barrierMutex.
+func (l *LockServer) expireBarriers(now time.Time, expiry time.Duration) (expired int) {
+	for name, phases := range l.barriers {
+		for generation, p := range phases {
+			if now.Sub(p.touched) > expiry {
+				delete(phases, generation)
+				expired++
+			}
+		}
+		if len(phases) == 0 {
+			delete(l.barriers, name)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,70 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// LockBatch - rpc handler for the locks on several names requested at once (see
+// dsync.FeatureBatching), granting either all of them or none. The names are locked in
+// order, one by one with the checks of Lock (or RLock for dsync.Shared), releasing the
+// locks granted so far once one of them is denied. The lease of every name is returned
+// in TTLs, as names may fall under different lease policies (see Options.LeaseTTLs).
+func (l *LockServer) LockBatch(args *dsync.BatchArgs, resp *dsync.LockResp) error {
+	if err := l.validateLockArgs(&args.LockArgs); err != nil {
+		return err
+	}
+	if args.DryRun {
+		return errors.New("LockBatch does not support dry runs")
+	}
+	lock, unlock := l.Lock, l.Unlock
+	if args.Mode == dsync.Shared {
+		lock, unlock = l.RLock, l.RUnlock
+	}
+	names := append([]string(nil), args.Names...)
+	sort.Strings(names)
+	for i, name := range names {
+		single := args.LockArgs
+		single.Name = name
+		var granted dsync.LockResp
+		err := lock(&single, &granted)
+		if err != nil || !granted.Granted {
+			for _, name := range names[:i] {
+				single.Name = name
+				unlock(&single, &dsync.LockResp{})
+			}
+			resp.Frozen, resp.Paused = granted.Frozen, granted.Paused
+			return err
+		}
+		if granted.TTL > 0 {
+			if resp.TTLs == nil {
+				resp.TTLs = make(map[string]time.Duration, len(names))
+			}
+			resp.TTLs[name] = granted.TTL
+			if resp.TTL == 0 || granted.TTL < resp.TTL {
+				resp.TTL = granted.TTL
+			}
+		}
+	}
+	resp.Granted = true
+	return nil
+}
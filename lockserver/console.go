@@ -0,0 +1,176 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+const consoleHelp = `Commands:
+  locks              list all names that are locked
+  holders <name>     show the holders of the lock on name
+  expire <name>      remove the lock on name (irrespective of write or read lock)
+  stats              show lock statistics
+  hotspots           show the most contended names
+  help               show this help
+  quit               close the console
+`
+
+// ServeConsole serves an interactive debug console, reading commands from r (one per
+// line) and writing the results to w, eg. for a connection accepted on an admin port.
+func (l *LockServer) ServeConsole(r io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(r)
+	fmt.Fprint(w, "> ")
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			fmt.Fprint(w, "> ")
+			continue
+		}
+		switch {
+		case fields[0] == "locks" && len(fields) == 1:
+			l.consoleLocks(w)
+		case fields[0] == "holders" && len(fields) == 2:
+			l.consoleHolders(w, fields[1])
+		case fields[0] == "expire" && len(fields) == 2:
+			l.consoleExpire(w, fields[1])
+		case fields[0] == "stats" && len(fields) == 1:
+			l.consoleStats(w)
+		case fields[0] == "hotspots" && len(fields) == 1:
+			l.consoleHotspots(w)
+		case fields[0] == "quit" && len(fields) == 1:
+			return
+		default:
+			fmt.Fprint(w, consoleHelp)
+		}
+		fmt.Fprint(w, "> ")
+	}
+}
+
+func (l *LockServer) consoleLocks(w io.Writer) {
+	err := l.store.Scan("", func(name string, holders []Holder, version uint64) bool {
+		fmt.Fprintln(w, name)
+		return true
+	})
+	if err != nil {
+		fmt.Fprintln(w, "error:", err)
+	}
+}
+
+func (l *LockServer) consoleHolders(w io.Writer, name string) {
+	holders, _, err := l.store.Get(name)
+	if err != nil {
+		fmt.Fprintln(w, "error:", err)
+		return
+	}
+
+	if len(holders) == 0 {
+		fmt.Fprintf(w, "%s is not locked\n", name)
+		return
+	}
+	for _, holder := range holders {
+		mode := "read"
+		if holder.Writer {
+			mode = "write"
+		}
+		fmt.Fprintf(w, "%-5s uid: %s  node: %s%s  since: %s (%s)\n", mode, holder.UID, holder.Node, holder.RPCPath,
+			holder.Timestamp.Format(time.RFC3339), l.now().Sub(holder.Timestamp).Truncate(time.Millisecond))
+		if holder.Owner != "" {
+			fmt.Fprintf(w, "      owner: %s  source: %s\n", holder.Owner, holder.Source)
+		}
+		if len(holder.Tags) > 0 {
+			fmt.Fprintf(w, "      tags: %s\n", formatTags(holder.Tags))
+		}
+	}
+}
+
+// formatTags formats tags as a list of key=value pairs sorted by key.
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+func (l *LockServer) consoleExpire(w io.Writer, name string) {
+	var expired int
+	err := l.update(name, func(holders []Holder) ([]Holder, bool, error) {
+		expired = len(holders)
+		return nil, expired > 0, nil
+	})
+	if err != nil {
+		fmt.Fprintln(w, "error:", err)
+		return
+	}
+
+	if expired == 0 {
+		fmt.Fprintf(w, "%s is not locked\n", name)
+		return
+	}
+	l.log(dsync.LevelInfo, "Admin console expired lock", dsync.Fields{"name": name, "holders": expired})
+	fmt.Fprintf(w, "expired lock on %s (%d holders)\n", name, expired)
+}
+
+func (l *LockServer) consoleStats(w io.Writer) {
+	var names, writeLocks, readLocks int
+	err := l.store.Scan("", func(name string, holders []Holder, version uint64) bool {
+		names++
+		if isWriteLock(holders) {
+			writeLocks++
+		} else {
+			readLocks += len(holders)
+		}
+		return true
+	})
+	if err != nil {
+		fmt.Fprintln(w, "error:", err)
+		return
+	}
+
+	fmt.Fprintf(w, "names locked: %d\nwrite locks: %d\nread locks: %d\n", names, writeLocks, readLocks)
+	l.pauseMutex.Lock()
+	pausedSince := l.pausedSince
+	l.pauseMutex.Unlock()
+	if !pausedSince.IsZero() {
+		fmt.Fprintf(w, "granting paused since %s\n", pausedSince.Format(time.RFC3339))
+	}
+	if l.opts.IdleTimeout > 0 {
+		gc := l.GCStats()
+		fmt.Fprintf(w, "idle bookkeeping collected: %d queues (%d jobs), %d barrier phases, %d intents, %d hotspot entries in %d runs\n",
+			gc.Queues, gc.Jobs, gc.Barriers, gc.Intents, gc.Hotspots, gc.Runs)
+	}
+}
+
+func (l *LockServer) consoleHotspots(w io.Writer) {
+	if l.hotspots == nil {
+		fmt.Fprintln(w, "hotspot tracking is not enabled")
+		return
+	}
+
+	for _, hs := range l.hotspots.top(10) {
+		fmt.Fprintf(w, "%s  requests: %d  denies: %d  avg wait: %s\n", hs.Name, hs.Requests, hs.Denies, hs.AvgWait.Truncate(time.Millisecond))
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import "github.com/minio/dsync"
+
+// dryRun sets whether the lock requested by args would be granted, running the checks of
+// Lock and RLock without recording the grant (see dsync.DRWMutex.DryRunLock).
+func (l *LockServer) dryRun(args *dsync.LockArgs, writer bool, resp *dsync.LockResp) error {
+	if l.refuseGrant(args.Name, resp) {
+		return nil
+	}
+	if !writer {
+		if admitted, _ := l.admitRead(args.Name, args.Node, false); !admitted {
+			return nil // A writer is waiting for the read locks held to drain
+		}
+	}
+	holders, _, err := l.store.Get(args.Name)
+	if err != nil {
+		return err
+	}
+	holders, _ = dropExpired(holders, l.now())
+	conflict, err := l.hierarchyConflict(args.Name, writer)
+	if err != nil {
+		return err
+	}
+	if writer {
+		resp.Granted = len(holders) == 0 && !conflict
+	} else {
+		resp.Granted = !isWriteLock(holders) && !conflict
+	}
+	if resp.Granted = resp.Granted && l.intercept(args, writer, holders); resp.Granted {
+		// Unless the quota of the namespace is exhausted
+		if resp.Granted = l.reserveQuota(args.Name); resp.Granted {
+			l.releaseQuota(args.Name, 1)
+		}
+	}
+	return nil
+}
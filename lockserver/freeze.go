@@ -0,0 +1,117 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// loadFrozen loads the frozen names from the freeze file (if any).
+func (l *LockServer) loadFrozen() error {
+	l.frozen = make(map[string]struct{})
+	if l.opts.FreezeFile == "" {
+		return nil
+	}
+	var names []string
+	if _, err := l.loadState(l.opts.FreezeFile, freezeSchema, &names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		l.frozen[name] = struct{}{}
+	}
+	return nil
+}
+
+// frozenNames returns the frozen names in sorted order, the caller must hold frozenMutex.
+func (l *LockServer) frozenNames() []string {
+	names := make([]string, 0, len(l.frozen))
+	for name := range l.frozen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// saveFrozen atomically replaces the freeze file (if any) with the frozen names,
+// the caller must hold frozenMutex.
+func (l *LockServer) saveFrozen() error {
+	if l.opts.FreezeFile == "" {
+		return nil
+	}
+	return saveState(l.opts.FreezeFile, freezeSchema, l.frozenNames())
+}
+
+// isFrozen returns whether name is frozen.
+func (l *LockServer) isFrozen(name string) bool {
+	l.frozenMutex.Lock()
+	defer l.frozenMutex.Unlock()
+	_, ok := l.frozen[name]
+	return ok
+}
+
+// Freeze - rpc handler for (un)freezing a name on behalf of an operator, replying with
+// all frozen names. Lock requests for frozen names are denied. Changes are persisted in
+// the freeze file and recorded in the audit log; an empty name only lists the frozen names.
+func (l *LockServer) Freeze(args *dsync.FreezeArgs, reply *dsync.FreezeReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	l.frozenMutex.Lock()
+	defer l.frozenMutex.Unlock()
+
+	if args.Name != "" {
+		if args.Operator == "" || args.Reason == "" {
+			return errors.New("Freeze called without operator or reason")
+		}
+
+		_, wasFrozen := l.frozen[args.Name]
+		if args.Unfreeze {
+			delete(l.frozen, args.Name)
+		} else {
+			l.frozen[args.Name] = struct{}{}
+		}
+		if err := l.saveFrozen(); err != nil {
+			// Revert, so that the frozen names match the freeze file
+			if wasFrozen {
+				l.frozen[args.Name] = struct{}{}
+			} else {
+				delete(l.frozen, args.Name)
+			}
+			return fmt.Errorf("Unable to persist frozen names: %v", err)
+		}
+
+		operation := "freeze"
+		if args.Unfreeze {
+			operation = "unfreeze"
+		}
+		l.audit(AuditRecord{
+			Time:      time.Now().UTC(),
+			Operation: operation,
+			Name:      args.Name,
+			Operator:  args.Operator,
+			Reason:    args.Reason,
+		})
+	}
+
+	reply.Names = l.frozenNames()
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"time"
+)
+
+// GCStats - bookkeeping of idle names collected by a lock server since start, see
+// Options.IdleTimeout.
+type GCStats struct {
+	Runs     uint64 // Number of collections
+	Queues   uint64 // Idle queues dropped
+	Jobs     uint64 // Jobs dropped along with their queues
+	Barriers uint64 // Idle phases of barriers dropped
+	Intents  uint64 // Expired write intents removed
+	Hotspots uint64 // Contention counts and waiting clients dropped from hotspot tracking
+}
+
+// GCStats returns the bookkeeping collected since start.
+func (l *LockServer) GCStats() GCStats {
+	l.gcMutex.Lock()
+	defer l.gcMutex.Unlock()
+	return l.gcStats
+}
+
+// gcLoop collects the bookkeeping of idle names twice per idle timeout, until the lock
+// server is closed.
+func (l *LockServer) gcLoop() {
+	ticker := time.NewTicker(l.opts.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-l.stop:
+			return
+		}
+		l.collect(time.Now())
+	}
+}
+
+// collect drops the bookkeeping of the names idle for longer than the idle timeout at
+// the given time.
+func (l *LockServer) collect(now time.Time) {
+	var stats GCStats
+	stats.Runs = 1
+
+	l.queueMutex.Lock()
+	for name, touched := range l.queueActivity {
+		if now.Sub(touched) > l.opts.IdleTimeout {
+			stats.Queues++
+			stats.Jobs += uint64(len(l.queues[name]))
+			delete(l.queues, name)
+			delete(l.queueActivity, name)
+		}
+	}
+	l.queueMutex.Unlock()
+
+	l.barrierMutex.Lock()
+	stats.Barriers = uint64(l.expireBarriers(now, l.opts.IdleTimeout))
+	l.barrierMutex.Unlock()
+
+	stats.Intents = uint64(l.expireIntents())
+	if l.hotspots != nil {
+		stats.Hotspots = uint64(l.hotspots.collect(now))
+	}
+
+	l.gcMutex.Lock()
+	l.gcStats.Runs += stats.Runs
+	l.gcStats.Queues += stats.Queues
+	l.gcStats.Jobs += stats.Jobs
+	l.gcStats.Barriers += stats.Barriers
+	l.gcStats.Intents += stats.Intents
+	l.gcStats.Hotspots += stats.Hotspots
+	l.gcMutex.Unlock()
+}
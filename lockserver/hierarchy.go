@@ -0,0 +1,75 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"strings"
+
+	"github.com/minio/dsync"
+)
+
+// lockHierarchy serializes the grants of a hierarchical lock server (see Options.Hierarchical),
+// so that no two conflicting locks on an ancestor and a descendant are granted concurrently.
+// Returns the function to call once the grant is done.
+func (l *LockServer) lockHierarchy() (unlock func()) {
+	if !l.opts.Hierarchical {
+		return func() {}
+	}
+	l.hierarchyMutex.Lock()
+	return l.hierarchyMutex.Unlock
+}
+
+// hierarchyConflict returns whether a lock on name (a write lock when writer is set)
+// conflicts with the locks held on the ancestors or descendants of name, the names
+// separated by dsync.NamespaceSeparator: a write lock conflicts with any lock, a read
+// lock with write locks only. Always false unless Options.Hierarchical is set.
+func (l *LockServer) hierarchyConflict(name string, writer bool) (bool, error) {
+	if !l.opts.Hierarchical {
+		return false, nil
+	}
+	now := l.now()
+	conflicts := func(holders []Holder) bool {
+		holders, _ = dropExpired(holders, now)
+		return len(holders) > 0 && (writer || isWriteLock(holders))
+	}
+
+	// Ancestors, eg. "bucket" of "bucket/object"
+	for i := strings.Index(name, dsync.NamespaceSeparator); i >= 0; {
+		if i > 0 {
+			holders, _, err := l.store.Get(name[:i])
+			if err != nil {
+				return false, err
+			}
+			if conflicts(holders) {
+				return true, nil
+			}
+		}
+		next := strings.Index(name[i+1:], dsync.NamespaceSeparator)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+
+	// Descendants, eg. "bucket/object" of "bucket"
+	conflict := false
+	err := l.store.Scan(name+dsync.NamespaceSeparator, func(_ string, holders []Holder, _ uint64) bool {
+		conflict = conflicts(holders)
+		return !conflict
+	})
+	return conflict, err
+}
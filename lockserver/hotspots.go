@@ -0,0 +1,246 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// Number of buckets the sliding window of the hotspot tracker is divided into.
+const hotspotBuckets = 6
+
+type hotspotCounts struct {
+	requests, denies int64
+	waits            int64         // Number of waits that ended in a grant
+	waited           time.Duration // Total time of those waits
+}
+
+type hotspotBucket struct {
+	epoch int64 // Index of the time slot counted by the bucket
+	names map[string]*hotspotCounts
+}
+
+// hotspotTracker - per name contention over a sliding window.
+type hotspotTracker struct {
+	mutex   sync.Mutex
+	slot    time.Duration // Duration of a single bucket
+	buckets [hotspotBuckets]hotspotBucket
+	waiting map[string]time.Time // Time of the first denied request, by name and client
+}
+
+func newHotspotTracker(window time.Duration) *hotspotTracker {
+	return &hotspotTracker{
+		slot:    window / hotspotBuckets,
+		waiting: make(map[string]time.Time),
+	}
+}
+
+// bucket returns the bucket for now, resetting it when it still counts an old slot.
+func (h *hotspotTracker) bucket(now time.Time) *hotspotBucket {
+	epoch := now.UnixNano() / int64(h.slot)
+	b := &h.buckets[epoch%hotspotBuckets]
+	if b.epoch != epoch || b.names == nil {
+		b.epoch = epoch
+		b.names = make(map[string]*hotspotCounts)
+
+		// forget clients that have been waiting longer than the window
+		for key, since := range h.waiting {
+			if now.Sub(since) > hotspotBuckets*h.slot {
+				delete(h.waiting, key)
+			}
+		}
+	}
+	return b
+}
+
+// collect drops the counts of the buckets that fell out of the window and forgets the
+// clients that have been waiting longer than the window, returning the number of entries
+// dropped. Otherwise they are only dropped once the buckets are reused by new requests.
+func (h *hotspotTracker) collect(now time.Time) (collected int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	current := now.UnixNano() / int64(h.slot)
+	for i := range h.buckets {
+		b := &h.buckets[i]
+		if current-b.epoch >= hotspotBuckets && b.names != nil {
+			collected += len(b.names)
+			b.names = nil
+		}
+	}
+	for key, since := range h.waiting {
+		if now.Sub(since) > hotspotBuckets*h.slot {
+			delete(h.waiting, key)
+			collected++
+		}
+	}
+	return collected
+}
+
+// record counts a lock request on name from a client, granted or denied.
+func (h *hotspotTracker) record(args *dsync.LockArgs, granted bool) {
+	now := time.Now()
+	key := args.Name + "\x00" + args.Node + args.RPCPath
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	b := h.bucket(now)
+	c, ok := b.names[args.Name]
+	if !ok {
+		c = &hotspotCounts{}
+		b.names[args.Name] = c
+	}
+	c.requests++
+	since, waiting := h.waiting[key]
+	switch {
+	case !granted:
+		c.denies++
+		if !waiting {
+			h.waiting[key] = now
+		}
+	case waiting:
+		c.waits++
+		c.waited += now.Sub(since)
+		delete(h.waiting, key)
+	}
+}
+
+// totals returns the counts over the window of the names selected by include.
+func (h *hotspotTracker) totals(include func(name string) bool) map[string]*hotspotCounts {
+	now := time.Now()
+
+	totals := make(map[string]*hotspotCounts)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	current := h.bucket(now).epoch
+	for i := range h.buckets {
+		b := &h.buckets[i]
+		if current-b.epoch >= hotspotBuckets {
+			continue
+		}
+		for name, c := range b.names {
+			if !include(name) {
+				continue
+			}
+			t, ok := totals[name]
+			if !ok {
+				t = &hotspotCounts{}
+				totals[name] = t
+			}
+			t.requests += c.requests
+			t.denies += c.denies
+			t.waits += c.waits
+			t.waited += c.waited
+		}
+	}
+	return totals
+}
+
+func newHotspot(name string, t *hotspotCounts) dsync.Hotspot {
+	hs := dsync.Hotspot{Name: name, Requests: t.requests, Denies: t.denies}
+	if t.waits > 0 {
+		hs.AvgWait = t.waited / time.Duration(t.waits)
+	}
+	return hs
+}
+
+// top returns the count names with the most denies (and then requests) over the window.
+func (h *hotspotTracker) top(count int) []dsync.Hotspot {
+	totals := h.totals(func(string) bool { return true })
+
+	hotspots := make([]dsync.Hotspot, 0, len(totals))
+	for name, t := range totals {
+		hotspots = append(hotspots, newHotspot(name, t))
+	}
+	sort.Slice(hotspots, func(i, j int) bool {
+		if hotspots[i].Denies != hotspots[j].Denies {
+			return hotspots[i].Denies > hotspots[j].Denies
+		}
+		if hotspots[i].Requests != hotspots[j].Requests {
+			return hotspots[i].Requests > hotspots[j].Requests
+		}
+		return hotspots[i].Name < hotspots[j].Name
+	})
+	if count > 0 && len(hotspots) > count {
+		hotspots = hotspots[:count]
+	}
+	return hotspots
+}
+
+// stats returns the counts over the window of the names with prefix and of names
+// (including those without any requests), sorted by name. An empty prefix selects
+// all names, unless names are given.
+func (h *hotspotTracker) stats(prefix string, names []string) []dsync.Hotspot {
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+	totals := h.totals(func(name string) bool {
+		return selected[name] || (prefix != "" || len(names) == 0) && strings.HasPrefix(name, prefix)
+	})
+	for name := range selected {
+		if _, ok := totals[name]; !ok {
+			totals[name] = &hotspotCounts{}
+		}
+	}
+
+	stats := make([]dsync.Hotspot, 0, len(totals))
+	for name, t := range totals {
+		stats = append(stats, newHotspot(name, t))
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// recordRequest counts a lock request for the hotspot tracker (when enabled).
+func (l *LockServer) recordRequest(args *dsync.LockArgs, granted bool) {
+	if l.hotspots != nil {
+		l.hotspots.record(args, granted)
+	}
+}
+
+// Hotspots - rpc handler returning the most contended names over the sliding window.
+func (l *LockServer) Hotspots(args *dsync.HotspotsArgs, reply *dsync.HotspotsReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	if l.hotspots == nil {
+		return errors.New("Hotspot tracking is not enabled")
+	}
+	reply.Window = l.opts.HotspotWindow
+	reply.Hotspots = l.hotspots.top(args.Count)
+	return nil
+}
+
+// Stats - rpc handler returning the contention of many names (selected by prefix and/or
+// by name) over the sliding window in a single call.
+func (l *LockServer) Stats(args *dsync.StatsArgs, reply *dsync.StatsReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	if l.hotspots == nil {
+		return errors.New("Hotspot tracking is not enabled")
+	}
+	reply.Window = l.opts.HotspotWindow
+	reply.Stats = l.hotspots.stats(args.Prefix, args.Names)
+	return nil
+}
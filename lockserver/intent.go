@@ -0,0 +1,103 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import "time"
+
+// writeIntent is the intent of a writer to acquire the lock on a name, along with the
+// batch of read locks still granted while the writer waits.
+type writeIntent struct {
+	expires time.Time
+	batch   map[string]bool // Clients (nodes) granted a read lock since the writer registered its intent
+}
+
+// setIntent records the intent of a writer to acquire the lock on name, refusing read
+// locks on name (beyond the batch of Options.ReadBatch) until validity has passed or
+// the write lock is released. The batch is kept while the writer retries.
+func (l *LockServer) setIntent(name string, validity time.Duration) {
+	l.intentMutex.Lock()
+	defer l.intentMutex.Unlock()
+	if l.intents == nil {
+		l.intents = make(map[string]*writeIntent)
+	}
+	now := l.now()
+	if intent, ok := l.intents[name]; ok && now.Before(intent.expires) {
+		intent.expires = now.Add(validity)
+		return
+	}
+	l.intents[name] = &writeIntent{expires: now.Add(validity)}
+}
+
+// clearIntent removes the write intent on name (if any).
+func (l *LockServer) clearIntent(name string) {
+	l.intentMutex.Lock()
+	defer l.intentMutex.Unlock()
+	delete(l.intents, name)
+}
+
+// admitRead returns true when a read lock on name may be granted to client, that is
+// when no writer intends to acquire the lock, or when the batch of read locks granted
+// while the writer waits has room for client. Every client gets a single read lock of
+// the batch, so that a chatty client cannot take the batch from the others. When
+// reserve is set the read lock is counted in the batch (returning true for batched), to
+// be returned with unreserveRead when it is not granted after all.
+func (l *LockServer) admitRead(name, client string, reserve bool) (ok, batched bool) {
+	l.intentMutex.Lock()
+	defer l.intentMutex.Unlock()
+	intent, found := l.intents[name]
+	if !found {
+		return true, false
+	}
+	if !l.now().Before(intent.expires) {
+		delete(l.intents, name)
+		return true, false
+	}
+	if len(intent.batch) >= l.opts.ReadBatch || intent.batch[client] {
+		return false, false
+	}
+	if reserve {
+		if intent.batch == nil {
+			intent.batch = make(map[string]bool)
+		}
+		intent.batch[client] = true
+	}
+	return true, reserve
+}
+
+// unreserveRead returns the read lock of client reserved by admitRead to the batch.
+func (l *LockServer) unreserveRead(name, client string) {
+	l.intentMutex.Lock()
+	defer l.intentMutex.Unlock()
+	if intent, ok := l.intents[name]; ok {
+		delete(intent.batch, client)
+	}
+}
+
+// expireIntents removes the write intents of writers that gave up, returning the number
+// of intents removed.
+func (l *LockServer) expireIntents() (expired int) {
+	l.intentMutex.Lock()
+	defer l.intentMutex.Unlock()
+	now := l.now()
+	for name, intent := range l.intents {
+		if !now.Before(intent.expires) {
+			delete(l.intents, name)
+			expired++
+		}
+	}
+	return expired
+}
@@ -0,0 +1,85 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// Request - lock request as presented to an Interceptor.
+type Request struct {
+	Name     string            // Name of the lock
+	Writer   bool              // Bool whether write or read lock
+	Mode     dsync.LockMode    // Mode of the lock, see dsync.ModeOf
+	Node     string            // Network address of client claiming lock
+	RPCPath  string            // RPC path of client claiming lock
+	UID      string            // Uid to uniquely identify request of client
+	Priority int               // Priority of the request (see dsync.PriorityKey)
+	Tenant   string            // Tenant on whose behalf the request is made (see dsync.TenantKey)
+	DryRun   bool              // Only checks whether the lock would be granted (see dsync.DRWMutex.DryRunLock)
+	Tags     map[string]string // Tags of the request (see dsync.TagsKey)
+
+	// Time after which the client no longer waits for the response (derived from the
+	// remaining time of the client, so without clock skew), zero when unknown. A
+	// request that cannot be served in time can be denied right away.
+	Deadline time.Time
+}
+
+// Interceptor - custom policy deciding on lock requests, eg. to only allow write locks
+// during business hours or to limit the number of locks per tenant.
+type Interceptor interface {
+	// Intercept is called when the lock server is about to grant a lock, with the
+	// request and the current holders of the lock. Returning false denies the lock.
+	//
+	// An interceptor can only deny locks, never grant conflicting ones. It may be called
+	// more than once for the same request (when the lock is changed concurrently) and
+	// must not call back into the lock server.
+	Intercept(req Request, holders []Holder) bool
+}
+
+// InterceptorFunc - adapter to use an ordinary function as Interceptor.
+type InterceptorFunc func(req Request, holders []Holder) bool
+
+// Intercept calls f(req, holders).
+func (f InterceptorFunc) Intercept(req Request, holders []Holder) bool {
+	return f(req, holders)
+}
+
+// intercept returns whether the interceptor (if any) allows the lock to be granted.
+func (l *LockServer) intercept(args *dsync.LockArgs, writer bool, holders []Holder) bool {
+	if l.opts.Interceptor == nil {
+		return true
+	}
+	req := Request{
+		Name:     args.Name,
+		Writer:   writer,
+		Mode:     dsync.ModeOf(writer),
+		Node:     args.Node,
+		RPCPath:  args.RPCPath,
+		UID:      args.UID,
+		Priority: args.Priority,
+		Tenant:   args.Tenant,
+		DryRun:   args.DryRun,
+		Tags:     args.Tags,
+	}
+	if args.Wait > 0 {
+		req.Deadline = time.Now().Add(args.Wait)
+	}
+	return l.opts.Interceptor.Intercept(req, holders)
+}
@@ -0,0 +1,188 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// Maximum number of events waiting to be shipped, events beyond are dropped.
+const journalBacklog = 4096
+
+// Maximum number of events shipped at once.
+const journalBatch = 256
+
+// EventType - kind of change of a lock, see Event.
+type EventType string
+
+const (
+	EventGrant   EventType = "grant"   // Lock granted to a holder
+	EventRelease EventType = "release" // Lock released by (or on behalf of) its holder
+	EventExpire  EventType = "expire"  // Lease of the lock expired
+)
+
+// Event - change of a lock on a lock server, as shipped to the Journal.
+type Event struct {
+	Type    EventType         `json:"type"`
+	Time    time.Time         `json:"time"`
+	Epoch   int64             `json:"epoch"` // Incarnation of the lock server the event happened on
+	Name    string            `json:"name"`
+	Writer  bool              `json:"writer"`
+	Mode    dsync.LockMode    `json:"mode"`
+	Node    string            `json:"node"`
+	RPCPath string            `json:"rpcPath"`
+	UID     string            `json:"uid"`
+	Tags    map[string]string `json:"tags,omitempty"` // Tags of the request (see dsync.TagsKey)
+}
+
+// Journal - sink of the lock events of a lock server, eg. a Kafka or NATS producer, so
+// that downstream systems can build audit pipelines and react to coordination events
+// without polling.
+//
+// Events are shipped asynchronously in batches, in the order they happened on the lock
+// server, and are never retried: a batch that fails to ship is logged and dropped, as
+// are events while the backlog is full, so that a slow sink cannot stall the lock server.
+// Note that every lock server ships its own events, so that a lock granted by a quorum
+// of the lock servers results in an event from each of them.
+type Journal interface {
+	Ship(events []Event) error
+}
+
+// JournalFunc - adapter to use an ordinary function as Journal.
+type JournalFunc func(events []Event) error
+
+// Ship calls f(events).
+func (f JournalFunc) Ship(events []Event) error {
+	return f(events)
+}
+
+// Publisher - message bus publishing data on a subject (or topic), as implemented by
+// the connection of a NATS client.
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// PublishJournal returns a Journal publishing every event as JSON on subject, eg. with a
+// NATS connection or an adapter around a Kafka producer.
+func PublishJournal(p Publisher, subject string) Journal {
+	return JournalFunc(func(events []Event) error {
+		for _, event := range events {
+			b, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if err = p.Publish(subject, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// journal queues the events of the lock server for the journal worker.
+type journal struct {
+	events  chan Event
+	dropped uint64 // Number of events dropped since start
+}
+
+// journalChanges queues an event for every holder granted or removed by an update of the
+// lock on name, when journaling is enabled.
+func (l *LockServer) journalChanges(name string, holders, updated []Holder) {
+	if l.journal == nil {
+		return
+	}
+	now := l.now()
+	for _, h := range holders {
+		if hasHolder(updated, h.UID) {
+			continue
+		}
+		if h.isExpired(now) {
+			l.journalEvent(EventExpire, name, h, now)
+		} else {
+			l.journalEvent(EventRelease, name, h, now)
+		}
+	}
+	for _, h := range updated {
+		if !hasHolder(holders, h.UID) {
+			l.journalEvent(EventGrant, name, h, now)
+		}
+	}
+}
+
+func (l *LockServer) journalEvent(typ EventType, name string, h Holder, now time.Time) {
+	event := Event{Type: typ, Time: now, Epoch: l.epoch, Name: name, Writer: h.Writer, Mode: dsync.ModeOf(h.Writer), Node: h.Node, RPCPath: h.RPCPath, UID: h.UID, Tags: h.Tags}
+	select {
+	case l.journal.events <- event:
+	default:
+		atomic.AddUint64(&l.journal.dropped, 1)
+	}
+}
+
+// JournalDropped returns the number of events dropped since start, because the backlog
+// was full or the journal failed to ship them.
+func (l *LockServer) JournalDropped() uint64 {
+	if l.journal == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&l.journal.dropped)
+}
+
+// journalLoop ships the queued events in batches until the lock server is closed, shipping
+// the events still queued at that time.
+func (l *LockServer) journalLoop() {
+	for {
+		var batch []Event
+		select {
+		case event := <-l.journal.events:
+			batch = append(batch, event)
+		case <-l.stop:
+			for {
+				select {
+				case event := <-l.journal.events:
+					batch = append(batch, event)
+				default:
+					l.ship(batch)
+					return
+				}
+			}
+		}
+	drain:
+		for len(batch) < journalBatch {
+			select {
+			case event := <-l.journal.events:
+				batch = append(batch, event)
+			default:
+				break drain
+			}
+		}
+		l.ship(batch)
+	}
+}
+
+func (l *LockServer) ship(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := l.opts.Journal.Ship(batch); err != nil {
+		atomic.AddUint64(&l.journal.dropped, uint64(len(batch)))
+		l.log(dsync.LevelError, "Failed to ship lock events", dsync.Fields{"events": len(batch), "error": err})
+	}
+}
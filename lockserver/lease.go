@@ -0,0 +1,135 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"strings"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// LeaseTTL - lease policy for the locks on a name prefix.
+type LeaseTTL struct {
+	// Lease granted when the client does not request one, zero for no lease.
+	Default time.Duration
+
+	// Maximum lease granted, zero for no maximum. Applies to clients requesting no
+	// lease as well, so that no lock is held forever by a client that went away.
+	Max time.Duration
+}
+
+// leaseTTL returns the lease to grant for a lock on name when the client requests
+// the given lease, zero when the lock does not expire.
+func (l *LockServer) leaseTTL(name string, requested time.Duration) time.Duration {
+	var prefix string
+	var policy LeaseTTL
+	found := false
+	for p, t := range l.opts.LeaseTTLs {
+		if strings.HasPrefix(name, p) && (!found || len(p) > len(prefix)) {
+			prefix, policy, found = p, t, true
+		}
+	}
+	ttl := requested
+	if ttl <= 0 {
+		ttl = policy.Default
+	}
+	if policy.Max > 0 && (ttl <= 0 || ttl > policy.Max) {
+		ttl = policy.Max
+	}
+	return ttl
+}
+
+// now returns the time by the clock the leases expire by, see Options.Clock.
+func (l *LockServer) now() time.Time {
+	if l.opts.Clock != nil {
+		return l.opts.Clock.Now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// isExpired returns true when the lease of the holder has expired.
+func (h Holder) isExpired(now time.Time) bool {
+	return !h.Expires.IsZero() && now.After(h.Expires)
+}
+
+// dropExpired returns the holders whose lease has not expired by now, and whether any did.
+func dropExpired(holders []Holder, now time.Time) ([]Holder, bool) {
+	kept := holders[:0:0]
+	for _, holder := range holders {
+		if !holder.isExpired(now) {
+			kept = append(kept, holder)
+		}
+	}
+	return kept, len(kept) < len(holders)
+}
+
+// Refresh - rpc handler for extending the lease of a lock, replying with the lease
+// granted. Not granted when the lock is no longer held, eg. because its lease expired.
+func (l *LockServer) Refresh(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	if err := l.validateLockArgs(args); err != nil {
+		return err
+	}
+	ttl := l.leaseTTL(args.Name, args.TTL)
+	err := l.update(args.Name, func(holders []Holder) ([]Holder, bool, error) {
+		holders, expired := dropExpired(holders, l.now())
+		resp.Granted = false
+		for idx := range holders {
+			if holders[idx].UID == args.UID {
+				resp.Granted = true
+				holders[idx].Expires = time.Time{}
+				if ttl > 0 {
+					holders[idx].Expires = l.now().Add(ttl)
+				}
+				return holders, true, nil
+			}
+		}
+		return holders, expired, nil
+	})
+	if err == nil && resp.Granted {
+		resp.TTL = ttl
+	}
+	return err
+}
+
+// expireLeases removes all locks whose lease has expired.
+func (l *LockServer) expireLeases() {
+	var names []string
+	now := l.now()
+	err := l.store.Scan("", func(name string, holders []Holder, version uint64) bool {
+		for _, holder := range holders {
+			if holder.isExpired(now) {
+				names = append(names, name)
+				break
+			}
+		}
+		return true
+	})
+	if err != nil {
+		l.log(dsync.LevelError, "Lock maintenance failed to scan locks", dsync.Fields{"error": err})
+		return
+	}
+
+	for _, name := range names {
+		if err = l.update(name, func(holders []Holder) ([]Holder, bool, error) {
+			kept, expired := dropExpired(holders, now)
+			return kept, expired, nil
+		}); err != nil {
+			l.log(dsync.LevelError, "Lock maintenance failed to expire lock", dsync.Fields{"name": name, "error": err})
+		}
+	}
+}
@@ -0,0 +1,1109 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lockserver implements a lock server for dsync, to be registered as the
+// "Dsync" service of a net/rpc server:
+//
+//	server := rpc.NewServer()
+//	server.RegisterName("Dsync", lockserver.New(lockserver.Options{}))
+//	server.HandleHTTP(dsync.DefaultPath, dsync.DefaultPath+"-debug")
+package lockserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// used when cached timestamp do not match with what client remembers.
+var errInvalidTimestamp = errors.New("Timestamps don't match, server may have restarted.")
+
+func isWriteLock(holders []Holder) bool {
+	return len(holders) == 1 && holders[0].Writer
+}
+
+func (l *LockServer) newHolder(args *dsync.LockArgs, writer bool, ttl time.Duration) Holder {
+	h := Holder{
+		Writer:        writer,
+		Node:          args.Node,
+		RPCPath:       args.RPCPath,
+		UID:           args.UID,
+		Owner:         args.Owner,
+		Source:        args.Source,
+		Tags:          args.Tags,
+		Timestamp:     l.now(),
+		TimeLastCheck: l.now(),
+	}
+	if ttl > 0 {
+		h.Expires = h.Timestamp.Add(ttl)
+	}
+	return h
+}
+
+// Options - configuration of a LockServer.
+type Options struct {
+	// Timestamp set at the time of initialization, lock requests carrying a different
+	// timestamp are refused. Leave zero to accept clients that do not set a timestamp.
+	Timestamp time.Time
+
+	// Store keeping the holders of all locks, defaults to a new MemoryStore.
+	Store LockStore
+
+	// Interceptor deciding on lock requests before they are granted, optional.
+	Interceptor Interceptor
+
+	// Interval between two rounds of lock maintenance, zero disables maintenance.
+	// Production should use eg. 1 minute.
+	MaintenanceInterval time.Duration
+
+	// Minimum age of a lock before maintenance checks back with its holder whether
+	// it is still active. Production should use eg. 2 minutes.
+	ValidityInterval time.Duration
+
+	// NewClient returns a client to check back with the holder of a lock at node and
+	// rpcPath, required when maintenance or invalidations are enabled.
+	NewClient func(node, rpcPath string) dsync.RPC
+
+	// Client of the cluster in this process, optional. Read locks it cached are
+	// invalidated on request of the other lock servers (see Invalidations), lock
+	// requests forwarded by clients (see dsync.Dsync.SetForwarding) are requested through
+	// it, and the locks it holds are reported as active to lock maintenance and notified
+	// when revoked (see MaxHoldTimes).
+	Client *dsync.Dsync
+
+	// Logger receiving the messages of the lock server, optional. Defaults to the logger
+	// of Client (see dsync.Dsync.SetLogger) or, without Client, to the log package.
+	Logger dsync.Logger
+
+	// Maximum time a lock may be held per name prefix (the longest matching prefix
+	// applies, use "" for all names). Locks held longer are revoked during lock
+	// maintenance and their holders are notified by calling Dsync.Revoked at their node.
+	MaxHoldTimes map[string]time.Duration
+
+	// Audit log receiving a JSON record (one per line) for every administrative
+	// operation, optional. Administrative operations are logged regardless.
+	AuditLog io.Writer
+
+	// Invalidate read locks cached by clients (see dsync.Dsync.SetReadCache) when a write lock
+	// is denied because of them, by calling Dsync.Invalidate at the nodes holding them.
+	Invalidations bool
+
+	// Sliding window over which the contention of names is tracked (see Hotspots and Stats),
+	// zero disables tracking. Production could use eg. 5 minutes.
+	HotspotWindow time.Duration
+
+	// File in which the frozen names (see Freeze) are persisted, so that they survive
+	// restarts. Leave empty to keep them in memory only.
+	FreezeFile string
+
+	// Delay after a client node has been reported down (see NodeDown) before the locks
+	// held by client instances on the node are released, zero disables reclamation.
+	// Should comfortably exceed the time it takes to detect a false positive.
+	ReclaimDelay time.Duration
+
+	// Maximum number of locks held concurrently per namespace (name prefix, see
+	// dsync.Namespace), eg. so that a single tenant or subsystem cannot exhaust the
+	// memory of the lock server. Lock requests beyond are denied. Since a lock needs
+	// a quorum of grants, the quota applies cluster wide when set on all lock servers.
+	Quotas map[string]int
+
+	// Leases of the locks granted per name prefix (the longest matching prefix applies,
+	// use "" for all names), overriding the lease requested by the client (see
+	// dsync.Dsync.SetLeaseTTL). Locks whose lease is not refreshed in time expire.
+	LeaseTTLs map[string]LeaseTTL
+
+	// File in which the high-water marks of the sequences (see dsync.Dsync.NextSequence) are
+	// persisted. Leave empty to keep them in memory only, in which case sequences can
+	// go backwards when a quorum of the lock servers restarts.
+	SequenceFile string
+
+	// Secret the token of every RPC must be signed with (see dsync.NewToken), so that only
+	// clients knowing it can acquire or release locks. Nil accepts all RPCs.
+	AuthSecret []byte
+
+	// Journal to which the lock events (grants, releases and expiries) are shipped
+	// asynchronously, eg. to Kafka or NATS (see PublishJournal), optional.
+	Journal Journal
+
+	// Time after which the bookkeeping kept per name besides the locks is collected once
+	// the name is idle: queues without any push, list, claim or ack (along with their jobs),
+	// phases of barriers no participant arrived at or polled, expired write intents and the
+	// contention tracked for hotspots beyond the window. Zero disables collection, in which
+	// case only phases of barriers are dropped (after a day). Production could use eg. 1 hour.
+	IdleTimeout time.Duration
+
+	// Number of read locks per name still granted while a writer waits for the read locks
+	// held to drain (see dsync.Dsync.SetLocalReads), at most one per client (LockArgs.Node),
+	// so that the readers of all clients get their turn rather than the client requesting
+	// the most. Beyond the batch, read locks are refused until the writer got its lock.
+	// Zero refuses all read locks as soon as a writer waits.
+	ReadBatch int
+
+	// Treat the names of the locks as a hierarchy of paths separated by dsync.NamespaceSeparator,
+	// eg. "bucket/object", in which locks conflict with the locks on their ancestors and
+	// descendants as if on the same name: a write lock on "bucket" is denied while any lock
+	// on an object of the bucket is held and vice versa. Every grant then looks up the locks
+	// on the ancestors and scans the lock table for the descendants, and grants are serialized.
+	// Must be set on all lock servers of a cluster or none.
+	Hierarchical bool
+
+	// Clock the leases of the locks and the write intents (see ReadBatch) expire by and the
+	// age of the locks is measured with (see MaxHoldTimes and ValidityInterval), the real
+	// clock when nil. To be replaced in tests only, eg. to skew the clock of a lock server
+	// (see the chaos tool).
+	Clock dsync.Clock
+}
+
+// LockServer - lock server keeping track of the holders of all locks, so that stale
+// locks (of crashed clients) can be detected and removed by lock maintenance.
+type LockServer struct {
+	store     LockStore
+	timestamp time.Time // Timestamp set at the time of initialization. Resets naturally on minio server restart.
+	epoch     int64     // Incarnation of the lock server, returned in the view of every grant
+
+	opts       Options
+	stop       chan struct{}
+	auditMutex sync.Mutex      // Serializes writes to the audit log
+	hotspots   *hotspotTracker // Nil unless hotspot tracking is enabled
+	journal    *journal        // Nil unless a journal is configured
+
+	frozenMutex sync.Mutex
+	frozen      map[string]struct{} // Names for which all lock requests are denied
+
+	pauseMutex  sync.Mutex
+	pausedSince time.Time // Time granting new locks was paused, zero unless paused
+
+	hierarchyMutex sync.Mutex // Serializes the grants when hierarchical, see Options.Hierarchical
+
+	reclaimMutex sync.Mutex
+	reclaims     map[string]*time.Timer // Pending reclamations by client node
+
+	quotaMutex  sync.Mutex
+	quotaCounts map[string]int // Number of locks held per namespace with a quota
+
+	sequenceMutex sync.Mutex
+	sequences     map[string]uint64 // High-water mark per sequence
+
+	queueMutex    sync.Mutex
+	queues        map[string]map[uint64]*queueJob // Jobs by ID per queue, kept in memory only
+	queueActivity map[string]time.Time            // Time of the last push, list, claim or ack per queue
+
+	barrierMutex sync.Mutex
+	barriers     map[string]map[uint64]*barrierPhase // Phases by generation per barrier, kept in memory only
+
+	intentMutex sync.Mutex
+	intents     map[string]*writeIntent // Expiry of the write intents by name, see dsync.Dsync.SetLocalReads
+
+	gcMutex sync.Mutex
+	gcStats GCStats // Bookkeeping collected since start
+}
+
+// New returns a LockServer, starting lock maintenance when enabled in opts.
+func New(opts Options) *LockServer {
+	l := &LockServer{
+		store:     opts.Store,
+		timestamp: opts.Timestamp,
+		opts:      opts,
+		epoch:     time.Now().UnixNano(),
+		stop:      make(chan struct{}),
+		reclaims:  make(map[string]*time.Timer),
+	}
+	if l.store == nil {
+		l.store = NewMemoryStore()
+	}
+	if opts.HotspotWindow > 0 {
+		l.hotspots = newHotspotTracker(opts.HotspotWindow)
+	}
+	if err := l.loadFrozen(); err != nil {
+		panic(fmt.Sprintf("lockserver: unable to load frozen names: %v", err))
+	}
+	if err := l.loadSequences(); err != nil {
+		panic(fmt.Sprintf("lockserver: unable to load sequences: %v", err))
+	}
+	if err := l.initQuotas(); err != nil {
+		panic(fmt.Sprintf("lockserver: unable to count locks for quotas: %v", err))
+	}
+	if len(opts.MaxHoldTimes) > 0 && opts.MaintenanceInterval == 0 {
+		panic("lockserver: lock maintenance is required for maximum hold times")
+	}
+	if (opts.MaintenanceInterval > 0 || opts.Invalidations) && opts.NewClient == nil {
+		panic("lockserver: NewClient is required for lock maintenance and invalidations")
+	}
+	if opts.MaintenanceInterval > 0 {
+		go l.maintenanceLoop()
+	}
+	if opts.Journal != nil {
+		l.journal = &journal{events: make(chan Event, journalBacklog)}
+		go l.journalLoop()
+	}
+	if opts.IdleTimeout > 0 {
+		go l.gcLoop()
+	}
+	return l
+}
+
+// Close stops lock maintenance and pending reclamations, shipping the lock events still
+// queued for the journal in the background.
+func (l *LockServer) Close() {
+	close(l.stop)
+	l.stopReclaims()
+}
+
+func (l *LockServer) maintenanceLoop() {
+	// Start with random sleep time, so as to avoid "synchronous checks" between servers
+	delay := time.Duration(rand.Float64() * float64(l.opts.MaintenanceInterval))
+	for {
+		select {
+		case <-time.After(delay):
+		case <-l.stop:
+			return
+		}
+		l.lockMaintenance(l.opts.ValidityInterval)
+		l.revokeOverdue()
+		l.expireLeases()
+		l.expireIntents()
+		delay = l.opts.MaintenanceInterval
+	}
+}
+
+func (l *LockServer) validateLockArgs(args *dsync.LockArgs) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	if !l.timestamp.Equal(args.Timestamp) {
+		return errInvalidTimestamp
+	}
+	return nil
+}
+
+// authenticate verifies the token of an RPC when authentication is enabled.
+func (l *LockServer) authenticate(token string) error {
+	if l.opts.AuthSecret == nil {
+		return nil
+	}
+	return dsync.VerifyToken(token, l.opts.AuthSecret)
+}
+
+// update applies fn to the holders of the lock on name and, when fn reports a change,
+// stores the new holders (removing the entry when none are left). The update is retried
+// when the entry was changed concurrently.
+func (l *LockServer) update(name string, fn func(holders []Holder) ([]Holder, bool, error)) error {
+	for {
+		holders, version, err := l.store.Get(name)
+		if err != nil {
+			return err
+		}
+		updated, changed, err := fn(holders)
+		if err != nil || !changed {
+			return err
+		}
+		var ok bool
+		if len(updated) == 0 {
+			ok, err = l.store.Delete(name, version)
+		} else {
+			ok, err = l.store.Set(name, updated, version)
+		}
+		if ok {
+			if released := removedHolders(holders, updated); released > 0 {
+				l.releaseQuota(name, released)
+			}
+			l.journalChanges(name, holders, updated)
+		}
+		if err != nil || ok {
+			return err
+		}
+	}
+}
+
+// Lock - rpc handler for (single) write lock operation.
+func (l *LockServer) Lock(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	reply := &resp.Granted // Set to true when lock is granted
+	if err := l.validateLockArgs(args); err != nil {
+		return err
+	}
+	if err := dsync.CheckMode(args.Mode, dsync.Exclusive); err != nil {
+		return err
+	}
+	if args.DryRun {
+		return l.dryRun(args, true, resp)
+	}
+	if l.refuseGrant(args.Name, resp) {
+		l.recordRequest(args, false)
+		return nil
+	}
+	if args.Intent > 0 {
+		// Refuse new read locks, so that the read locks held drain
+		l.setIntent(args.Name, args.Intent)
+	}
+	ttl := l.leaseTTL(args.Name, args.TTL)
+	reserved := false
+	unlockHierarchy := l.lockHierarchy()
+	err := l.update(args.Name, func(holders []Holder) ([]Holder, bool, error) {
+		holders, expired := dropExpired(holders, l.now())
+		conflict, err := l.hierarchyConflict(args.Name, true)
+		if err != nil {
+			return nil, false, err
+		}
+		// No locks held on the given name (nor on its ancestors and descendants when
+		// hierarchical), so claim write lock (unless denied by interceptor)
+		if *reply = len(holders) == 0 && !conflict && l.intercept(args, true, holders); !*reply {
+			if l.opts.Invalidations && len(holders) > 0 && !isWriteLock(holders) {
+				go l.invalidate(args.Name, holders)
+			}
+			return holders, expired, nil
+		}
+		// Unless the quota of the namespace is exhausted
+		if !reserved {
+			if reserved = l.reserveQuota(args.Name); !reserved {
+				*reply = false
+				return holders, expired, nil
+			}
+		}
+		resp.View = &dsync.LockView{Writer: true, Epoch: l.epoch}
+		return []Holder{l.newHolder(args, true, ttl)}, true, nil
+	})
+	unlockHierarchy()
+	if reserved && (err != nil || !*reply) {
+		l.releaseQuota(args.Name, 1)
+	}
+	if err == nil {
+		l.recordRequest(args, *reply)
+	}
+	if *reply {
+		resp.TTL = ttl
+	} else {
+		resp.View = nil // Set by an attempt that was retried
+	}
+	return err
+}
+
+// Unlock - rpc handler for (single) write unlock operation.
+func (l *LockServer) Unlock(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	reply := &resp.Granted // Set to true when lock is released
+	if err := l.validateLockArgs(args); err != nil {
+		return err
+	}
+	if err := dsync.CheckMode(args.Mode, dsync.Exclusive); err != nil {
+		return err
+	}
+	err := l.update(args.Name, func(holders []Holder) ([]Holder, bool, error) {
+		if *reply = len(holders) > 0; !*reply { // No lock is held on the given name
+			return nil, false, fmt.Errorf("Unlock attempted on an unlocked entity: %s", args.Name)
+		}
+		if *reply = isWriteLock(holders); !*reply { // Unless it is a write lock
+			return nil, false, fmt.Errorf("Unlock attempted on a read locked entity: %s (%d read locks active)", args.Name, len(holders))
+		}
+		if !removeHolder(args.UID, &holders) {
+			return nil, false, fmt.Errorf("Unlock unable to find corresponding lock for uid: %s", args.UID)
+		}
+		return holders, true, nil
+	})
+	if err == nil {
+		l.clearIntent(args.Name) // The writer is done
+	}
+	return err
+}
+
+// RLock - rpc handler for read lock operation.
+func (l *LockServer) RLock(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	reply := &resp.Granted // Set to true when lock is granted
+	if err := l.validateLockArgs(args); err != nil {
+		return err
+	}
+	if err := dsync.CheckMode(args.Mode, dsync.Shared); err != nil {
+		return err
+	}
+	if args.DryRun {
+		return l.dryRun(args, false, resp)
+	}
+	if l.refuseGrant(args.Name, resp) {
+		l.recordRequest(args, false)
+		return nil
+	}
+	admitted, batched := l.admitRead(args.Name, args.Node, true)
+	if !admitted { // A writer is waiting for the read locks held to drain
+		l.recordRequest(args, false)
+		return nil
+	}
+	ttl := l.leaseTTL(args.Name, args.TTL)
+	reserved := false
+	unlockHierarchy := l.lockHierarchy()
+	err := l.update(args.Name, func(holders []Holder) ([]Holder, bool, error) {
+		holders, expired := dropExpired(holders, l.now())
+		conflict, err := l.hierarchyConflict(args.Name, false)
+		if err != nil {
+			return nil, false, err
+		}
+		// Grant the (first) read lock, unless there is a write lock (also on an ancestor or
+		// descendant when hierarchical) or denied by interceptor
+		if *reply = !isWriteLock(holders) && !conflict && l.intercept(args, false, holders); !*reply {
+			return holders, expired, nil
+		}
+		// Unless the quota of the namespace is exhausted
+		if !reserved {
+			if reserved = l.reserveQuota(args.Name); !reserved {
+				*reply = false
+				return holders, expired, nil
+			}
+		}
+		holders = append(holders, l.newHolder(args, false, ttl))
+		resp.View = &dsync.LockView{Readers: len(holders), Epoch: l.epoch}
+		return holders, true, nil
+	})
+	unlockHierarchy()
+	if reserved && (err != nil || !*reply) {
+		l.releaseQuota(args.Name, 1)
+	}
+	if batched && (err != nil || !*reply) {
+		l.unreserveRead(args.Name, args.Node)
+	}
+	if err == nil {
+		l.recordRequest(args, *reply)
+	}
+	if *reply {
+		resp.TTL = ttl
+	} else {
+		resp.View = nil // Set by an attempt that was retried
+	}
+	return err
+}
+
+// RUnlock - rpc handler for read unlock operation.
+func (l *LockServer) RUnlock(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	reply := &resp.Granted // Set to true when lock is released
+	if err := l.validateLockArgs(args); err != nil {
+		return err
+	}
+	if err := dsync.CheckMode(args.Mode, dsync.Shared); err != nil {
+		return err
+	}
+	return l.update(args.Name, func(holders []Holder) ([]Holder, bool, error) {
+		if *reply = len(holders) > 0; !*reply { // No lock is held on the given name
+			return nil, false, fmt.Errorf("RUnlock attempted on an unlocked entity: %s", args.Name)
+		}
+		if *reply = !isWriteLock(holders); !*reply { // A write-lock is held, cannot release a read lock
+			return nil, false, fmt.Errorf("RUnlock attempted on a write locked entity: %s", args.Name)
+		}
+		if !removeHolder(args.UID, &holders) {
+			return nil, false, fmt.Errorf("RUnlock unable to find corresponding read lock for uid: %s", args.UID)
+		}
+		return holders, true, nil
+	})
+}
+
+// Upgrade - rpc handler converting the read lock held with uid into a write lock, without
+// releasing it in between. Only granted when no other locks are held on the name, in which
+// case the read lock is kept as is (see dsync.DRWMutex.Upgrade).
+func (l *LockServer) Upgrade(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	reply := &resp.Granted // Set to true when the read lock is converted
+	if err := l.validateLockArgs(args); err != nil {
+		return err
+	}
+	if err := dsync.CheckMode(args.Mode, dsync.Exclusive); err != nil {
+		return err
+	}
+	if l.refuseGrant(args.Name, resp) {
+		l.recordRequest(args, false)
+		return nil
+	}
+	unlockHierarchy := l.lockHierarchy()
+	err := l.update(args.Name, func(holders []Holder) ([]Holder, bool, error) {
+		holders, expired := dropExpired(holders, l.now())
+		if !hasHolder(holders, args.UID) || isWriteLock(holders) {
+			*reply = false
+			return nil, false, fmt.Errorf("Upgrade unable to find corresponding read lock for uid: %s", args.UID)
+		}
+		conflict, err := l.hierarchyConflict(args.Name, true)
+		if err != nil {
+			return nil, false, err
+		}
+		// Convert the read lock when it is the only lock held (unless denied by interceptor)
+		if *reply = len(holders) == 1 && !conflict && l.intercept(args, true, nil); !*reply {
+			return holders, expired, nil
+		}
+		holders[0].Writer = true
+		resp.View = &dsync.LockView{Writer: true, Epoch: l.epoch}
+		return holders, true, nil
+	})
+	unlockHierarchy()
+	if err == nil {
+		l.recordRequest(args, *reply)
+	}
+	if !*reply {
+		resp.View = nil // Set by an attempt that was retried
+	}
+	return err
+}
+
+// Downgrade - rpc handler converting the write lock held with uid into a read lock, without
+// releasing it in between (see dsync.DRWMutex.Downgrade).
+func (l *LockServer) Downgrade(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	reply := &resp.Granted // Set to true when the write lock is converted
+	if err := l.validateLockArgs(args); err != nil {
+		return err
+	}
+	if err := dsync.CheckMode(args.Mode, dsync.Shared); err != nil {
+		return err
+	}
+	err := l.update(args.Name, func(holders []Holder) ([]Holder, bool, error) {
+		if *reply = isWriteLock(holders) && holders[0].UID == args.UID; !*reply {
+			return nil, false, fmt.Errorf("Downgrade unable to find corresponding write lock for uid: %s", args.UID)
+		}
+		holders[0].Writer = false
+		resp.View = &dsync.LockView{Readers: 1, Epoch: l.epoch}
+		return holders, true, nil
+	})
+	if err == nil {
+		l.clearIntent(args.Name) // The writer is done
+	} else {
+		resp.View = nil
+	}
+	return err
+}
+
+// ForceUnlock - rpc handler for force unlock operation.
+func (l *LockServer) ForceUnlock(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	reply := &resp.Granted // Set to true when lock is released
+	if err := l.validateLockArgs(args); err != nil {
+		return err
+	}
+	if len(args.UID) != 0 {
+		return fmt.Errorf("ForceUnlock called with non-empty UID: %s", args.UID)
+	}
+	// Remove the lock (irrespective of write or read lock), only when set
+	if err := l.update(args.Name, func(holders []Holder) ([]Holder, bool, error) {
+		return nil, len(holders) > 0, nil
+	}); err != nil {
+		return err
+	}
+	*reply = true
+	return nil
+}
+
+// log logs msg at level with fields to the logger of the lock server, see Options.Logger.
+func (l *LockServer) log(level dsync.Level, msg string, fields dsync.Fields) {
+	switch {
+	case l.opts.Logger != nil:
+		l.opts.Logger.Log(level, msg, fields)
+	case l.opts.Client != nil:
+		l.opts.Client.Log(level, msg, fields)
+	default:
+		dsync.Log(level, msg, fields)
+	}
+}
+
+// Expired - rpc handler for expired lock status.
+func (l *LockServer) Expired(args *dsync.LockArgs, reply *bool) error {
+	if err := l.validateLockArgs(args); err != nil {
+		return err
+	}
+	holders, _, err := l.store.Get(args.Name)
+	if err != nil {
+		return err
+	}
+	// Check whether uid is still active for this name
+	for _, holder := range holders {
+		if holder.UID == args.UID {
+			*reply = false // When uid found, lock is still active so return not expired
+			return nil
+		}
+	}
+	// Or whether it is held by a client in this process (the lock need not be placed on this node)
+	if l.opts.Client != nil && l.opts.Client.HoldsLock(args.UID) {
+		*reply = false
+		return nil
+	}
+	// When we get here, lock is no longer active due to either args.Name being absent from store
+	// or uid not found for given args.Name
+	*reply = true
+	return nil
+}
+
+// Validate - rpc handler replying whether the lock on name is still held with uid (and its
+// lease has not expired), so that clients detect the locks they lost, eg. because the lock
+// server restarted (see dsync.Dsync.SetValidation). Unlike Refresh the lease is not extended.
+// The timestamp is not checked, as a lock server that restarted does not know the lock anyway.
+func (l *LockServer) Validate(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	holders, _, err := l.store.Get(args.Name)
+	if err != nil {
+		return err
+	}
+	now := l.now()
+	resp.Granted = false
+	for _, holder := range holders {
+		if holder.UID == args.UID && !holder.isExpired(now) {
+			resp.Granted = true
+			break
+		}
+	}
+	return nil
+}
+
+// ExpirePrefix - rpc handler for removing all locks (irrespective of write or read lock)
+// with names starting with a prefix, replying with the locks removed. In dry-run mode
+// the locks are only listed.
+func (l *LockServer) ExpirePrefix(args *dsync.ExpirePrefixArgs, reply *dsync.SnapshotReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	if args.Prefix == "" {
+		return errors.New("ExpirePrefix called with empty prefix")
+	}
+	var names []string
+	err := l.store.Scan(args.Prefix, func(name string, holders []Holder, version uint64) bool {
+		names = append(names, name)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err = l.update(name, func(holders []Holder) ([]Holder, bool, error) {
+			for _, holder := range holders {
+				reply.Entries = append(reply.Entries, newLockEntry(name, holder))
+			}
+			return nil, !args.DryRun && len(holders) > 0, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !args.DryRun && len(reply.Entries) > 0 {
+		l.log(dsync.LevelInfo, "Expired locks for prefix", dsync.Fields{"prefix": args.Prefix, "locks": len(reply.Entries)})
+	}
+	return nil
+}
+
+// AuditRecord - record of an administrative operation in the audit log.
+type AuditRecord struct {
+	Time      time.Time         `json:"time"`
+	Operation string            `json:"operation"`
+	Name      string            `json:"name"`
+	Operator  string            `json:"operator"`
+	Reason    string            `json:"reason"`
+	Override  bool              `json:"override"` // Performed with less than a quorum of the nodes reachable
+	Removed   []dsync.LockEntry `json:"removed"`
+}
+
+// audit records an administrative operation in the log and the audit log.
+func (l *LockServer) audit(r AuditRecord) {
+	fields := dsync.Fields{"operation": r.Operation, "name": r.Name, "operator": r.Operator, "reason": r.Reason}
+	if r.Override {
+		fields["override"] = "QUORUM OVERRIDE"
+	}
+	if r.Operation == "force-unlock" || r.Operation == "reclaim" {
+		fields["removed"] = len(r.Removed)
+	}
+	l.log(dsync.LevelWarn, "Audit", fields)
+
+	if l.opts.AuditLog == nil {
+		return
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		l.log(dsync.LevelError, "Failed to marshal audit record", dsync.Fields{"error": err})
+		return
+	}
+	l.auditMutex.Lock()
+	defer l.auditMutex.Unlock()
+	if _, err = l.opts.AuditLog.Write(append(b, '\n')); err != nil {
+		l.log(dsync.LevelError, "Failed to write audit record", dsync.Fields{"error": err})
+	}
+}
+
+// AdminForceUnlock - rpc handler for force unlock operation on behalf of an operator,
+// replying with the locks removed. The operation is recorded in the audit log.
+func (l *LockServer) AdminForceUnlock(args *dsync.AdminForceUnlockArgs, reply *dsync.SnapshotReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	if args.Operator == "" || args.Reason == "" {
+		return errors.New("AdminForceUnlock called without operator or reason")
+	}
+	err := l.update(args.Name, func(holders []Holder) ([]Holder, bool, error) {
+		reply.Entries = nil // Start over when retried
+		for _, holder := range holders {
+			reply.Entries = append(reply.Entries, newLockEntry(args.Name, holder))
+		}
+		return nil, len(holders) > 0, nil
+	})
+	if err != nil {
+		return err
+	}
+	l.audit(AuditRecord{
+		Time:      time.Now().UTC(),
+		Operation: "force-unlock",
+		Name:      args.Name,
+		Operator:  args.Operator,
+		Reason:    args.Reason,
+		Override:  args.Override,
+		Removed:   reply.Entries,
+	})
+	return nil
+}
+
+// Invalidate - rpc handler for invalidating the read lock on name that is cached by the
+// client(s) in this process, so that a waiting writer can get the lock.
+func (l *LockServer) Invalidate(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	if err := l.validateLockArgs(args); err != nil {
+		return err
+	}
+	if l.opts.Client != nil {
+		l.opts.Client.InvalidateReadCache(args.Name)
+	}
+	resp.Granted = true
+	return nil
+}
+
+// invalidate asks the nodes holding the read locks on name to invalidate their cached read locks.
+func (l *LockServer) invalidate(name string, holders []Holder) {
+	invalidated := make(map[string]bool)
+	for _, holder := range holders {
+		if invalidated[holder.Node+holder.RPCPath] {
+			continue
+		}
+		invalidated[holder.Node+holder.RPCPath] = true
+
+		// We will ignore any errors, the cached read lock expires by itself anyway
+		c := l.opts.NewClient(holder.Node, holder.RPCPath)
+		var resp dsync.LockResp
+		c.Call("Dsync.Invalidate", &dsync.LockArgs{Name: name}, &resp)
+		c.Close()
+	}
+}
+
+// Revoked - rpc handler for notifying the client in this process that a lock server
+// has revoked its lock.
+func (l *LockServer) Revoked(args *dsync.LockArgs, resp *dsync.LockResp) error {
+	if err := l.validateLockArgs(args); err != nil {
+		return err
+	}
+	if l.opts.Client != nil {
+		l.opts.Client.NotifyRevoked(args.Name, args.UID)
+	}
+	resp.Granted = true
+	return nil
+}
+
+// Forward - rpc handler for a lock request forwarded by a client (see dsync.Dsync.SetForwarding),
+// which is requested from the nodes the lock is placed on by the client in this process.
+func (l *LockServer) Forward(args *dsync.ForwardArgs, reply *dsync.ForwardReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	if l.opts.Client == nil {
+		return errors.New("Forwarding requires a client, see Options.Client")
+	}
+	return l.opts.Client.Forward(args, reply)
+}
+
+// maxHoldTime returns the maximum hold time for name, zero when unlimited.
+func (l *LockServer) maxHoldTime(name string) time.Duration {
+	var prefix string
+	var maxHold time.Duration
+	found := false
+	for p, d := range l.opts.MaxHoldTimes {
+		if strings.HasPrefix(name, p) && (!found || len(p) > len(prefix)) {
+			prefix, maxHold, found = p, d, true
+		}
+	}
+	return maxHold
+}
+
+// revokeOverdue revokes all locks that have been held longer than their maximum
+// hold time and notifies their holders.
+func (l *LockServer) revokeOverdue() {
+	if len(l.opts.MaxHoldTimes) == 0 {
+		return
+	}
+
+	var names []string
+	err := l.store.Scan("", func(name string, holders []Holder, version uint64) bool {
+		names = append(names, name)
+		return true
+	})
+	if err != nil {
+		l.log(dsync.LevelError, "Lock maintenance failed to scan locks", dsync.Fields{"error": err})
+		return
+	}
+
+	for _, name := range names {
+		maxHold := l.maxHoldTime(name)
+		if maxHold == 0 {
+			continue
+		}
+		var revoked []Holder
+		err = l.update(name, func(holders []Holder) ([]Holder, bool, error) {
+			revoked = nil // Start over when retried
+			kept := holders[:0:0]
+			now := l.now()
+			for _, holder := range holders {
+				if now.Sub(holder.Timestamp) > maxHold {
+					revoked = append(revoked, holder)
+				} else {
+					kept = append(kept, holder)
+				}
+			}
+			return kept, len(revoked) > 0, nil
+		})
+		if err != nil {
+			l.log(dsync.LevelError, "Lock maintenance failed to revoke lock", dsync.Fields{"name": name, "error": err})
+			continue
+		}
+
+		for _, holder := range revoked {
+			l.log(dsync.LevelWarn, "Revoked lock held for too long", dsync.Fields{"name": name, "node": holder.Node + holder.RPCPath, "maxHold": maxHold})
+			// We will ignore any errors, the holder finds out when unlocking anyway
+			c := l.opts.NewClient(holder.Node, holder.RPCPath)
+			var resp dsync.LockResp
+			c.Call("Dsync.Revoked", &dsync.LockArgs{Name: name, UID: holder.UID}, &resp)
+			c.Close()
+		}
+	}
+}
+
+// Version - rpc handler for version information.
+func (l *LockServer) Version(args *dsync.VersionArgs, reply *dsync.VersionInfo) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	*reply = dsync.LocalVersion()
+	return nil
+}
+
+// Snapshot - rpc handler for listing all locks held, sorted by name, along with their
+// checksum so that corruption in transfer is detected. Locks whose lease expired are left
+// out, even when they have not been removed yet.
+func (l *LockServer) Snapshot(args *dsync.SnapshotArgs, reply *dsync.SnapshotReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	now := l.now()
+	err := l.store.Scan("", func(name string, holders []Holder, version uint64) bool {
+		for _, holder := range holders {
+			if holder.isExpired(now) {
+				continue
+			}
+			reply.Entries = append(reply.Entries, newLockEntry(name, holder))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	reply.Checksum = dsync.ChecksumEntries(reply.Entries)
+	return nil
+}
+
+// List - rpc handler for listing the locks held on all names with a prefix and on the
+// given names, like Snapshot (see dsync.Dsync.Inspect).
+func (l *LockServer) List(args *dsync.ListArgs, reply *dsync.SnapshotReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	now := l.now()
+	listed := make(map[string]bool)
+	add := func(name string, holders []Holder) {
+		listed[name] = true
+		for _, holder := range holders {
+			if !holder.isExpired(now) {
+				reply.Entries = append(reply.Entries, newLockEntry(name, holder))
+			}
+		}
+	}
+	if args.Prefix != "" || len(args.Names) == 0 {
+		err := l.store.Scan(args.Prefix, func(name string, holders []Holder, version uint64) bool {
+			add(name, holders)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range args.Names {
+		if listed[name] {
+			continue
+		}
+		holders, _, err := l.store.Get(name)
+		if err != nil {
+			return err
+		}
+		add(name, holders)
+	}
+	sort.SliceStable(reply.Entries, func(i, j int) bool { return reply.Entries[i].Name < reply.Entries[j].Name })
+	reply.Checksum = dsync.ChecksumEntries(reply.Entries)
+	return nil
+}
+
+func newLockEntry(name string, holder Holder) dsync.LockEntry {
+	return dsync.LockEntry{
+		Name:    name,
+		Writer:  holder.Writer,
+		Mode:    dsync.ModeOf(holder.Writer),
+		Node:    holder.Node,
+		RPCPath: holder.RPCPath,
+		UID:     holder.UID,
+		Owner:   holder.Owner,
+		Source:  holder.Source,
+		Tags:    holder.Tags,
+		Since:   holder.Timestamp,
+	}
+}
+
+// removedHolders returns the number of holders that are no longer in updated.
+func removedHolders(holders, updated []Holder) (removed int) {
+	for _, holder := range holders {
+		found := false
+		for _, u := range updated {
+			if u.UID == holder.UID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed++
+		}
+	}
+	return removed
+}
+
+// removeHolder removes, based on the uid of the lock message, a single holder from the
+// holders (leaving none in case of a write lock or last read lock)
+func removeHolder(uid string, holders *[]Holder) bool {
+	// Find correct entry to remove based on uid
+	for index, holder := range *holders {
+		if holder.UID == uid {
+			*holders = append((*holders)[:index], (*holders)[index+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Similar to removeHolder but only removes the holder if the lock still exists in the store.
+func (l *LockServer) removeHolderIfExists(nh nameHolderPair) error {
+	return l.update(nh.name, func(holders []Holder) ([]Holder, bool, error) {
+		// Check if entry is still in store (could have been removed altogether by 'concurrent' (R)Unlock of last entry)
+		if len(holders) == 0 {
+			return nil, false, nil
+		}
+		if !removeHolder(nh.holder.UID, &holders) {
+			// Remove failed, in case it is a:
+			if nh.holder.Writer {
+				// Writer: this should never happen as the whole entry should have been deleted
+				l.log(dsync.LevelError, "Lock maintenance failed to remove entry for write lock (should never happen)", dsync.Fields{"name": nh.name, "uid": nh.holder.UID, "holders": holders})
+			} // Reader: this can happen if multiple read locks were active and
+			// the one we are looking for has been released concurrently (so it is fine)
+			return nil, false, nil
+		} // Remove went okay, all is fine
+		return holders, true, nil
+	})
+}
+
+type nameHolderPair struct {
+	name   string
+	holder Holder
+}
+
+// getLongLivedLocks returns locks that are older than a certain time and
+// have not been 'checked' for validity too soon enough
+func (l *LockServer) getLongLivedLocks(interval time.Duration) ([]nameHolderPair, error) {
+
+	rslt := []nameHolderPair{}
+
+	var names []string
+	err := l.store.Scan("", func(name string, holders []Holder, version uint64) bool {
+		names = append(names, name)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		var due []nameHolderPair
+		err = l.update(name, func(holders []Holder) ([]Holder, bool, error) {
+			due = nil // Start over when retried
+			now := l.now()
+			for idx := range holders {
+				// Check whether enough time has gone by since last check
+				if now.Sub(holders[idx].TimeLastCheck) >= interval {
+					due = append(due, nameHolderPair{name: name, holder: holders[idx]})
+					holders[idx].TimeLastCheck = now
+				}
+			}
+			return holders, len(due) > 0, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		rslt = append(rslt, due...)
+	}
+
+	return rslt, nil
+}
+
+// lockMaintenance loops over locks that have been active for some time and checks back
+// with the original server whether it is still alive or not
+//
+// Following logic inside ignores the errors generated for Dsync.Active operation.
+// - server at client down
+// - some network error (and server is up normally)
+//
+// We will ignore the error, and we will retry later to get a resolve on this lock
+func (l *LockServer) lockMaintenance(interval time.Duration) {
+	// Get list of long lived locks to check for staleness.
+	nhLongLived, err := l.getLongLivedLocks(interval)
+	if err != nil {
+		l.log(dsync.LevelError, "Lock maintenance failed to scan locks", dsync.Fields{"error": err})
+		return
+	}
+
+	// Validate if long lived locks are indeed clean.
+	for _, nh := range nhLongLived {
+		// Initialize client based on the long live locks.
+		c := l.opts.NewClient(nh.holder.Node, nh.holder.RPCPath)
+
+		var expired bool
+
+		// Call back to original server to verify whether the lock is still active (based on name & uid)
+		// We will ignore any errors (see above for reasons), such locks will be retried later to get resolved
+		c.Call("Dsync.Expired", &dsync.LockArgs{
+			Name: nh.name,
+			UID:  nh.holder.UID,
+		}, &expired)
+		c.Close()
+
+		if expired {
+			// The lock is no longer active at server that originated the lock
+			// So remove the lock from the store.
+			if err := l.removeHolderIfExists(nh); err != nil { // Purge the stale entry if it exists.
+				l.log(dsync.LevelError, "Lock maintenance failed to remove stale lock", dsync.Fields{"name": nh.name, "error": err})
+			}
+		}
+	}
+}
@@ -0,0 +1,1541 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newLockServer returns a lock server with opts, closed once the test is done.
+func newLockServer(t *testing.T, opts lockserver.Options) *lockserver.LockServer {
+	l := lockserver.New(opts)
+	t.Cleanup(l.Close)
+	return l
+}
+
+func TestLockServer(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{})
+
+	var resp LockResp
+	if err := l.Lock(&LockArgs{Name: "name", UID: "1"}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected write lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+	if err := l.RLock(&LockArgs{Name: "name", UID: "2"}, &resp); err != nil || resp.Granted {
+		t.Fatalf("expected read lock to be denied, got %v (%v)", resp.Granted, err)
+	}
+	if err := l.Unlock(&LockArgs{Name: "name", UID: "1"}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected write lock to be released, got %v (%v)", resp.Granted, err)
+	}
+
+	for _, uid := range []string{"3", "4"} {
+		if err := l.RLock(&LockArgs{Name: "name", UID: uid}, &resp); err != nil || !resp.Granted {
+			t.Fatalf("expected read lock to be granted, got %v (%v)", resp.Granted, err)
+		}
+	}
+	if err := l.Lock(&LockArgs{Name: "name", UID: "5"}, &resp); err != nil || resp.Granted {
+		t.Fatalf("expected write lock to be denied, got %v (%v)", resp.Granted, err)
+	}
+
+	var snapshot SnapshotReply
+	if err := l.Snapshot(&SnapshotArgs{}, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Entries) != 2 || snapshot.Entries[0].Writer || snapshot.Entries[0].UID != "3" {
+		t.Fatalf("unexpected snapshot %v", snapshot.Entries)
+	}
+
+	var expired bool
+	if err := l.Expired(&LockArgs{Name: "name", UID: "3"}, &expired); err != nil || expired {
+		t.Fatalf("expected read lock not to be expired, got %v (%v)", expired, err)
+	}
+	if err := l.RUnlock(&LockArgs{Name: "name", UID: "3"}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected read lock to be released, got %v (%v)", resp.Granted, err)
+	}
+	if err := l.Expired(&LockArgs{Name: "name", UID: "3"}, &expired); err != nil || !expired {
+		t.Fatalf("expected read lock to be expired, got %v (%v)", expired, err)
+	}
+	if err := l.RUnlock(&LockArgs{Name: "name", UID: "3"}, &resp); err == nil {
+		t.Fatal("expected error releasing read lock twice")
+	}
+}
+
+// expiredClient answers every Expired call of lock maintenance with true.
+type expiredClient struct{}
+
+func (expiredClient) Call(serviceMethod string, args interface {
+	SetToken(token string)
+	SetTimestamp(tstamp time.Time)
+}, reply interface{}) error {
+	*reply.(*bool) = true
+	return nil
+}
+func (expiredClient) Node() string    { return "127.0.0.1:0" }
+func (expiredClient) RPCPath() string { return DefaultPath }
+func (expiredClient) Close() error    { return nil }
+
+func TestLockServerMaintenance(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{
+		MaintenanceInterval: 10 * time.Millisecond,
+		NewClient:           func(node, rpcPath string) RPC { return expiredClient{} },
+	})
+
+	var resp LockResp
+	if err := l.Lock(&LockArgs{Name: "stale", UID: "1"}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected write lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if err := l.Lock(&LockArgs{Name: "stale", UID: "2"}, &resp); err == nil && resp.Granted {
+			return
+		}
+	}
+	t.Fatal("expected stale lock to be removed by lock maintenance")
+}
+
+func TestMemoryStore(t *testing.T) {
+
+	s := lockserver.NewMemoryStore()
+
+	if ok, err := s.Set("a", []lockserver.Holder{{Writer: true, UID: "1"}}, 0); err != nil || !ok {
+		t.Fatalf("expected set of new entry to succeed, got %v (%v)", ok, err)
+	}
+	if ok, err := s.Set("a", []lockserver.Holder{{UID: "2"}}, 0); err != nil || ok {
+		t.Fatalf("expected set of existing entry at version 0 to fail, got %v (%v)", ok, err)
+	}
+
+	holders, version, err := s.Get("a")
+	if err != nil || len(holders) != 1 || holders[0].UID != "1" || version == 0 {
+		t.Fatalf("unexpected entry %v at version %d (%v)", holders, version, err)
+	}
+	if ok, err := s.Set("a", []lockserver.Holder{{UID: "2"}, {UID: "3"}}, version); err != nil || !ok {
+		t.Fatalf("expected set at current version to succeed, got %v (%v)", ok, err)
+	}
+	if ok, err := s.Delete("a", version); err != nil || ok {
+		t.Fatalf("expected delete at stale version to fail, got %v (%v)", ok, err)
+	}
+
+	s.Set("b", []lockserver.Holder{{UID: "4"}}, 0)
+	s.Set("ab", []lockserver.Holder{{UID: "5"}}, 0)
+	var names []string
+	s.Scan("a", func(name string, holders []lockserver.Holder, version uint64) bool {
+		names = append(names, name)
+		return true
+	})
+	if len(names) != 2 || names[0] != "a" || names[1] != "ab" {
+		t.Fatalf("expected scan to return [a ab], got %v", names)
+	}
+
+	_, version, _ = s.Get("a")
+	if ok, err := s.Delete("a", version); err != nil || !ok {
+		t.Fatalf("expected delete at current version to succeed, got %v (%v)", ok, err)
+	}
+	if holders, version, _ = s.Get("a"); len(holders) != 0 || version != 0 {
+		t.Fatalf("expected deleted entry to be absent, got %v at version %d", holders, version)
+	}
+}
+
+func TestCompactMemoryStore(t *testing.T) {
+
+	s := lockserver.NewCompactMemoryStore(8, 1)
+
+	long1, long2 := "bucket/object-1", "bucket/object-2"
+	for i, name := range []string{"short", long1, long2} {
+		if ok, err := s.Set(name, []lockserver.Holder{{UID: fmt.Sprint(i)}}, 0); err != nil || !ok {
+			t.Fatalf("expected set of %s to succeed, got %v (%v)", name, ok, err)
+		}
+	}
+
+	// Only the most recently stored long name is remembered
+	var names []string
+	s.Scan("", func(name string, holders []lockserver.Holder, version uint64) bool {
+		names = append(names, name)
+		return true
+	})
+	if len(names) != 3 || names[0] != "#"+hashOf(long1) || names[1] != long2 || names[2] != "short" {
+		t.Fatalf("expected scan to return [#%s %s short], got %v", hashOf(long1), long2, names)
+	}
+
+	// The forgotten name is accepted in place of the name
+	holders, version, err := s.Get(names[0])
+	if err != nil || len(holders) != 1 || holders[0].UID != "1" {
+		t.Fatalf("expected holder 1 for %s, got %v (%v)", names[0], holders, err)
+	}
+	if ok, err := s.Delete(names[0], version); err != nil || !ok {
+		t.Fatalf("expected delete at current version to succeed, got %v (%v)", ok, err)
+	}
+	if holders, _, _ = s.Get(long1); len(holders) != 0 {
+		t.Fatalf("expected deleted entry to be absent, got %v", holders)
+	}
+
+	// Locking works the same with long names
+	l := newLockServer(t, lockserver.Options{Store: s})
+	var resp LockResp
+	if l.Lock(&LockArgs{Name: long1, UID: "3"}, &resp); !resp.Granted {
+		t.Fatal("expected write lock to be granted")
+	}
+	var rresp LockResp
+	if l.RLock(&LockArgs{Name: long1, UID: "4"}, &rresp); rresp.Granted {
+		t.Fatal("expected read lock to be denied while write locked")
+	}
+	if err := l.Unlock(&LockArgs{Name: long1, UID: "3"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hashOf returns the hash of name as used by a compact memory store.
+func hashOf(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:sha256.Size/2])
+}
+
+func TestLockServerInterceptor(t *testing.T) {
+
+	// Allow at most two read locks and deny write locks on names starting with "ro-"
+	// (unless requested with a high priority)
+	l := newLockServer(t, lockserver.Options{
+		Interceptor: lockserver.InterceptorFunc(func(req lockserver.Request, holders []lockserver.Holder) bool {
+			if req.Priority > 10 {
+				return true
+			}
+			if req.Writer {
+				return !strings.HasPrefix(req.Name, "ro-")
+			}
+			return len(holders) < 2
+		}),
+	})
+
+	var resp LockResp
+	if err := l.Lock(&LockArgs{Name: "ro-name", UID: "1"}, &resp); err != nil || resp.Granted {
+		t.Fatalf("expected write lock to be denied by interceptor, got %v (%v)", resp.Granted, err)
+	}
+	if err := l.Lock(&LockArgs{Name: "name", UID: "2"}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected write lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+	for i, expected := range []bool{true, true, false} {
+		if err := l.RLock(&LockArgs{Name: "ro-name", UID: fmt.Sprint(i + 3)}, &resp); err != nil || resp.Granted != expected {
+			t.Fatalf("expected read lock %d to be granted: %v, got %v (%v)", i, expected, resp.Granted, err)
+		}
+	}
+	if err := l.RLock(&LockArgs{Name: "ro-name", UID: "6", Priority: 20}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected high priority read lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+}
+
+func TestLockServerInterceptorDeadline(t *testing.T) {
+
+	var deadline time.Time
+	l := newLockServer(t, lockserver.Options{
+		Interceptor: lockserver.InterceptorFunc(func(req lockserver.Request, holders []lockserver.Holder) bool {
+			deadline = req.Deadline
+			return true
+		}),
+	})
+
+	var resp LockResp
+	l.Lock(&LockArgs{Name: "a", UID: "1"}, &resp)
+	if !deadline.IsZero() {
+		t.Fatalf("expected no deadline when the client does not wait, got %v", deadline)
+	}
+	start := time.Now()
+	l.Lock(&LockArgs{Name: "b", UID: "2", Wait: time.Minute}, &resp)
+	if deadline.Before(start.Add(time.Minute)) || deadline.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("expected deadline a minute from now, got %v", deadline.Sub(start))
+	}
+}
+
+func TestLockServerWriteIntent(t *testing.T) {
+
+	fc := NewFakeClock(time.Now())
+	l := newLockServer(t, lockserver.Options{Clock: fc})
+
+	rlock := func(uid string) bool {
+		var resp LockResp
+		l.RLock(&LockArgs{Name: "a", UID: uid}, &resp)
+		return resp.Granted
+	}
+	lock := func(uid string, intent time.Duration) bool {
+		var resp LockResp
+		l.Lock(&LockArgs{Name: "a", UID: uid, Intent: intent}, &resp)
+		return resp.Granted
+	}
+	var resp LockResp
+
+	if !rlock("r1") {
+		t.Fatal("expected read lock to be granted")
+	}
+
+	// The writer is denied because of the read lock, but registers its intent
+	if lock("w1", time.Minute) {
+		t.Fatal("expected write lock to be denied while read locked")
+	}
+	if rlock("r2") {
+		t.Fatal("expected read lock to be denied while a writer intends to lock")
+	}
+
+	// Once the read lock drained the writer gets the lock, and readers are welcome again after it was released
+	l.RUnlock(&LockArgs{Name: "a", UID: "r1"}, &resp)
+	if !lock("w2", time.Minute) {
+		t.Fatal("expected write lock to be granted after the read lock drained")
+	}
+	l.Unlock(&LockArgs{Name: "a", UID: "w2"}, &resp)
+	if !rlock("r3") {
+		t.Fatal("expected read lock to be granted after the write lock was released")
+	}
+
+	// Intents of writers that gave up expire
+	if lock("w3", 20*time.Millisecond) {
+		t.Fatal("expected write lock to be denied while read locked")
+	}
+	if rlock("r4") {
+		t.Fatal("expected read lock to be denied until the clock passed the intent")
+	}
+	fc.Advance(30 * time.Millisecond)
+	if !rlock("r4") {
+		t.Fatal("expected read lock to be granted after the intent expired")
+	}
+}
+
+func TestLockServerReadBatch(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{ReadBatch: 2})
+
+	rlock := func(node, uid string) bool {
+		var resp LockResp
+		l.RLock(&LockArgs{Name: "a", Node: node, UID: uid}, &resp)
+		return resp.Granted
+	}
+	lock := func(uid string) bool {
+		var resp LockResp
+		l.Lock(&LockArgs{Name: "a", UID: uid, Intent: time.Minute}, &resp)
+		return resp.Granted
+	}
+	var resp LockResp
+
+	if !rlock("client-a", "r1") {
+		t.Fatal("expected read lock to be granted")
+	}
+	if lock("w1") {
+		t.Fatal("expected write lock to be denied while read locked")
+	}
+
+	// While the writer waits, every client gets a single read lock of the batch
+	if !rlock("client-a", "r2") {
+		t.Fatal("expected read lock to be granted within the batch")
+	}
+	if rlock("client-a", "r3") {
+		t.Fatal("expected second read lock of the same client to be denied within the batch")
+	}
+	if lock("w2") {
+		t.Fatal("expected write lock to be denied while read locked")
+	}
+	if !rlock("client-b", "r4") {
+		t.Fatal("expected read lock of another client to be granted within the batch")
+	}
+	if rlock("client-c", "r5") {
+		t.Fatal("expected read lock to be denied once the batch is full")
+	}
+
+	// Once the read locks drained the writer gets the lock, after which a new batch starts
+	for _, uid := range []string{"r1", "r2", "r4"} {
+		l.RUnlock(&LockArgs{Name: "a", UID: uid}, &resp)
+	}
+	if !lock("w3") {
+		t.Fatal("expected write lock to be granted after the read locks drained")
+	}
+	l.Unlock(&LockArgs{Name: "a", UID: "w3"}, &resp)
+	if !rlock("client-a", "r6") || !rlock("client-a", "r7") {
+		t.Fatal("expected read locks to be granted after the write lock was released")
+	}
+}
+
+func TestLockServerLockBatch(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{})
+
+	var resp LockResp
+	l.Lock(&LockArgs{Name: "b", UID: "held"}, &resp)
+
+	// Either all names are granted or none
+	batch := &BatchArgs{LockArgs: LockArgs{UID: "batch"}, Names: []string{"c", "b", "a"}}
+	var denied LockResp
+	if err := l.LockBatch(batch, &denied); err != nil || denied.Granted {
+		t.Fatalf("expected batch to be denied, got %v (%v)", denied.Granted, err)
+	}
+	var snapshot SnapshotReply
+	l.Snapshot(&SnapshotArgs{}, &snapshot)
+	if len(snapshot.Entries) != 1 || snapshot.Entries[0].Name != "b" {
+		t.Fatalf("expected the names granted to be released after the batch was denied, got %v", snapshot.Entries)
+	}
+
+	l.Unlock(&LockArgs{Name: "b", UID: "held"}, &resp)
+	var granted LockResp
+	if err := l.LockBatch(batch, &granted); err != nil || !granted.Granted {
+		t.Fatalf("expected batch to be granted, got %v (%v)", granted.Granted, err)
+	}
+	snapshot = SnapshotReply{}
+	l.Snapshot(&SnapshotArgs{}, &snapshot)
+	if len(snapshot.Entries) != 3 {
+		t.Fatalf("expected 3 locks, got %v", snapshot.Entries)
+	}
+	for _, name := range batch.Names {
+		if err := l.Unlock(&LockArgs{Name: name, UID: "batch"}, &resp); err != nil {
+			t.Fatalf("expected %s to be unlocked with the uid of the batch, got %v", name, err)
+		}
+	}
+}
+
+func TestLockServerLockBatchLeases(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{
+		LeaseTTLs: map[string]lockserver.LeaseTTL{
+			"short/": {Default: time.Minute},
+			"long/":  {Default: time.Hour},
+		},
+	})
+
+	var resp LockResp
+	batch := &BatchArgs{LockArgs: LockArgs{UID: "batch"}, Names: []string{"long/a", "short/b", "c"}}
+	if err := l.LockBatch(batch, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected batch to be granted, got %v (%v)", resp.Granted, err)
+	}
+	expected := map[string]time.Duration{"long/a": time.Hour, "short/b": time.Minute}
+	if !reflect.DeepEqual(resp.TTLs, expected) {
+		t.Fatalf("expected leases %v, got %v", expected, resp.TTLs)
+	}
+	if resp.TTL != time.Minute {
+		t.Fatalf("expected the shortest lease of %v, got %v", time.Minute, resp.TTL)
+	}
+}
+
+func TestLockServerHierarchical(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{Hierarchical: true})
+
+	lock := func(name, uid string) bool {
+		var resp LockResp
+		l.Lock(&LockArgs{Name: name, UID: uid}, &resp)
+		return resp.Granted
+	}
+	rlock := func(name, uid string) bool {
+		var resp LockResp
+		l.RLock(&LockArgs{Name: name, UID: uid}, &resp)
+		return resp.Granted
+	}
+	var resp LockResp
+
+	// A lock on a child conflicts with a write lock on its ancestors
+	if !rlock("bucket/object", "r1") {
+		t.Fatal("expected read lock on object to be granted")
+	}
+	if lock("bucket", "w1") {
+		t.Fatal("expected write lock on bucket to be denied while an object is locked")
+	}
+	if !rlock("bucket", "r2") {
+		t.Fatal("expected read lock on bucket to be granted while an object is read locked")
+	}
+	if lock("bucket/other", "w2") {
+		t.Fatal("expected write lock on object to be denied while the bucket is read locked")
+	}
+	l.RUnlock(&LockArgs{Name: "bucket", UID: "r2"}, &resp)
+	if !lock("bucket/other", "w3") {
+		t.Fatal("expected write lock on object to be granted once the bucket is released")
+	}
+	if !lock("bucketx", "w4") {
+		t.Fatal("expected write lock on a name sharing the prefix only to be granted")
+	}
+	var dryRun LockResp
+	if err := l.Lock(&LockArgs{Name: "bucket", UID: "w5", DryRun: true}, &dryRun); err != nil || dryRun.Granted {
+		t.Fatalf("expected dry run of write lock on bucket to be denied, got %v (%v)", dryRun.Granted, err)
+	}
+
+	// A write lock on the bucket conflicts with locks on all descendants
+	l.RUnlock(&LockArgs{Name: "bucket/object", UID: "r1"}, &resp)
+	l.Unlock(&LockArgs{Name: "bucket/other", UID: "w3"}, &resp)
+	if !lock("bucket", "w6") {
+		t.Fatal("expected write lock on bucket to be granted once the objects are released")
+	}
+	if rlock("bucket/dir/object", "r3") {
+		t.Fatal("expected read lock on a descendant to be denied while the bucket is write locked")
+	}
+
+	// Without the option names are independent
+	flat := newLockServer(t, lockserver.Options{})
+	flat.Lock(&LockArgs{Name: "bucket/object", UID: "w7"}, &resp)
+	var granted LockResp
+	if flat.Lock(&LockArgs{Name: "bucket", UID: "w8"}, &granted); !granted.Granted {
+		t.Fatal("expected write lock on bucket to be granted when not hierarchical")
+	}
+}
+
+// invalidateClient reports the names of all Invalidate calls on a channel.
+type invalidateClient chan string
+
+func (c invalidateClient) Call(serviceMethod string, args interface {
+	SetToken(token string)
+	SetTimestamp(tstamp time.Time)
+}, reply interface{}) error {
+	if serviceMethod == "Dsync.Invalidate" {
+		c <- args.(*LockArgs).Name
+	}
+	return nil
+}
+func (invalidateClient) Node() string    { return "127.0.0.1:0" }
+func (invalidateClient) RPCPath() string { return DefaultPath }
+func (invalidateClient) Close() error    { return nil }
+
+func TestLockServerInvalidations(t *testing.T) {
+
+	ch := make(invalidateClient, 10)
+	l := newLockServer(t, lockserver.Options{
+		Invalidations: true,
+		NewClient:     func(node, rpcPath string) RPC { return ch },
+	})
+
+	var resp LockResp
+	for _, uid := range []string{"1", "2"} {
+		if err := l.RLock(&LockArgs{Name: "cached", Node: "127.0.0.1:0", UID: uid}, &resp); err != nil || !resp.Granted {
+			t.Fatalf("expected read lock to be granted, got %v (%v)", resp.Granted, err)
+		}
+	}
+	if err := l.Lock(&LockArgs{Name: "cached", UID: "3"}, &resp); err != nil || resp.Granted {
+		t.Fatalf("expected write lock to be denied, got %v (%v)", resp.Granted, err)
+	}
+
+	select {
+	case name := <-ch:
+		if name != "cached" {
+			t.Fatalf("expected invalidation of cached, got %s", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected invalidation of read locks")
+	}
+	select {
+	case <-ch:
+		t.Fatal("expected a single invalidation for read locks held by the same node")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// revokedClient reports the uids of all Revoked calls on a channel.
+type revokedClient chan string
+
+func (c revokedClient) Call(serviceMethod string, args interface {
+	SetToken(token string)
+	SetTimestamp(tstamp time.Time)
+}, reply interface{}) error {
+	if serviceMethod == "Dsync.Revoked" {
+		c <- args.(*LockArgs).UID
+	}
+	return nil
+}
+func (revokedClient) Node() string    { return "127.0.0.1:0" }
+func (revokedClient) RPCPath() string { return DefaultPath }
+func (revokedClient) Close() error    { return nil }
+
+func TestLockServerMaxHoldTimes(t *testing.T) {
+
+	ch := make(revokedClient, 10)
+	l := newLockServer(t, lockserver.Options{
+		MaintenanceInterval: 10 * time.Millisecond,
+		ValidityInterval:    time.Hour,
+		MaxHoldTimes:        map[string]time.Duration{"": time.Hour, "short/": 20 * time.Millisecond},
+		NewClient:           func(node, rpcPath string) RPC { return ch },
+	})
+
+	var resp LockResp
+	for _, args := range []*LockArgs{{Name: "short/a", UID: "1"}, {Name: "long/b", UID: "2"}} {
+		if err := l.Lock(args, &resp); err != nil || !resp.Granted {
+			t.Fatalf("expected write lock to be granted, got %v (%v)", resp.Granted, err)
+		}
+	}
+
+	select {
+	case uid := <-ch:
+		if uid != "1" {
+			t.Fatalf("expected lock with uid 1 to be revoked, got %s", uid)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected lock to be revoked")
+	}
+
+	var snapshot SnapshotReply
+	l.Snapshot(&SnapshotArgs{}, &snapshot)
+	if len(snapshot.Entries) != 1 || snapshot.Entries[0].Name != "long/b" {
+		t.Fatalf("expected only long/b to be locked, got %v", snapshot.Entries)
+	}
+}
+
+func TestLockServerMaxHoldTimesClock(t *testing.T) {
+
+	// Hold times are measured with the clock of the lock server, like the leases
+	fc := NewFakeClock(time.Now())
+	ch := make(revokedClient, 10)
+	l := newLockServer(t, lockserver.Options{
+		MaintenanceInterval: 10 * time.Millisecond,
+		ValidityInterval:    time.Hour,
+		MaxHoldTimes:        map[string]time.Duration{"": time.Minute},
+		NewClient:           func(node, rpcPath string) RPC { return ch },
+		Clock:               fc,
+	})
+
+	var resp LockResp
+	if err := l.Lock(&LockArgs{Name: "a", UID: "1"}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected write lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+	var snapshot SnapshotReply
+	l.Snapshot(&SnapshotArgs{}, &snapshot)
+	if len(snapshot.Entries) != 1 || !snapshot.Entries[0].Since.Equal(fc.Now()) {
+		t.Fatalf("expected the lock to be timestamped by the clock of the lock server, got %v", snapshot.Entries)
+	}
+
+	select {
+	case uid := <-ch:
+		t.Fatalf("expected lock with uid %s not to be revoked before the clock passed the hold time", uid)
+	case <-time.After(100 * time.Millisecond):
+	}
+	fc.Advance(2 * time.Minute)
+	select {
+	case uid := <-ch:
+		if uid != "1" {
+			t.Fatalf("expected lock with uid 1 to be revoked, got %s", uid)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected lock to be revoked once the clock passed the hold time")
+	}
+}
+
+func TestLockServerAuditLog(t *testing.T) {
+
+	var auditLog bytes.Buffer
+	l := newLockServer(t, lockserver.Options{AuditLog: &auditLog})
+
+	var resp LockResp
+	l.Lock(&LockArgs{Name: "stuck", UID: "1"}, &resp)
+
+	var reply SnapshotReply
+	args := AdminForceUnlockArgs{Name: "stuck", Operator: "operator", Reason: "disaster", Override: true}
+	if err := l.AdminForceUnlock(&args, &reply); err != nil || len(reply.Entries) != 1 {
+		t.Fatalf("expected lock to be removed, got %v (%v)", reply.Entries, err)
+	}
+
+	var record lockserver.AuditRecord
+	if err := json.Unmarshal(auditLog.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Operation != "force-unlock" || record.Name != "stuck" || record.Operator != "operator" ||
+		record.Reason != "disaster" || !record.Override || len(record.Removed) != 1 {
+		t.Fatalf("unexpected audit record %+v", record)
+	}
+}
+
+func TestLockServerHotspots(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{HotspotWindow: time.Minute})
+
+	var resp LockResp
+	l.RLock(&LockArgs{Name: "cold", Node: "A", UID: "1"}, &resp)
+	l.Lock(&LockArgs{Name: "hot", Node: "A", UID: "2"}, &resp)
+	for i := 0; i < 2; i++ {
+		if l.Lock(&LockArgs{Name: "hot", Node: "B", UID: fmt.Sprint(i + 3)}, &resp); resp.Granted {
+			t.Fatal("expected write lock to be denied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	l.Unlock(&LockArgs{Name: "hot", Node: "A", UID: "2"}, &resp)
+	if l.Lock(&LockArgs{Name: "hot", Node: "B", UID: "5"}, &resp); !resp.Granted {
+		t.Fatal("expected write lock to be granted")
+	}
+
+	var reply HotspotsReply
+	if err := l.Hotspots(&HotspotsArgs{Count: 1}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Window != time.Minute || len(reply.Hotspots) != 1 {
+		t.Fatalf("expected a single hotspot over a minute, got %v over %s", reply.Hotspots, reply.Window)
+	}
+	if hs := reply.Hotspots[0]; hs.Name != "hot" || hs.Requests != 4 || hs.Denies != 2 || hs.AvgWait < 20*time.Millisecond {
+		t.Fatalf("expected hot with 4 requests, 2 denies and a wait of at least 20ms, got %+v", hs)
+	}
+
+	// Tracking is disabled by default
+	l2 := newLockServer(t, lockserver.Options{})
+	if err := l2.Hotspots(&HotspotsArgs{}, &reply); err == nil {
+		t.Fatal("expected error when hotspot tracking is disabled")
+	}
+}
+
+func TestLockServerStats(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{HotspotWindow: time.Minute})
+
+	var resp LockResp
+	for i, name := range []string{"bucket/a", "bucket/b", "bucket/b", "other"} {
+		l.RLock(&LockArgs{Name: name, Node: "A", UID: fmt.Sprint(i)}, &resp)
+	}
+
+	var reply StatsReply
+	if err := l.Stats(&StatsArgs{Prefix: "bucket/", Names: []string{"idle"}}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Window != time.Minute || len(reply.Stats) != 3 {
+		t.Fatalf("expected stats of 3 names over a minute, got %v over %s", reply.Stats, reply.Window)
+	}
+	for i, expected := range []Hotspot{{Name: "bucket/a", Requests: 1}, {Name: "bucket/b", Requests: 2}, {Name: "idle"}} {
+		if reply.Stats[i] != expected {
+			t.Fatalf("expected %+v, got %+v", expected, reply.Stats[i])
+		}
+	}
+
+	// An empty prefix selects all names
+	if err := l.Stats(&StatsArgs{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Stats) != 3 || reply.Stats[2].Name != "other" {
+		t.Fatalf("expected stats of all 3 names, got %v", reply.Stats)
+	}
+}
+
+func TestLockServerFreeze(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lockserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var auditLog bytes.Buffer
+	opts := lockserver.Options{FreezeFile: filepath.Join(dir, "frozen.json"), AuditLog: &auditLog}
+
+	l := newLockServer(t, opts)
+
+	var reply FreezeReply
+	if err = l.Freeze(&FreezeArgs{Name: "corrupt", Operator: "operator", Reason: "investigating"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Names) != 1 || reply.Names[0] != "corrupt" {
+		t.Fatalf("expected corrupt to be frozen, got %v", reply.Names)
+	}
+	if !strings.Contains(auditLog.String(), `"operation":"freeze"`) {
+		t.Fatalf("expected freeze in audit log, got %s", auditLog.String())
+	}
+
+	// Frozen names survive a restart
+	l2 := newLockServer(t, opts)
+
+	var resp LockResp
+	if err = l2.Lock(&LockArgs{Name: "corrupt", UID: "1"}, &resp); err != nil || resp.Granted || !resp.Frozen {
+		t.Fatalf("expected write lock to be denied as frozen, got %+v (%v)", resp, err)
+	}
+	if err = l2.RLock(&LockArgs{Name: "corrupt", UID: "2"}, &resp); err != nil || resp.Granted || !resp.Frozen {
+		t.Fatalf("expected read lock to be denied as frozen, got %+v (%v)", resp, err)
+	}
+
+	if err = l2.Freeze(&FreezeArgs{Name: "corrupt", Unfreeze: true, Operator: "operator", Reason: "restored"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if err = l2.Lock(&LockArgs{Name: "corrupt", UID: "3"}, &resp); err != nil || !resp.Granted || resp.Frozen {
+		t.Fatalf("expected write lock to be granted once unfrozen, got %+v (%v)", resp, err)
+	}
+}
+
+func TestLockServerReclaim(t *testing.T) {
+
+	var auditLog lockedBuffer
+	l := newLockServer(t, lockserver.Options{ReclaimDelay: 20 * time.Millisecond, AuditLog: &auditLog})
+
+	var resp LockResp
+	l.Lock(&LockArgs{Name: "a", Node: "dead", UID: "1"}, &resp)
+	l.RLock(&LockArgs{Name: "b", Node: "dead", UID: "2"}, &resp)
+	l.RLock(&LockArgs{Name: "b", Node: "alive", UID: "3"}, &resp)
+	l.Lock(&LockArgs{Name: "c", Node: "alive", UID: "4"}, &resp)
+
+	// False positive, cancelled in time
+	l.NodeDown("alive")
+	l.NodeUp("alive")
+
+	l.NodeDown("dead")
+	time.Sleep(100 * time.Millisecond)
+
+	var reply SnapshotReply
+	l.Snapshot(&SnapshotArgs{}, &reply)
+	if len(reply.Entries) != 2 {
+		t.Fatalf("expected only the locks of the alive node to be left, got %v", reply.Entries)
+	}
+	for _, e := range reply.Entries {
+		if e.Node != "alive" {
+			t.Fatalf("expected lock of dead node to be reclaimed, got %v", e)
+		}
+	}
+	if s := auditLog.String(); strings.Count(s, `"operation":"reclaim"`) != 2 {
+		t.Fatalf("expected two reclaim records in audit log, got %s", s)
+	}
+}
+
+func TestLockServerNodeMoved(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{ReclaimDelay: 20 * time.Millisecond})
+
+	var resp LockResp
+	l.Lock(&LockArgs{Name: "a", Node: "old", UID: "1"}, &resp)
+	l.RLock(&LockArgs{Name: "b", Node: "old", UID: "2"}, &resp)
+	l.RLock(&LockArgs{Name: "b", Node: "other", UID: "3"}, &resp)
+
+	// The old address is reported down before the move is announced
+	l.NodeDown("old")
+	l.NodeMoved("old", "new")
+	time.Sleep(100 * time.Millisecond)
+
+	var reply SnapshotReply
+	l.Snapshot(&SnapshotArgs{}, &reply)
+	nodes := make(map[string]string)
+	for _, e := range reply.Entries {
+		nodes[e.UID] = e.Node
+	}
+	if len(nodes) != 3 || nodes["1"] != "new" || nodes["2"] != "new" || nodes["3"] != "other" {
+		t.Fatalf("expected the locks of the old address to be kept at the new one, got %v", reply.Entries)
+	}
+
+	// The moved lock can be released as before
+	if err := l.Unlock(&LockArgs{Name: "a", UID: "1"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockServerAdopt(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{})
+
+	var resp LockResp
+	l.Lock(&LockArgs{Name: "a", Node: "n1", UID: "1"}, &resp)
+	l.RLock(&LockArgs{Name: "b", Node: "n1", UID: "2"}, &resp)
+
+	var reply SnapshotReply
+	err := l.Adopt(&AdoptArgs{Entries: []LockEntry{
+		{Name: "a", Node: "n2", UID: "3"},               // Write locked
+		{Name: "b", Node: "n1", UID: "2"},               // Held already
+		{Name: "b", Node: "n2", UID: "4"},               // Adopted
+		{Name: "c", Node: "n2", UID: "5", Writer: true}, // Write locks are not adopted
+		{Name: "d", Node: "n3", UID: "6"},               // Adopted
+	}}, &reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adopted := make(map[string]string)
+	for _, e := range reply.Entries {
+		adopted[e.UID] = e.Name
+	}
+	if len(adopted) != 2 || adopted["4"] != "b" || adopted["6"] != "d" {
+		t.Fatalf("expected read locks 4 and 6 to be adopted, got %v", reply.Entries)
+	}
+
+	reply = SnapshotReply{}
+	l.Snapshot(&SnapshotArgs{}, &reply)
+	if len(reply.Entries) != 4 {
+		t.Fatalf("expected 4 locks held, got %v", reply.Entries)
+	}
+
+	// An adopted lock keeps readers company until released
+	if l.Lock(&LockArgs{Name: "d", Node: "n1", UID: "7"}, &resp); resp.Granted {
+		t.Fatal("expected write lock to be denied while an adopted read lock is held")
+	}
+	if err := l.RUnlock(&LockArgs{Name: "d", UID: "6"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lockedBuffer - bytes.Buffer that is safe for concurrent use.
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestLockServerQuotas(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{Quotas: map[string]int{"tenant/": 3, "tenant/sub/": 1}})
+
+	var resp LockResp
+	for i, tc := range []struct {
+		name    string
+		read    bool
+		granted bool
+	}{
+		{"tenant/a", false, true},
+		{"tenant/sub/b", true, true},
+		{"tenant/sub/b", true, false}, // Quota of child namespace exhausted
+		{"tenant/c", true, true},
+		{"tenant/d", false, false}, // Quota of namespace exhausted
+		{"other/e", false, true},   // No quota
+	} {
+		args := &LockArgs{Name: tc.name, UID: fmt.Sprint(i)}
+		var err error
+		if tc.read {
+			err = l.RLock(args, &resp)
+		} else {
+			err = l.Lock(args, &resp)
+		}
+		if err != nil || resp.Granted != tc.granted {
+			t.Fatalf("case %d: expected lock on %s to be granted: %v, got %v (%v)", i, tc.name, tc.granted, resp.Granted, err)
+		}
+	}
+
+	// Releasing a lock makes room again
+	l.Unlock(&LockArgs{Name: "tenant/a", UID: "0"}, &resp)
+	if l.Lock(&LockArgs{Name: "tenant/d", UID: "6"}, &resp); !resp.Granted {
+		t.Fatal("expected write lock to be granted once quota is available")
+	}
+}
+
+func TestLockServerLeaseTTLs(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{
+		LeaseTTLs: map[string]lockserver.LeaseTTL{
+			"":      {Default: 50 * time.Millisecond, Max: 100 * time.Millisecond},
+			"long/": {Max: time.Hour},
+		},
+	})
+
+	for i, tc := range []struct {
+		name      string
+		requested time.Duration
+		ttl       time.Duration
+	}{
+		{"a", 0, 50 * time.Millisecond},                     // Default applies
+		{"b", 20 * time.Millisecond, 20 * time.Millisecond}, // Honored below the maximum
+		{"c", time.Hour, 100 * time.Millisecond},            // Capped at the maximum
+		{"long/d", 0, time.Hour},                            // No default, so capped at the maximum
+	} {
+		var resp LockResp
+		if err := l.Lock(&LockArgs{Name: tc.name, UID: fmt.Sprint(i), TTL: tc.requested}, &resp); err != nil || !resp.Granted {
+			t.Fatalf("case %d: expected lock to be granted, got %v (%v)", i, resp.Granted, err)
+		}
+		if resp.TTL != tc.ttl {
+			t.Errorf("case %d: expected lease of %v, got %v", i, tc.ttl, resp.TTL)
+		}
+	}
+
+	// Keep the lease of a alive
+	var resp LockResp
+	time.Sleep(30 * time.Millisecond)
+	if l.Refresh(&LockArgs{Name: "a", UID: "0"}, &resp); !resp.Granted || resp.TTL != 50*time.Millisecond {
+		t.Fatalf("expected lease to be refreshed, got %v (%v)", resp.Granted, resp.TTL)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// Lease of a refreshed, lease of b expired
+	if l.Lock(&LockArgs{Name: "a", UID: "4"}, &resp); resp.Granted {
+		t.Fatal("expected write lock with refreshed lease to be held")
+	}
+	if l.Lock(&LockArgs{Name: "b", UID: "5"}, &resp); !resp.Granted {
+		t.Fatal("expected write lock to be granted once the lease expired")
+	}
+	if l.Refresh(&LockArgs{Name: "b", UID: "1"}, &resp); resp.Granted {
+		t.Fatal("expected refresh of expired lease to be denied")
+	}
+
+	// Expired leases no longer show up as held, even before they are removed
+	if l.Lock(&LockArgs{Name: "e", UID: "6", TTL: 10 * time.Millisecond}, &resp); !resp.Granted {
+		t.Fatal("expected write lock to be granted")
+	}
+	time.Sleep(20 * time.Millisecond)
+	var snapshot SnapshotReply
+	if err := l.Snapshot(&SnapshotArgs{}, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range snapshot.Entries {
+		if e.Name == "e" {
+			t.Fatalf("expected lock with expired lease to be left out, got %v", e)
+		}
+	}
+}
+
+func TestLockServerClock(t *testing.T) {
+
+	// Leases expire by the clock of the lock server, eg. one running ahead
+	fc := NewFakeClock(time.Now())
+	l := newLockServer(t, lockserver.Options{Clock: fc})
+
+	var resp LockResp
+	if err := l.Lock(&LockArgs{Name: "a", UID: "1", TTL: time.Minute}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+	fc.Advance(50 * time.Second)
+	if l.Lock(&LockArgs{Name: "a", UID: "2"}, &resp); resp.Granted {
+		t.Fatal("expected write lock with lease to be held")
+	}
+	fc.Advance(20 * time.Second)
+	if l.Lock(&LockArgs{Name: "a", UID: "3"}, &resp); !resp.Granted {
+		t.Fatal("expected write lock to be granted once the clock passed the lease")
+	}
+}
+
+func TestLockServerValidate(t *testing.T) {
+
+	timestamp := time.Now().UTC()
+	l := newLockServer(t, lockserver.Options{Timestamp: timestamp})
+
+	var resp LockResp
+	if err := l.Validate(&LockArgs{Name: "a", UID: "1"}, &resp); err != nil || resp.Granted {
+		t.Fatalf("expected lock not to be held, got %v (%v)", resp.Granted, err)
+	}
+	args := &LockArgs{Name: "a", UID: "1"}
+	args.SetTimestamp(timestamp)
+	if err := l.Lock(args, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+
+	// Validated irrespective of the timestamp, eg. by a client of the lock server before a restart
+	if err := l.Validate(&LockArgs{Name: "a", UID: "1"}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected lock to be held, got %v (%v)", resp.Granted, err)
+	}
+	if l.Validate(&LockArgs{Name: "a", UID: "2"}, &resp); resp.Granted {
+		t.Fatal("expected lock not to be held with other uid")
+	}
+}
+
+func TestLockServerUpgrade(t *testing.T) {
+
+	timestamp := time.Now().UTC()
+	l := newLockServer(t, lockserver.Options{Timestamp: timestamp})
+
+	call := func(fn func(*LockArgs, *LockResp) error, uid string) (bool, error) {
+		args := &LockArgs{Name: "a", UID: uid}
+		args.SetTimestamp(timestamp)
+		var resp LockResp
+		err := fn(args, &resp)
+		return resp.Granted, err
+	}
+	if granted, err := call(l.RLock, "1"); err != nil || !granted {
+		t.Fatalf("expected read lock to be granted, got %v (%v)", granted, err)
+	}
+	if granted, err := call(l.RLock, "2"); err != nil || !granted {
+		t.Fatalf("expected read lock to be granted, got %v (%v)", granted, err)
+	}
+
+	// Not converted while other read locks are held, nor for an unknown uid
+	if granted, err := call(l.Upgrade, "1"); err != nil || granted {
+		t.Fatalf("expected upgrade to be denied, got %v (%v)", granted, err)
+	}
+	if _, err := call(l.Upgrade, "3"); err == nil {
+		t.Fatal("expected upgrade of unknown read lock to fail")
+	}
+	if _, err := call(l.RUnlock, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if granted, err := call(l.Upgrade, "1"); err != nil || !granted {
+		t.Fatalf("expected upgrade to be granted, got %v (%v)", granted, err)
+	}
+	if granted, _ := call(l.RLock, "4"); granted {
+		t.Fatal("expected read lock to be denied after upgrade")
+	}
+
+	// Converted back, after which other read locks are granted and the read lock is released
+	if _, err := call(l.Downgrade, "3"); err == nil {
+		t.Fatal("expected downgrade of unknown write lock to fail")
+	}
+	if granted, err := call(l.Downgrade, "1"); err != nil || !granted {
+		t.Fatalf("expected downgrade to be granted, got %v (%v)", granted, err)
+	}
+	if granted, err := call(l.RLock, "4"); err != nil || !granted {
+		t.Fatalf("expected read lock to be granted after downgrade, got %v (%v)", granted, err)
+	}
+	if _, err := call(l.RUnlock, "1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockServerMode(t *testing.T) {
+
+	timestamp := time.Now().UTC()
+	l := newLockServer(t, lockserver.Options{Timestamp: timestamp})
+
+	// Requests in another mode than the RPC operates in are refused, requests of older
+	// clients without mode are accepted
+	var resp LockResp
+	for _, mode := range []LockMode{Shared, "intent"} {
+		args := &LockArgs{Name: "a", UID: "1", Mode: mode}
+		args.SetTimestamp(timestamp)
+		if err := l.Lock(args, &resp); err == nil {
+			t.Fatalf("expected lock in mode %q to be refused", mode)
+		}
+	}
+	args := &LockArgs{Name: "a", UID: "1", Mode: Exclusive}
+	args.SetTimestamp(timestamp)
+	if err := l.Lock(args, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+	args = &LockArgs{Name: "b", UID: "2"}
+	args.SetTimestamp(timestamp)
+	if err := l.RLock(args, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected read lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+
+	// Reported along with the grants
+	var reply SnapshotReply
+	if err := l.Snapshot(&SnapshotArgs{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range reply.Entries {
+		if e.Mode != ModeOf(e.Writer) || e.Mode.IsExclusive() != (e.Name == "a") {
+			t.Fatalf("expected mode matching the lock, got %+v", e)
+		}
+	}
+}
+
+func TestLockServerDryRun(t *testing.T) {
+
+	timestamp := time.Now().UTC()
+	l := newLockServer(t, lockserver.Options{Timestamp: timestamp, Quotas: map[string]int{"q/": 1}})
+
+	call := func(fn func(*LockArgs, *LockResp) error, name, uid string, dryRun bool) bool {
+		args := &LockArgs{Name: name, UID: uid, DryRun: dryRun}
+		args.SetTimestamp(timestamp)
+		var resp LockResp
+		if err := fn(args, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Granted
+	}
+
+	// Dry runs do not grant the lock
+	if !call(l.Lock, "a", "1", true) || !call(l.Lock, "a", "2", true) {
+		t.Fatal("expected dry run of write lock to succeed on a free lock")
+	}
+	if !call(l.RLock, "a", "3", false) {
+		t.Fatal("expected read lock to be granted after dry runs")
+	}
+	if call(l.Lock, "a", "4", true) || !call(l.RLock, "a", "5", true) {
+		t.Fatal("expected dry runs to only succeed for read locks while read locked")
+	}
+
+	// Quotas are checked without being charged
+	if !call(l.Lock, "q/a", "6", true) || !call(l.Lock, "q/b", "7", false) {
+		t.Fatal("expected lock within the quota to be granted after dry run")
+	}
+	if call(l.Lock, "q/c", "8", true) {
+		t.Fatal("expected dry run to fail with the quota exhausted")
+	}
+
+	var reply SnapshotReply
+	if err := l.Snapshot(&SnapshotArgs{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Entries) != 2 {
+		t.Fatalf("expected only the locks granted for real to be held, got %+v", reply.Entries)
+	}
+}
+
+func TestLockServerOwner(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{})
+
+	var resp LockResp
+	if err := l.RLock(&LockArgs{Name: "a", UID: "1", Owner: "owner", Source: "app/main.go:42"}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected read lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+	var reply SnapshotReply
+	if err := l.Snapshot(&SnapshotArgs{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Entries) != 1 || reply.Entries[0].Owner != "owner" || reply.Entries[0].Source != "app/main.go:42" {
+		t.Fatalf("expected grant with owner and source, got %+v", reply.Entries)
+	}
+
+	// Kept when the read lock is adopted by another node
+	other := newLockServer(t, lockserver.Options{})
+	var adopted SnapshotReply
+	if err := other.Adopt(&AdoptArgs{Entries: reply.Entries}, &adopted); err != nil {
+		t.Fatal(err)
+	}
+	if len(adopted.Entries) != 1 || adopted.Entries[0].Owner != "owner" || adopted.Entries[0].Source != "app/main.go:42" {
+		t.Fatalf("expected adopted grant with owner and source, got %+v", adopted.Entries)
+	}
+}
+
+func TestLockServerTags(t *testing.T) {
+
+	events := make(chan lockserver.Event, 10)
+	l := newLockServer(t, lockserver.Options{
+		Journal: lockserver.JournalFunc(func(batch []lockserver.Event) error {
+			for _, event := range batch {
+				events <- event
+			}
+			return nil
+		}),
+	})
+
+	tags := map[string]string{"job": "42"}
+	var resp LockResp
+	if err := l.RLock(&LockArgs{Name: "a", UID: "1", Tags: tags}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected read lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+	var reply SnapshotReply
+	if err := l.Snapshot(&SnapshotArgs{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Entries) != 1 || !reflect.DeepEqual(reply.Entries[0].Tags, tags) {
+		t.Fatalf("expected grant with tags %v, got %+v", tags, reply.Entries)
+	}
+	select {
+	case event := <-events:
+		if event.Type != lockserver.EventGrant || !reflect.DeepEqual(event.Tags, tags) {
+			t.Fatalf("expected grant event with tags %v, got %+v", tags, event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected grant event")
+	}
+
+	// Kept when the read lock is adopted by another node
+	other := newLockServer(t, lockserver.Options{})
+	var adopted SnapshotReply
+	if err := other.Adopt(&AdoptArgs{Entries: reply.Entries}, &adopted); err != nil {
+		t.Fatal(err)
+	}
+	if len(adopted.Entries) != 1 || !reflect.DeepEqual(adopted.Entries[0].Tags, tags) {
+		t.Fatalf("expected adopted grant with tags %v, got %+v", tags, adopted.Entries)
+	}
+}
+
+func TestLockServerIdleTimeout(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{IdleTimeout: 50 * time.Millisecond, HotspotWindow: 60 * time.Millisecond})
+
+	var reply QueueReply
+	for id := uint64(1); id <= 2; id++ {
+		if err := l.QueuePush(&QueueArgs{Queue: "idle", ID: id}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var barrier BarrierReply
+	if err := l.Barrier(&BarrierArgs{Barrier: "idle", Parties: 2, UID: "1"}, &barrier); err != nil || !barrier.Granted {
+		t.Fatalf("expected arrival at barrier, got %v (%v)", barrier.Granted, err)
+	}
+	var resp LockResp
+	if err := l.Lock(&LockArgs{Name: "a", UID: "1"}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected write lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+
+	// Queues in use are kept
+	deadline := time.Now().Add(2 * time.Second)
+	for l.GCStats().Runs < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		var list QueueReply
+		if err := l.QueueList(&QueueArgs{Queue: "idle"}, &list); err != nil || len(list.IDs) != 2 {
+			t.Fatalf("expected jobs of queue in use to be kept, got %v (%v)", list.IDs, err)
+		}
+	}
+
+	// Idle bookkeeping is collected, the locks are kept
+	for time.Now().Before(deadline) {
+		if gc := l.GCStats(); gc.Queues == 1 && gc.Jobs == 2 && gc.Barriers == 1 && gc.Hotspots > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if gc := l.GCStats(); gc.Queues != 1 || gc.Jobs != 2 || gc.Barriers != 1 || gc.Hotspots == 0 {
+		t.Fatalf("expected idle queue, barrier phase and hotspots to be collected, got %+v", gc)
+	}
+	var list QueueReply
+	if err := l.QueueList(&QueueArgs{Queue: "idle"}, &list); err != nil || len(list.IDs) != 0 {
+		t.Fatalf("expected idle queue to be dropped, got %v (%v)", list.IDs, err)
+	}
+	var polled BarrierReply
+	if err := l.Barrier(&BarrierArgs{Barrier: "idle", Parties: 2}, &polled); err != nil || polled.Granted {
+		t.Fatalf("expected idle barrier phase to be dropped, got %+v (%v)", polled, err)
+	}
+	if l.Lock(&LockArgs{Name: "a", UID: "2"}, &resp); resp.Granted {
+		t.Fatal("expected write lock to be kept")
+	}
+}
+
+func TestLockServerList(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{})
+
+	for i, name := range []string{"a/1", "a/2", "b/1", "c"} {
+		var resp LockResp
+		if err := l.Lock(&LockArgs{Name: name, UID: fmt.Sprint(i)}, &resp); err != nil || !resp.Granted {
+			t.Fatalf("expected lock to be granted, got %v (%v)", resp.Granted, err)
+		}
+	}
+	for _, tc := range []struct {
+		prefix string
+		names  []string
+		want   string
+	}{
+		{"", nil, "a/1 a/2 b/1 c"},
+		{"a/", nil, "a/1 a/2"},
+		{"", []string{"c", "missing"}, "c"},
+		{"a/", []string{"c", "a/1"}, "a/1 a/2 c"},
+	} {
+		var reply SnapshotReply
+		if err := l.List(&ListArgs{Prefix: tc.prefix, Names: tc.names}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range reply.Entries {
+			names = append(names, e.Name)
+		}
+		if got := strings.Join(names, " "); got != tc.want || reply.Checksum != ChecksumEntries(reply.Entries) {
+			t.Fatalf("expected %q for prefix %q and names %v, got %q", tc.want, tc.prefix, tc.names, got)
+		}
+	}
+}
+
+func TestLockServerSequence(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "dsync-sequence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sequences.json")
+
+	l := lockserver.New(lockserver.Options{SequenceFile: file})
+	var reply SequenceReply
+	if err = l.Sequence(&SequenceArgs{Name: "seq", Value: 5}, &reply); err != nil || !reply.Accepted || reply.HighWater != 5 {
+		t.Fatalf("expected value to be accepted, got %v (%v)", reply, err)
+	}
+	reply = SequenceReply{}
+	if l.Sequence(&SequenceArgs{Name: "seq", Value: 5}, &reply); reply.Accepted || reply.HighWater != 5 {
+		t.Fatalf("expected value at high-water mark to be refused, got %v", reply)
+	}
+	l.Close()
+
+	// High-water marks survive a restart
+	l = newLockServer(t, lockserver.Options{SequenceFile: file})
+	reply = SequenceReply{}
+	if l.Sequence(&SequenceArgs{Name: "seq", Value: 3}, &reply); reply.Accepted || reply.HighWater != 5 {
+		t.Fatalf("expected high-water mark to be persisted, got %v", reply)
+	}
+}
+
+func TestLockServerStateMigration(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "dsync-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	freezeFile, sequenceFile := filepath.Join(dir, "frozen.json"), filepath.Join(dir, "sequences.json")
+
+	// Files as written before they were versioned
+	if err = ioutil.WriteFile(freezeFile, []byte(`["frozen"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(sequenceFile, []byte(`{"seq":7}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := lockserver.New(lockserver.Options{FreezeFile: freezeFile, SequenceFile: sequenceFile})
+	var resp LockResp
+	if l.Lock(&LockArgs{Name: "frozen", UID: "1"}, &resp); !resp.Frozen {
+		t.Fatal("expected frozen name to be migrated")
+	}
+	var reply SequenceReply
+	if l.Sequence(&SequenceArgs{Name: "seq", Value: 7}, &reply); reply.Accepted || reply.HighWater != 7 {
+		t.Fatalf("expected high-water mark to be migrated, got %v", reply)
+	}
+	l.Close()
+
+	for _, file := range []string{freezeFile, sequenceFile} {
+		if b, err := ioutil.ReadFile(file); err != nil || !strings.HasPrefix(string(b), `{"version":1,`) {
+			t.Fatalf("expected %s to be rewritten with the current schema version, got %s (%v)", file, b, err)
+		}
+	}
+
+	// Files of a newer lock server are refused rather than misinterpreted
+	if err = ioutil.WriteFile(sequenceFile, []byte(`{"version":99,"data":{"seq":7}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "schema version 99") {
+			t.Fatalf("expected newer schema version to be refused, got %v", r)
+		}
+	}()
+	lockserver.New(lockserver.Options{SequenceFile: sequenceFile})
+}
+
+func TestLockServerStateChecksum(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "dsync-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sequences.json")
+
+	l := lockserver.New(lockserver.Options{SequenceFile: file})
+	var reply SequenceReply
+	if l.Sequence(&SequenceArgs{Name: "seq", Value: 5}, &reply); !reply.Accepted {
+		t.Fatalf("expected value to be accepted, got %v", reply)
+	}
+	l.Close()
+
+	// Silently corrupted on disk
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(file, bytes.Replace(b, []byte(`"seq":5`), []byte(`"seq":1`), 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), ErrChecksum.Error()) {
+			t.Fatalf("expected corrupt file to be refused, got %v", r)
+		}
+	}()
+	lockserver.New(lockserver.Options{SequenceFile: file})
+}
+
+func TestLockServerAdoptChecksum(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{})
+
+	entries := []LockEntry{{Name: "a", Node: "node", UID: "1"}}
+	checksum := ChecksumEntries(entries)
+	entries[0].UID = "2" // Corrupted in transfer
+
+	var reply SnapshotReply
+	if err := l.Adopt(&AdoptArgs{Entries: entries, Checksum: checksum}, &reply); err != ErrChecksum {
+		t.Fatalf("expected corrupt read locks to be refused, got %v", err)
+	}
+	if err := l.Adopt(&AdoptArgs{Entries: entries, Checksum: ChecksumEntries(entries)}, &reply); err != nil || len(reply.Entries) != 1 {
+		t.Fatalf("expected read lock to be adopted, got %v (%v)", reply.Entries, err)
+	}
+}
+
+func TestLockServerView(t *testing.T) {
+
+	l := newLockServer(t, lockserver.Options{})
+
+	var resp LockResp
+	l.RLock(&LockArgs{Name: "a", UID: "1"}, &resp)
+	l.RLock(&LockArgs{Name: "a", UID: "2"}, &resp)
+	if !resp.Granted || resp.View == nil || resp.View.Writer || resp.View.Readers != 2 || resp.View.Epoch == 0 {
+		t.Fatalf("expected view with 2 readers, got %+v", resp.View)
+	}
+	epoch := resp.View.Epoch
+
+	resp = LockResp{}
+	if l.Lock(&LockArgs{Name: "a", UID: "3"}, &resp); resp.Granted || resp.View != nil {
+		t.Fatalf("expected no view without grant, got %+v", resp.View)
+	}
+	if l.Lock(&LockArgs{Name: "b", UID: "4"}, &resp); !resp.Granted || resp.View == nil || !resp.View.Writer ||
+		resp.View.Readers != 0 || resp.View.Epoch != epoch {
+		t.Fatalf("expected view of write lock, got %+v", resp.View)
+	}
+}
+
+type publisher struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (p *publisher) Publish(subject string, data []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.messages = append(p.messages, subject+" "+string(data))
+	return nil
+}
+
+func TestLockServerJournal(t *testing.T) {
+
+	events := make(chan lockserver.Event, 10)
+	l := newLockServer(t, lockserver.Options{
+		Journal: lockserver.JournalFunc(func(batch []lockserver.Event) error {
+			for _, event := range batch {
+				events <- event
+			}
+			return nil
+		}),
+	})
+
+	var resp LockResp
+	if l.Lock(&LockArgs{Name: "a", UID: "1", Node: "node", TTL: 20 * time.Millisecond}, &resp); !resp.Granted {
+		t.Fatal("expected write lock to be granted")
+	}
+	if l.Lock(&LockArgs{Name: "a", UID: "2"}, &resp); resp.Granted {
+		t.Fatal("expected write lock to be denied")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if l.Lock(&LockArgs{Name: "a", UID: "3"}, &resp); !resp.Granted {
+		t.Fatal("expected write lock to be granted once the lease expired")
+	}
+	if err := l.Unlock(&LockArgs{Name: "a", UID: "3"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Denied requests leave no trace, expiries are shipped before the grant replacing them
+	for i, expected := range []struct {
+		typ lockserver.EventType
+		uid string
+	}{
+		{lockserver.EventGrant, "1"},
+		{lockserver.EventExpire, "1"},
+		{lockserver.EventGrant, "3"},
+		{lockserver.EventRelease, "3"},
+	} {
+		select {
+		case event := <-events:
+			if event.Type != expected.typ || event.UID != expected.uid || event.Name != "a" || !event.Writer {
+				t.Fatalf("event %d: expected %s of %s, got %+v", i, expected.typ, expected.uid, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d: expected %s of %s to be shipped", i, expected.typ, expected.uid)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("expected no more events, got %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p := &publisher{}
+	if err := lockserver.PublishJournal(p, "locks").Ship([]lockserver.Event{{Type: lockserver.EventGrant, Name: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.messages) != 1 || !strings.HasPrefix(p.messages[0], `locks {"type":"grant"`) {
+		t.Fatalf("expected event to be published as JSON, got %v", p.messages)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"errors"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// isPaused returns whether granting new locks is paused.
+func (l *LockServer) isPaused() bool {
+	l.pauseMutex.Lock()
+	defer l.pauseMutex.Unlock()
+	return !l.pausedSince.IsZero()
+}
+
+// refuseGrant returns whether a lock request for name is to be denied because name is
+// frozen or granting is paused, setting resp accordingly.
+func (l *LockServer) refuseGrant(name string, resp *dsync.LockResp) bool {
+	resp.Paused = l.isPaused()
+	resp.Frozen = resp.Paused || l.isFrozen(name)
+	return resp.Frozen
+}
+
+// Pause - rpc handler for pausing (or resuming) granting new locks on behalf of an
+// operator, replying with whether granting is paused. While paused all lock requests are
+// denied like for frozen names, whereas locks already held can be released and their
+// leases refreshed. Changes are recorded in the audit log but kept in memory only.
+func (l *LockServer) Pause(args *dsync.PauseArgs, reply *dsync.PauseReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	l.pauseMutex.Lock()
+	defer l.pauseMutex.Unlock()
+
+	if !args.Query {
+		if args.Operator == "" || args.Reason == "" {
+			return errors.New("Pause called without operator or reason")
+		}
+
+		operation := "pause"
+		if args.Resume {
+			operation = "resume"
+			l.pausedSince = time.Time{}
+		} else if l.pausedSince.IsZero() {
+			l.pausedSince = time.Now().UTC()
+		}
+		l.audit(AuditRecord{
+			Time:      time.Now().UTC(),
+			Operation: operation,
+			Operator:  args.Operator,
+			Reason:    args.Reason,
+		})
+	}
+
+	reply.Paused, reply.Since = !l.pausedSince.IsZero(), l.pausedSince
+	return nil
+}
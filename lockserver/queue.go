@@ -0,0 +1,143 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"sort"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// queueJob - job of a queue (see dsync.Queue).
+type queueJob struct {
+	payload        []byte
+	claimer        string    // Uid of the claim, empty when not claimed
+	invisibleUntil time.Time // End of the visibility timeout of the claim
+}
+
+// isVisible returns whether the job can be claimed at the given time.
+func (j *queueJob) isVisible(now time.Time) bool {
+	return j.claimer == "" || now.After(j.invisibleUntil)
+}
+
+// queue returns the jobs of the named queue, the caller must hold queueMutex.
+func (l *LockServer) queue(name string) map[uint64]*queueJob {
+	if l.queues == nil {
+		l.queues = make(map[string]map[uint64]*queueJob)
+	}
+	q, ok := l.queues[name]
+	if !ok {
+		q = make(map[uint64]*queueJob)
+		l.queues[name] = q
+	}
+	return q
+}
+
+// touchQueue records activity on the named queue (see Options.IdleTimeout), the caller
+// must hold queueMutex.
+func (l *LockServer) touchQueue(name string) {
+	if l.queueActivity == nil {
+		l.queueActivity = make(map[string]time.Time)
+	}
+	l.queueActivity[name] = time.Now()
+}
+
+// QueuePush - rpc handler for adding a job to a queue.
+func (l *LockServer) QueuePush(args *dsync.QueueArgs, reply *dsync.QueueReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	l.queueMutex.Lock()
+	defer l.queueMutex.Unlock()
+	l.touchQueue(args.Queue)
+	q := l.queue(args.Queue)
+	if _, ok := q[args.ID]; !ok {
+		q[args.ID] = &queueJob{payload: args.Payload}
+	}
+	reply.Granted = true
+	return nil
+}
+
+// QueueList - rpc handler for listing the jobs of a queue that can be claimed.
+func (l *LockServer) QueueList(args *dsync.QueueArgs, reply *dsync.QueueReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	l.queueMutex.Lock()
+	defer l.queueMutex.Unlock()
+	now := time.Now()
+	if _, ok := l.queues[args.Queue]; ok {
+		l.touchQueue(args.Queue)
+	}
+	for id, job := range l.queues[args.Queue] {
+		if job.isVisible(now) {
+			reply.IDs = append(reply.IDs, id)
+		}
+	}
+	sort.Slice(reply.IDs, func(i, j int) bool { return reply.IDs[i] < reply.IDs[j] })
+	reply.Granted = true
+	return nil
+}
+
+// QueueClaim - rpc handler for claiming a job of a queue, hiding it from other claimers
+// for the visibility timeout. A zero visibility timeout releases the claim.
+func (l *LockServer) QueueClaim(args *dsync.QueueArgs, reply *dsync.QueueReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	l.queueMutex.Lock()
+	defer l.queueMutex.Unlock()
+	job, ok := l.queues[args.Queue][args.ID]
+	if !ok {
+		return nil
+	}
+	l.touchQueue(args.Queue)
+	switch {
+	case args.Visibility <= 0:
+		if job.claimer == args.UID {
+			job.claimer, job.invisibleUntil = "", time.Time{}
+			reply.Granted = true
+		}
+	case job.claimer == args.UID || job.isVisible(time.Now()):
+		job.claimer, job.invisibleUntil = args.UID, time.Now().Add(args.Visibility)
+		reply.Granted, reply.Payload = true, job.payload
+	}
+	return nil
+}
+
+// QueueAck - rpc handler for acknowledging a job, removing it from its queue. Only the
+// current claimer can acknowledge a job.
+func (l *LockServer) QueueAck(args *dsync.QueueArgs, reply *dsync.QueueReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	l.queueMutex.Lock()
+	defer l.queueMutex.Unlock()
+	q := l.queues[args.Queue]
+	if job, ok := q[args.ID]; ok && job.claimer == args.UID {
+		delete(q, args.ID)
+		reply.Granted = true
+		if len(q) == 0 {
+			delete(l.queues, args.Queue)
+			delete(l.queueActivity, args.Queue)
+		} else {
+			l.touchQueue(args.Queue)
+		}
+	}
+	return nil
+}
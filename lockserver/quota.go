@@ -0,0 +1,97 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import "strings"
+
+// quotaPrefixes returns the namespace prefixes with a quota that name falls under.
+func (l *LockServer) quotaPrefixes(name string) (prefixes []string) {
+	for p := range l.opts.Quotas {
+		if strings.HasPrefix(name, p) {
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes
+}
+
+// initQuotas counts the locks already held in the store per namespace with a quota.
+func (l *LockServer) initQuotas() error {
+	l.quotaCounts = make(map[string]int)
+	if len(l.opts.Quotas) == 0 {
+		return nil
+	}
+	return l.store.Scan("", func(name string, holders []Holder, version uint64) bool {
+		for _, p := range l.quotaPrefixes(name) {
+			l.quotaCounts[p] += len(holders)
+		}
+		return true
+	})
+}
+
+// reserveQuota reserves room for another lock on name in the quotas of all namespaces
+// name falls under, returning false (without reserving anything) when any of them is
+// exhausted.
+func (l *LockServer) reserveQuota(name string) bool {
+	if len(l.opts.Quotas) == 0 {
+		return true
+	}
+	prefixes := l.quotaPrefixes(name)
+
+	l.quotaMutex.Lock()
+	defer l.quotaMutex.Unlock()
+	for _, p := range prefixes {
+		if l.quotaCounts[p] >= l.opts.Quotas[p] {
+			return false
+		}
+	}
+	for _, p := range prefixes {
+		l.quotaCounts[p]++
+	}
+	return true
+}
+
+// chargeQuota counts n more locks on name against the quotas of all namespaces name falls
+// under, irrespective of whether they are exhausted (as the locks were granted elsewhere).
+func (l *LockServer) chargeQuota(name string, n int) {
+	if len(l.opts.Quotas) == 0 || n == 0 {
+		return
+	}
+	prefixes := l.quotaPrefixes(name)
+
+	l.quotaMutex.Lock()
+	defer l.quotaMutex.Unlock()
+	for _, p := range prefixes {
+		l.quotaCounts[p] += n
+	}
+}
+
+// releaseQuota returns the room of n locks on name to the quotas of all namespaces
+// name falls under.
+func (l *LockServer) releaseQuota(name string, n int) {
+	if len(l.opts.Quotas) == 0 {
+		return
+	}
+	prefixes := l.quotaPrefixes(name)
+
+	l.quotaMutex.Lock()
+	defer l.quotaMutex.Unlock()
+	for _, p := range prefixes {
+		if l.quotaCounts[p] -= n; l.quotaCounts[p] <= 0 {
+			delete(l.quotaCounts, p)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// NodeDown reports that the client node (its network address) is gone, eg. when a
+// membership or health checking layer declares it dead. Unless NodeUp is called for the
+// node within the ReclaimDelay, all locks held by client instances on the node are then
+// released, recording each release in the audit log. Does nothing when reclamation
+// is disabled.
+func (l *LockServer) NodeDown(node string) {
+	if l.opts.ReclaimDelay == 0 {
+		return
+	}
+
+	l.reclaimMutex.Lock()
+	defer l.reclaimMutex.Unlock()
+	if _, ok := l.reclaims[node]; ok {
+		return // Already pending
+	}
+	l.log(dsync.LevelInfo, "Node reported down, reclaiming its locks", dsync.Fields{"node": node, "delay": l.opts.ReclaimDelay})
+	var t *time.Timer
+	t = time.AfterFunc(l.opts.ReclaimDelay, func() {
+		l.reclaimMutex.Lock()
+		canceled := l.reclaims[node] != t // NodeUp was called while firing
+		if !canceled {
+			delete(l.reclaims, node)
+		}
+		l.reclaimMutex.Unlock()
+		if !canceled {
+			l.reclaim(node)
+		}
+	})
+	l.reclaims[node] = t
+}
+
+// NodeUp cancels a pending reclamation of the locks of the client node, eg. when the
+// node turns out to be alive after all.
+func (l *LockServer) NodeUp(node string) {
+	l.reclaimMutex.Lock()
+	defer l.reclaimMutex.Unlock()
+	if t, ok := l.reclaims[node]; ok {
+		t.Stop()
+		delete(l.reclaims, node)
+		l.log(dsync.LevelInfo, "Node reported up, not reclaiming its locks", dsync.Fields{"node": node})
+	}
+}
+
+// NodeMoved reports that the client node moved from address oldNode to newNode, eg. when
+// the membership layer announces that it was rescheduled with a new IP (see
+// dsync.Dsync.ReplaceNode). The locks held by client instances on the node are kept, but
+// recorded at the new address so that lock maintenance, revocations and invalidations
+// reach their holders. A pending reclamation of the locks of the node is canceled.
+func (l *LockServer) NodeMoved(oldNode, newNode string) {
+	l.NodeUp(oldNode)
+
+	var names []string
+	err := l.store.Scan("", func(name string, holders []Holder, version uint64) bool {
+		for _, holder := range holders {
+			if holder.Node == oldNode {
+				names = append(names, name)
+				break
+			}
+		}
+		return true
+	})
+	if err != nil {
+		l.log(dsync.LevelError, "Failed to move locks", dsync.Fields{"error": err})
+		return
+	}
+
+	for _, name := range names {
+		err = l.update(name, func(holders []Holder) ([]Holder, bool, error) {
+			moved := false
+			for i := range holders {
+				if holders[i].Node == oldNode {
+					holders[i].Node, moved = newNode, true
+				}
+			}
+			return holders, moved, nil
+		})
+		if err != nil {
+			l.log(dsync.LevelError, "Failed to move lock", dsync.Fields{"name": name, "error": err})
+		}
+	}
+	l.log(dsync.LevelInfo, "Node moved, moved its locks", dsync.Fields{"from": oldNode, "to": newNode, "names": len(names)})
+}
+
+// Adopt - rpc handler for taking over read locks held at other nodes, eg. when a node joins
+// or leaves the cluster (see dsync.Dsync.AddNode and dsync.Dsync.RemoveNode), returning the locks adopted.
+// Read locks are adopted unless the name is write locked or the lock is held already. As
+// their holders do not release adopted locks here, these are kept until lock maintenance
+// finds that their holder no longer holds them. Locks received corrupt are refused with
+// dsync.ErrChecksum, for the client to send them again.
+func (l *LockServer) Adopt(args *dsync.AdoptArgs, reply *dsync.SnapshotReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	if args.Checksum != 0 && args.Checksum != dsync.ChecksumEntries(args.Entries) {
+		return dsync.ErrChecksum
+	}
+	byName := make(map[string][]dsync.LockEntry)
+	for _, e := range args.Entries {
+		if !e.Writer {
+			byName[e.Name] = append(byName[e.Name], e)
+		}
+	}
+
+	for name, entries := range byName {
+		var adopted []dsync.LockEntry
+		err := l.update(name, func(holders []Holder) ([]Holder, bool, error) {
+			adopted = nil // Start over when retried
+			if isWriteLock(holders) {
+				return holders, false, nil
+			}
+			now := time.Now().UTC()
+			for _, e := range entries {
+				if hasHolder(holders, e.UID) {
+					continue
+				}
+				holders = append(holders, Holder{Node: e.Node, RPCPath: e.RPCPath, UID: e.UID, Owner: e.Owner, Source: e.Source, Tags: e.Tags,
+					Timestamp: now, TimeLastCheck: now})
+				adopted = append(adopted, newLockEntry(name, holders[len(holders)-1]))
+			}
+			return holders, len(adopted) > 0, nil
+		})
+		if err != nil {
+			return err
+		}
+		l.chargeQuota(name, len(adopted))
+		reply.Entries = append(reply.Entries, adopted...)
+	}
+	if len(reply.Entries) > 0 {
+		l.log(dsync.LevelInfo, "Adopted read locks held at other nodes", dsync.Fields{"locks": len(reply.Entries)})
+	}
+	return nil
+}
+
+// hasHolder returns true when one of the holders has the uid.
+func hasHolder(holders []Holder, uid string) bool {
+	for _, holder := range holders {
+		if holder.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// stopReclaims cancels all pending reclamations.
+func (l *LockServer) stopReclaims() {
+	l.reclaimMutex.Lock()
+	defer l.reclaimMutex.Unlock()
+	for node, t := range l.reclaims {
+		t.Stop()
+		delete(l.reclaims, node)
+	}
+}
+
+// reclaim releases all locks held by client instances on node.
+func (l *LockServer) reclaim(node string) {
+	var names []string
+	err := l.store.Scan("", func(name string, holders []Holder, version uint64) bool {
+		for _, holder := range holders {
+			if holder.Node == node {
+				names = append(names, name)
+				break
+			}
+		}
+		return true
+	})
+	if err != nil {
+		l.log(dsync.LevelError, "Failed to reclaim locks", dsync.Fields{"error": err})
+		return
+	}
+
+	for _, name := range names {
+		record := AuditRecord{
+			Operation: "reclaim",
+			Name:      name,
+			Operator:  "membership",
+			Reason:    fmt.Sprintf("node %s declared dead", node),
+		}
+		err = l.update(name, func(holders []Holder) ([]Holder, bool, error) {
+			record.Removed = nil // Start over when retried
+			var kept []Holder
+			for _, holder := range holders {
+				if holder.Node == node {
+					record.Removed = append(record.Removed, newLockEntry(name, holder))
+				} else {
+					kept = append(kept, holder)
+				}
+			}
+			return kept, len(record.Removed) > 0, nil
+		})
+		if err != nil {
+			l.log(dsync.LevelError, "Failed to reclaim lock", dsync.Fields{"name": name, "error": err})
+			continue
+		}
+		if len(record.Removed) > 0 {
+			record.Time = time.Now().UTC()
+			l.audit(record)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"fmt"
+
+	"github.com/minio/dsync"
+)
+
+// loadSequences loads the high-water marks of the sequences from the sequence file (if any).
+func (l *LockServer) loadSequences() error {
+	l.sequences = make(map[string]uint64)
+	if l.opts.SequenceFile == "" {
+		return nil
+	}
+	_, err := l.loadState(l.opts.SequenceFile, sequenceSchema, &l.sequences)
+	return err
+}
+
+// saveSequences atomically replaces the sequence file (if any) with the high-water
+// marks of all sequences, the caller must hold sequenceMutex.
+func (l *LockServer) saveSequences() error {
+	if l.opts.SequenceFile == "" {
+		return nil
+	}
+	return saveState(l.opts.SequenceFile, sequenceSchema, l.sequences)
+}
+
+// Sequence - rpc handler for proposing the next value of a sequence (see dsync.Dsync.NextSequence).
+// The value is accepted when it is above the high-water mark of the sequence, which is
+// then raised to the value and persisted in the sequence file before replying.
+func (l *LockServer) Sequence(args *dsync.SequenceArgs, reply *dsync.SequenceReply) error {
+	if err := l.authenticate(args.Token); err != nil {
+		return err
+	}
+	l.sequenceMutex.Lock()
+	defer l.sequenceMutex.Unlock()
+
+	highWater := l.sequences[args.Name]
+	if args.Value > highWater {
+		l.sequences[args.Name] = args.Value
+		if err := l.saveSequences(); err != nil {
+			// Revert, so that the high-water marks match the sequence file
+			l.sequences[args.Name] = highWater
+			return fmt.Errorf("Unable to persist sequence: %v", err)
+		}
+		reply.Accepted = true
+	}
+	reply.HighWater = l.sequences[args.Name]
+	return nil
+}
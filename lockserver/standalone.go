@@ -0,0 +1,58 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"fmt"
+
+	"github.com/minio/dsync"
+)
+
+// Standalone returns a cluster of n lock servers that all run in this process and
+// are called directly instead of over the network, eg. to develop an application
+// without setting up a cluster. Dsync still goes through the same code paths (quorum,
+// retries, maintenance), so switching to distributed mode only takes initializing dsync
+// with network clients instead.
+//
+// All lock servers are created with opts, NewClient defaults to the in-process clients
+// and Client to the cluster returned.
+func Standalone(n int, opts Options) (*dsync.Dsync, error) {
+
+	clnts := make([]dsync.RPC, n)
+	if opts.NewClient == nil {
+		// All locks are held by this process, so any of the servers can answer on its behalf
+		opts.NewClient = func(node, rpcPath string) dsync.RPC {
+			return clnts[0]
+		}
+	}
+	servers := make([]*LockServer, n)
+	for i := range clnts {
+		servers[i] = New(opts)
+		clnts[i] = dsync.NewLocalClient(fmt.Sprintf("local-%d", i), servers[i])
+	}
+
+	ds, err := dsync.New(clnts, 0)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Client == nil {
+		for _, l := range servers {
+			l.opts.Client = ds
+		}
+	}
+	return ds, nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+
+	"github.com/minio/dsync"
+)
+
+// stateFile - state persisted by a lock server (eg. the frozen names), stored as JSON along
+// with the version of its schema, so that files written by older lock servers are migrated
+// when loaded instead of having to be wiped on upgrade, and the checksum of the data, so
+// that a lock server refuses to start with a corrupt file rather than act on it.
+type stateFile struct {
+	Version  int             `json:"version"`
+	Data     json.RawMessage `json:"data"`
+	Checksum uint32          `json:"checksum,omitempty"` // CRC-32C of data, zero for files written before checksums
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// migration - forward migration of the data of a state file from one schema version to the next.
+type migration func(data json.RawMessage) (json.RawMessage, error)
+
+// stateSchema - schema of a kind of state file. The migration at index i migrates the data
+// from version i to i+1, so the current version is the number of migrations. Version 0 is
+// the bare data as written before state files were versioned.
+//
+// Changing the format of the data therefore takes appending a migration from the previous
+// format, never changing the existing ones.
+type stateSchema struct {
+	name       string
+	migrations []migration
+}
+
+// version returns the current version of the schema.
+func (s stateSchema) version() int {
+	return len(s.migrations)
+}
+
+// unversioned migrates bare data to the first versioned schema, which stores it unchanged.
+func unversioned(data json.RawMessage) (json.RawMessage, error) {
+	return data, nil
+}
+
+var (
+	freezeSchema   = stateSchema{name: "freeze file", migrations: []migration{unversioned}}
+	sequenceSchema = stateSchema{name: "sequence file", migrations: []migration{unversioned}}
+)
+
+// decodeState returns the version of the schema and the data of a state file.
+func decodeState(b []byte) (int, json.RawMessage, error) {
+	var f stateFile
+	if err := json.Unmarshal(b, &f); err == nil && f.Version > 0 {
+		// Unversioned data is never an object holding an object or array as "data"
+		if data := bytes.TrimSpace(f.Data); len(data) > 0 && (data[0] == '{' || data[0] == '[') {
+			// Checksummed as written, ie. compacted
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, f.Data); err != nil {
+				return 0, nil, err
+			}
+			if f.Checksum != 0 && f.Checksum != crc32.Checksum(compact.Bytes(), castagnoli) {
+				return 0, nil, dsync.ErrChecksum
+			}
+			return f.Version, f.Data, nil
+		}
+	}
+	if !json.Valid(b) {
+		return 0, nil, errors.New("invalid JSON")
+	}
+	return 0, b, nil
+}
+
+// loadState reads the state file at path into v, migrating data written with an older
+// version of schema (the file is then rewritten with the current version). Returns false
+// when the file does not exist. Files written with a newer version than known are
+// refused, so that a downgraded lock server does not misinterpret them.
+func (l *LockServer) loadState(path string, schema stateSchema, v interface{}) (bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	version, data, err := decodeState(b)
+	if err != nil {
+		return false, fmt.Errorf("%s %s: %v", schema.name, path, err)
+	}
+	if version > schema.version() {
+		return false, fmt.Errorf("%s %s has schema version %d, only up to %d is supported", schema.name, path, version, schema.version())
+	}
+	for i := version; i < schema.version(); i++ {
+		if data, err = schema.migrations[i](data); err != nil {
+			return false, fmt.Errorf("%s %s: migration from schema version %d failed: %v", schema.name, path, i, err)
+		}
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("%s %s: %v", schema.name, path, err)
+	}
+	if version < schema.version() {
+		if err = saveState(path, schema, v); err != nil {
+			return false, err
+		}
+		l.log(dsync.LevelInfo, "Migrated to the current schema version", dsync.Fields{"schema": schema.name, "path": path, "from": version, "to": schema.version()})
+	}
+	return true, nil
+}
+
+// saveState atomically replaces the state file at path with v, stored with the current
+// version of schema.
+func saveState(path string, schema stateSchema, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(&stateFile{Version: schema.version(), Data: data, Checksum: crc32.Checksum(data, castagnoli)})
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
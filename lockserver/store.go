@@ -0,0 +1,229 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lockserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Holder - single holder of a lock.
+type Holder struct {
+	Writer        bool              // Bool whether write or read lock
+	Node          string            // Network address of client claiming lock
+	RPCPath       string            // RPC path of client claiming lock
+	UID           string            // Uid to uniquely identify request of client
+	Owner         string            // Uid of the DRWMutex of the client holding the lock, empty for older clients
+	Source        string            // File:line of the caller that requested the lock, empty for older clients
+	Tags          map[string]string // Tags of the request (see dsync.TagsKey)
+	Timestamp     time.Time         // Timestamp set at the time of initialization
+	TimeLastCheck time.Time         // Timestamp for last check of validity of lock
+	Expires       time.Time         // Expiry of the lease of the lock, zero when the lock does not expire
+}
+
+// LockStore - storage of the holders of all locks of a lock server.
+//
+// Every update is a compare-and-swap on the version of the entry of a name, so that
+// concurrent requests for the same name cannot overwrite each other. Versions are
+// assigned by the store and are never 0 for an existing entry.
+type LockStore interface {
+	// Get returns the holders of the lock on name and the version of the entry,
+	// or no holders and version 0 when name is not locked.
+	Get(name string) (holders []Holder, version uint64, err error)
+
+	// Set stores the holders of the lock on name, provided that the entry is still at
+	// the given version (0 when name must not be locked). Returns false otherwise.
+	Set(name string, holders []Holder, version uint64) (bool, error)
+
+	// Delete removes the entry of name, provided that it is still at the given version.
+	// Returns false otherwise.
+	Delete(name string, version uint64) (bool, error)
+
+	// Scan calls fn for all locked names starting with prefix, in order of name,
+	// until fn returns false.
+	Scan(prefix string, fn func(name string, holders []Holder, version uint64) bool) error
+}
+
+type memoryEntry struct {
+	holders []Holder
+	version uint64
+}
+
+// MemoryStore - LockStore that keeps all locks in memory (and loses them on restart).
+type MemoryStore struct {
+	mutex   sync.Mutex
+	entries map[string]memoryEntry // Entries by name, or by hashed key for long names
+	version uint64                 // Last version handed out
+
+	threshold int        // Length beyond which names are hashed, zero when names are kept as is
+	names     *nameCache // Recently stored hashed names, nil when names are kept as is
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// NewCompactMemoryStore returns an empty MemoryStore that keeps names longer than
+// threshold (eg. 64) as a hash of 17 bytes, so that millions of locks on long object
+// paths do not take up memory mostly for their names.
+//
+// Only the maxNames most recently stored of those names are remembered for introspection.
+// Scan returns the other ones as "#" followed by the hash in hex, which is accepted by
+// all methods of the store in place of the name. Since such names are passed on to the
+// lock servers of the clients during lock maintenance, all lock servers of a cluster must
+// use a compact store. Scans by prefix miss the names that are no longer remembered.
+func NewCompactMemoryStore(threshold, maxNames int) *MemoryStore {
+	m := NewMemoryStore()
+	m.threshold, m.names = threshold, newNameCache(maxNames)
+	return m
+}
+
+const (
+	hashedKeyPrefix = "\x00"          // Prefix of hashed keys, which no name that is kept as is starts with
+	hashSize        = sha256.Size / 2 // Size of the hash of a name in a hashed key
+)
+
+// hashedName returns the hashed key for a name returned by Scan in place of a name
+// that is no longer remembered.
+func hashedName(name string) (string, bool) {
+	if !strings.HasPrefix(name, "#") || len(name) != 1+2*hashSize {
+		return "", false
+	}
+	sum, err := hex.DecodeString(name[1:])
+	if err != nil {
+		return "", false
+	}
+	return hashedKeyPrefix + string(sum), true
+}
+
+// key returns the key of the entry of name.
+func (m *MemoryStore) key(name string) string {
+	if m.threshold == 0 {
+		return name
+	}
+	if key, ok := hashedName(name); ok {
+		return key
+	}
+	if len(name) <= m.threshold && !strings.HasPrefix(name, hashedKeyPrefix) {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return hashedKeyPrefix + string(sum[:hashSize])
+}
+
+// name returns the name of the entry with key, the caller must hold mutex.
+func (m *MemoryStore) name(key string) string {
+	if !strings.HasPrefix(key, hashedKeyPrefix) || m.names == nil {
+		return key
+	}
+	if name, ok := m.names.names[key]; ok {
+		return name
+	}
+	return "#" + hex.EncodeToString([]byte(key[len(hashedKeyPrefix):]))
+}
+
+// Get implements LockStore.
+func (m *MemoryStore) Get(name string) ([]Holder, uint64, error) {
+	key := m.key(name)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	e := m.entries[key]
+	return append([]Holder(nil), e.holders...), e.version, nil
+}
+
+// Set implements LockStore.
+func (m *MemoryStore) Set(name string, holders []Holder, version uint64) (bool, error) {
+	key := m.key(name)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.entries[key].version != version {
+		return false, nil
+	}
+	m.version++
+	m.entries[key] = memoryEntry{holders: append([]Holder(nil), holders...), version: m.version}
+	if _, ok := hashedName(name); key != name && !ok {
+		m.names.add(key, name)
+	}
+	return true, nil
+}
+
+// Delete implements LockStore.
+func (m *MemoryStore) Delete(name string, version uint64) (bool, error) {
+	key := m.key(name)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if e, ok := m.entries[key]; !ok || e.version != version {
+		return false, nil
+	}
+	delete(m.entries, key)
+	return true, nil
+}
+
+// Scan implements LockStore. The entries are copied up front, so fn is free to
+// update the store.
+func (m *MemoryStore) Scan(prefix string, fn func(name string, holders []Holder, version uint64) bool) error {
+	m.mutex.Lock()
+	names := make([]string, 0, len(m.entries))
+	keys := make(map[string]string, len(m.entries)) // Keys by name
+	for key := range m.entries {
+		if name := m.name(key); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+			keys[name] = key
+		}
+	}
+	sort.Strings(names)
+	entries := make([]memoryEntry, len(names))
+	for i, name := range names {
+		e := m.entries[keys[name]]
+		entries[i] = memoryEntry{holders: append([]Holder(nil), e.holders...), version: e.version}
+	}
+	m.mutex.Unlock()
+
+	for i, name := range names {
+		if !fn(name, entries[i].holders, entries[i].version) {
+			break
+		}
+	}
+	return nil
+}
+
+// nameCache - bounded map of hashed keys to their names, evicting the oldest first.
+type nameCache struct {
+	names map[string]string // Names by hashed key
+	keys  []string          // Ring buffer of the hashed keys in order of insertion
+	next  int               // Position in keys of the next insertion
+}
+
+func newNameCache(size int) *nameCache {
+	return &nameCache{names: make(map[string]string), keys: make([]string, size)}
+}
+
+// add remembers name for key, forgetting the oldest name when full.
+func (c *nameCache) add(key, name string) {
+	if _, ok := c.names[key]; ok || len(c.keys) == 0 {
+		return
+	}
+	delete(c.names, c.keys[c.next])
+	c.keys[c.next] = key
+	c.next = (c.next + 1) % len(c.keys)
+	c.names[key] = name
+}
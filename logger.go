@@ -0,0 +1,121 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Level - severity of a log message, see Logger.
+type Level int
+
+const (
+	LevelDebug Level = iota // Failed RPCs, eg. to a node that is down
+	LevelInfo               // Failed rounds of lock acquisitions, changes of the lock servers
+	LevelWarn               // Releases given up on, failovers
+	LevelError              // Protocol violations and failures of the lock servers
+)
+
+// String returns the name of the level, eg. "warn".
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Fields - fields of a log message, eg. "name" (of the lock), "node" or "error".
+type Fields map[string]interface{}
+
+// String formats the fields as key=value pairs sorted by key.
+func (f Fields) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// Logger - receives the diagnostics of dsync and of the lock servers of the lockserver
+// package, eg. to route them into a structured logging pipeline, see Dsync.SetLogger.
+type Logger interface {
+	Log(level Level, msg string, fields Fields)
+}
+
+// LoggerFunc - adapter to use an ordinary function as Logger.
+type LoggerFunc func(level Level, msg string, fields Fields)
+
+// Log calls f(level, msg, fields).
+func (f LoggerFunc) Log(level Level, msg string, fields Fields) {
+	f(level, msg, fields)
+}
+
+type logger struct{ l Logger }
+
+// SetLogger sets the logger that receives all diagnostics of ds: failed RPCs, failed
+// rounds of lock acquisitions, releases given up on, protocol violations and the messages
+// of the lock servers having ds as their client (see Options.Client of package lockserver).
+// The logger decides what to keep by the level, as all messages are passed on regardless
+// of DSYNC_LOG and DSYNC_LOG_DENIED. Passing nil restores the default of logging with the
+// log package. The logger can also be set when initializing ds, see Options.
+func (ds *Dsync) SetLogger(l Logger) {
+	ds.loggerValue.Store(logger{l})
+}
+
+// Log logs msg at level with fields to the logger of ds (see SetLogger) or, by default,
+// with the log package. Used by the lockserver package.
+func (ds *Dsync) Log(level Level, msg string, fields Fields) {
+	ds.logMessage(true, level, msg, fields)
+}
+
+// Log logs msg at level with fields with the log package, for diagnostics that do not
+// belong to a Dsync. Used by the lockserver package.
+func Log(level Level, msg string, fields Fields) {
+	logMessage(nil, true, level, msg, fields)
+}
+
+// logMessage logs msg like Log, by default only when enabled (eg. by DSYNC_LOG).
+func (ds *Dsync) logMessage(enabled bool, level Level, msg string, fields Fields) {
+	v, _ := ds.loggerValue.Load().(logger)
+	logMessage(v.l, enabled, level, msg, fields)
+}
+
+// logMessage logs msg to l or, when nil, with the log package when enabled.
+func logMessage(l Logger, enabled bool, level Level, msg string, fields Fields) {
+	if l != nil {
+		l.Log(level, msg, fields)
+		return
+	}
+	if !enabled {
+		return
+	}
+	if len(fields) > 0 {
+		msg += " " + fields.String()
+	}
+	log.Println(msg)
+}
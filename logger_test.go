@@ -0,0 +1,87 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+)
+
+func TestLogger(t *testing.T) {
+
+	type message struct {
+		level  Level
+		msg    string
+		fields Fields
+	}
+	var mutex sync.Mutex
+	var messages []message
+	ds.SetLogger(LoggerFunc(func(level Level, msg string, fields Fields) {
+		if fields["name"] == "test-logger" || fields["prefix"] == "test-logger" {
+			mutex.Lock()
+			messages = append(messages, message{level, msg, fields})
+			mutex.Unlock()
+		}
+	}))
+	defer ds.SetLogger(nil)
+
+	// Failed acquisitions are logged regardless of DSYNC_LOG_DENIED
+	dm := NewDRWMutex("test-logger", ds)
+	dm.Lock()
+	if NewDRWMutex("test-logger", ds).TryLock() {
+		t.Fatal("expected lock to be denied")
+	}
+	dm.Unlock()
+	mutex.Lock()
+	if len(messages) != 1 || messages[0].level != LevelInfo || messages[0].fields["error"] == nil {
+		t.Fatalf("expected failed acquisition to be logged, got %+v", messages)
+	}
+	messages = nil
+	mutex.Unlock()
+
+	// So are the messages of the lock servers having ds as their client
+	l := lockserver.New(lockserver.Options{Client: ds})
+	defer l.Close()
+	var resp LockResp
+	if err := l.Lock(&LockArgs{Name: "test-logger/a", UID: "1"}, &resp); err != nil || !resp.Granted {
+		t.Fatalf("expected write lock to be granted, got %v (%v)", resp.Granted, err)
+	}
+	var reply SnapshotReply
+	if err := l.ExpirePrefix(&ExpirePrefixArgs{Prefix: "test-logger"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(messages) != 1 || messages[0].msg != "Expired locks for prefix" || messages[0].fields["locks"] != 1 {
+		t.Fatalf("expected expiry to be logged, got %+v", messages)
+	}
+}
+
+func TestLevelString(t *testing.T) {
+
+	for level, expected := range map[Level]string{LevelDebug: "debug", LevelInfo: "info", LevelWarn: "warn", LevelError: "error", Level(7): "level(7)"} {
+		if s := level.String(); s != expected {
+			t.Errorf("expected %q, got %q", expected, s)
+		}
+	}
+	if s := (Fields{"node": "n1", "error": "failed"}).String(); s != "error=failed node=n1" {
+		t.Errorf("expected fields sorted by key, got %q", s)
+	}
+}
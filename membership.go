@@ -0,0 +1,326 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// members - the nodes participating in the distributed locking. It is replaced as a whole
+// when the membership changes (see AddNode and RemoveNode), so that every lock round works
+// with a consistent set of nodes and quorum. Nodes keep their index for as long as they are
+// members, and the index of a removed node is not reused: the locks granted are recorded by
+// the index of the node that granted them.
+type members struct {
+	clnts       []*nodeClient // One per index, nil for the nodes removed
+	ids         []string      // Identity of every node on the hash ring, see SetReplication
+	ownNode     int           // Index of the node running on localhost
+	count       int           // Number of nodes, not counting the nodes removed
+	quorum      int           // Simple majority based quorum, count/2+1
+	quorumReads int           // Quorum for read operations, count/2 rounded up
+	ring        *ring         // Hash ring placing the locks on the nodes
+	prev        *members      // Nodes before the change in progress, nil when there is none
+}
+
+// membership returns the current members.
+func (ds *Dsync) membership() *members {
+	return ds.membersValue.Load().(*members)
+}
+
+// newMembers returns the members with the clients and ring identities given by index.
+func newMembers(clnts []*nodeClient, ids []string, ownNode int) *members {
+	m := &members{clnts: clnts, ids: ids, ownNode: ownNode}
+	for _, c := range clnts {
+		if c != nil {
+			m.count++
+		}
+	}
+	m.quorum = m.count/2 + 1
+	m.quorumReads = (m.count + 1) / 2 // Rounded up, so that it overlaps with every write quorum
+	m.ring = newRing(ids)
+	return m
+}
+
+// nodes returns the indices of the nodes, in order.
+func (m *members) nodes() []int {
+	nodes := make([]int, 0, m.count)
+	for index, c := range m.clnts {
+		if c != nil {
+			nodes = append(nodes, index)
+		}
+	}
+	return nodes
+}
+
+// client returns the client of the node at index, which includes the nodes that are being
+// removed (but still take part in the locking), or nil when there is no such node.
+func (m *members) client(index int) *nodeClient {
+	if index >= 0 && index < len(m.clnts) && m.clnts[index] != nil {
+		return m.clnts[index]
+	}
+	if m.prev != nil {
+		return m.prev.client(index)
+	}
+	return nil
+}
+
+// node returns the network address of the node at index, empty when there is no such node.
+func (m *members) node(index int) string {
+	if c := m.client(index); c != nil {
+		return c.Node()
+	}
+	return ""
+}
+
+// ringID returns the identity of the node of c on the hash ring, its address at the time
+// it became a member so that moving it later on (see ReplaceNode) does not move its locks.
+func ringID(c RPC) string {
+	return c.Node() + c.RPCPath()
+}
+
+// Returned for requests to a node that is no longer a member.
+var errNodeRemoved = errors.New("Node has been removed")
+
+// Time given to the lock rounds in progress to finish (or release the locks they were
+// granted), comfortably longer than a lock round.
+const reconcileInterval = 100 * time.Millisecond
+
+// AdoptArgs - arguments for the Adopt RPC.
+type AdoptArgs struct {
+	AuthArgs
+	Entries  []LockEntry `json:"entries"`            // Read locks held at other nodes
+	Checksum uint32      `json:"checksum,omitempty"` // Checksum of the entries (see ChecksumEntries), zero when not computed
+}
+
+// AddNode adds a node to the nodes at runtime, eg. to grow the cluster, returning the
+// index of the new node. All processes sharing the locks have to add the same node within
+// the settle period: during that period a lock is only granted with the quorum of the nodes
+// before the change as well as with the quorum of the nodes after the change, so that lock
+// rounds of processes that did not learn about the new node yet keep excluding each other.
+//
+// The read locks held when the settle period ends are then copied to the new node (see
+// Adopt of package lockserver) as reads need less than a majority of the nodes, after which
+// only the quorum of the new set of nodes is required. Locks held remain valid throughout.
+// Nodes are added one at a time, and dsync remains designed for up to 16 nodes (while an
+// uneven number of nodes is fine once initialized). When the read locks cannot be copied
+// the change is undone and an error is returned, in which case it has to be undone (or
+// retried) by the other processes as well.
+func (ds *Dsync) AddNode(c RPC, settle time.Duration) (int, error) {
+	ds.membershipMutex.Lock()
+	defer ds.membershipMutex.Unlock()
+
+	m := ds.membership()
+	switch {
+	case ds.singleNode:
+		return -1, &ConfigError{"Cannot add nodes in single-node mode"}
+	case m.count >= 16:
+		return -1, &ConfigError{"Dsync not designed for more than 16 nodes"}
+	}
+
+	index := len(m.clnts)
+	clnts := append(append([]*nodeClient(nil), m.clnts...), newNodeClient(ds, c))
+	ids := append(append([]string(nil), m.ids...), ringID(c))
+	next := newMembers(clnts, ids, m.ownNode)
+	if err := ds.changeMembers(m, next, settle, []int{index}, 1); err != nil {
+		return -1, err
+	}
+	return index, nil
+}
+
+// RemoveNode removes the node at index from the nodes at runtime, eg. to drain it before
+// it is decommissioned. Like AddNode, all processes sharing the locks have to remove the
+// same node within the settle period, after which the read locks held are copied to the
+// remaining nodes (to the extent that the node removed no longer counts towards the quorum
+// for writes) and the node is closed. The node of this process cannot be removed.
+func (ds *Dsync) RemoveNode(index int, settle time.Duration) error {
+	ds.membershipMutex.Lock()
+	defer ds.membershipMutex.Unlock()
+
+	m := ds.membership()
+	switch {
+	case ds.singleNode:
+		return &ConfigError{"Cannot remove nodes in single-node mode"}
+	case index < 0 || index >= len(m.clnts) || m.clnts[index] == nil:
+		return &ConfigError{"Index of node is out of range"}
+	case index == m.ownNode:
+		return &ConfigError{"Cannot remove own node"}
+	case m.count <= 4:
+		return &ConfigError{"Dsync not designed for less than 4 nodes"}
+	}
+
+	clnts := append([]*nodeClient(nil), m.clnts...)
+	ids := append([]string(nil), m.ids...)
+	clnts[index], ids[index] = nil, ""
+	next := newMembers(clnts, ids, m.ownNode)
+	if err := ds.changeMembers(m, next, settle, next.nodes(), next.quorumReads); err != nil {
+		return err
+	}
+	m.clnts[index].Close()
+	return nil
+}
+
+// changeMembers changes the members from m to next (with a single node added or removed):
+// during settle both quorums are required, after which the read locks held are copied
+// to the nodes given (at least need of them) and next takes effect by itself.
+func (ds *Dsync) changeMembers(m, next *members, settle time.Duration, nodes []int, need int) error {
+	joint := *next
+	joint.prev = m
+	ds.membersValue.Store(&joint)
+
+	<-ds.clock().After(settle)
+	entries, err := ds.heldReadLocks(m)
+	if err == nil {
+		err = ds.adopt(nodes, need, entries)
+	}
+	if err != nil {
+		ds.membersValue.Store(m)
+		return err
+	}
+	ds.membersValue.Store(next)
+	return nil
+}
+
+// heldReadLocks returns the read locks held at the nodes of m, ie. present in two
+// snapshots taken reconcileInterval apart (leaving out the grants of rounds that fail).
+// The snapshots have to reach a quorum of the nodes, so that every read lock is found.
+func (ds *Dsync) heldReadLocks(m *members) ([]LockEntry, error) {
+	first, err := ds.readLocks(m)
+	if err != nil {
+		return nil, err
+	}
+	<-ds.clock().After(reconcileInterval)
+	second, err := ds.readLocks(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var held []LockEntry
+	for k, e := range second {
+		if _, ok := first[k]; ok {
+			held = append(held, e)
+		}
+	}
+	return held, nil
+}
+
+// readLockKey - key of a read lock, identifying the grant irrespective of its time (and
+// tags, which are not comparable).
+type readLockKey struct {
+	name, node, rpcPath, uid, owner, source string
+	mode                                    LockMode
+}
+
+// readLocks returns the read locks held at the nodes of m.
+func (ds *Dsync) readLocks(m *members) (map[readLockKey]LockEntry, error) {
+	nodes := m.nodes()
+	snapshots := make([]NodeSnapshot, len(nodes))
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			snapshots[i].Entries, snapshots[i].Err = ds.snapshot(index)
+			ch <- i
+		}(i, index)
+	}
+	reached := 0
+	for range nodes {
+		if i := <-ch; snapshots[i].Err == nil {
+			reached++
+		}
+	}
+	if reached < m.quorum {
+		return nil, fmt.Errorf("Listing the read locks held reached only %d of %d nodes", reached, m.count)
+	}
+
+	entries := make(map[readLockKey]LockEntry)
+	for _, s := range snapshots {
+		for _, e := range s.Entries {
+			if !e.Writer {
+				e.Since = time.Time{} // Compare the grants only
+				entries[readLockKey{name: e.Name, node: e.Node, rpcPath: e.RPCPath, uid: e.UID,
+					owner: e.Owner, source: e.Source, mode: e.Mode}] = e
+			}
+		}
+	}
+	return entries, nil
+}
+
+// adopt copies the read locks to the nodes, at least need of which have to adopt them.
+func (ds *Dsync) adopt(nodes []int, need int, entries []LockEntry) error {
+	errs := make([]error, len(nodes))
+	checksum := ChecksumEntries(entries)
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			for attempt := 1; attempt <= snapshotRetries; attempt++ {
+				// Sent again when the lock server received them corrupt
+				var reply SnapshotReply
+				errs[i] = ds.call(index, "Dsync.Adopt", &AdoptArgs{Entries: entries, Checksum: checksum}, &reply)
+				if errs[i] == nil || errs[i].Error() != ErrChecksum.Error() {
+					break
+				}
+			}
+			ch <- i
+		}(i, index)
+	}
+	for range nodes {
+		<-ch
+	}
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", ds.membership().node(nodes[i]), err))
+		}
+	}
+	if len(nodes)-len(failed) < need {
+		return fmt.Errorf("Copying the read locks held reached less than %d nodes: %v", need, failed)
+	}
+	return nil
+}
+
+// placement - nodes a lock is requested from, and how many of them have to grant it.
+type placement struct {
+	nodes  []int
+	quorum int
+}
+
+// lockPlacements returns the placements of the lock on name: on the nodes of m and, during
+// a membership change, on the nodes before the change as well.
+func (ds *Dsync) lockPlacements(m *members, name string, isReadLock bool) []placement {
+	placements := []placement{{ds.lockNodes(m, name, isReadLock), ds.lockQuorum(m, isReadLock)}}
+	if m.prev != nil {
+		placements = append(placements, placement{ds.lockNodes(m.prev, name, isReadLock), ds.lockQuorum(m.prev, isReadLock)})
+	}
+	return placements
+}
+
+// placementNodes returns the indices of the nodes of all placements.
+func placementNodes(placements []placement) []int {
+	var nodes []int
+	for _, p := range placements {
+		for _, index := range p.nodes {
+			if !isReplica(nodes, index) {
+				nodes = append(nodes, index)
+			}
+		}
+	}
+	return nodes
+}
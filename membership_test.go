@@ -0,0 +1,97 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"testing"
+	"time"
+)
+
+// heldAt returns whether the lock server holds a lock on name.
+func heldAt(l *lockserver.LockServer, name string) bool {
+	var reply SnapshotReply
+	l.Snapshot(&SnapshotArgs{}, &reply)
+	for _, e := range reply.Entries {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAddRemoveNode(t *testing.T) {
+
+	// Lock server joining the cluster, running in-process
+	l := lockserver.New(lockserver.Options{})
+	defer l.Close()
+
+	// Read lock held while the node is added
+	held := NewDRWMutex("test-add-node-held", ds)
+	held.RLock()
+
+	index, err := ds.AddNode(NewLocalClient("in-process", l), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != N {
+		t.Fatalf("expected new node at index %d, got %d", N, index)
+	}
+	if len(ds.Snapshots()) != N+1 {
+		t.Fatalf("expected %d nodes", N+1)
+	}
+
+	// The read lock held has been adopted by the new node
+	if !heldAt(l, "test-add-node-held") {
+		t.Fatal("expected read lock held to be adopted by the new node")
+	}
+	held.RUnlock()
+	l.ForceUnlock(&LockArgs{Name: "test-add-node-held"}, &LockResp{}) // Lock maintenance would release it eventually
+
+	// Locks are placed on the new node as well
+	dm := NewDRWMutex("test-add-node", ds)
+	dm.Lock()
+	if !heldAt(l, "test-add-node") {
+		t.Fatal("expected lock to be granted by the new node")
+	}
+	dm.Unlock()
+
+	if err := ds.RemoveNode(index, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.Snapshots()) != N {
+		t.Fatalf("expected %d nodes", N)
+	}
+
+	// Locks are no longer placed on the node removed
+	dm.Lock()
+	if heldAt(l, "test-add-node") {
+		t.Fatal("expected lock not to be requested from the node removed")
+	}
+	dm.Unlock()
+
+	if err := ds.RemoveNode(index, 0); err == nil {
+		t.Fatal("expected error for node removed already")
+	}
+	if err := ds.RemoveNode(0, 0); err == nil {
+		t.Fatal("expected error for own node")
+	}
+	if err := ds.RemoveNode(N-1, 0); err == nil {
+		t.Fatal("expected error for less than 4 nodes")
+	}
+}
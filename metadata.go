@@ -0,0 +1,118 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// contextKey - type of the keys under which dsync looks up request-scoped metadata
+// in the context passed to LockContext and RLockContext.
+type contextKey string
+
+var (
+	// PriorityKey - context key of the priority (an int) of a lock request. Lock servers
+	// may use it to favour important requests, higher values meaning more important.
+	PriorityKey = contextKey("dsync-priority")
+
+	// TenantKey - context key of the tenant (a string) on whose behalf a lock request
+	// is made, eg. to let lock servers enforce per tenant limits.
+	TenantKey = contextKey("dsync-tenant")
+
+	// TraceKey - context key of a function with the signature of log.Printf that is
+	// called with every step of a single lock acquisition: all rounds, the response of
+	// every node and the timings, eg. to debug one problematic acquisition in
+	// production without enabling logging for all locks.
+	TraceKey = contextKey("dsync-trace")
+
+	// LeaseTTLKey - context key of the lease (a time.Duration) requested for the lock,
+	// overriding the lease set with SetLeaseTTL for a single acquisition. Not passed on
+	// for requests that are forwarded (see SetForwarding).
+	LeaseTTLKey = contextKey("dsync-lease-ttl")
+
+	// TagsKey - context key of the tags (a map[string]string) of a lock request, eg. the
+	// ID of the job or of the API request it is made for. The lock servers store the tags
+	// along with the lock, so that they show up in audit records, journal events and the
+	// output of Dsync.Inspect for joining coordination activity with application logs.
+	// See WithTags.
+	TagsKey = contextKey("dsync-tags")
+)
+
+// WithTags returns a copy of ctx with the given tags added to the tags already stored under
+// TagsKey (if any), overriding the tags of the same keys.
+func WithTags(ctx context.Context, tags map[string]string) context.Context {
+	parent, _ := ctx.Value(TagsKey).(map[string]string)
+	merged := make(map[string]string, len(parent)+len(tags))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, TagsKey, merged)
+}
+
+func (k contextKey) String() string {
+	return string(k)
+}
+
+// lockMetadata - request-scoped metadata passed on to the lock servers.
+type lockMetadata struct {
+	priority int
+	tenant   string
+	trace    func(format string, v ...interface{}) // Nil unless tracing is requested
+	node     string                                // Client a forwarded request is made for, see Forward
+	rpcPath  string
+	latency  *Latency      // Nil unless the latency of the acquisition is broken down
+	ttl      time.Duration // Lease requested, zero for the lease set with SetLeaseTTL
+	dryRun   bool          // Only check whether the lock would be granted, see DRWMutex.DryRunLock
+	owner    string        // Uid of the DRWMutex requesting the lock
+	source   string        // File:line of the caller requesting the lock
+	tags     map[string]string
+	span     Span // Span of the acquisition, when a tracer is set (see SetTracer)
+}
+
+// metadataFromContext returns the metadata stored in ctx, values of the wrong
+// type are ignored.
+func metadataFromContext(ctx context.Context) (meta lockMetadata) {
+	meta.priority, _ = ctx.Value(PriorityKey).(int)
+	meta.tenant, _ = ctx.Value(TenantKey).(string)
+	meta.trace, _ = ctx.Value(TraceKey).(func(format string, v ...interface{}))
+	meta.ttl, _ = ctx.Value(LeaseTTLKey).(time.Duration)
+	meta.tags, _ = ctx.Value(TagsKey).(map[string]string)
+	return meta
+}
+
+// traceFor prefixes the traces with the operation and the name of the lock.
+func (meta lockMetadata) traceFor(operation, name string) lockMetadata {
+	if trace := meta.trace; trace != nil {
+		prefix := fmt.Sprintf("dsync: %s %s: ", operation, name)
+		meta.trace = func(format string, v ...interface{}) {
+			trace(prefix+format, v...)
+		}
+	}
+	return meta
+}
+
+// tracef traces a step of the lock acquisition, when tracing is requested.
+func (meta lockMetadata) tracef(format string, v ...interface{}) {
+	if meta.trace != nil {
+		meta.trace(format, v...)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	"fmt"
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockContextMetadata(t *testing.T) {
+
+	var mutex sync.Mutex
+	var requests []LockArgs
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && serviceMethod == "Dsync.Lock" && a.Name == "test-metadata" {
+			mutex.Lock()
+			requests = append(requests, *a)
+			mutex.Unlock()
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	ctx := context.WithValue(context.Background(), PriorityKey, 5)
+	ctx = context.WithValue(ctx, TenantKey, "tenant")
+
+	dm := NewDRWMutex("test-metadata", ds)
+	if !dm.LockContext(ctx) {
+		t.Fatal("expected lock to be acquired")
+	}
+	dm.Unlock()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(requests) < N {
+		t.Fatalf("expected at least %d lock requests, got %d", N, len(requests))
+	}
+	for _, r := range requests {
+		if r.Priority != 5 || r.Tenant != "tenant" {
+			t.Fatalf("expected priority 5 and tenant to be passed on, got %d and %q", r.Priority, r.Tenant)
+		}
+		if r.Wait <= 0 || r.Wait > DRWMutexAcquireTimeout {
+			t.Fatalf("expected time waited for the response to be passed on, got %v", r.Wait)
+		}
+	}
+}
+
+func TestLockContextTags(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	tds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tags are merged, overriding the tags of the same keys
+	ctx := WithTags(context.Background(), map[string]string{"job": "1", "request": "a"})
+	ctx = WithTags(ctx, map[string]string{"job": "2"})
+	tags := map[string]string{"job": "2", "request": "a"}
+
+	dm := NewDRWMutex("test-tags", tds)
+	if !dm.LockContext(ctx) {
+		t.Fatal("expected lock to be acquired")
+	}
+	defer dm.Unlock()
+
+	infos, err := tds.Inspect("", "test-tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || len(infos[0].Holders) != 1 || !reflect.DeepEqual(infos[0].Holders[0].Tags, tags) {
+		t.Fatalf("expected lock held with tags %v, got %+v", tags, infos)
+	}
+}
+
+func TestLockContextTrace(t *testing.T) {
+
+	var mutex sync.Mutex
+	var traces []string
+	trace := func(format string, v ...interface{}) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		traces = append(traces, fmt.Sprintf(format, v...))
+	}
+	ctx := context.WithValue(context.Background(), TraceKey, trace)
+
+	dm := NewDRWMutex("test-trace", ds)
+	dm.Lock()
+	ctx2, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if NewDRWMutex("test-trace", ds).LockContext(ctx2) {
+		t.Fatal("expected lock not to be acquired while held")
+	}
+	dm.Unlock()
+	if !dm.LockContext(ctx) {
+		t.Fatal("expected lock to be acquired")
+	}
+	dm.Unlock()
+
+	mutex.Lock()
+	all := strings.Join(traces, "\n")
+	mutex.Unlock()
+	for _, expected := range []string{
+		"dsync: Lock test-trace: round 1: requesting lock from",
+		"dsync: Lock test-trace: round 1: Lock \"test-trace\" failed",
+		"dsync: Lock test-trace: backing off",
+		"dsync: Lock test-trace: gave up after",
+		"dsync: Lock test-trace: node " + nodes[0] + ": granted after",
+		"dsync: Lock test-trace: acquired in round",
+		"dsync: Lock test-trace: latency: ",
+	} {
+		if !strings.Contains(all, expected) {
+			t.Errorf("expected trace %q, got:\n%s", expected, all)
+		}
+	}
+
+	// Acquisitions without a tracer are not traced
+	time.Sleep(50 * time.Millisecond) // Let late responses come in
+	mutex.Lock()
+	n := len(traces)
+	mutex.Unlock()
+	dm.Lock()
+	dm.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(traces) != n {
+		t.Fatalf("expected no traces without tracer, got %d", len(traces)-n)
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds of the buckets of the latency histograms, in seconds.
+var latencyBuckets = [...]float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram - distribution of latencies, laid out like a Prometheus histogram.
+type Histogram struct {
+	Buckets []float64 // Upper bounds of the buckets, in seconds
+	Counts  []uint64  // Cumulative number of observations per bucket
+	Count   uint64    // Number of observations
+	Sum     float64   // Sum of the observations, in seconds
+}
+
+// OperationMetrics - metrics of the locks of one kind (write or read locks) of a Dsync.
+type OperationMetrics struct {
+	Acquisitions   uint64    // Locks acquired
+	Failures       uint64    // Acquisitions given up on, eg. after a timeout
+	Retries        uint64    // Rounds of acquisitions after their first round
+	QuorumMisses   uint64    // Rounds that did not reach a quorum of the nodes
+	Active         int64     // Locks currently held by the process
+	AcquireLatency Histogram // Time until a lock was acquired or given up on
+	UnlockLatency  Histogram // Time until a lock server acknowledged a release
+}
+
+// Metrics - metrics of the lock operations of a Dsync since it was initialized, see
+// Dsync.Metrics.
+type Metrics struct {
+	Lock        OperationMetrics // Write locks
+	RLock       OperationMetrics // Read locks
+	PausedNodes int              // Nodes at which granting is paused as last reported by them, see Pause
+}
+
+// histogram - Histogram that is updated concurrently.
+type histogram struct {
+	counts [len(latencyBuckets) + 1]uint64 // Non-cumulative count per bucket of latencyBuckets, followed by +Inf
+	sum    int64                           // In nanoseconds
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d.Seconds() > latencyBuckets[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{Buckets: append([]float64(nil), latencyBuckets[:]...), Counts: make([]uint64, len(latencyBuckets))}
+	for i := 0; i <= len(latencyBuckets); i++ {
+		s.Count += atomic.LoadUint64(&h.counts[i])
+		if i < len(latencyBuckets) {
+			s.Counts[i] = s.Count
+		}
+	}
+	s.Sum = time.Duration(atomic.LoadInt64(&h.sum)).Seconds()
+	return s
+}
+
+// operationMetrics - OperationMetrics that are updated concurrently.
+type operationMetrics struct {
+	acquisitions, failures, retries, quorumMisses uint64
+	active                                        int64
+	acquireLatency, unlockLatency                 histogram
+}
+
+func (m *operationMetrics) snapshot() OperationMetrics {
+	return OperationMetrics{
+		Acquisitions:   atomic.LoadUint64(&m.acquisitions),
+		Failures:       atomic.LoadUint64(&m.failures),
+		Retries:        atomic.LoadUint64(&m.retries),
+		QuorumMisses:   atomic.LoadUint64(&m.quorumMisses),
+		Active:         atomic.LoadInt64(&m.active),
+		AcquireLatency: m.acquireLatency.snapshot(),
+		UnlockLatency:  m.unlockLatency.snapshot(),
+	}
+}
+
+// lockMetrics - the metrics of a Dsync, by kind of lock.
+type lockMetrics struct {
+	lock, rlock operationMetrics
+}
+
+func (m *lockMetrics) of(isReadLock bool) *operationMetrics {
+	if isReadLock {
+		return &m.rlock
+	}
+	return &m.lock
+}
+
+// acquired records an acquisition that took rounds and d, whether or not it succeeded.
+func (m *lockMetrics) acquired(isReadLock, acquired bool, rounds int, d time.Duration) {
+	om := m.of(isReadLock)
+	if acquired {
+		atomic.AddUint64(&om.acquisitions, 1)
+	} else {
+		atomic.AddUint64(&om.failures, 1)
+	}
+	if rounds > 1 {
+		atomic.AddUint64(&om.retries, uint64(rounds-1))
+	}
+	om.acquireLatency.observe(d)
+}
+
+// quorumMissed records a round that did not reach a quorum.
+func (m *lockMetrics) quorumMissed(isReadLock bool) {
+	atomic.AddUint64(&m.of(isReadLock).quorumMisses, 1)
+}
+
+// held records a change of the number of locks held by delta.
+func (m *lockMetrics) held(isReadLock bool, delta int) {
+	atomic.AddInt64(&m.of(isReadLock).active, int64(delta))
+}
+
+// released records a release acknowledged by a lock server after d.
+func (m *lockMetrics) released(isReadLock bool, d time.Duration) {
+	m.of(isReadLock).unlockLatency.observe(d)
+}
+
+// Metrics returns the metrics of the lock operations of ds since it was initialized, eg.
+// to alert on lock contention: the locks acquired, the acquisitions given up on, the
+// retries, the rounds that missed the quorum, the locks held and the latencies of the
+// acquisitions and releases, along with the number of nodes at which granting is paused.
+// Locks granted in single-node mode are counted as held only.
+func (ds *Dsync) Metrics() Metrics {
+	m := Metrics{Lock: ds.metrics.lock.snapshot(), RLock: ds.metrics.rlock.snapshot()}
+	for _, s := range ds.Status() {
+		if s.Paused {
+			m.PausedNodes++
+		}
+	}
+	return m
+}
+
+// MetricsHandler returns an http.Handler serving the metrics of ds in the text format of
+// Prometheus, to be scraped along with (or instead of) the metrics of the application,
+// eg. http.Handle("/metrics/dsync", ds.MetricsHandler()).
+func (ds *Dsync) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteMetrics(w, ds.Metrics())
+	})
+}
+
+// WriteMetrics writes m in the text format of Prometheus, labeled by operation.
+func WriteMetrics(w io.Writer, m Metrics) error {
+	ops := []struct {
+		name string
+		m    OperationMetrics
+	}{{"Lock", m.Lock}, {"RLock", m.RLock}}
+
+	counters := []struct {
+		name, help, kind string
+		value            func(m OperationMetrics) string
+	}{
+		{"dsync_acquisitions_total", "Locks acquired.", "counter", func(m OperationMetrics) string { return fmt.Sprint(m.Acquisitions) }},
+		{"dsync_acquisition_failures_total", "Lock acquisitions given up on.", "counter", func(m OperationMetrics) string { return fmt.Sprint(m.Failures) }},
+		{"dsync_acquisition_retries_total", "Rounds of lock acquisitions after their first round.", "counter", func(m OperationMetrics) string { return fmt.Sprint(m.Retries) }},
+		{"dsync_quorum_misses_total", "Rounds that did not reach a quorum of the nodes.", "counter", func(m OperationMetrics) string { return fmt.Sprint(m.QuorumMisses) }},
+		{"dsync_active_locks", "Locks held by the process.", "gauge", func(m OperationMetrics) string { return fmt.Sprint(m.Active) }},
+	}
+	for _, c := range counters {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", c.name, c.help, c.name, c.kind); err != nil {
+			return err
+		}
+		for _, op := range ops {
+			if _, err := fmt.Fprintf(w, "%s{operation=%q} %s\n", c.name, op.name, c.value(op.m)); err != nil {
+				return err
+			}
+		}
+	}
+
+	histograms := []struct {
+		name, help string
+		value      func(m OperationMetrics) Histogram
+	}{
+		{"dsync_acquire_latency_seconds", "Time until a lock was acquired or given up on.", func(m OperationMetrics) Histogram { return m.AcquireLatency }},
+		{"dsync_unlock_latency_seconds", "Time until a lock server acknowledged a release.", func(m OperationMetrics) Histogram { return m.UnlockLatency }},
+	}
+	for _, h := range histograms {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name); err != nil {
+			return err
+		}
+		for _, op := range ops {
+			hist := h.value(op.m)
+			for i, le := range hist.Buckets {
+				if _, err := fmt.Fprintf(w, "%s_bucket{operation=%q,le=\"%g\"} %d\n", h.name, op.name, le, hist.Counts[i]); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "%s_bucket{operation=%q,le=\"+Inf\"} %d\n%s_sum{operation=%q} %g\n%s_count{operation=%q} %d\n",
+				h.name, op.name, hist.Count, h.name, op.name, hist.Sum, h.name, op.name, hist.Count); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "# HELP dsync_paused_nodes Nodes at which granting new locks is paused.\n# TYPE dsync_paused_nodes gauge\ndsync_paused_nodes %d\n", m.PausedNodes)
+	return err
+}
@@ -0,0 +1,85 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	mds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dm := NewDRWMutex("test-metrics", mds)
+	dm.Lock()
+	if NewDRWMutex("test-metrics", mds).TryLock() {
+		t.Fatal("expected lock to be held")
+	}
+	m := mds.Metrics()
+	if m.Lock.Acquisitions != 1 || m.Lock.Failures != 1 || m.Lock.QuorumMisses != 1 || m.Lock.Active != 1 {
+		t.Fatalf("expected an acquisition, a failure, a quorum miss and an active lock, got %+v", m.Lock)
+	}
+	if h := m.Lock.AcquireLatency; h.Count != 2 || h.Counts[len(h.Counts)-1] > h.Count || len(h.Counts) != len(h.Buckets) {
+		t.Fatalf("expected two observations of the acquisition latency, got %+v", h)
+	}
+
+	dm.Unlock()
+	dm.RLock()
+	if m = mds.Metrics(); m.Lock.Active != 0 || m.RLock.Active != 1 || m.RLock.Acquisitions != 1 {
+		t.Fatalf("expected the read lock only to be active, got %+v and %+v", m.Lock, m.RLock)
+	}
+	dm.RUnlock()
+
+	// Releases are acknowledged asynchronously
+	deadline := time.Now().Add(time.Second)
+	for m = mds.Metrics(); m.Lock.UnlockLatency.Count < 4 && time.Now().Before(deadline); m = mds.Metrics() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m.Lock.UnlockLatency.Count != 4 || m.RLock.Active != 0 {
+		t.Fatalf("expected the release of the write lock at all nodes, got %+v", m.Lock.UnlockLatency)
+	}
+
+	rec := httptest.NewRecorder()
+	mds.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	for _, line := range []string{
+		"# TYPE dsync_acquisitions_total counter",
+		`dsync_acquisitions_total{operation="Lock"} 1`,
+		`dsync_acquisition_failures_total{operation="Lock"} 1`,
+		`dsync_active_locks{operation="RLock"} 0`,
+		"# TYPE dsync_acquire_latency_seconds histogram",
+		`dsync_acquire_latency_seconds_bucket{operation="Lock",le="+Inf"} 2`,
+		`dsync_acquire_latency_seconds_count{operation="RLock"} 1`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Fatalf("expected %q in metrics, got:\n%s", line, body)
+		}
+	}
+}
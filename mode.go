@@ -0,0 +1,52 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import "fmt"
+
+// LockMode - mode in which a lock is requested or held, carried on the wire in LockArgs
+// (and reported in LockEntry and the events of the lock servers) so that modes beyond
+// read and write locks (eg. intent locks) can be introduced without new RPCs.
+type LockMode string
+
+const (
+	Exclusive LockMode = "exclusive" // Write lock, held by a single holder
+	Shared    LockMode = "shared"    // Read lock, held by any number of holders at once
+)
+
+// ModeOf returns the mode of a write lock (writer set) or read lock.
+func ModeOf(writer bool) LockMode {
+	if writer {
+		return Exclusive
+	}
+	return Shared
+}
+
+// IsExclusive returns true for a mode that excludes all other holders.
+func (m LockMode) IsExclusive() bool {
+	return m == Exclusive
+}
+
+// CheckMode returns an error when mode, as requested in the LockArgs of an RPC, is not the
+// mode the RPC operates in. An empty mode, as sent by older clients, is accepted. To be
+// called by lock servers, so that requests in modes they do not know are refused.
+func CheckMode(mode, expected LockMode) error {
+	if mode != "" && mode != expected {
+		return fmt.Errorf("Lock mode %q not supported, expected %q", mode, expected)
+	}
+	return nil
+}
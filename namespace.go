@@ -0,0 +1,77 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"errors"
+	"strings"
+)
+
+// NamespaceSeparator - separates the name of a namespace from the names of its locks.
+const NamespaceSeparator = "/"
+
+// Namespace - scope for the locks of a subsystem of an application, sharing the
+// nodes, connections and all other configuration of its Dsync.
+//
+// Lock names are prefixed with the name of the namespace, so that subsystems can
+// pick lock names independently. Namespaces are cheap to create and can be nested.
+type Namespace struct {
+	prefix string
+	ds     *Dsync
+}
+
+// NewNamespace returns the namespace with the given name for the locks of ds.
+func NewNamespace(name string, ds *Dsync) *Namespace {
+	return &Namespace{prefix: name + NamespaceSeparator, ds: ds}
+}
+
+// Namespace returns the child namespace with the given name.
+func (ns *Namespace) Namespace(name string) *Namespace {
+	return &Namespace{prefix: ns.prefix + name + NamespaceSeparator, ds: ns.ds}
+}
+
+// Prefix returns the prefix of the names of all locks in the namespace (and its children).
+func (ns *Namespace) Prefix() string {
+	return ns.prefix
+}
+
+// NewDRWMutex returns a DRWMutex for name in the namespace.
+func (ns *Namespace) NewDRWMutex(name string) *DRWMutex {
+	return NewDRWMutex(ns.prefix+name, ns.ds)
+}
+
+// NewFusedDRWMutex returns a FusedDRWMutex for name in the namespace.
+func (ns *Namespace) NewFusedDRWMutex(name string) *FusedDRWMutex {
+	return NewFusedDRWMutex(ns.prefix+name, ns.ds)
+}
+
+// NewSubtreeDRWMutex returns a DRWMutex on the namespace itself, which conflicts with
+// the locks in the namespace (and its children) when the lock servers treat names as a
+// hierarchy (see the Hierarchical option of the lockserver package), eg. to write lock
+// a whole bucket for its deletion. Otherwise it is an independent lock.
+func (ns *Namespace) NewSubtreeDRWMutex() *DRWMutex {
+	return NewDRWMutex(strings.TrimSuffix(ns.prefix, NamespaceSeparator), ns.ds)
+}
+
+// ExpireAll releases all locks in the namespace (and its children) at all nodes,
+// see ExpirePrefix.
+func (ns *Namespace) ExpireAll(dryRun bool) ([]NodeSnapshot, error) {
+	if ns.prefix == NamespaceSeparator {
+		return nil, errors.New("Refusing to expire the locks of an unnamed namespace")
+	}
+	return ns.ds.ExpirePrefix(ns.prefix, dryRun)
+}
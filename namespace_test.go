@@ -0,0 +1,92 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"fmt"
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"testing"
+	"time"
+)
+
+func TestNamespace(t *testing.T) {
+
+	ns := NewNamespace("test-namespace", ds)
+	child := ns.Namespace("child")
+	if dm := child.NewDRWMutex("lock"); dm.Name != "test-namespace/child/lock" {
+		t.Fatalf("expected lock name test-namespace/child/lock, got %s", dm.Name)
+	}
+
+	// Same lock name in different namespaces does not conflict
+	dm1 := ns.NewDRWMutex("lock")
+	dm2 := NewNamespace("test-namespace2", ds).NewDRWMutex("lock")
+	dm1.Lock()
+	dm2.Lock()
+
+	dm3 := child.NewDRWMutex("lock")
+	dm3.RLock()
+
+	expired, err := ns.ExpireAll(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range expired {
+		if e.Err != nil || len(e.Entries) != 2 {
+			t.Fatalf("expected two locks in namespace at node %s, got %v (%v)", e.Node, e.Entries, e.Err)
+		}
+	}
+
+	dm1.Unlock()
+	dm2.Unlock()
+	dm3.RUnlock()
+}
+
+func TestNamespaceHierarchical(t *testing.T) {
+
+	var clnts []RPC
+	for i := 0; i < 4; i++ {
+		l := lockserver.New(lockserver.Options{Hierarchical: true})
+		defer l.Close()
+		clnts = append(clnts, NewLocalClient(fmt.Sprintf("hierarchical-%d", i), l))
+	}
+	rds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := NewNamespace("test-bucket", rds)
+	object := bucket.NewDRWMutex("object")
+	object.Lock()
+
+	// The bucket cannot be locked for deletion while an object is locked
+	all := bucket.NewSubtreeDRWMutex()
+	if all.Name != "test-bucket" {
+		t.Fatalf("expected lock name test-bucket, got %s", all.Name)
+	}
+	if all.LockWithTimeout(100 * time.Millisecond) {
+		t.Fatal("expected bucket not to be locked while an object is locked")
+	}
+	object.Unlock()
+	if !all.LockWithTimeout(5 * time.Second) {
+		t.Fatal("expected bucket to be locked once the object is released")
+	}
+	if bucket.NewDRWMutex("other").TryRLock() {
+		t.Fatal("expected object not to be locked while the bucket is locked")
+	}
+	all.Unlock()
+}
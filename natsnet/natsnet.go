@@ -0,0 +1,161 @@
+//go:build nats
+// +build nats
+
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package natsnet is a NATS transport for dsync, for deployments that already run NATS
+// as their messaging backbone. Every RPC is a NATS request/reply on the subject of the
+// lock server, with the arguments and reply encoded by dsync.JSONCodec:
+//
+//	nc, err := nats.Connect(nats.DefaultURL)
+//
+//	// On the node of the lock server
+//	sub, err := natsnet.Serve(nc, natsnet.Subject("dsync", "lock1", dsync.DefaultPath), lockServer)
+//
+//	// On the clients
+//	clnt := natsnet.NewClient(nc, "dsync", "lock1", dsync.DefaultPath)
+//
+// Subjects are named per node and per lock server instance on the node (its rpcPath),
+// see Subject, so that every lock server only receives the requests addressed to it.
+//
+// The package depends on github.com/nats-io/nats.go and is therefore only built with the
+// nats build tag.
+package natsnet
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/minio/dsync"
+	"github.com/nats-io/nats.go"
+)
+
+// Default timeout of a request, see Client.
+const DefaultTimeout = 30 * time.Second
+
+// request - RPC of the lock server as sent over NATS.
+type request struct {
+	Method string          `json:"method"` // Name of the method of the lock server, eg. "Dsync.Lock"
+	Args   json.RawMessage `json:"args"`
+}
+
+// response - reply of the lock server as sent over NATS.
+type response struct {
+	Reply json.RawMessage `json:"reply,omitempty"`
+	Err   string          `json:"err,omitempty"` // Error returned by the lock server
+}
+
+// Subject returns the subject of the lock server at node and rpcPath, prefix being the
+// subject shared by all lock servers of a cluster (eg. "dsync"). Characters that have a
+// special meaning in subjects are replaced, eg. "dsync.10_0_0_1:9000.dsync" for node
+// "10.0.0.1:9000" and rpcPath "/dsync".
+func Subject(prefix, node, rpcPath string) string {
+	return prefix + "." + token(node) + "." + token(strings.TrimPrefix(rpcPath, "/"))
+}
+
+// token replaces the characters of s that are not allowed within a token of a subject.
+func token(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', '/', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Serve answers the requests on subject by calling the methods of rcvr (eg. a
+// *lockserver.LockServer) following the net/rpc conventions (see dsync.Serve), until the
+// subscription returned is unsubscribed.
+func Serve(nc *nats.Conn, subject string, rcvr interface{}) (*nats.Subscription, error) {
+	return nc.Subscribe(subject, func(msg *nats.Msg) {
+		var resp response
+		var req request
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			resp.Err = err.Error()
+		} else if reply, err := dsync.Serve(rcvr, req.Method, req.Args, dsync.JSONCodec); err != nil {
+			resp.Err = err.Error()
+		} else {
+			resp.Reply = reply
+		}
+		b, _ := json.Marshal(&resp)
+		msg.Respond(b)
+	})
+}
+
+// Client - dsync.RPC client of a single lock server over NATS. The connection is shared
+// with the other clients, so closing a client leaves it open.
+type Client struct {
+	nc      *nats.Conn
+	subject string
+	node    string
+	rpcPath string
+
+	// Timeout of every request, defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// NewClient returns a client for the lock server at node and rpcPath, sending the requests
+// on its subject below prefix (see Subject).
+func NewClient(nc *nats.Conn, prefix, node, rpcPath string) *Client {
+	return &Client{nc: nc, subject: Subject(prefix, node, rpcPath), node: node, rpcPath: rpcPath, Timeout: DefaultTimeout}
+}
+
+// Call sends the RPC named by serviceMethod ("Dsync.<method>") to the lock server and
+// waits for its reply.
+func (c *Client) Call(serviceMethod string, args interface {
+	SetToken(token string)
+	SetTimestamp(tstamp time.Time)
+}, reply interface{}) error {
+	b, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	b, err = json.Marshal(&request{Method: serviceMethod, Args: b})
+	if err != nil {
+		return err
+	}
+	msg, err := c.nc.Request(c.subject, b, c.Timeout)
+	if err != nil {
+		return err
+	}
+	var resp response
+	if err = json.Unmarshal(msg.Data, &resp); err != nil {
+		return err
+	}
+	if resp.Err != "" {
+		return errors.New(resp.Err)
+	}
+	return json.Unmarshal(resp.Reply, reply)
+}
+
+func (c *Client) Node() string {
+	return c.node
+}
+
+func (c *Client) RPCPath() string {
+	return c.rpcPath
+}
+
+func (c *Client) Close() error {
+	return nil
+}
@@ -0,0 +1,96 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// NetLocker - transport-agnostic client of a single lock server, covering the lock
+// operations proper, so that dsync can be run over other transports than net/rpc (eg.
+// gRPC behind HTTP/2 load balancers), see NewNetLockerClient.
+type NetLocker interface {
+	Lock(args *LockArgs, resp *LockResp) error
+	Unlock(args *LockArgs, resp *LockResp) error
+	RLock(args *LockArgs, resp *LockResp) error
+	RUnlock(args *LockArgs, resp *LockResp) error
+	ForceUnlock(args *LockArgs, resp *LockResp) error
+	Close() error
+}
+
+// Caller - optional interface of a NetLocker that can issue any other RPC of the lock
+// server as well, like RPC.Call.
+type Caller interface {
+	Call(serviceMethod string, args RPCArgs, reply interface{}) error
+}
+
+// netLockerClient - RPC implementation on top of a NetLocker.
+type netLockerClient struct {
+	nl      NetLocker
+	node    string
+	rpcPath string
+}
+
+// NewNetLockerClient returns an RPC client for the lock server at node and rpcPath that is
+// reached through nl. Lock operations are mapped onto the methods of nl, all other RPCs
+// (eg. lease refreshes, snapshots or version negotiation) are passed on when nl implements
+// Caller and fail like an unknown method otherwise, so that dsync falls back to the core
+// protocol for such lock servers.
+func NewNetLockerClient(nl NetLocker, node, rpcPath string) RPC {
+	return &netLockerClient{nl: nl, node: node, rpcPath: rpcPath}
+}
+
+// Call maps serviceMethod ("Dsync.<method>") onto the NetLocker.
+func (c *netLockerClient) Call(serviceMethod string, args interface {
+	SetToken(token string)
+	SetTimestamp(tstamp time.Time)
+}, reply interface{}) error {
+	lockArgs, ok1 := args.(*LockArgs)
+	resp, ok2 := reply.(*LockResp)
+	if ok1 && ok2 {
+		switch serviceMethod[strings.LastIndex(serviceMethod, ".")+1:] {
+		case "Lock":
+			return c.nl.Lock(lockArgs, resp)
+		case "Unlock":
+			return c.nl.Unlock(lockArgs, resp)
+		case "RLock":
+			return c.nl.RLock(lockArgs, resp)
+		case "RUnlock":
+			return c.nl.RUnlock(lockArgs, resp)
+		case "ForceUnlock":
+			return c.nl.ForceUnlock(lockArgs, resp)
+		}
+	}
+	if caller, ok := c.nl.(Caller); ok {
+		return caller.Call(serviceMethod, args, reply)
+	}
+	return errors.New("rpc: can't find method " + serviceMethod)
+}
+
+func (c *netLockerClient) Node() string {
+	return c.node
+}
+
+func (c *netLockerClient) RPCPath() string {
+	return c.rpcPath
+}
+
+func (c *netLockerClient) Close() error {
+	return c.nl.Close()
+}
@@ -0,0 +1,71 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"fmt"
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"strings"
+	"testing"
+	"time"
+)
+
+// netLocker - lock server reached through the NetLocker interface only.
+type netLocker struct {
+	*lockserver.LockServer
+}
+
+func (nl netLocker) Close() error {
+	nl.LockServer.Close()
+	return nil
+}
+
+func TestNetLockerClient(t *testing.T) {
+
+	clnts := make([]RPC, 4)
+	for i := range clnts {
+		clnts[i] = NewNetLockerClient(netLocker{lockserver.New(lockserver.Options{})}, fmt.Sprintf("netlocker-%d", i), DefaultPath)
+	}
+	defer func() {
+		for _, c := range clnts {
+			c.Close()
+		}
+	}()
+
+	var v VersionInfo
+	if err := clnts[0].Call("Dsync.Version", &VersionArgs{}, &v); err == nil || !strings.Contains(err.Error(), "can't find method") {
+		t.Fatalf("expected unknown method error, got %v", err)
+	}
+
+	cluster, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm := NewDRWMutex("test-netlocker", cluster)
+	if !dm.LockWithTimeout(time.Second) {
+		t.Fatal("expected write lock to be granted")
+	}
+	if NewDRWMutex("test-netlocker", cluster).TryRLock() {
+		t.Fatal("expected read lock to be denied")
+	}
+	dm.Unlock()
+	if !dm.LockWithTimeout(time.Second) {
+		t.Fatal("expected write lock to be granted once released")
+	}
+	dm.ForceUnlock()
+}
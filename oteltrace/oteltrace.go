@@ -0,0 +1,113 @@
+//go:build otel
+// +build otel
+
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package oteltrace instruments dsync with OpenTelemetry: every acquisition and release of
+// a lock gets a span, with a child span per RPC to a node and the outcome of the rounds
+// recorded as events, so that slow acquisitions can be diagnosed from the traces:
+//
+//	ds.SetTracer(oteltrace.New(otel.Tracer("github.com/minio/dsync")))
+//
+// Acquisitions with a context (eg. LockContext) are children of the span of the context.
+//
+// The package depends on go.opentelemetry.io/otel and is therefore only built with the
+// otel build tag.
+package oteltrace
+
+import (
+	"context"
+	"time"
+
+	"github.com/minio/dsync"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Keys of the attributes of the spans.
+const (
+	NameKey    = attribute.Key("dsync.lock.name") // Name of the lock
+	NodeKey    = attribute.Key("dsync.node")      // Network address of the node of an RPC
+	OutcomeKey = attribute.Key("dsync.outcome")   // Outcome of an RPC, see dsync.Outcome
+	GrantedKey = attribute.Key("dsync.granted")   // Number of nodes that granted the lock in a round
+	NodesKey   = attribute.Key("dsync.nodes")     // Number of nodes the lock was requested from in a round
+	QuorumKey  = attribute.Key("dsync.quorum")    // Whether a round met the quorum
+	OKKey      = attribute.Key("dsync.ok")        // Whether the lock was acquired (or released)
+	RoundsKey  = attribute.Key("dsync.rounds")    // Number of rounds of the acquisition
+	RetriesKey = attribute.Key("dsync.retries")   // Number of rounds after the first one
+)
+
+// Tracer - dsync.Tracer creating OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a Tracer creating the spans with tracer.
+func New(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// Start starts the span of operation on name, named eg. "dsync.Lock".
+func (t *Tracer) Start(ctx context.Context, operation, name string) dsync.Span {
+	ctx, s := t.tracer.Start(ctx, "dsync."+operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(NameKey.String(name)))
+	return &span{ctx: ctx, span: s, tracer: t.tracer}
+}
+
+// span - dsync.Span of an OpenTelemetry span.
+type span struct {
+	ctx    context.Context // Context of span, the parent of the spans of the RPCs
+	span   trace.Span
+	tracer trace.Tracer
+}
+
+// Call records the RPC as a child span, named after serviceMethod (eg. "Dsync.Lock").
+func (s *span) Call(node, serviceMethod string, start time.Time, latency time.Duration, outcome dsync.Outcome, err error) {
+	_, call := s.tracer.Start(s.ctx, serviceMethod, trace.WithSpanKind(trace.SpanKindClient), trace.WithTimestamp(start),
+		trace.WithAttributes(NodeKey.String(node), OutcomeKey.String(string(outcome))))
+	if err != nil {
+		call.RecordError(err)
+		call.SetStatus(codes.Error, err.Error())
+	}
+	call.End(trace.WithTimestamp(start.Add(latency)))
+}
+
+// Round records the outcome of the round as an event.
+func (s *span) Round(granted, nodes int, quorum bool) {
+	s.span.AddEvent("round", trace.WithAttributes(GrantedKey.Int(granted), NodesKey.Int(nodes), QuorumKey.Bool(quorum)))
+}
+
+// End ends the span, with an error status when the operation failed.
+func (s *span) End(ok bool, rounds int, err error) {
+	retries := rounds - 1
+	if retries < 0 {
+		retries = 0
+	}
+	s.span.SetAttributes(OKKey.Bool(ok), RoundsKey.Int(rounds), RetriesKey.Int(retries))
+	if err != nil {
+		s.span.RecordError(err)
+	}
+	if !ok {
+		msg := "not acquired"
+		if err != nil {
+			msg = err.Error()
+		}
+		s.span.SetStatus(codes.Error, msg)
+	}
+	s.span.End()
+}
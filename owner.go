@@ -0,0 +1,62 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	cryptorand "crypto/rand"
+	"fmt"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Owner returns the uid identifying dm at the lock servers. Every lock server hands out
+// a uid of its own for a grant, while the owner is passed along with all lock requests of
+// dm, so that operators can tell which grants at the different nodes belong together (see
+// LockEntry), and the application can log it to find out who holds a lock.
+func (dm *DRWMutex) Owner() string {
+	return dm.owner
+}
+
+// newOwner returns a new uid for the owner of locks.
+func newOwner() string {
+	bytesUid := [16]byte{}
+	cryptorand.Read(bytesUid[:])
+	return fmt.Sprintf("%X", bytesUid[:])
+}
+
+// Maximum number of frames searched for the caller outside of this package.
+const maxSourceFrames = 16
+
+// callerSource returns the directory, file and line of the first caller outside of this
+// package (eg. "app/main.go:42"), or an empty string when not found.
+func callerSource() string {
+	var pcs [maxSourceFrames]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs[:])])
+
+	// The function itself tells the package path, which changes when vendored
+	own, more := frames.Next()
+	prefix := own.Function[:strings.LastIndex(own.Function, ".")+1]
+	for more {
+		var frame runtime.Frame
+		if frame, more = frames.Next(); !strings.HasPrefix(frame.Function, prefix) {
+			return path.Join(path.Base(path.Dir(frame.File)), path.Base(frame.File)) + ":" + strconv.Itoa(frame.Line)
+		}
+	}
+	return ""
+}
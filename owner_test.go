@@ -0,0 +1,55 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"strings"
+	"testing"
+)
+
+func TestLockOwner(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	ods, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dm := NewDRWMutex("test-owner", ods)
+	if dm.Owner() == "" || dm.Owner() == NewDRWMutex("test-owner", ods).Owner() {
+		t.Fatalf("expected a distinct owner per mutex, got %q", dm.Owner())
+	}
+	dm.Lock()
+	defer dm.Unlock()
+
+	// All grants carry the owner and the caller that requested the lock
+	for _, s := range ods.Snapshots() {
+		if s.Err != nil {
+			t.Fatal(s.Err)
+		}
+		for _, e := range s.Entries {
+			if e.Owner != dm.Owner() || !strings.HasSuffix(strings.SplitN(e.Source, ":", 2)[0], "/owner_test.go") {
+				t.Fatalf("expected grant owned by %s from owner_test.go, got %+v", dm.Owner(), e)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// PauseArgs - arguments for the Pause RPC.
+type PauseArgs struct {
+	AuthArgs
+	Query    bool   `json:"query,omitempty"` // Only report whether granting is paused
+	Resume   bool   `json:"resume"`          // Resume rather than pause granting
+	Operator string `json:"operator"`        // Operator pausing or resuming, for the audit log
+	Reason   string `json:"reason"`          // Reason for pausing or resuming, for the audit log
+}
+
+// PauseReply - reply for the Pause RPC, whether a lock server grants new locks.
+type PauseReply struct {
+	Paused bool      `json:"paused"`
+	Since  time.Time `json:"since,omitempty"` // Time granting was paused, zero when not paused
+}
+
+// NodePaused - whether granting is paused at (or the error querying) a single node.
+type NodePaused struct {
+	Node   string
+	Paused bool
+	Since  time.Time
+	Err    error
+}
+
+// Pause pauses granting new locks at all nodes on behalf of an operator, eg. during
+// coordinated maintenance of the protected resources. All lock requests are denied (like
+// for frozen names, see Freeze) until granting is resumed; locks already held are not
+// affected and can still be released. Lock servers record the change in their audit log,
+// but keep it in memory only: a lock server that restarts grants locks again.
+//
+// An error is returned when less than a quorum of the nodes paused granting, in which
+// case locks can still be granted.
+func (ds *Dsync) Pause(operator, reason string) error {
+	return ds.pause(false, operator, reason)
+}
+
+// Resume resumes granting new locks (see Pause) at all nodes on behalf of an operator.
+//
+// An error is returned when not all nodes resumed granting, in which case lock requests
+// can still be refused until the remaining nodes are resumed.
+func (ds *Dsync) Resume(operator, reason string) error {
+	return ds.pause(true, operator, reason)
+}
+
+func (ds *Dsync) pause(resume bool, operator, reason string) error {
+
+	if operator == "" || reason == "" {
+		return errors.New("Operator and reason are required for the audit log")
+	}
+
+	m := ds.membership()
+	var failed []string
+	for _, p := range ds.callPause(m, PauseArgs{Resume: resume, Operator: operator, Reason: reason}) {
+		if p.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", p.Node, p.Err))
+		}
+	}
+	if resume && len(failed) > 0 {
+		return fmt.Errorf("Resume failed at %d of %d nodes: %v", len(failed), m.count, failed)
+	} else if m.count-len(failed) < m.quorum {
+		return fmt.Errorf("Pause reached less than a quorum of %d nodes: %v", m.quorum, failed)
+	}
+	return nil
+}
+
+// PauseStatus retrieves whether granting is paused at all nodes (see Pause).
+func (ds *Dsync) PauseStatus() []NodePaused {
+	return ds.callPause(ds.membership(), PauseArgs{Query: true})
+}
+
+// callPause calls the Pause RPC at all nodes of m, recording their state for Status.
+func (ds *Dsync) callPause(m *members, args PauseArgs) []NodePaused {
+
+	nodes := m.nodes()
+	paused := make([]NodePaused, len(nodes))
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			var reply PauseReply
+			args := args
+			paused[i].Node = m.node(index)
+			if paused[i].Err = ds.call(index, "Dsync.Pause", &args, &reply); paused[i].Err == nil {
+				paused[i].Paused, paused[i].Since = reply.Paused, reply.Since
+				ds.recordPaused(index, reply.Paused)
+			}
+			ch <- i
+		}(i, index)
+	}
+	for range nodes {
+		<-ch
+	}
+
+	return paused
+}
+
+// recordPaused records whether granting is paused at the node at index, as reported by
+// the lock server with every lock response (see NodeStatus.Paused).
+func (ds *Dsync) recordPaused(index int, paused bool) {
+	c := ds.membership().client(index)
+	if c == nil {
+		return
+	}
+	var v int32
+	if paused {
+		v = 1
+	}
+	atomic.StoreInt32(&c.paused, v)
+}
@@ -0,0 +1,98 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+)
+
+func TestPause(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	rds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pausedNodes := func() (n int) {
+		for _, s := range rds.Status() {
+			if s.Paused {
+				n++
+			}
+		}
+		return n
+	}
+
+	holder := NewDRWMutex("test-pause-held", rds)
+	holder.Lock()
+
+	if err := rds.Pause("", ""); err == nil {
+		t.Fatal("expected pause without operator and reason to be refused")
+	}
+	if err := rds.Pause("operator", "maintenance"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range rds.PauseStatus() {
+		if p.Err != nil || !p.Paused || p.Since.IsZero() {
+			t.Fatalf("expected %s to be paused, got %+v", p.Node, p)
+		}
+	}
+	if pausedNodes() != 4 || rds.Metrics().PausedNodes != 4 {
+		t.Fatalf("expected 4 paused nodes, got %d", pausedNodes())
+	}
+
+	// New locks are denied, whereas the locks held can be released
+	dm := NewDRWMutex("test-pause", rds)
+	if dm.LockWithTimeout(100 * time.Millisecond) {
+		t.Fatal("expected lock to be denied while paused")
+	}
+
+	// Other processes learn of the pause from the responses to their lock requests
+	other, err := New(clnts, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NewDRWMutex("test-pause", other).TryLock() {
+		t.Fatal("expected lock to be denied while paused")
+	}
+	for i := 0; other.Metrics().PausedNodes < 4; i++ { // The responses after the round was decided arrive later
+		if i == 100 {
+			t.Fatalf("expected 4 paused nodes, got %d", other.Metrics().PausedNodes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := <-holder.UnlockAsync(); err != nil {
+		t.Fatalf("expected lock held to be released while paused, got %v", err)
+	}
+
+	if err := rds.Resume("operator", "maintenance done"); err != nil {
+		t.Fatal(err)
+	}
+	if pausedNodes() != 0 {
+		t.Fatalf("expected no paused nodes, got %d", pausedNodes())
+	}
+	if !dm.LockWithTimeout(5 * time.Second) {
+		t.Fatal("expected lock to be granted after resuming")
+	}
+	dm.Unlock()
+}
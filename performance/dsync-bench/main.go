@@ -0,0 +1,201 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command dsync-bench runs the performance workload on a cluster of lock servers launched
+// on the local machine, so that benchmark results can be reproduced on a single machine.
+//
+// It starts the given number of performance programs on consecutive ports (each being a
+// lock server as well as a client running the workload), waits for all of them to finish
+// and tears the cluster down again. The arguments after the flags are passed on to every
+// program, eg.
+//
+//	dsync-bench -n 8 -latency 200us -- -parallel 8 -runs 10000
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	nodesFlag   = flag.Int("n", 4, "Number of lock servers to launch")
+	portFlag    = flag.Int("port", 12345, "Port of the first lock server, the others listen on the ports following it")
+	latencyFlag = flag.Duration("latency", 0, "Latency added to every call to a lock server, to simulate a network")
+	binFlag     = flag.String("bin", "", "Performance program to run (built from github.com/minio/dsync/performance when empty)")
+	logsFlag    = flag.String("logs", "", "Directory for the output of every lock server (a temporary directory when empty)")
+	timeoutFlag = flag.Duration("timeout", 30*time.Minute, "Time after which the cluster is torn down when the workload has not finished")
+)
+
+// Time the programs get to exit after an interrupt before they are killed.
+const killAfter = 15 * time.Second
+
+func main() {
+	flag.Parse()
+
+	if *nodesFlag < 4 || *nodesFlag > 16 {
+		log.Fatalf("Number of lock servers must be between 4 and 16")
+	}
+	logs := *logsFlag
+	if logs == "" {
+		var err error
+		if logs, err = ioutil.TempDir("", "dsync-bench"); err != nil {
+			log.Fatal(err)
+		}
+	} else if err := os.MkdirAll(logs, 0755); err != nil {
+		log.Fatal(err)
+	}
+	bin := *binFlag
+	if bin == "" {
+		bin = filepath.Join(logs, "performance")
+		build := exec.Command("go", "build", "-o", bin, "github.com/minio/dsync/performance")
+		build.Stdout, build.Stderr = os.Stdout, os.Stderr
+		if err := build.Run(); err != nil {
+			log.Fatalf("Unable to build the performance program: %v", err)
+		}
+	}
+
+	var nodes []string
+	for i := 0; i < *nodesFlag; i++ {
+		node := "127.0.0.1:" + strconv.Itoa(*portFlag+i)
+		if l, err := net.Listen("tcp", node); err != nil {
+			log.Fatalf("Port of lock server %d not available: %v", i, err)
+		} else {
+			l.Close()
+		}
+		nodes = append(nodes, node)
+	}
+
+	fmt.Printf("Lock servers: %d on ports %d-%d\n", len(nodes), *portFlag, *portFlag+len(nodes)-1)
+	fmt.Printf("Latency: %v\n", *latencyFlag)
+	fmt.Printf("Arguments: %s\n", strings.Join(flag.Args(), " "))
+	fmt.Printf("GOMAXPROCS=%d NumCPU=%d\n", runtime.GOMAXPROCS(0), runtime.NumCPU())
+	fmt.Printf("Output of the lock servers: %s\n", logs)
+
+	cmds := make([]*exec.Cmd, len(nodes))
+	files := make([]string, len(nodes))
+	var wg sync.WaitGroup
+	for i := range nodes {
+		args := []string{"-p", strconv.Itoa(*portFlag + i), "-nodes", strings.Join(nodes, ","), "-latency", latencyFlag.String()}
+		cmds[i] = exec.Command(bin, append(args, flag.Args()...)...)
+		files[i] = filepath.Join(logs, fmt.Sprintf("node-%d.log", i))
+		f, err := os.Create(files[i])
+		if err != nil {
+			teardown(cmds[:i], os.Kill)
+			log.Fatal(err)
+		}
+		defer f.Close()
+		// Only the output of the first lock server is shown, the others are alike
+		var out io.Writer = f
+		if i == 0 {
+			out = io.MultiWriter(f, os.Stdout)
+		}
+		cmds[i].Stdout, cmds[i].Stderr = out, out
+		if err = cmds[i].Start(); err != nil {
+			teardown(cmds[:i], os.Kill)
+			log.Fatalf("Unable to start lock server %d: %v", i, err)
+		}
+		wg.Add(1)
+		go func(cmd *exec.Cmd) {
+			defer wg.Done()
+			cmd.Wait()
+		}(cmds[i])
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	// Tear the cluster down on Ctrl-C or when the workload does not finish in time
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	select {
+	case <-finished:
+	case <-c:
+		fmt.Println("Ctrl-C intercepted, stopping lock servers")
+		teardown(cmds, os.Interrupt)
+	case <-time.After(*timeoutFlag):
+		fmt.Printf("Workload did not finish in %v, stopping lock servers\n", *timeoutFlag)
+		teardown(cmds, os.Interrupt)
+	}
+	select {
+	case <-finished:
+	case <-time.After(killAfter):
+		teardown(cmds, os.Kill)
+		<-finished
+	}
+
+	summarize(files)
+}
+
+// teardown sends sig to the programs, which must have been started.
+func teardown(cmds []*exec.Cmd, sig os.Signal) {
+	for _, cmd := range cmds {
+		cmd.Process.Signal(sig) // Fails for the programs that exited already
+	}
+}
+
+// summarize prints the throughput of the whole cluster, summing up the throughput reported
+// by every lock server (which is missing when it was stopped or swept configurations).
+func summarize(files []string) {
+	locks, msgs, reported := 0.0, 0.0, 0
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 2 {
+				continue
+			}
+			v, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				continue
+			}
+			switch fields[0] {
+			case "Locks/sec:":
+				locks += v
+				reported++
+			case "Msgs/sec:":
+				msgs += v
+			}
+		}
+		f.Close()
+	}
+	if reported < len(files) {
+		return
+	}
+	fmt.Println("")
+	fmt.Printf("Cluster locks/sec: %7.0f\n", locks)
+	fmt.Printf(" Cluster msgs/sec: %7.0f\n", msgs)
+}
@@ -18,6 +18,7 @@ package main
 
 import (
 	"errors"
+	"io"
 	"net/rpc"
 	"sync"
 	"time"
@@ -48,6 +49,17 @@ func (rpcClient *RPCClient) clearRPCClient() {
 	rpcClient.mu.Unlock()
 }
 
+// dropRPCClient clears the pointer to the rpc.Client object like clearRPCClient when it
+// still points to c, and closes c.
+func (rpcClient *RPCClient) dropRPCClient(c *rpc.Client) {
+	rpcClient.mu.Lock()
+	if rpcClient.rpcPrivate == c {
+		rpcClient.rpcPrivate = nil
+	}
+	rpcClient.mu.Unlock()
+	c.Close()
+}
+
 // getRPCClient gets the pointer to the rpc.Client object in a safe manner
 func (rpcClient *RPCClient) getRPCClient() *rpc.Client {
 	rpcClient.mu.Lock()
@@ -107,6 +119,12 @@ func (rpcClient *RPCClient) Call(serviceMethod string, args interface {
 
 			// Set rpc error as rpc.ErrShutdown type.
 			err = rpc.ErrShutdown
+		} else if err == io.ErrUnexpectedEOF || err == io.EOF {
+			// The connection broke while the call was in flight: reconnect on the
+			// next call instead of failing it with rpc.ErrShutdown first. Other calls
+			// in flight fail likewise, only drop the connection when no call has
+			// reconnected meanwhile.
+			rpcClient.dropRPCClient(rpcLocalStack)
 		}
 	}
 	return err
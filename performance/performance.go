@@ -26,12 +26,14 @@ import (
 	"net/rpc"
 	"os"
 	"os/signal"
+	"runtime"
 	"strconv"
 	"sync"
 	"time"
 	"strings"
 
 	"github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
 )
 
 var nodes = []string{
@@ -46,12 +48,34 @@ var nodes = []string{
 
 var (
 	portFlag = flag.Int("p", 0, "Port for server to listen on")
+	maintenanceFlag = flag.Duration("maintenance", 0, "Interval of lock maintenance at the lock server (disabled when 0)")
+	validityFlag = flag.Duration("validity", 2*time.Minute, "Minimum age of a lock before lock maintenance checks its validity")
+	parallelFlag = flag.Int("parallel", 5, "Number of parallel loops acquiring locks (maximum when sweeping)")
+	connsFlag = flag.Int("conns", 1, "Number of connections to every lock server (maximum when sweeping)")
+	runsFlag = flag.Int("runs", 40000, "Number of locks acquired by every loop (in total per configuration when sweeping or scaling)")
+	sweepFlag = flag.Bool("sweep", false, "Measure every combination of parallel loops and connections up to -parallel and -conns")
+	nodesFlag = flag.String("nodes", "", "Comma separated addresses of the lock servers, overriding the nodes array")
+	latencyFlag = flag.Duration("latency", 0, "Latency added to every call to a lock server, to simulate a network on a single machine")
+	namesFlag = flag.Int("names", 0, "Measure the scaling with 1, 10, 100, ... up to this number of distinct names locked concurrently (disabled when 0)")
+	holdFlag = flag.Duration("hold", 0, "Time every lock is held when scaling")
+	workloadFlag = flag.Bool("workload", false, "Simulate the traffic of an object store: Zipfian names, mostly short read locks and occasional long write locks")
+	objectsFlag = flag.Int("objects", 10000, "Number of distinct names of the workload")
+	zipfFlag = flag.Float64("zipf", 1.1, "Skew of the Zipfian distribution of the names of the workload (greater than 1, higher concentrates the locks on fewer names)")
+	writesFlag = flag.Float64("writes", 0.05, "Fraction of the locks of the workload that are write locks")
+	readHoldFlag = flag.Duration("read-hold", time.Millisecond, "Mean time every read lock of the workload is held")
+	writeHoldFlag = flag.Duration("write-hold", 50*time.Millisecond, "Mean time every write lock of the workload is held")
 	rpcPaths []string
 )
 
+// Cluster of the lock servers.
+var ds *dsync.Dsync
+
+// Lock server of this node.
+var server *lockserver.LockServer
+
 func lockLoop(w *sync.WaitGroup, timeStart *time.Time, runs int, done *bool, nr int, ch chan<- float64) {
 	defer w.Done()
-	dm := dsync.NewDRWMutex(fmt.Sprintf("chaos-%d-%d", *portFlag, nr))
+	dm := dsync.NewDRWMutex(fmt.Sprintf("chaos-%d-%d", *portFlag, nr), ds)
 
 	delayMax := float64(0.0)
 	timeLast := time.Now()
@@ -78,14 +102,86 @@ func lockLoop(w *sync.WaitGroup, timeStart *time.Time, runs int, done *bool, nr
 	ch <- delayMax
 }
 
+// result - throughput measured for a number of parallel loops and connections per lock server.
+type result struct {
+	parallel    int
+	conns       int
+	locksPerSec float64
+	msgsPerSec  float64
+	delayMax    float64
+}
+
+// Clusters by number of connections per lock server, so that the connections are reused.
+var clusters = make(map[int]*dsync.Dsync)
+
+// measure runs parallel loops acquiring runs locks each with conns connections to every
+// lock server, returning the throughput.
+func measure(parallel, conns, runs int, done *bool) result {
+	ds = cluster(conns)
+
+	timeStart := time.Now()
+	wait := sync.WaitGroup{}
+	wait.Add(parallel)
+
+	// Create channel to get back max delay
+	ch := make(chan float64, parallel)
+
+	for i := 0; i < parallel; i++ {
+		go lockLoop(&wait, &timeStart, runs, done, i, ch)
+	}
+	totalRuns := runs * parallel
+
+	wait.Wait()
+	close(ch)
+
+	r := result{parallel: parallel, conns: conns}
+	for c := range ch {
+		if r.delayMax < c {
+			r.delayMax = c
+		}
+	}
+	r.locksPerSec = 1.0 / (time.Since(timeStart).Seconds() / float64(totalRuns))
+	r.msgsPerSec = float64(len(nodes)) * 2.0 * r.locksPerSec
+	return r
+}
+
+// cluster returns the cluster with conns connections to every lock server.
+func cluster(conns int) *dsync.Dsync {
+	if clusters[conns] == nil {
+		// Initialize net/rpc clients for dsync.
+		var clnts []dsync.RPC
+		for i := 0; i < len(nodes); i++ {
+			clnts = append(clnts, newPool(nodes[i], rpcPaths[i], conns))
+		}
+
+		var opts dsync.Options
+		if *latencyFlag > 0 {
+			opts.Interceptors = []dsync.Interceptor{func(c dsync.RPC, serviceMethod string, args dsync.RPCArgs, reply interface{}, invoke dsync.Invoker) error {
+				time.Sleep(*latencyFlag)
+				return invoke(c, serviceMethod, args, reply)
+			}}
+		}
+		var err error
+		if clusters[conns], err = dsync.NewWithOptions(clnts, getSelfNode(clnts, *portFlag), opts); err != nil {
+			log.Fatalf("set nodes failed with %v", err)
+		}
+	}
+	return clusters[conns]
+}
+
 func startRPCServer(port int) {
-	server := rpc.NewServer()
-	server.RegisterName("Dsync", &lockServer{
-		mutex:   sync.Mutex{},
-		lockMap: make(map[string]int64),
+	server = lockserver.New(lockserver.Options{
+		MaintenanceInterval: *maintenanceFlag,
+		ValidityInterval:    *validityFlag,
+		NewClient: func(node, rpcPath string) dsync.RPC {
+			return newClient(node, rpcPath)
+		},
 	})
+	rpcServer := rpc.NewServer()
+	rpcServer.RegisterName("Dsync", server)
 	// For some reason the registration paths need to be different (even for different server objs)
-	server.HandleHTTP(rpcPaths[port-12345], fmt.Sprintf("%s-debug", rpcPaths[port-12345]))
+	index := nodeIndex(port)
+	rpcServer.HandleHTTP(rpcPaths[index], fmt.Sprintf("%s-debug", rpcPaths[index]))
 	l, e := net.Listen("tcp", ":"+strconv.Itoa(port))
 	if e != nil {
 		log.Fatal("listen error:", e)
@@ -102,27 +198,20 @@ func main() {
 	if *portFlag == 0 {
 		log.Fatalf("No port number specified")
 	}
-
+	if *nodesFlag != "" {
+		nodes = strings.Split(*nodesFlag, ",")
+	}
+	if nodeIndex(*portFlag) == -1 {
+		log.Fatalf("No node with port %d", *portFlag)
+	}
 	rpcPaths = make([]string, 0, len(nodes)) // list of rpc paths where lock server is serving.
 	for i := range nodes {
 		rpcPaths = append(rpcPaths, dsync.RpcPath+"-"+strconv.Itoa(i))
 	}
 
-	// Initialize net/rpc clients for dsync.
-	var clnts []dsync.RPC
-	for i := 0; i < len(nodes); i++ {
-		clnts = append(clnts, newClient(nodes[i], rpcPaths[i]))
-	}
-
-	if err := dsync.SetNodesWithClients(clnts, getSelfNode(clnts, *portFlag)); err != nil {
-		log.Fatalf("set nodes failed with %v", err)
-	}
-
 	// Start server
 	startRPCServer(*portFlag)
 
-	timeStart := time.Now()
-
 	done := false
 
 	// Catch Ctrl-C and abort gracefully with release of locks
@@ -135,36 +224,34 @@ func main() {
 		}
 	}()
 
-	runs := 40000
-	parallel := 5
-	wait := sync.WaitGroup{}
-	wait.Add(parallel)
-
-	// Create channel to get back max delay
-	ch := make(chan float64, parallel)
-
+	fmt.Printf("GOMAXPROCS=%d NumCPU=%d\n", runtime.GOMAXPROCS(0), runtime.NumCPU())
 	fmt.Println("Test starting...")
 
-	for i := 0; i < parallel; i++ {
-		go lockLoop(&wait, &timeStart, runs, &done, i, ch)
-	}
-	totalRuns := runs * parallel
-
-	wait.Wait()
-	close(ch)
-
-	delayMax := float64(0.0)
-	for c := range ch {
-		if delayMax < c {
-			delayMax = c
+	if *workloadFlag {
+		workload(workloadConfig{
+			objects:   *objectsFlag,
+			skew:      *zipfFlag,
+			writes:    *writesFlag,
+			readHold:  *readHoldFlag,
+			writeHold: *writeHoldFlag,
+		}, *parallelFlag, *connsFlag, *runsFlag, &done)
+	} else if *namesFlag > 0 {
+		scale(*namesFlag, *connsFlag, *runsFlag, *holdFlag, &done)
+	} else if *sweepFlag {
+		maxParallel := *parallelFlag
+		if !flagSet("parallel") {
+			maxParallel = sweepParallelPerCPU * runtime.GOMAXPROCS(0)
 		}
+		sweep(maxParallel, *connsFlag, *runsFlag, &done)
+	} else {
+		r := measure(*parallelFlag, *connsFlag, *runsFlag, &done)
+
+		fmt.Println("")
+		fmt.Printf("        Locks/sec: %7.0f\n", r.locksPerSec)
+		fmt.Printf("         Msgs/sec: %7.0f\n", r.msgsPerSec)
+		fmt.Printf(" Worst case delay: %5.3f s\n", r.delayMax)
 	}
 
-	fmt.Println("")
-	fmt.Printf("        Locks/sec: %7.0f\n", 1.0/(time.Since(timeStart).Seconds()/float64(totalRuns)))
-	fmt.Printf("         Msgs/sec: %7.0f\n", float64(len(nodes))*2.0*1.0/(time.Since(timeStart).Seconds()/float64(totalRuns)))
-	fmt.Printf(" Worst case delay: %5.3f s\n", delayMax)
-
 	if !done {
 		// Let release messages get out
 		fmt.Println("Waiting for test to close...")
@@ -172,6 +259,16 @@ func main() {
 	}
 }
 
+// nodeIndex returns the index of the node listening on port, or -1 when there is none.
+func nodeIndex(port int) int {
+	for i, node := range nodes {
+		if strings.HasSuffix(node, ":"+strconv.Itoa(port)) {
+			return i
+		}
+	}
+	return -1
+}
+
 func getSelfNode(rpcClnts []dsync.RPC, port int) int {
 
 	index := -1
@@ -0,0 +1,66 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// rpcPool - dsync.RPC spreading the calls to a lock server round-robin over a pool of
+// connections, each of them a RPCClient.
+type rpcPool struct {
+	clients []*RPCClient
+	next    uint32
+}
+
+// newPool returns a rpcPool of size connections to the lock server at node and rpcPath.
+func newPool(node, rpcPath string, size int) *rpcPool {
+	p := &rpcPool{}
+	for i := 0; i < size; i++ {
+		p.clients = append(p.clients, newClient(node, rpcPath))
+	}
+	return p
+}
+
+// Call makes the RPC call on the next connection of the pool.
+func (p *rpcPool) Call(serviceMethod string, args interface {
+	SetTimestamp(time.Time)
+	SetToken(string)
+}, reply interface{}) error {
+	c := p.clients[atomic.AddUint32(&p.next, 1)%uint32(len(p.clients))]
+	return c.Call(serviceMethod, args, reply)
+}
+
+// Close closes all connections of the pool.
+func (p *rpcPool) Close() error {
+	var err error
+	for _, c := range p.clients {
+		if e := c.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (p *rpcPool) Node() string {
+	return p.clients[0].Node()
+}
+
+func (p *rpcPool) RPCPath() string {
+	return p.clients[0].RPCPath()
+}
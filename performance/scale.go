@@ -0,0 +1,145 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// Interval at which the memory and the locks held at the lock server are sampled.
+const sampleInterval = 100 * time.Millisecond
+
+// scaleResult - throughput and memory measured for a number of distinct names.
+type scaleResult struct {
+	names       int
+	locksPerSec float64
+	msgsPerSec  float64
+	peakHeld    int    // Highest number of locks held at the lock server of this node
+	heapGrowth  uint64 // Growth of the heap in use from before the run to its peak
+}
+
+// scale measures the throughput and the memory for 1, 10, 100, ... up to maxNames distinct
+// names locked concurrently (simulating per-object locking in an object store) with conns
+// connections to every lock server, acquiring runs locks in total per number of names, and
+// prints a table of the results. Every name is locked by a loop of its own, holding the lock
+// for hold, and the names are distinct per node, so that the loops share nothing.
+func scale(maxNames, conns, runs int, hold time.Duration, done *bool) {
+
+	var results []scaleResult
+	for _, names := range decades(maxNames) {
+		if *done {
+			break
+		}
+		perName := runs / names
+		if perName < 1 {
+			perName = 1
+		}
+		results = append(results, measureNames(names, conns, perName, hold, done))
+	}
+
+	fmt.Println("")
+	fmt.Printf("%9s %10s %10s %10s %12s %10s\n", "Names", "Locks/sec", "Msgs/sec", "Peak held", "Heap growth", "Per lock")
+	for _, r := range results {
+		perLock := uint64(0)
+		if r.peakHeld > 0 {
+			perLock = r.heapGrowth / uint64(r.peakHeld)
+		}
+		fmt.Printf("%9d %10.0f %10.0f %10d %9d KiB %8d B\n", r.names, r.locksPerSec, r.msgsPerSec, r.peakHeld, r.heapGrowth/1024, perLock)
+	}
+	fmt.Println("")
+	fmt.Printf("GOMAXPROCS=%d NumCPU=%d conns=%d hold=%v\n", runtime.GOMAXPROCS(0), runtime.NumCPU(), conns, hold)
+}
+
+// measureNames runs a loop per name acquiring runs locks each with conns connections to
+// every lock server, returning the throughput along with the memory used.
+func measureNames(names, conns, runs int, hold time.Duration, done *bool) scaleResult {
+	ds = cluster(conns)
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	// Sample the memory and the locks held until all loops finished
+	r := scaleResult{names: names}
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			if m.HeapInuse > before.HeapInuse && m.HeapInuse-before.HeapInuse > r.heapGrowth {
+				r.heapGrowth = m.HeapInuse - before.HeapInuse
+			}
+			var reply dsync.SnapshotReply
+			if server.Snapshot(&dsync.SnapshotArgs{}, &reply) == nil && len(reply.Entries) > r.peakHeld {
+				r.peakHeld = len(reply.Entries)
+			}
+		}
+	}()
+
+	// Start timing once the first lock is acquired, to account for the initial delay to start all nodes
+	var timeStart time.Time
+	var started sync.Once
+	wait := sync.WaitGroup{}
+	wait.Add(names)
+	for i := 0; i < names; i++ {
+		go func(dm *dsync.DRWMutex) {
+			defer wait.Done()
+			for run := 1; !*done && run <= runs; run++ {
+				dm.Lock()
+				started.Do(func() { timeStart = time.Now() })
+				if hold > 0 {
+					time.Sleep(hold)
+				}
+				dm.Unlock()
+				if run%100 == 0 {
+					fmt.Print(".")
+				}
+			}
+		}(dsync.NewDRWMutex(fmt.Sprintf("object-%d-%d", *portFlag, i), ds))
+	}
+	wait.Wait()
+	elapsed := time.Since(timeStart)
+	close(stop)
+	<-sampled
+
+	r.locksPerSec = float64(runs*names) / elapsed.Seconds()
+	r.msgsPerSec = float64(len(nodes)) * 2.0 * r.locksPerSec
+	return r
+}
+
+// decades returns 1, 10, 100, ... up to max, including max itself.
+func decades(max int) []int {
+	var d []int
+	for i := 1; i < max; i *= 10 {
+		d = append(d, i)
+	}
+	return append(d, max)
+}
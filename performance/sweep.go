@@ -0,0 +1,98 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+)
+
+// Parallel loops per CPU (GOMAXPROCS) swept up to unless -parallel is given.
+const sweepParallelPerCPU = 4
+
+// A configuration saturates the cluster once it reaches this fraction of the highest
+// throughput measured, so that more parallel loops or connections gain little.
+const saturation = 0.9
+
+// sweep measures the throughput for 1, 2, 4, ... up to maxParallel parallel loops and
+// 1, 2, 4, ... up to maxConns connections to every lock server, acquiring runs locks in
+// total per configuration, and prints a table along with the saturation point: the
+// configuration with the fewest loops (and then the fewest connections) reaching the
+// saturation fraction of the highest throughput.
+func sweep(maxParallel, maxConns, runs int, done *bool) {
+
+	var results []result
+	for _, conns := range steps(maxConns) {
+		for _, parallel := range steps(maxParallel) {
+			if *done {
+				break
+			}
+			perLoop := runs / parallel
+			if perLoop < 1 {
+				perLoop = 1
+			}
+			results = append(results, measure(parallel, conns, perLoop, done))
+		}
+	}
+
+	fmt.Println("")
+	fmt.Printf("%9s %6s %10s %10s %12s\n", "Parallel", "Conns", "Locks/sec", "Msgs/sec", "Worst delay")
+	best := result{}
+	for _, r := range results {
+		fmt.Printf("%9d %6d %10.0f %10.0f %10.3f s\n", r.parallel, r.conns, r.locksPerSec, r.msgsPerSec, r.delayMax)
+		if r.locksPerSec > best.locksPerSec {
+			best = r
+		}
+	}
+	if len(results) == 0 {
+		return
+	}
+
+	saturated := best
+	for _, r := range results {
+		if r.locksPerSec < saturation*best.locksPerSec {
+			continue
+		}
+		if r.parallel < saturated.parallel || r.parallel == saturated.parallel && r.conns < saturated.conns {
+			saturated = r
+		}
+	}
+	fmt.Println("")
+	fmt.Printf("Saturation point: parallel=%d conns=%d (%.0f locks/sec, %.0f%% of the highest) with GOMAXPROCS=%d NumCPU=%d\n",
+		saturated.parallel, saturated.conns, saturated.locksPerSec, 100*saturated.locksPerSec/best.locksPerSec, runtime.GOMAXPROCS(0), runtime.NumCPU())
+}
+
+// flagSet returns true when the flag with name has been passed on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// steps returns 1, 2, 4, ... up to max, including max itself.
+func steps(max int) []int {
+	var s []int
+	for i := 1; i < max; i *= 2 {
+		s = append(s, i)
+	}
+	return append(s, max)
+}
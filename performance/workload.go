@@ -0,0 +1,169 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/dsync"
+)
+
+// Time after which a lock of the workload is given up, counted as a timeout.
+const workloadTimeout = 10 * time.Second
+
+// workloadConfig - shape of the traffic generated by workload.
+type workloadConfig struct {
+	objects   int           // Distinct names, drawn from a Zipfian distribution
+	skew      float64       // Skew of the distribution, higher concentrates the locks on fewer names
+	writes    float64       // Fraction of the locks that are write locks
+	readHold  time.Duration // Mean time a read lock is held
+	writeHold time.Duration // Mean time a write lock is held
+}
+
+// kindResult - outcome of the read or the write locks of a workload.
+type kindResult struct {
+	delays   []time.Duration // Time to acquire every lock that was acquired
+	timeouts int
+}
+
+// add adds the outcome of another loop.
+func (k *kindResult) add(o kindResult) {
+	k.delays = append(k.delays, o.delays...)
+	k.timeouts += o.timeouts
+}
+
+// percentile returns the p-th percentile of the acquisition delays, 0 when there are none.
+// The delays must be sorted.
+func (k *kindResult) percentile(p float64) time.Duration {
+	if len(k.delays) == 0 {
+		return 0
+	}
+	return k.delays[int(p*float64(len(k.delays)-1))]
+}
+
+// workload runs parallel loops with conns connections to every lock server, each acquiring
+// runs locks modeled on the traffic of an object store: the names are drawn from a Zipfian
+// distribution over the objects (a few hot objects and a long tail), most locks are read
+// locks held briefly like for a GET, and the rest are write locks held longer like for a PUT,
+// with exponentially distributed hold times. The names are the same on all nodes, so that the
+// hot objects are contended cluster wide. It prints the throughput and the acquisition delays
+// of the read and the write locks.
+func workload(cfg workloadConfig, parallel, conns, runs int, done *bool) {
+	if cfg.skew <= 1 {
+		log.Fatalf("Skew of the workload must be greater than 1, got %v", cfg.skew)
+	}
+	if cfg.objects < 1 {
+		log.Fatalf("Workload needs at least one object, got %d", cfg.objects)
+	}
+	ds = cluster(conns)
+
+	// Start timing once the first lock is acquired, to account for the initial delay to start all nodes
+	var timeStart time.Time
+	var started sync.Once
+	var hottest int64 // Locks acquired on the hottest object
+	var mutex sync.Mutex
+	var reads, writes kindResult
+	wait := sync.WaitGroup{}
+	wait.Add(parallel)
+	for i := 0; i < parallel; i++ {
+		go func(nr int) {
+			defer wait.Done()
+			r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(*portFlag*parallel+nr)))
+			zipf := rand.NewZipf(r, cfg.skew, 1, uint64(cfg.objects-1))
+			var rs, ws kindResult
+			for run := 1; !*done && run <= runs; run++ {
+				object := zipf.Uint64()
+				dm := dsync.NewDRWMutex(fmt.Sprintf("object-%d", object), ds)
+				write := r.Float64() < cfg.writes
+
+				start := time.Now()
+				var ok bool
+				if write {
+					ok = dm.LockWithTimeout(workloadTimeout)
+				} else {
+					ok = dm.RLockWithTimeout(workloadTimeout)
+				}
+				delay := time.Since(start)
+				kind := &rs
+				if write {
+					kind = &ws
+				}
+				if !ok {
+					kind.timeouts++
+					continue
+				}
+				started.Do(func() { timeStart = time.Now() })
+				kind.delays = append(kind.delays, delay)
+				if object == 0 {
+					atomic.AddInt64(&hottest, 1)
+				}
+
+				hold := cfg.readHold
+				if write {
+					hold = cfg.writeHold
+				}
+				if hold > 0 {
+					time.Sleep(time.Duration(r.ExpFloat64() * float64(hold)))
+				}
+				if write {
+					dm.Unlock()
+				} else {
+					dm.RUnlock()
+				}
+				if run%100 == 0 {
+					fmt.Print(".")
+				}
+			}
+			mutex.Lock()
+			reads.add(rs)
+			writes.add(ws)
+			mutex.Unlock()
+		}(i)
+	}
+	wait.Wait()
+	elapsed := time.Since(timeStart)
+
+	locks := len(reads.delays) + len(writes.delays)
+	fmt.Println("")
+	fmt.Printf("%6s %8s %10s %10s %10s %10s %9s\n", "Kind", "Locks", "Locks/sec", "p50", "p99", "Max", "Timeouts")
+	for _, k := range []struct {
+		name string
+		kindResult
+	}{{"Read", reads}, {"Write", writes}} {
+		sort.Slice(k.delays, func(i, j int) bool { return k.delays[i] < k.delays[j] })
+		perSec := 0.0
+		if elapsed > 0 {
+			perSec = float64(len(k.delays)) / elapsed.Seconds()
+		}
+		fmt.Printf("%6s %8d %10.0f %10v %10v %10v %9d\n", k.name, len(k.delays), perSec,
+			k.percentile(0.5).Round(time.Microsecond), k.percentile(0.99).Round(time.Microsecond),
+			k.percentile(1).Round(time.Microsecond), k.timeouts)
+	}
+	fmt.Println("")
+	if locks > 0 {
+		fmt.Printf("Hottest object: %.1f%% of the locks\n", 100*float64(hottest)/float64(locks))
+	}
+	fmt.Printf("GOMAXPROCS=%d NumCPU=%d parallel=%d conns=%d objects=%d zipf=%v writes=%v read-hold=%v write-hold=%v\n",
+		runtime.GOMAXPROCS(0), runtime.NumCPU(), parallel, conns, cfg.objects, cfg.skew, cfg.writes, cfg.readHold, cfg.writeHold)
+}
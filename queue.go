@@ -0,0 +1,221 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	cryptorand "crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// QueueArgs - arguments for the queue RPCs.
+type QueueArgs struct {
+	AuthArgs
+	Queue      string        `json:"queue"`
+	ID         uint64        `json:"id,omitempty"`         // Job pushed, claimed or acknowledged
+	Payload    []byte        `json:"payload,omitempty"`    // Payload of the job pushed
+	UID        string        `json:"uid,omitempty"`        // Uid of the claim
+	Visibility time.Duration `json:"visibility,omitempty"` // Visibility timeout of the claim, zero releases the claim
+}
+
+// QueueReply - reply for the queue RPCs.
+type QueueReply struct {
+	Granted bool     `json:"granted"`           // Whether the job was pushed, claimed or acknowledged
+	Payload []byte   `json:"payload,omitempty"` // Payload of the job claimed
+	IDs     []uint64 `json:"ids,omitempty"`     // Jobs visible in the queue, in order of push
+}
+
+// Maximum number of rounds Queue.Claim contends for a job.
+const maxQueueRounds = 10
+
+// A Queue is a distributed work queue for coordinating background jobs among the nodes.
+//
+// Jobs are stored by the lock servers. A claimed job is invisible to other claimers until
+// its visibility timeout, enforced by the lock servers, has passed; so a job that is
+// not acknowledged in time, eg. because its claimer crashed, is handed out again. Jobs
+// are therefore delivered at least once. Like locks, all operations need a quorum of
+// the nodes.
+type Queue struct {
+	name string
+	ds   *Dsync
+}
+
+// NewQueue returns the queue with the given name, stored by the nodes of ds.
+func NewQueue(name string, ds *Dsync) *Queue {
+	return &Queue{name: name, ds: ds}
+}
+
+// Job - a job claimed from a queue, to be acknowledged once done.
+type Job struct {
+	Queue   string
+	ID      uint64 // Jobs are claimed in order of ID
+	Payload []byte
+	uid     string
+	ds      *Dsync
+}
+
+// Push adds a job with the given payload to q, returning its ID.
+func (q *Queue) Push(payload []byte) (uint64, error) {
+	id, err := q.ds.NextSequence("queue" + NamespaceSeparator + q.name)
+	if err != nil {
+		return 0, err
+	}
+	args := QueueArgs{Queue: q.name, ID: id, Payload: payload}
+	if _, err = q.ds.queueQuorum("Push", &args); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Claim claims the oldest job of q that is visible, hiding it from other claimers for
+// the visibility timeout. Returns a nil job when no job is available.
+func (q *Queue) Claim(visibility time.Duration) (*Job, error) {
+	if visibility <= 0 {
+		return nil, errors.New("Visibility timeout must be positive")
+	}
+
+	for round := 1; round <= maxQueueRounds; round++ {
+		ids, err := q.visible()
+		if err != nil || len(ids) == 0 {
+			return nil, err
+		}
+		for _, id := range ids {
+			if job := q.claim(id, visibility); job != nil {
+				return job, nil
+			}
+		}
+
+		// All jobs were claimed concurrently by other clients, look again after a
+		// randomized back-off (claims lost halfway may have been released meanwhile)
+		q.ds.clock().Sleep(time.Duration(q.ds.random().Float64() * float64(round) * float64(time.Millisecond)))
+	}
+	return nil, fmt.Errorf("Claim from queue %q remained contended for %d rounds", q.name, maxQueueRounds)
+}
+
+// visible returns the IDs of the jobs of q that are visible at a quorum of the nodes,
+// in order of ID.
+func (q *Queue) visible() ([]uint64, error) {
+	m := q.ds.membership()
+	replies, errs := q.ds.queueBroadcast(m, "List", func(int) *QueueArgs { return &QueueArgs{Queue: q.name} })
+	visible := make(map[uint64]int)
+	reached := 0
+	for _, index := range m.nodes() {
+		if errs[index] == nil {
+			reached++
+			for _, id := range replies[index].IDs {
+				visible[id]++
+			}
+		}
+	}
+	if reached < m.quorum {
+		return nil, fmt.Errorf("Claim from queue %q reached less than a quorum of %d nodes", q.name, m.quorum)
+	}
+	var ids []uint64
+	for id, count := range visible {
+		if count >= m.quorum {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// claim claims the job of q with the given id, returning nil when less than a quorum of
+// the nodes granted the claim (in which case the claims granted are released).
+func (q *Queue) claim(id uint64, visibility time.Duration) *Job {
+	bytesUid := [16]byte{}
+	cryptorand.Read(bytesUid[:])
+	args := QueueArgs{Queue: q.name, ID: id, UID: fmt.Sprintf("%X", bytesUid[:]), Visibility: visibility}
+	replies, err := q.ds.queueQuorum("Claim", &args)
+	if err == nil {
+		job := &Job{Queue: q.name, ID: id, uid: args.UID, ds: q.ds}
+		for _, r := range replies {
+			if r.Granted {
+				job.Payload = r.Payload
+				break
+			}
+		}
+		return job
+	}
+
+	release := args
+	release.Visibility = 0
+	q.ds.queueBroadcast(q.ds.membership(), "Claim", func(index int) *QueueArgs {
+		if index >= len(replies) || !replies[index].Granted {
+			return nil
+		}
+		return &release
+	})
+	return nil
+}
+
+// Ack acknowledges that the job is done, removing it from its queue. An error is
+// returned when the claim expired and the job was claimed by another client since.
+func (j *Job) Ack() error {
+	args := QueueArgs{Queue: j.Queue, ID: j.ID, UID: j.uid}
+	_, err := j.ds.queueQuorum("Ack", &args)
+	return err
+}
+
+// queueQuorum sends a queue RPC to all nodes, returning an error when less than
+// a quorum of them granted it.
+func (ds *Dsync) queueQuorum(operation string, args *QueueArgs) ([]QueueReply, error) {
+	m := ds.membership()
+	replies, errs := ds.queueBroadcast(m, operation, func(int) *QueueArgs {
+		a := *args // A copy per node, as RPC clients set the token of the arguments
+		return &a
+	})
+	granted := 0
+	var failed []string
+	for _, index := range m.nodes() {
+		if err := errs[index]; err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", m.node(index), err))
+		} else if replies[index].Granted {
+			granted++
+		}
+	}
+	if granted < m.quorum {
+		return replies, fmt.Errorf("%s of job %d of queue %q granted by less than a quorum of %d nodes (errors: %v)",
+			operation, args.ID, args.Queue, m.quorum, failed)
+	}
+	return replies, nil
+}
+
+// queueBroadcast sends the queue RPC "Dsync.Queue<operation>" with the arguments returned
+// by args (skipping nodes for which it returns nil) to the nodes of m and waits for all
+// replies, which are returned by the index of the node.
+func (ds *Dsync) queueBroadcast(m *members, operation string, args func(index int) *QueueArgs) ([]QueueReply, []error) {
+	replies := make([]QueueReply, len(m.clnts))
+	errs := make([]error, len(m.clnts))
+
+	nodes := m.nodes()
+	ch := make(chan int, len(nodes))
+	for _, index := range nodes {
+		go func(index int) {
+			if a := args(index); a != nil {
+				errs[index] = ds.call(index, "Dsync.Queue"+operation, a, &replies[index])
+			}
+			ch <- index
+		}(index)
+	}
+	for range nodes {
+		<-ch
+	}
+	return replies, errs
+}
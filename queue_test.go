@@ -0,0 +1,108 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+
+	q := NewQueue("test-queue", ds)
+	for _, payload := range []string{"a", "b"} {
+		if _, err := q.Push([]byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Jobs are claimed in order of push
+	job, err := q.Claim(50 * time.Millisecond)
+	if err != nil || job == nil || string(job.Payload) != "a" {
+		t.Fatalf("expected job a to be claimed, got %v (%v)", job, err)
+	}
+	job2, err := q.Claim(time.Minute)
+	if err != nil || job2 == nil || string(job2.Payload) != "b" {
+		t.Fatalf("expected job b to be claimed, got %v (%v)", job2, err)
+	}
+	if job3, err := q.Claim(time.Minute); err != nil || job3 != nil {
+		t.Fatalf("expected no job to be available, got %v (%v)", job3, err)
+	}
+	if err = job2.Ack(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Job that is not acknowledged in time is handed out again
+	time.Sleep(60 * time.Millisecond)
+	job3, err := q.Claim(time.Minute)
+	if err != nil || job3 == nil || job3.ID != job.ID {
+		t.Fatalf("expected job a to be claimed again, got %v (%v)", job3, err)
+	}
+	if err = job.Ack(); err == nil {
+		t.Fatal("expected acknowledgement of expired claim to fail")
+	}
+	if err = job3.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if job4, err := q.Claim(time.Minute); err != nil || job4 != nil {
+		t.Fatalf("expected queue to be empty, got %v (%v)", job4, err)
+	}
+}
+
+func TestQueueConcurrentClaims(t *testing.T) {
+
+	q := NewQueue("test-queue-concurrent", ds)
+	for i := 0; i < 20; i++ {
+		if _, err := q.Push(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mutex sync.Mutex
+	claimed := make(map[uint64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := q.Claim(time.Minute)
+				if err != nil {
+					t.Error(err)
+					return
+				} else if job == nil {
+					return
+				}
+				mutex.Lock()
+				if claimed[job.ID] {
+					t.Errorf("expected job %d to be claimed once", job.ID)
+				}
+				claimed[job.ID] = true
+				mutex.Unlock()
+				if err = job.Ack(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(claimed) != 20 {
+		t.Fatalf("expected all 20 jobs to be claimed, got %d", len(claimed))
+	}
+}
@@ -0,0 +1,40 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+// quorumFailureHandler wraps the handler of failed rounds (see SetQuorumFailureHandler).
+type quorumFailureHandler struct {
+	fn func(err *MultiNodeError)
+}
+
+// SetQuorumFailureHandler sets a function that is called for every round of a lock
+// acquisition from the lock servers of ds that does not reach the quorum, with the
+// outcome per node of the round, eg. to implement circuit breaking in the application
+// (such as switching to read-only mode after a number of consecutive failures) rather
+// than polling the metrics. Rounds of dry runs and rounds aborted because the caller
+// gave up are not reported. The handler is called synchronously from the acquisition,
+// so it should not block. Passing nil removes the handler.
+func (ds *Dsync) SetQuorumFailureHandler(fn func(err *MultiNodeError)) {
+	ds.quorumFailureHandler.Store(quorumFailureHandler{fn})
+}
+
+// quorumFailed passes a round that did not reach the quorum on to the handler.
+func (ds *Dsync) quorumFailed(err *MultiNodeError) {
+	if h, ok := ds.quorumFailureHandler.Load().(quorumFailureHandler); ok && h.fn != nil {
+		h.fn(err)
+	}
+}
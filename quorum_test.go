@@ -0,0 +1,87 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+)
+
+func TestQuorumFailureHandler(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	rds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A circuit breaker opening after three consecutive failed rounds
+	var mutex sync.Mutex
+	var failures []*MultiNodeError
+	consecutive, open := 0, false
+	rds.SetQuorumFailureHandler(func(err *MultiNodeError) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		failures = append(failures, err)
+		if consecutive++; consecutive >= 3 {
+			open = true
+		}
+	})
+
+	holder := NewDRWMutex("test-quorum-failure", rds)
+	holder.Lock()
+	if NewDRWMutex("test-quorum-failure", rds).LockWithTimeout(100 * time.Millisecond) {
+		t.Fatal("expected lock not to be acquired")
+	}
+
+	mutex.Lock()
+	if len(failures) < 3 || !open {
+		t.Fatalf("expected the circuit breaker to open after at least 3 failed rounds, got %d", len(failures))
+	}
+	for _, f := range failures {
+		if f.Operation != "Lock" || f.Name != "test-quorum-failure" || len(f.Results) != 4 {
+			t.Fatalf("expected the results of all 4 nodes for the write lock, got %+v", f)
+		}
+		if f.Count(OutcomeDenied) < 2 || f.Count(OutcomeGranted) > 2 {
+			t.Fatalf("expected a quorum of the nodes to deny the lock, got %v", f)
+		}
+	}
+	reported := len(failures)
+	mutex.Unlock()
+
+	// Dry runs are not reported, nor rounds once the handler is removed
+	if granted, _ := NewDRWMutex("test-quorum-failure", rds).DryRunLock(); granted {
+		t.Fatal("expected dry run not to be granted")
+	}
+	rds.SetQuorumFailureHandler(nil)
+	if NewDRWMutex("test-quorum-failure", rds).TryLock() {
+		t.Fatal("expected lock not to be acquired")
+	}
+	mutex.Lock()
+	if len(failures) != reported {
+		t.Fatalf("expected no more failed rounds to be reported, got %d", len(failures)-reported)
+	}
+	mutex.Unlock()
+	holder.Unlock()
+}
@@ -0,0 +1,69 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+)
+
+// Rand - source of randomness for the retry jitter of a Dsync (see Options.Rand), must be
+// safe for concurrent use.
+type Rand interface {
+	// Float64 returns a number in [0.0,1.0).
+	Float64() float64
+}
+
+// random returns the source of randomness of ds, see Options.Rand.
+func (ds *Dsync) random() Rand {
+	return ds.rand
+}
+
+type seededRand struct {
+	mutex sync.Mutex
+	rnd   *rand.Rand
+}
+
+// NewSeededRand returns a Rand that produces the same sequence for the same seed.
+// Unlike the top-level functions of math/rand it does not share state with the rest of the program.
+func NewSeededRand(seed int64) Rand {
+	return &seededRand{rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (s *seededRand) Float64() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rnd.Float64()
+}
+
+type cryptoRand struct{}
+
+// NewCryptoRand returns a Rand backed by crypto/rand, making the jitter unpredictable.
+func NewCryptoRand() Rand {
+	return cryptoRand{}
+}
+
+func (cryptoRand) Float64() float64 {
+	var b [8]byte
+	if _, err := cryptorand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	// Use the top 53 bits for a uniformly distributed float64 in [0.0,1.0)
+	return float64(binary.BigEndian.Uint64(b[:])>>11) / (1 << 53)
+}
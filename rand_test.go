@@ -0,0 +1,68 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"testing"
+	. "github.com/minio/dsync"
+)
+
+func TestSeededRand(t *testing.T) {
+
+	r1, r2 := NewSeededRand(42), NewSeededRand(42)
+	for i := 0; i < 100; i++ {
+		if f1, f2 := r1.Float64(), r2.Float64(); f1 != f2 {
+			t.Fatalf("same seed gave different sequences: %v != %v", f1, f2)
+		}
+	}
+}
+
+func TestCryptoRand(t *testing.T) {
+
+	r := NewCryptoRand()
+	for i := 0; i < 100; i++ {
+		if f := r.Float64(); f < 0.0 || f >= 1.0 {
+			t.Fatalf("%v out of range", f)
+		}
+	}
+}
+
+func TestRandPerInstance(t *testing.T) {
+
+	seeded, err := NewWithOptions([]RPC{newClient(nodes[0], rpcPaths[0])}, 0, Options{Rand: NewSeededRand(42)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewWithOptions([]RPC{newClient(nodes[0], rpcPaths[0])}, 0, Options{Rand: NewSeededRand(42)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drawing from one instance does not advance the sequence of another one
+	expected := NewSeededRand(42)
+	for i := 0; i < 10; i++ {
+		if f, e := seeded.Random().Float64(), expected.Float64(); f != e {
+			t.Fatalf("expected %v from the seeded instance, got %v", e, f)
+		}
+	}
+	if f, e := other.Random().Float64(), NewSeededRand(42).Float64(); f != e {
+		t.Fatalf("expected the other instance to start its own sequence with %v, got %v", e, f)
+	}
+	if ds.Random() == nil {
+		t.Fatal("expected a default source of randomness")
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SetReadCache enables caching of granted read locks for the given validity (zero
+// disables caching, which is the default).
+//
+// While cached, a read lock is kept at the lock servers after RUnlock, so that
+// subsequent RLocks of the same name from this process share it without any network
+// traffic. The read lock is released once the validity has passed, when Lock is called
+// for the same name from this process or when a lock server invalidates it on behalf
+// of a waiting writer (see InvalidateReadCache). Writers from other processes are thus
+// delayed by at most the validity, so keep it short.
+func (ds *Dsync) SetReadCache(validity time.Duration) {
+	atomic.StoreInt64(&ds.readCacheValidity, int64(validity))
+}
+
+type cachedRead struct {
+	locks   []string      // Uids of the nodes that granted the read lock
+	readers int           // Number of read locks from this process sharing it
+	invalid bool          // Set once expired or invalidated, no more readers will share it
+	done    chan struct{} // Closed once invalidated, stops waiting for the expiry
+}
+
+// cachedRLock returns the locks of a valid cached read lock on name, registering
+// another reader for it.
+func (ds *Dsync) cachedRLock(name string) ([]string, bool) {
+	ds.readCacheMutex.Lock()
+	defer ds.readCacheMutex.Unlock()
+	c, ok := ds.readCache[name]
+	if !ok || c.invalid {
+		return nil, false
+	}
+	c.readers++
+	return c.locks, true
+}
+
+// cacheRLock caches the read lock that has just been granted on name, unless a cached
+// read lock is still around for name.
+func (ds *Dsync) cacheRLock(name string, locks []string) {
+	validity := time.Duration(atomic.LoadInt64(&ds.readCacheValidity))
+	if validity == 0 {
+		return
+	}
+	ds.readCacheMutex.Lock()
+	defer ds.readCacheMutex.Unlock()
+	if _, ok := ds.readCache[name]; ok {
+		return
+	}
+	c := &cachedRead{locks: append([]string(nil), locks...), readers: 1, done: make(chan struct{})}
+	ds.readCache[name] = c
+	expired := ds.clock().After(validity) // Taken here, so that a *FakeClock sees the timer right away
+	ds.goBackground(func() {
+		select {
+		case <-expired:
+			ds.invalidate(name, c)
+		case <-c.done:
+		case <-ds.closed:
+		}
+	})
+}
+
+// cachedRUnlock returns true when locks belong to a cached read lock, in which case
+// the read lock is only released when it is no longer valid and this was the last reader.
+func (ds *Dsync) cachedRUnlock(name string, locks []string) bool {
+	ds.readCacheMutex.Lock()
+	c, ok := ds.readCache[name]
+	if !ok || !sameLocks(c.locks, locks) {
+		ds.readCacheMutex.Unlock()
+		return false
+	}
+	c.readers--
+	release := c.invalid && c.readers == 0
+	if release {
+		delete(ds.readCache, name)
+	}
+	ds.readCacheMutex.Unlock()
+
+	if release {
+		ds.unlock(c.locks, name, true)
+	}
+	return true
+}
+
+// InvalidateReadCache stops sharing the cached read lock on name (if any) and releases
+// it as soon as it is no longer in use. To be called by the lock server of this node
+// when a writer is waiting for the read lock, see the Invalidate RPC and Options.Client of
+// package lockserver.
+func (ds *Dsync) InvalidateReadCache(name string) {
+	ds.readCacheMutex.Lock()
+	c, ok := ds.readCache[name]
+	ds.readCacheMutex.Unlock()
+	if ok {
+		ds.invalidate(name, c)
+	}
+}
+
+// invalidate invalidates the cached read lock c on name, releasing it when not in use.
+func (ds *Dsync) invalidate(name string, c *cachedRead) {
+	ds.readCacheMutex.Lock()
+	if !c.invalid {
+		c.invalid = true
+		close(c.done)
+	}
+	release := c.readers == 0 && ds.readCache[name] == c
+	if release {
+		delete(ds.readCache, name)
+	}
+	ds.readCacheMutex.Unlock()
+
+	if release {
+		ds.unlock(c.locks, name, true)
+	}
+}
+
+// cachedLocks returns true when locks belong to the cached read lock on name.
+func (ds *Dsync) cachedLocks(name string, locks []string) bool {
+	ds.readCacheMutex.Lock()
+	defer ds.readCacheMutex.Unlock()
+	c, ok := ds.readCache[name]
+	return ok && sameLocks(c.locks, locks)
+}
+
+// dropReadCache forgets the cached read lock on name (if any) without releasing it.
+func (ds *Dsync) dropReadCache(name string) {
+	ds.readCacheMutex.Lock()
+	defer ds.readCacheMutex.Unlock()
+	delete(ds.readCache, name)
+}
+
+func sameLocks(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
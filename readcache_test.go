@@ -0,0 +1,126 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadCache(t *testing.T) {
+
+	var calls int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && a.Name == "test-read-cache" &&
+			(serviceMethod == "Dsync.RLock" || serviceMethod == "Dsync.RUnlock") {
+			atomic.AddInt64(&calls, 1)
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	ds.SetReadCache(time.Hour)
+	defer ds.SetReadCache(0)
+
+	dm := NewDRWMutex("test-read-cache", ds)
+	dm.RLock()
+	dm.RUnlock()
+	if c := atomic.LoadInt64(&calls); c != int64(N) {
+		t.Fatalf("expected %d calls for first read lock, got %d", N, c)
+	}
+
+	// Read locks are shared with the cached read lock without any network traffic
+	for i := 0; i < 10; i++ {
+		dm.RLock()
+		dm.RUnlock()
+	}
+	if c := atomic.LoadInt64(&calls); c != int64(N) {
+		t.Fatalf("expected no calls for cached read locks, got %d", c-int64(N))
+	}
+
+	// Write lock from this process invalidates (and releases) the cached read lock
+	dm.Lock()
+	dm.Unlock()
+}
+
+func TestReadCacheExpiry(t *testing.T) {
+
+	ds.SetReadCache(50 * time.Millisecond)
+	defer ds.SetReadCache(0)
+
+	dm := NewDRWMutex("test-read-cache-expiry", ds)
+	dm.RLock()
+	dm.RUnlock()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		held := false
+		for _, s := range ds.Snapshots() {
+			for _, e := range s.Entries {
+				held = held || e.Name == dm.Name
+			}
+		}
+		if !held {
+			return
+		}
+	}
+	t.Fatal("expected cached read lock to be released after its validity")
+}
+
+func TestReadCacheFakeClock(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	fc := NewFakeClock(time.Now())
+	cds, err := NewWithOptions(clnts, 0, Options{Clock: fc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cds.Close()
+	cds.SetReadCache(50 * time.Millisecond)
+
+	held := func() bool {
+		for _, s := range cds.Snapshots() {
+			for _, e := range s.Entries {
+				if e.Name == "test-read-cache-clock" {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	dm := NewDRWMutex("test-read-cache-clock", cds)
+	dm.RLock()
+	dm.RUnlock()
+
+	// The validity is measured with the clock of cds, not the wall clock
+	time.Sleep(100 * time.Millisecond)
+	if !held() {
+		t.Fatal("expected cached read lock to be kept until the clock passed its validity")
+	}
+	fc.Advance(50 * time.Millisecond)
+	for deadline := time.Now().Add(5 * time.Second); held(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected cached read lock to be released once the clock passed its validity")
+		}
+	}
+}
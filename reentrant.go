@@ -0,0 +1,62 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+// MutexOption - option configuring a DRWMutex, see NewDRWMutex.
+type MutexOption func(dm *DRWMutex)
+
+// Reentrant makes the write lock of a DRWMutex reentrant: while the write lock is
+// held, Lock (and its variants) re-acquires it right away instead of blocking, and
+// the lock is only released by the Unlock matching the outermost Lock, so that nested
+// Lock/Unlock pairs work.
+//
+// The owner of the lock is identified by the UID granted to dm, so that the lock is
+// re-entered from any goroutine locking the same DRWMutex while it is held: share a
+// reentrant DRWMutex between goroutines only when they act as a single owner. Read
+// locks are not affected, as RLock already grants another read lock while held.
+func Reentrant() MutexOption {
+	return func(dm *DRWMutex) {
+		dm.reentrant = true
+	}
+}
+
+// reenter re-acquires the write lock when dm is reentrant and holds it, returning
+// false when the lock is to be acquired from the nodes instead.
+func (dm *DRWMutex) reenter() bool {
+	if !dm.reentrant {
+		return false
+	}
+	dm.m.Lock()
+	defer dm.m.Unlock()
+	if !isLocked(firstLock(dm.writeLocks)) {
+		return false
+	}
+	dm.holds++
+	return true
+}
+
+// leave releases a nested write lock held on dm, returning false when the lock is
+// to be released at the nodes instead.
+func (dm *DRWMutex) leave() bool {
+	dm.m.Lock()
+	defer dm.m.Unlock()
+	if dm.holds == 0 {
+		return false
+	}
+	dm.holds--
+	return true
+}
@@ -0,0 +1,65 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/minio/dsync"
+)
+
+func TestReentrant(t *testing.T) {
+
+	dm := NewDRWMutex("test-reentrant", ds, Reentrant())
+	other := NewDRWMutex("test-reentrant", ds)
+
+	// Nested locks are granted right away while the lock is held
+	dm.Lock()
+	if !dm.TryLock() {
+		t.Fatal("expected nested TryLock to succeed")
+	}
+	if !dm.LockWithTimeout(10 * time.Millisecond) {
+		t.Fatal("expected nested LockWithTimeout to succeed")
+	}
+
+	// The lock is only released by the outermost Unlock
+	dm.Unlock()
+	if err := <-dm.UnlockAsync(); err != nil {
+		t.Fatalf("expected nested UnlockAsync to succeed, got %v", err)
+	}
+	if other.TryLock() {
+		t.Fatal("expected lock to be held until the outermost Unlock")
+	}
+	dm.Unlock()
+	if !other.LockWithTimeout(time.Second) {
+		t.Fatal("expected lock to be released by the outermost Unlock")
+	}
+
+	// The lock is only re-entered by its holder
+	if dm.TryLock() {
+		t.Fatal("expected TryLock to fail while the lock is held by another mutex")
+	}
+	other.Unlock()
+
+	// Without the option a mutex is not reentrant
+	other.Lock()
+	if other.LockWithTimeout(100 * time.Millisecond) {
+		t.Fatal("expected nested lock to fail without Reentrant")
+	}
+	other.Unlock()
+}
@@ -0,0 +1,333 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Back-off between the retries of a release, the last one repeating until the release expires.
+var releaseBackOffs = []time.Duration{
+	30 * time.Second, // 30secs.
+	1 * time.Minute,  // 1min.
+	3 * time.Minute,  // 3min.
+	10 * time.Minute, // 10min.
+	30 * time.Minute, // 30min.
+	1 * time.Hour,    // 1hr.
+}
+
+// Default time after which a release that could not be delivered is given up on. By then
+// lock maintenance at the lock server has long since removed the lock as stale.
+const defaultReleaseMaxAge = 24 * time.Hour
+
+// Default maximum number of releases the release worker retries at once.
+const defaultMaxPendingReleases = 10000
+
+// ReleaseOverflow - what happens to a failed release while the maximum number of releases
+// is pending, see SetReleaseLimits.
+type ReleaseOverflow int
+
+const (
+	// ReleaseDrop drops the release and logs it, leaving the lock to expire or to be
+	// removed as stale by lock maintenance at the lock server.
+	ReleaseDrop ReleaseOverflow = iota
+	// ReleaseBlock blocks the goroutine delivering the release until another pending
+	// release is done, so that every release is retried at the cost of the goroutines
+	// waiting meanwhile.
+	ReleaseBlock
+)
+
+type releaseLimits struct {
+	maxPending int
+	maxAge     time.Duration
+	overflow   ReleaseOverflow
+}
+
+// newReleaseLimits returns the limits of the releases pending, applying the defaults
+// for the limits left zero.
+func newReleaseLimits(maxPending int, maxAge time.Duration, overflow ReleaseOverflow) releaseLimits {
+	if maxPending <= 0 {
+		maxPending = defaultMaxPendingReleases
+	}
+	if maxAge <= 0 {
+		maxAge = defaultReleaseMaxAge
+	}
+	return releaseLimits{maxPending, maxAge, overflow}
+}
+
+// SetReleaseLimits bounds the releases the release worker of ds retries, so that its
+// memory does not grow without bounds while nodes are unreachable for a long time: at
+// most maxPending releases are pending at once (10000 by default), and a release is given
+// up on once maxAge has passed since its first attempt (a day by default). Zero restores
+// the default. A failed release arriving while maxPending releases are pending is handled
+// according to overflow. The releases pending, dropped and expired are reported by Debug.
+// The limits can also be set when initializing ds, see Options.
+func (ds *Dsync) SetReleaseLimits(maxPending int, maxAge time.Duration, overflow ReleaseOverflow) {
+	q := ds.releases
+	q.limits.Store(newReleaseLimits(maxPending, maxAge, overflow))
+
+	// Let blocked releases check for room again
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.room.Broadcast()
+}
+
+// pendingRelease - release of a lock at a single node that still has to be delivered.
+type pendingRelease struct {
+	ds         *Dsync
+	index      int
+	name       string
+	uid        string // Empty for a force unlock
+	isReadLock bool
+	since      time.Time // Time of the first attempt
+	attempts   int       // Number of retries so far
+	next       time.Time // Time of the next retry
+	admitted   bool      // Set once counted as pending, see retryRelease
+}
+
+// deliver sends the release to the node.
+func (r *pendingRelease) deliver() error {
+
+	// Just send name & uid (and leave out node and rpcPath; unimportant for unlocks)
+	serviceMethod := "Dsync.Unlock"
+	if len(r.uid) == 0 {
+		serviceMethod = "Dsync.ForceUnlock"
+	} else if r.isReadLock {
+		serviceMethod = "Dsync.RUnlock"
+	}
+
+	// All client methods issuing RPCs are thread-safe and goroutine-safe,
+	// i.e. it is safe to call them from multiple concurrently running goroutines.
+	args := LockArgs{Name: r.name, UID: r.uid}
+	if len(r.uid) > 0 {
+		args.Mode = ModeOf(!r.isReadLock)
+	}
+	var resp LockResp
+	err := r.ds.call(r.index, serviceMethod, &args, &resp)
+	if err != nil {
+		r.ds.logMessage(dsyncLog, LevelDebug, "Unable to call "+serviceMethod, Fields{"name": r.name, "node": r.ds.membership().node(r.index), "error": err})
+	}
+	return err
+}
+
+// retryable returns whether the release is to be retried after it failed with err.
+func (r *pendingRelease) retryable(err error) bool {
+	if err == errNodeRemoved {
+		// Node is no longer a member (see RemoveNode), so there is nothing to release
+		return false
+	}
+	if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+		// Release possibly failed with server timestamp mismatch, server may have restarted.
+		return false
+	}
+	return !r.expired(r.ds.clock().Now())
+}
+
+// expired returns whether the release is to be given up on because of its age.
+func (r *pendingRelease) expired(now time.Time) bool {
+	return now.Sub(r.since) >= r.ds.limitsOfReleases().maxAge
+}
+
+// releaseQueue - releases of a Dsync its release worker retries. The release worker is
+// started by New and runs until the Dsync is closed.
+type releaseQueue struct {
+	// Number of releases dropped because the maximum number of releases was pending, and
+	// given up on because of their age, since start. First for 64-bit alignment.
+	dropped, expired int64
+
+	goroutines int64 // Releases currently being delivered or retried, see Debug
+
+	limits atomic.Value // Limits of the releases pending (a releaseLimits), see SetReleaseLimits
+
+	mutex    sync.Mutex        // Protects the fields below
+	room     *sync.Cond        // Signaled when a pending release is done, for releases blocked by ReleaseBlock
+	admitted int               // Releases pending, both waiting for and being retried by the release worker
+	pending  []*pendingRelease // Releases the release worker retries
+	closed   bool              // Set by Close, releases failing afterwards are given up on
+	wake     chan struct{}     // Wakes up the release worker when a release is added while it sleeps
+	stop     chan struct{}     // Closed by Close to stop the release worker
+	stopped  chan struct{}     // Closed once the release worker stopped
+}
+
+// newReleaseQueue returns an empty releaseQueue with the limits given.
+func newReleaseQueue(limits releaseLimits) *releaseQueue {
+	q := &releaseQueue{
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	q.room = sync.NewCond(&q.mutex)
+	q.limits.Store(limits)
+	return q
+}
+
+// limitsOfReleases returns the limits of the releases pending at ds.
+func (ds *Dsync) limitsOfReleases() releaseLimits {
+	return ds.releases.limits.Load().(releaseLimits)
+}
+
+// retryRelease hands a failed release to the release worker, which owns all retries
+// and keeps retrying the release until it is acknowledged or expires. A new release is
+// dropped (or waits, see ReleaseBlock) while the maximum number of releases is pending,
+// and once ds is closed.
+func (ds *Dsync) retryRelease(r *pendingRelease) {
+	backOff := releaseBackOffs[len(releaseBackOffs)-1]
+	if r.attempts < len(releaseBackOffs) {
+		backOff = releaseBackOffs[r.attempts]
+	}
+	r.attempts++
+
+	q := ds.releases
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for !r.admitted {
+		limits := ds.limitsOfReleases()
+		if q.closed {
+			atomic.AddInt64(&q.goroutines, -1)
+			ds.logMessage(dsyncLog, LevelWarn, "Giving up on release", Fields{"name": r.name, "node": ds.membership().node(r.index), "error": "closed"})
+			return
+		} else if q.admitted < limits.maxPending {
+			q.admitted++
+			r.admitted = true
+		} else if limits.overflow == ReleaseBlock {
+			q.room.Wait()
+		} else {
+			atomic.AddInt64(&q.dropped, 1)
+			atomic.AddInt64(&q.goroutines, -1)
+			ds.logMessage(true, LevelWarn, "Dropping release", Fields{"name": r.name, "node": ds.membership().node(r.index), "pending": q.admitted})
+			return
+		}
+	}
+	if q.closed {
+		// Closed while retried by the release worker
+		q.releaseDone()
+		ds.logMessage(dsyncLog, LevelWarn, "Giving up on release", Fields{"name": r.name, "node": ds.membership().node(r.index), "error": "closed"})
+		return
+	}
+	r.next = ds.clock().Now().Add(backOff)
+	q.pending = append(q.pending, r)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// releaseWorker retries the pending releases of ds that are due, sleeping until the next
+// one is due in between, until ds is closed.
+func (ds *Dsync) releaseWorker() {
+	q := ds.releases
+	defer close(q.stopped)
+	for {
+		q.mutex.Lock()
+		now := ds.clock().Now()
+		var due []*pendingRelease
+		next := time.Time{}
+		kept := q.pending[:0]
+		for _, r := range q.pending {
+			if r.expired(now) {
+				// Given up on without waiting for its next retry
+				atomic.AddInt64(&q.expired, 1)
+				ds.logMessage(dsyncLog, LevelWarn, "Giving up on release", Fields{"name": r.name, "node": ds.membership().node(r.index), "error": "expired"})
+				q.releaseDone()
+				continue
+			}
+			if !r.next.After(now) {
+				due = append(due, r)
+				continue
+			}
+			kept = append(kept, r)
+			if next.IsZero() || r.next.Before(next) {
+				next = r.next
+			}
+		}
+		q.pending = kept
+		q.mutex.Unlock()
+
+		if len(due) == 0 {
+			// Without releases pending, sleep until one is added
+			var timer <-chan time.Time
+			if !next.IsZero() {
+				timer = ds.clock().After(next.Sub(now))
+			}
+			select {
+			case <-timer:
+			case <-q.wake:
+			case <-q.stop:
+				return
+			}
+			continue
+		}
+		for _, r := range due {
+			err := r.deliver()
+			if err != nil && r.retryable(err) {
+				ds.retryRelease(r)
+				continue
+			}
+			if err != nil && r.expired(ds.clock().Now()) {
+				atomic.AddInt64(&q.expired, 1)
+			}
+			if err != nil {
+				ds.logMessage(dsyncLog, LevelWarn, "Giving up on release", Fields{"name": r.name, "node": ds.membership().node(r.index), "error": err})
+			}
+			q.mutex.Lock()
+			q.releaseDone()
+			q.mutex.Unlock()
+		}
+	}
+}
+
+// releaseDone accounts for a pending release that is done, making room for another one.
+// The caller must hold q.mutex.
+func (q *releaseQueue) releaseDone() {
+	q.admitted--
+	q.room.Signal()
+	atomic.AddInt64(&q.goroutines, -1)
+}
+
+// close stops the release worker, giving up on the releases pending, and waits for it
+// to stop. Releases waiting for room (see ReleaseBlock) are given up on as well.
+func (q *releaseQueue) close() {
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		<-q.stopped
+		return
+	}
+	q.closed = true
+	close(q.stop)
+	q.room.Broadcast()
+	q.mutex.Unlock()
+	<-q.stopped
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, r := range q.pending {
+		r.ds.logMessage(dsyncLog, LevelWarn, "Giving up on release", Fields{"name": r.name, "node": r.ds.membership().node(r.index), "error": "closed"})
+		q.releaseDone()
+	}
+	q.pending = nil
+}
+
+// pendingReleaseCount returns the number of releases pending.
+func (q *releaseQueue) pendingReleaseCount() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.admitted
+}
@@ -0,0 +1,188 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"errors"
+	. "github.com/minio/dsync"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReleaseWorker(t *testing.T) {
+
+	var failing, attempts, delivered int64
+	atomic.StoreInt64(&failing, 1)
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && a.Name == "test-release-worker" && serviceMethod == "Dsync.Unlock" && c.Node() == nodes[N-1] {
+			atomic.AddInt64(&attempts, 1)
+			if atomic.LoadInt64(&failing) == 1 {
+				return errors.New("unreachable")
+			}
+			defer atomic.AddInt64(&delivered, 1)
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	dm := NewDRWMutex("test-release-worker", ds)
+	dm.Lock()
+	fc := NewFakeClock(time.Now())
+	ds.SetClock(fc)
+	defer ds.SetClock(nil)
+	dm.Unlock()
+
+	// Retried beyond the initial back-off schedule, as long as the release has not expired
+	for i := 0; atomic.LoadInt64(&attempts) < 10; i++ {
+		if i == 500 {
+			t.Fatalf("expected release to be retried, got %d attempts", atomic.LoadInt64(&attempts))
+		}
+		fc.Advance(time.Hour)
+		time.Sleep(5 * time.Millisecond)
+	}
+	atomic.StoreInt64(&failing, 0)
+	for i := 0; atomic.LoadInt64(&delivered) == 0; i++ {
+		if i == 500 {
+			t.Fatal("expected release to be delivered")
+		}
+		fc.Advance(time.Hour)
+		time.Sleep(5 * time.Millisecond)
+	}
+	ds.SetClock(nil)
+
+	dm.Lock()
+	dm.Unlock()
+}
+
+func TestReleaseLimits(t *testing.T) {
+
+	var failing int64
+	atomic.StoreInt64(&failing, 1)
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && strings.HasPrefix(a.Name, "test-release-limits") && serviceMethod == "Dsync.Unlock" && c.Node() == nodes[N-1] {
+			if atomic.LoadInt64(&failing) == 1 {
+				return errors.New("unreachable")
+			}
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+	defer ds.SetReleaseLimits(0, 0, ReleaseDrop)
+
+	fc := NewFakeClock(time.Now())
+	ds.SetClock(fc)
+	defer ds.SetClock(nil)
+
+	waitFor := func(what string, cond func(d DebugInfo) bool) {
+		for i := 0; !cond(ds.Debug()); i++ {
+			if i == 500 {
+				t.Fatalf("expected %s, got %+v", what, ds.Debug())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// Releases beyond the maximum are dropped
+	before := ds.Debug()
+	ds.SetReleaseLimits(int(before.Pending)+1, 2*time.Hour, ReleaseDrop)
+	first, second := NewDRWMutex("test-release-limits-1", ds), NewDRWMutex("test-release-limits-2", ds)
+	first.Lock()
+	second.Lock()
+	first.Unlock()
+	waitFor("first release to be pending", func(d DebugInfo) bool { return d.Pending == before.Pending+1 })
+	second.Unlock()
+	waitFor("second release to be dropped", func(d DebugInfo) bool { return d.Dropped == before.Dropped+1 })
+
+	// Releases are given up on once they are older than the maximum age
+	fc.Advance(3 * time.Hour)
+	waitFor("first release to expire", func(d DebugInfo) bool { return d.Expired > before.Expired && d.Pending <= before.Pending })
+	atomic.StoreInt64(&failing, 0)
+	first.ForceUnlock()
+	second.ForceUnlock()
+
+	// Releases beyond the maximum wait for room instead when blocking
+	atomic.StoreInt64(&failing, 1)
+	before = ds.Debug()
+	ds.SetReleaseLimits(int(before.Pending)+1, 0, ReleaseBlock)
+	first, second = NewDRWMutex("test-release-limits-3", ds), NewDRWMutex("test-release-limits-4", ds)
+	first.Lock()
+	second.Lock()
+	first.Unlock()
+	waitFor("first release to be pending", func(d DebugInfo) bool { return d.Pending == before.Pending+1 })
+	second.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	if d := ds.Debug(); d.Dropped != before.Dropped || d.Pending != before.Pending+1 {
+		t.Fatalf("expected second release to wait, got %+v", d)
+	}
+
+	atomic.StoreInt64(&failing, 0)
+	for i := 0; ds.Debug().Pending > before.Pending; i++ {
+		if i == 500 {
+			t.Fatalf("expected releases to be delivered, got %+v", ds.Debug())
+		}
+		fc.Advance(time.Minute)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if d := ds.Debug(); d.Dropped != before.Dropped {
+		t.Fatalf("expected no release to be dropped while blocking, got %+v", d)
+	}
+}
+
+func TestReleaseWorkerClose(t *testing.T) {
+
+	var clnts []RPC
+	for i := range nodes {
+		clnts = append(clnts, newClient(nodes[i], rpcPaths[i]))
+	}
+	closing, err := NewWithOptions(clnts, 0, Options{Interceptors: []Interceptor{
+		func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+			if a, ok := args.(*LockArgs); ok && a.Name == "test-release-close" && serviceMethod == "Dsync.Unlock" && c.Node() == nodes[N-1] {
+				return errors.New("unreachable")
+			}
+			return invoke(c, serviceMethod, args, reply)
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := ds.Debug()
+
+	dm := NewDRWMutex("test-release-close", closing)
+	dm.Lock()
+	dm.Unlock()
+	for i := 0; closing.Debug().Pending != 1; i++ {
+		if i == 500 {
+			t.Fatalf("expected release to be pending, got %+v", closing.Debug())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if d := ds.Debug(); d.Pending != before.Pending {
+		t.Fatalf("expected release to be pending at its own instance only, got %+v", d)
+	}
+
+	// Closing gives up on the releases pending
+	closing.Close()
+	if d := closing.Debug(); d.Pending != 0 {
+		t.Fatalf("expected no release to be pending once closed, got %+v", d)
+	}
+	closing.Close()
+
+	// Remove the lock left at the last node
+	NewDRWMutex("test-release-close", ds).ForceUnlock()
+}
@@ -0,0 +1,90 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import "sync/atomic"
+
+// SetReplication places every lock on a subset of r nodes (selected by a consistent
+// hash ring with virtual nodes) instead of on all nodes, with the quorum taken over those r nodes: r/2+1 for
+// write locks and r/2 (rounded up) for read locks. Large clusters thus scale their lock
+// throughput horizontally, as a lock no longer involves every node. Passing 0 (or the
+// number of nodes) places locks on all nodes again, which is the default.
+//
+// The ring is built from the addresses the nodes had when they became members, so that
+// moving a node to a new address later on (see ReplaceNode) does not move its locks.
+// All processes must use the same replication factor and addresses, and change the
+// replication factor only while no locks are held. It cannot be combined with
+// SetLocalReads: a *ConfigError is returned while local reads are enabled. Nodes added or removed later on (see AddNode and RemoveNode) join or
+// leave the ring, moving only a share of the names.
+//
+// Since the own node is not necessarily among the nodes a lock is placed on, lock servers
+// check back with the holder of a lock during lock maintenance (see HoldsLock) instead of
+// relying on the own node holding it as well.
+func (ds *Dsync) SetReplication(r int) error {
+	m := ds.membership()
+	if r < 0 || r > m.count {
+		return &ConfigError{"Replication factor is out of range"}
+	}
+	if r == m.count {
+		r = 0
+	}
+	ds.protocolMutex.Lock()
+	defer ds.protocolMutex.Unlock()
+	if r > 0 && ds.localReadsEnabled() {
+		return &ConfigError{"Replication cannot be combined with local reads"}
+	}
+	atomic.StoreInt32(&ds.replicationFactor, int32(r))
+	return nil
+}
+
+// replicaCount returns the number of the nodes of m every lock is placed on.
+func (ds *Dsync) replicaCount(m *members) int {
+	if r := int(atomic.LoadInt32(&ds.replicationFactor)); r > 0 && r < m.count {
+		return r
+	}
+	return m.count
+}
+
+// replicaNodes returns the indices of the nodes of m the lock on name is placed on: all
+// nodes, or as many nodes as the replication factor as selected by the hash ring.
+func (ds *Dsync) replicaNodes(m *members, name string) []int {
+	if replicas := ds.replicaCount(m); replicas < m.count {
+		return m.ring.replicas(name, replicas)
+	}
+	return m.nodes()
+}
+
+// Placement returns the addresses of the nodes the lock on name is placed on, eg. to
+// inspect the placement of names when a replication factor is set.
+func (ds *Dsync) Placement(name string) []string {
+	m := ds.membership()
+	var nodes []string
+	for _, index := range ds.replicaNodes(m, name) {
+		nodes = append(nodes, m.node(index))
+	}
+	return nodes
+}
+
+// isReplica returns true when index is among nodes.
+func isReplica(nodes []int, index int) bool {
+	for _, n := range nodes {
+		if n == index {
+			return true
+		}
+	}
+	return false
+}
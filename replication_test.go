@@ -0,0 +1,114 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	"fmt"
+	. "github.com/minio/dsync"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplication(t *testing.T) {
+
+	if err := ds.SetReplication(3); err != nil {
+		t.Fatal(err)
+	}
+	defer ds.SetReplication(0)
+
+	// Pick a name that is not placed on the own node
+	var name string
+	var replicas []string
+	for i := 0; name == ""; i++ {
+		candidate := fmt.Sprintf("test-replication-%d", i)
+		replicas = nil
+		for _, index := range ds.ReplicaNodes(candidate) {
+			replicas = append(replicas, nodes[index])
+		}
+		if len(replicas) != 3 {
+			t.Fatalf("expected lock to be placed on 3 nodes, got %v", replicas)
+		}
+		onOwnNode := false
+		for _, node := range replicas {
+			onOwnNode = onOwnNode || node == nodes[0]
+		}
+		if !onOwnNode {
+			name = candidate
+		}
+	}
+	sort.Strings(replicas)
+
+	var mutex sync.Mutex
+	called := make(map[string]bool)
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && a.Name == name && serviceMethod == "Dsync.Lock" {
+			mutex.Lock()
+			called[c.Node()] = true
+			mutex.Unlock()
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	dm1 := NewDRWMutex(name, ds)
+	dm1.Lock()
+
+	mutex.Lock()
+	var contacted []string
+	for node := range called {
+		contacted = append(contacted, node)
+	}
+	mutex.Unlock()
+	sort.Strings(contacted)
+	if fmt.Sprint(contacted) != fmt.Sprint(replicas) {
+		t.Fatalf("expected lock requests to go to %v only, got %v", replicas, contacted)
+	}
+
+	// Mutual exclusion holds with the quorum over the replicas
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	dm2 := NewDRWMutex(name, ds)
+	if dm2.LockContext(ctx) {
+		t.Fatal("expected second lock not to be acquired while the first one is held")
+	}
+	dm1.Unlock()
+	dm2.Lock()
+	dm2.Unlock()
+
+	if err := ds.SetReplication(N + 1); err == nil {
+		t.Fatal("expected error for replication factor beyond the number of nodes")
+	}
+}
+
+func TestReplicationLocalReads(t *testing.T) {
+
+	if err := ds.SetLocalReads(true); err != nil {
+		t.Fatal(err)
+	}
+	defer ds.SetLocalReads(false)
+
+	if _, ok := ds.SetReplication(3).(*ConfigError); !ok {
+		t.Fatal("expected replication to be refused while local reads are enabled")
+	}
+	// Placing locks on all nodes again is fine
+	if err := ds.SetReplication(0); err != nil {
+		t.Fatal(err)
+	}
+}
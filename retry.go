@@ -0,0 +1,134 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"time"
+)
+
+// Defaults of the fields of a RetryPolicy left zero.
+const (
+	DefaultRetryInitialDelay = time.Millisecond
+	DefaultRetryMaxDelay     = time.Second
+)
+
+// defaultRetryPolicy is the retry policy of acquisitions without one (see SetRetryPolicy).
+// The back-off is randomized entirely ("full jitter"), so that clients contending for the
+// same lock spread their rounds instead of retrying in waves, which would keep splitting
+// the grants among them such that none of them reaches a quorum.
+var defaultRetryPolicy = RetryPolicy{Jitter: 1}
+
+// RetryPolicy - timing of the rounds of a lock acquisition, see SetRetryPolicy and
+// WithRetryPolicy. After every failed round the acquisition backs off before the next
+// round, doubling the back-off from InitialDelay up to MaxDelay.
+type RetryPolicy struct {
+	InitialDelay time.Duration // Back-off after the first failed round, DefaultRetryInitialDelay when zero
+	MaxDelay     time.Duration // Maximum back-off, DefaultRetryMaxDelay when zero
+	Jitter       float64       // Fraction of the back-off that is randomized, from 0 (none) to 1 (all of it)
+	MaxAttempts  int           // Maximum number of rounds, zero for no maximum (see SetRetryPolicy)
+}
+
+// Validate returns a *ConfigError when a field of p is out of range.
+func (p RetryPolicy) Validate() error {
+	switch {
+	case p.InitialDelay < 0 || p.MaxDelay < 0:
+		return &ConfigError{"Retry delays cannot be negative"}
+	case p.initialDelay() > p.maxDelay():
+		return &ConfigError{"Initial retry delay exceeds the maximum delay"}
+	case p.Jitter < 0 || p.Jitter > 1:
+		return &ConfigError{"Retry jitter is out of range"}
+	case p.MaxAttempts < 0:
+		return &ConfigError{"Maximum number of attempts cannot be negative"}
+	}
+	return nil
+}
+
+func (p RetryPolicy) initialDelay() time.Duration {
+	if p.InitialDelay == 0 {
+		return DefaultRetryInitialDelay
+	}
+	return p.InitialDelay
+}
+
+func (p RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelay == 0 {
+		return DefaultRetryMaxDelay
+	}
+	return p.MaxDelay
+}
+
+// delay returns the back-off after the given (failed) round, randomized with r.
+func (p RetryPolicy) delay(round int, r Rand) time.Duration {
+	d, max := p.initialDelay(), p.maxDelay()
+	for i := 1; i < round && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d - time.Duration(p.Jitter*r.Float64()*float64(d))
+}
+
+// retryPolicyHolder wraps the retry policy of a Dsync (see SetRetryPolicy).
+type retryPolicyHolder struct {
+	p *RetryPolicy
+}
+
+// SetRetryPolicy sets the timing of the rounds of the lock acquisitions from the lock
+// servers of ds, eg. so that latency-sensitive services give up sooner. Acquisitions
+// that cannot give up (Lock and RLock) ignore MaxAttempts. Passing nil restores the
+// default: an entirely randomized back-off doubling up to a second, without a maximum
+// number of rounds. Returns a *ConfigError when the policy is invalid.
+func (ds *Dsync) SetRetryPolicy(p *RetryPolicy) error {
+	if p != nil {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		copied := *p
+		p = &copied
+	}
+	ds.retryPolicy.Store(retryPolicyHolder{p})
+	return nil
+}
+
+// WithRetryPolicy sets the timing of the rounds of the lock acquisitions of a DRWMutex,
+// overriding the policy of its Dsync (see SetRetryPolicy). It is a run-time error if the
+// policy is invalid (see RetryPolicy.Validate).
+func WithRetryPolicy(p RetryPolicy) MutexOption {
+	if err := p.Validate(); err != nil {
+		panic(err)
+	}
+	return func(dm *DRWMutex) {
+		dm.retry = &p
+	}
+}
+
+// retryPolicy returns the retry policy of dm.
+func (dm *DRWMutex) retryPolicy() *RetryPolicy {
+	if dm.retry != nil {
+		return dm.retry
+	}
+	return dm.ds.clusterRetryPolicy()
+}
+
+// clusterRetryPolicy returns the retry policy of ds.
+func (ds *Dsync) clusterRetryPolicy() *RetryPolicy {
+	if h, ok := ds.retryPolicy.Load().(retryPolicyHolder); ok && h.p != nil {
+		return h.p
+	}
+	return &defaultRetryPolicy
+}
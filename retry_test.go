@@ -0,0 +1,185 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+)
+
+func TestRetryPolicyValidate(t *testing.T) {
+
+	for _, p := range []RetryPolicy{
+		{InitialDelay: -time.Millisecond},
+		{InitialDelay: time.Second, MaxDelay: time.Millisecond},
+		{InitialDelay: 2 * time.Second}, // Exceeds the default maximum delay
+		{Jitter: 1.5},
+		{MaxAttempts: -1},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", p)
+		} else if _, ok := err.(*ConfigError); !ok {
+			t.Errorf("expected *ConfigError, got %T", err)
+		}
+	}
+	if err := ds.SetRetryPolicy(&RetryPolicy{Jitter: -1}); err == nil {
+		t.Error("expected invalid policy to be refused")
+	}
+	if err := (RetryPolicy{}).Validate(); err != nil {
+		t.Errorf("expected zero policy to be valid, got %v", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+
+	p := RetryPolicy{InitialDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	for round, expected := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond} {
+		if d := RetryDelay(p, round+1); d != expected {
+			t.Errorf("round %d: expected back-off of %v, got %v", round+1, expected, d)
+		}
+	}
+
+	// Jitter shortens the back-off by up to the fraction given
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := RetryDelay(p, 3); d <= 2*time.Millisecond || d > 4*time.Millisecond {
+			t.Fatalf("expected back-off in (2ms, 4ms], got %v", d)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	rds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mutex sync.Mutex
+	var rounds []int
+	rds.SetLatencyHandler(func(operation, name string, l Latency) {
+		if !l.Acquired {
+			mutex.Lock()
+			rounds = append(rounds, l.Rounds)
+			mutex.Unlock()
+		}
+	})
+	lastRounds := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return rounds[len(rounds)-1]
+	}
+
+	holder := NewDRWMutex("test-retry", rds)
+	holder.Lock()
+
+	// Gives up after the maximum number of rounds, long before the timeout
+	if err := rds.SetRetryPolicy(&RetryPolicy{InitialDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond, MaxAttempts: 3}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if NewDRWMutex("test-retry", rds).LockWithTimeout(10 * time.Second) {
+		t.Fatal("expected lock not to be acquired")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second || lastRounds() != 3 {
+		t.Fatalf("expected to give up after 3 rounds, got %d rounds in %v", lastRounds(), elapsed)
+	}
+
+	// The policy of a mutex overrides the one of the cluster
+	if NewDRWMutex("test-retry", rds, WithRetryPolicy(RetryPolicy{MaxAttempts: 1})).LockWithTimeout(10 * time.Second) {
+		t.Fatal("expected lock not to be acquired")
+	}
+	if lastRounds() != 1 {
+		t.Fatalf("expected to give up after a single round, got %d rounds", lastRounds())
+	}
+
+	// Lock blocks until acquired regardless
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		holder.Unlock()
+	}()
+	dm := NewDRWMutex("test-retry", rds)
+	dm.Lock()
+	dm.Unlock()
+
+	// The default back-off is restored
+	if err := rds.SetRetryPolicy(nil); err != nil {
+		t.Fatal(err)
+	}
+	dm.Lock()
+	if NewDRWMutex("test-retry", rds).LockWithTimeout(200 * time.Millisecond) {
+		t.Fatal("expected lock not to be acquired")
+	}
+	if lastRounds() <= 3 {
+		t.Fatalf("expected more rounds than the maximum of the policy, got %d", lastRounds())
+	}
+	dm.Unlock()
+}
+
+// benchmarkContention acquires a write lock contended by the given number of clients
+// backing off according to policy, reporting the rounds needed per acquisition.
+func benchmarkContention(b *testing.B, contenders int, policy RetryPolicy) {
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	rds, err := New(clnts, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	remaining := int64(b.N)
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for i := 0; i < contenders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dm := NewDRWMutex("test-contention", rds, WithRetryPolicy(policy))
+			for atomic.AddInt64(&remaining, -1) >= 0 {
+				dm.Lock()
+				dm.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	b.StopTimer()
+	m := rds.Metrics().Lock
+	b.ReportMetric(float64(m.Acquisitions+m.Retries)/float64(m.Acquisitions), "rounds/op")
+}
+
+// Without jitter contending clients retry in waves, splitting the grants among them
+// round after round, compare with the default (jittered) back-off.
+func BenchmarkContentionFixedBackOff(b *testing.B) {
+	benchmarkContention(b, 16, RetryPolicy{InitialDelay: 5 * time.Millisecond, MaxDelay: 5 * time.Millisecond})
+}
+
+func BenchmarkContentionExponentialBackOff(b *testing.B) {
+	benchmarkContention(b, 16, RetryPolicy{})
+}
+
+func BenchmarkContentionJitteredBackOff(b *testing.B) {
+	benchmarkContention(b, 16, RetryPolicy{Jitter: 1})
+}
@@ -0,0 +1,98 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+// registerHolder records dm as the holder of the granted locks. The locks of a batch
+// share their uid at a node (see MultiMutex), so holders are kept per name as well.
+func (ds *Dsync) registerHolder(dm *DRWMutex, locks []string) {
+	ds.holdersMutex.Lock()
+	defer ds.holdersMutex.Unlock()
+	for _, uid := range locks {
+		if !isLocked(uid) {
+			continue
+		}
+		if ds.holders[uid] == nil {
+			ds.holders[uid] = make(map[string]*DRWMutex)
+		}
+		ds.holders[uid][dm.Name] = dm
+	}
+}
+
+// unregisterHolder forgets the holder of the released locks on name.
+func (ds *Dsync) unregisterHolder(name string, locks []string) {
+	ds.holdersMutex.Lock()
+	defer ds.holdersMutex.Unlock()
+	for _, uid := range locks {
+		if names, ok := ds.holders[uid]; ok {
+			delete(names, name)
+			if len(names) == 0 {
+				delete(ds.holders, uid)
+			}
+		}
+	}
+}
+
+// HoldsLock returns true when a lock granted with uid is held by a client of ds. To be
+// called by the lock server of this node when asked whether a lock is still active, as
+// the lock is not necessarily placed on this node (see SetReplication).
+func (ds *Dsync) HoldsLock(uid string) bool {
+	ds.holdersMutex.Lock()
+	defer ds.holdersMutex.Unlock()
+	_, ok := ds.holders[uid]
+	return ok
+}
+
+// Revoked returns a channel that is closed when a lock server revokes a lock held on
+// dm, eg. because it has been held longer than the maximum hold time configured at the
+// lock server. The lock should then be considered lost: stop using the protected
+// resource and unlock dm. After a revocation a new channel is returned.
+func (dm *DRWMutex) Revoked() <-chan struct{} {
+	dm.m.Lock()
+	defer dm.m.Unlock()
+	if dm.revoked == nil {
+		dm.revoked = make(chan struct{})
+	}
+	return dm.revoked
+}
+
+// NotifyRevoked notifies the holder of the lock on name with uid, a client of ds, that a
+// lock server has revoked it. To be called by the lock server of this node, see the
+// Revoked RPC of package lockserver.
+func (ds *Dsync) NotifyRevoked(name, uid string) {
+	ds.holdersMutex.Lock()
+	dm, ok := ds.holders[uid][name]
+	ds.holdersMutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	// A cached read lock is no longer complete either
+	dm.ds.InvalidateReadCache(name)
+
+	dm.m.Lock()
+	if dm.revoked == nil {
+		dm.revoked = make(chan struct{})
+	}
+	close(dm.revoked)
+	dm.revoked = nil
+	dm.m.Unlock()
+
+	if h, ok := dm.ds.lostHandler.Load().(lostHandler); ok && h.fn != nil {
+		h.fn(name)
+	}
+}
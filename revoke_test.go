@@ -0,0 +1,59 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"testing"
+	"time"
+)
+
+func TestRevoked(t *testing.T) {
+
+	// Capture the uid the lock is requested under at the first node
+	var uid string
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if serviceMethod == "Dsync.Lock" && c.Node() == nodes[0] {
+			uid = args.(*LockArgs).UID
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	dm := NewDRWMutex("test-revoked", ds)
+	revoked := dm.Revoked()
+	dm.Lock()
+
+	ds.NotifyRevoked(dm.Name, "unknown-uid")
+	select {
+	case <-revoked:
+		t.Fatal("expected lock not to be revoked for unknown uid")
+	default:
+	}
+
+	ds.NotifyRevoked(dm.Name, uid)
+	select {
+	case <-revoked:
+	case <-time.After(time.Second):
+		t.Fatal("expected lock to be revoked")
+	}
+
+	if dm.Revoked() == revoked {
+		t.Fatal("expected new channel after revocation")
+	}
+	dm.Unlock()
+}
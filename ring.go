@@ -0,0 +1,93 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// Number of points every node occupies on the hash ring, so that the names are spread
+// evenly over the nodes and only a share of about 1/n of them moves when a node joins
+// or leaves the ring.
+const ringVirtualNodes = 64
+
+// ring - consistent hash ring of the nodes, placing every name on the nodes that
+// follow its hash clockwise.
+type ring struct {
+	points []uint64 // Hashes of the virtual nodes, sorted
+	nodes  []int    // Index of the node of every point
+	count  int      // Number of nodes on the ring
+}
+
+// ringHash hashes s onto the ring, mixing the bits of the FNV hash as that hardly
+// spreads strings that only differ at the end (like the virtual nodes of a node).
+func ringHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// newRing returns a ring of the nodes with the given identities (eg. their addresses),
+// the index in ids being the index of the node. Empty identities are left out.
+func newRing(ids []string) *ring {
+	r := &ring{}
+	type point struct {
+		hash uint64
+		node int
+	}
+	points := make([]point, 0, len(ids)*ringVirtualNodes)
+	for node, id := range ids {
+		if id == "" {
+			continue
+		}
+		r.count++
+		for v := 0; v < ringVirtualNodes; v++ {
+			points = append(points, point{ringHash(fmt.Sprintf("%s#%d", id, v)), node})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+	for _, p := range points {
+		r.points = append(r.points, p.hash)
+		r.nodes = append(r.nodes, p.node)
+	}
+	return r
+}
+
+// replicas returns the indices of the n distinct nodes name is placed on.
+func (r *ring) replicas(name string, n int) []int {
+	if n > r.count {
+		n = r.count
+	}
+	h := ringHash(name)
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	nodes := make([]int, 0, n)
+	for i := 0; len(nodes) < n; i++ {
+		node := r.nodes[(start+i)%len(r.points)]
+		if !isReplica(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,66 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"fmt"
+	. "github.com/minio/dsync"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+
+	ids := make([]string, 8)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("10.0.0.%d:9000/dsync", i+1)
+	}
+	const names = 10000
+	replicasOf := NewRing(ids)
+
+	// Names are placed on distinct nodes, spread evenly
+	counts := make([]int, len(ids))
+	for i := 0; i < names; i++ {
+		replicas := replicasOf(fmt.Sprintf("bucket/object-%d", i), 3)
+		if len(replicas) != 3 || replicas[0] == replicas[1] || replicas[1] == replicas[2] || replicas[0] == replicas[2] {
+			t.Fatalf("expected 3 distinct nodes, got %v", replicas)
+		}
+		counts[replicas[0]]++
+	}
+	for node, count := range counts {
+		if count < names/len(ids)/2 || count > names/len(ids)*2 {
+			t.Fatalf("expected about %d names on node %d, got %d", names/len(ids), node, count)
+		}
+	}
+
+	// Adding a node only moves names onto the new node
+	grown := append(append([]string(nil), ids...), "10.0.0.9:9000/dsync")
+	grownReplicasOf := NewRing(grown)
+	moved := 0
+	for i := 0; i < names; i++ {
+		name := fmt.Sprintf("bucket/object-%d", i)
+		before, after := replicasOf(name, 1)[0], grownReplicasOf(name, 1)[0]
+		if before != after {
+			if after != len(ids) {
+				t.Fatalf("expected %s to stay on node %d or move to the new node, moved to %d", name, before, after)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > names/len(ids)*2 {
+		t.Fatalf("expected about %d names to move to the new node, got %d", names/len(grown), moved)
+	}
+}
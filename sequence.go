@@ -0,0 +1,122 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SequenceArgs - arguments for the Sequence RPC.
+type SequenceArgs struct {
+	AuthArgs
+	Name  string `json:"name"`  // Name of the sequence
+	Value uint64 `json:"value"` // Value proposed, accepted when above the high-water mark
+}
+
+// SequenceReply - reply for the Sequence RPC.
+type SequenceReply struct {
+	Accepted  bool   `json:"accepted"`  // Whether the value proposed was accepted
+	HighWater uint64 `json:"highWater"` // Highest value accepted so far for the sequence
+}
+
+// Maximum number of rounds NextSequence contends for a value.
+const maxSequenceRounds = 100
+
+func (ds *Dsync) lastSequence(name string) uint64 {
+	ds.sequencesMutex.Lock()
+	defer ds.sequencesMutex.Unlock()
+	return ds.lastSequences[name]
+}
+
+func (ds *Dsync) setLastSequence(name string, value uint64) {
+	ds.sequencesMutex.Lock()
+	defer ds.sequencesMutex.Unlock()
+	if value > ds.lastSequences[name] {
+		ds.lastSequences[name] = value
+	}
+}
+
+// NextSequence returns the next value of the sequence name, which is strictly greater
+// than all values returned before by any client, eg. to be used as a fencing token, an
+// object version or a unique ID. Values are not necessarily consecutive.
+//
+// A value is proposed to all nodes and taken once a quorum of the nodes accepted it,
+// that is raised its high-water mark to the value (which lock servers persist). Since
+// any two quorums overlap, no value can be taken twice. When the proposal is not
+// accepted by a quorum, the next round proposes a value above the highest high-water
+// mark reported.
+func (ds *Dsync) NextSequence(name string) (uint64, error) {
+
+	if name == "" {
+		return 0, errors.New("Name is required")
+	}
+
+	value := ds.lastSequence(name) + 1
+	for round := 1; round <= maxSequenceRounds; round++ {
+		m := ds.membership()
+		nodes := m.nodes()
+		replies := make([]SequenceReply, len(nodes))
+		errs := make([]error, len(nodes))
+
+		ch := make(chan int, len(nodes))
+		for i, index := range nodes {
+			go func(i, index int) {
+				errs[i] = ds.call(index, "Dsync.Sequence", &SequenceArgs{Name: name, Value: value}, &replies[i])
+				ch <- i
+			}(i, index)
+		}
+		for range nodes {
+			<-ch
+		}
+
+		accepted, highWater := 0, uint64(0)
+		var failed []string
+		for i, err := range errs {
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s (%v)", m.node(nodes[i]), err))
+				continue
+			}
+			if replies[i].Accepted {
+				accepted++
+			}
+			if replies[i].HighWater > highWater {
+				highWater = replies[i].HighWater
+			}
+		}
+		if accepted >= m.quorum {
+			ds.setLastSequence(name, value)
+			return value, nil
+		}
+		if m.count-len(failed) < m.quorum {
+			return 0, fmt.Errorf("Sequence %q reached less than a quorum of %d nodes: %v", name, m.quorum, failed)
+		}
+
+		// Contended by another client (or taken elsewhere since), so propose above all
+		// values seen after a randomized back-off
+		if highWater >= value {
+			value = highWater + 1
+		} else {
+			value++
+		}
+		if round > 1 {
+			ds.clock().Sleep(time.Duration(ds.random().Float64() * float64(round) * float64(time.Millisecond)))
+		}
+	}
+	return 0, fmt.Errorf("Sequence %q remained contended for %d rounds", name, maxSequenceRounds)
+}
@@ -0,0 +1,70 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"errors"
+	. "github.com/minio/dsync"
+	"sync"
+	"testing"
+)
+
+func TestNextSequence(t *testing.T) {
+
+	// Sequences remain unique with a node down
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if serviceMethod == "Dsync.Sequence" && c.Node() == nodes[N-1] {
+			return errors.New("unreachable")
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	var mutex sync.Mutex
+	seen := make(map[uint64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last uint64
+			for j := 0; j < 10; j++ {
+				v, err := ds.NextSequence("test-sequence")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if v <= last {
+					t.Errorf("expected sequence to increase, got %d after %d", v, last)
+				}
+				last = v
+
+				mutex.Lock()
+				if seen[v] {
+					t.Errorf("expected unique sequence values, got %d twice", v)
+				}
+				seen[v] = true
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := ds.NextSequence(""); err == nil {
+		t.Fatal("expected error for empty name")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"fmt"
+	"time"
+)
+
+type localLock struct {
+	writer  bool          // Write lock held
+	readers int           // Number of read locks held
+	changed chan struct{} // Closed when the lock is released, to wake up waiters
+}
+
+// localTryLock grants a lock on name in-process, returning its uid or (when the lock
+// is not available) a channel that is closed once the lock changes.
+func (ds *Dsync) localTryLock(name string, isReadLock bool) (string, <-chan struct{}) {
+	ds.localMutex.Lock()
+	defer ds.localMutex.Unlock()
+
+	l, ok := ds.localLocks[name]
+	if !ok {
+		l = &localLock{changed: make(chan struct{})}
+		ds.localLocks[name] = l
+	}
+	switch {
+	case l.writer, !isReadLock && l.readers > 0:
+		return "", l.changed
+	case isReadLock:
+		l.readers++
+	default:
+		l.writer = true
+	}
+
+	bytesUid := [16]byte{}
+	cryptorand.Read(bytesUid[:])
+	return fmt.Sprintf("%X", bytesUid[:]), nil
+}
+
+// localWouldLock returns whether localTryLock would grant a lock on name.
+func (ds *Dsync) localWouldLock(name string, isReadLock bool) bool {
+	ds.localMutex.Lock()
+	defer ds.localMutex.Unlock()
+
+	l, ok := ds.localLocks[name]
+	return !ok || !l.writer && (isReadLock || l.readers == 0)
+}
+
+// localUnlock releases an in-process lock on name (all locks when force is set),
+// waking up the waiters.
+func (ds *Dsync) localUnlock(name string, isReadLock, force bool) {
+	ds.localMutex.Lock()
+	defer ds.localMutex.Unlock()
+
+	l, ok := ds.localLocks[name]
+	if !ok {
+		return
+	}
+	switch {
+	case force:
+		l.writer, l.readers = false, 0
+	case isReadLock && l.readers > 0:
+		l.readers--
+	case !isReadLock:
+		l.writer = false
+	}
+	close(l.changed)
+	if !l.writer && l.readers == 0 {
+		delete(ds.localLocks, name)
+	} else {
+		l.changed = make(chan struct{})
+	}
+}
+
+// localUpgrade converts the in-process read lock on name into a write lock, provided that
+// it is the only lock held.
+func (ds *Dsync) localUpgrade(name string) bool {
+	ds.localMutex.Lock()
+	defer ds.localMutex.Unlock()
+
+	l, ok := ds.localLocks[name]
+	if !ok || l.writer || l.readers != 1 {
+		return false
+	}
+	l.writer, l.readers = true, 0
+	return true
+}
+
+// localDowngrade converts the in-process write lock on name into a read lock, waking up
+// the waiters for a read lock.
+func (ds *Dsync) localDowngrade(name string) {
+	ds.localMutex.Lock()
+	defer ds.localMutex.Unlock()
+
+	l, ok := ds.localLocks[name]
+	if !ok || !l.writer {
+		return
+	}
+	l.writer, l.readers = false, 1
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// lockLocal acquires the lock in single-node mode, blocking until it is available
+// or until the deadline (if not zero) has passed or ctx is done.
+func (dm *DRWMutex) lockLocal(ctx context.Context, isReadLock bool, deadline time.Time) bool {
+
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		expired = dm.ds.clock().After(deadline.Sub(dm.ds.clock().Now()))
+	}
+
+	for {
+		uid, changed := dm.ds.localTryLock(dm.Name, isReadLock)
+		if changed == nil {
+			m := dm.ds.membership()
+			locks := make([]string, len(m.clnts))
+			locks[m.ownNode] = uid
+			dm.granted(isReadLock, locks)
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		case <-expired:
+			return false
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	. "github.com/minio/dsync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetNodesConfigErrors(t *testing.T) {
+
+	clnt := newClient(nodes[0], rpcPaths[0])
+	testCases := []struct {
+		clnts   []RPC
+		ownNode int
+	}{
+		{nil, 0},                                 // No nodes
+		{[]RPC{clnt, clnt}, 0},                   // Too few nodes
+		{[]RPC{clnt, clnt, clnt, clnt}, 4},       // Own node out of range
+		{[]RPC{clnt, clnt, clnt, clnt}, -1},      // Own node out of range
+		{[]RPC{clnt, clnt, clnt, clnt, clnt}, 0}, // Uneven number of nodes
+	}
+	for i, tc := range testCases {
+		_, err := New(tc.clnts, tc.ownNode)
+		if _, ok := err.(*ConfigError); !ok {
+			t.Errorf("case %d: expected configuration error", i)
+		}
+	}
+}
+
+// newSingleNode returns a cluster of a single node, the own node of the tests.
+func newSingleNode(t *testing.T) *Dsync {
+	single, err := New([]RPC{newClient(nodes[0], rpcPaths[0])}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return single
+}
+
+func TestSingleNode(t *testing.T) {
+
+	ds := newSingleNode(t)
+
+	var calls int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && a.Name == "test-single-node" {
+			atomic.AddInt64(&calls, 1)
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	dm := NewDRWMutex("test-single-node", ds)
+	dm.RLock()
+	dm.RLock()
+
+	// Write lock is not available while read locked
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if NewDRWMutex("test-single-node", ds).LockContext(ctx) {
+		t.Fatal("expected write lock not to be acquired while read locked")
+	}
+
+	// Waiting writer gets the lock once the readers are gone
+	locked := make(chan struct{})
+	go func() {
+		dm2 := NewDRWMutex("test-single-node", ds)
+		dm2.Lock()
+		close(locked)
+		dm2.Unlock()
+	}()
+	dm.RUnlock()
+	select {
+	case <-locked:
+		t.Fatal("expected write lock not to be acquired while read locked")
+	case <-time.After(20 * time.Millisecond):
+	}
+	dm.RUnlock()
+	<-locked
+
+	dm.Lock()
+	dm.Unlock()
+
+	if c := atomic.LoadInt64(&calls); c != 0 {
+		t.Fatalf("expected no RPCs in single-node mode, got %d", c)
+	}
+}
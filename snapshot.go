@@ -0,0 +1,151 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"errors"
+	"hash/crc32"
+	"strconv"
+	"time"
+)
+
+// AuthArgs - authentication fields, embedded in the arguments of all RPCs besides LockArgs.
+type AuthArgs struct {
+	Token     string    `json:"token,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (a *AuthArgs) SetToken(token string) {
+	a.Token = token
+}
+
+func (a *AuthArgs) SetTimestamp(tstamp time.Time) {
+	a.Timestamp = tstamp
+}
+
+// LockEntry - single grant held by a lock server.
+type LockEntry struct {
+	Name    string            `json:"name"`
+	Writer  bool              `json:"writer"`            // Write (exclusive) or read lock
+	Mode    LockMode          `json:"mode,omitempty"`    // Mode of the lock, see ModeOf (not covered by the checksum)
+	Node    string            `json:"node,omitempty"`    // Network address of client holding the lock
+	RPCPath string            `json:"rpcPath,omitempty"` // RPC path of client holding the lock
+	UID     string            `json:"uid,omitempty"`     // Uid of the request that was granted
+	Owner   string            `json:"owner,omitempty"`   // Uid of the DRWMutex holding the lock (not covered by the checksum)
+	Source  string            `json:"source,omitempty"`  // File:line of the caller that requested the lock (not covered by the checksum)
+	Tags    map[string]string `json:"tags,omitempty"`    // Tags of the request, see TagsKey (not covered by the checksum)
+	Since   time.Time         `json:"since"`             // Time the lock was granted
+}
+
+// SnapshotArgs - arguments for the Snapshot RPC.
+type SnapshotArgs struct {
+	AuthArgs
+}
+
+// SnapshotReply - reply for the Snapshot RPC, all grants held by a lock server.
+type SnapshotReply struct {
+	Entries  []LockEntry `json:"entries"`
+	Checksum uint32      `json:"checksum,omitempty"` // Checksum of the entries (see ChecksumEntries), zero when not computed
+}
+
+// ErrChecksum - returned when transferred or persisted state does not match its checksum.
+var ErrChecksum = errors.New("Checksum mismatch, the data is corrupt")
+
+// Number of times a snapshot is fetched again when it arrives corrupt.
+const snapshotRetries = 3
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ChecksumEntries returns the CRC-32C of entries, computed over a canonical encoding so that
+// it does not depend on the encoding used by the transport.
+func ChecksumEntries(entries []LockEntry) uint32 {
+	var b []byte
+	for _, e := range entries {
+		b = append(b, e.Name...)
+		b = append(b, 0)
+		b = strconv.AppendBool(b, e.Writer)
+		b = append(b, 0)
+		b = append(b, e.Node...)
+		b = append(b, 0)
+		b = append(b, e.RPCPath...)
+		b = append(b, 0)
+		b = append(b, e.UID...)
+		b = append(b, 0)
+		b = strconv.AppendInt(b, e.Since.UnixNano(), 10)
+		b = append(b, '\n')
+	}
+	return crc32.Checksum(b, castagnoli)
+}
+
+// snapshot retrieves the grants held by the node at index, fetching them again when they
+// arrive corrupt. Replies of older lock servers come without checksum and are accepted.
+func (ds *Dsync) snapshot(index int) ([]LockEntry, error) {
+	return ds.entries(index, "Dsync.Snapshot", &SnapshotArgs{})
+}
+
+// entries calls the RPC serviceMethod replying with a SnapshotReply at the node at index,
+// like snapshot.
+func (ds *Dsync) entries(index int, serviceMethod string, args RPCArgs) ([]LockEntry, error) {
+	for attempt := 1; ; attempt++ {
+		var reply SnapshotReply
+		if err := ds.call(index, serviceMethod, args, &reply); err != nil {
+			return nil, err
+		}
+		if reply.Checksum == 0 || reply.Checksum == ChecksumEntries(reply.Entries) {
+			for i := range reply.Entries {
+				if reply.Entries[i].Mode == "" { // Older lock server
+					reply.Entries[i].Mode = ModeOf(reply.Entries[i].Writer)
+				}
+			}
+			return reply.Entries, nil
+		}
+		if attempt == snapshotRetries {
+			return nil, ErrChecksum
+		}
+	}
+}
+
+// NodeSnapshot - the grants held by (or the error retrieving them from) a single node.
+type NodeSnapshot struct {
+	Node    string
+	Entries []LockEntry
+	Err     error
+}
+
+// Snapshots retrieves the grants held by all nodes. Note that the snapshots are not
+// taken at exactly the same moment, so locks that are being (un)locked while taking
+// the snapshots can show up as a difference between nodes.
+func (ds *Dsync) Snapshots() []NodeSnapshot {
+
+	m := ds.membership()
+	nodes := m.nodes()
+	snapshots := make([]NodeSnapshot, len(nodes))
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			snapshots[i].Node = m.node(index)
+			snapshots[i].Entries, snapshots[i].Err = ds.snapshot(index)
+			ch <- i
+		}(i, index)
+	}
+	for range nodes {
+		<-ch
+	}
+
+	return snapshots
+}
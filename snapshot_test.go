@@ -0,0 +1,86 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"testing"
+	. "github.com/minio/dsync"
+)
+
+func TestSnapshots(t *testing.T) {
+
+	dm := NewDRWMutex("test-snapshot", ds)
+	dm.Lock()
+	defer dm.Unlock()
+
+	snapshots := ds.Snapshots()
+	if len(snapshots) != N {
+		t.Fatalf("expected %d snapshots, got %d", N, len(snapshots))
+	}
+	for _, s := range snapshots {
+		if s.Err != nil {
+			t.Fatalf("node %s: %v", s.Node, s.Err)
+		}
+		found := false
+		for _, e := range s.Entries {
+			if e.Name == "test-snapshot" {
+				if !e.Writer {
+					t.Fatalf("node %s: expected write lock for %s", s.Node, e.Name)
+				}
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("node %s: lock test-snapshot missing from snapshot", s.Node)
+		}
+	}
+}
+
+func TestSnapshotChecksum(t *testing.T) {
+
+	dm := NewDRWMutex("test-snapshot-checksum", ds)
+	dm.Lock()
+	defer dm.Unlock()
+
+	// Corrupt the snapshots of the first node in transfer, the first one or all of them
+	corrupted, always := 0, false
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		err := invoke(c, serviceMethod, args, reply)
+		if r, ok := reply.(*SnapshotReply); ok && err == nil && c.Node() == nodes[0] && (always || corrupted == 0) && len(r.Entries) > 0 {
+			corrupted++
+			r.Entries[0].UID += "corrupt"
+		}
+		return err
+	})
+	defer ds.SetInterceptors()
+
+	for _, s := range ds.Snapshots() {
+		if s.Err != nil {
+			t.Fatalf("node %s: expected corrupt snapshot to be fetched again, got %v", s.Node, s.Err)
+		}
+	}
+	if corrupted != 1 {
+		t.Fatalf("expected a single corrupt snapshot, got %d", corrupted)
+	}
+
+	always = true
+	for _, s := range ds.Snapshots() {
+		if (s.Err == ErrChecksum) != (s.Node == nodes[0]) {
+			t.Fatalf("node %s: expected checksum error only for %s, got %v", s.Node, nodes[0], s.Err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// LockedTx - database transaction bracketed by a distributed lock, which is released
+// once the transaction is committed or rolled back. The embedded *sql.Tx gives access
+// to all other methods of the transaction.
+type LockedTx struct {
+	*sql.Tx
+	dm         *DRWMutex
+	isReadLock bool
+	once       sync.Once
+}
+
+// BeginLocked acquires the write lock on dm and starts a transaction on db, so that
+// the transaction runs under the distributed lock:
+//
+//	tx, err := dsync.BeginLocked(ctx, db, dsync.NewDRWMutex("accounts/42"), nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer tx.Rollback() // Releases the lock, unless committed before
+//	...
+//	return tx.Commit() // Releases the lock
+//
+// Returns the error of ctx when the lock could not be acquired before ctx was done.
+func BeginLocked(ctx context.Context, db *sql.DB, dm *DRWMutex, opts *sql.TxOptions) (*LockedTx, error) {
+	return beginLocked(ctx, db, dm, false, opts)
+}
+
+// BeginRLocked acquires a read lock on dm and starts a transaction on db, like BeginLocked.
+func BeginRLocked(ctx context.Context, db *sql.DB, dm *DRWMutex, opts *sql.TxOptions) (*LockedTx, error) {
+	return beginLocked(ctx, db, dm, true, opts)
+}
+
+func beginLocked(ctx context.Context, db *sql.DB, dm *DRWMutex, isReadLock bool, opts *sql.TxOptions) (*LockedTx, error) {
+	deadline, _ := ctx.Deadline()
+	if !dm.lockBlocking(ctx, isReadLock, deadline) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, context.DeadlineExceeded
+	}
+	tx := &LockedTx{dm: dm, isReadLock: isReadLock}
+	var err error
+	if tx.Tx, err = db.BeginTx(ctx, opts); err != nil {
+		tx.unlock()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Commit commits the transaction and releases the lock, also when the commit fails.
+func (tx *LockedTx) Commit() error {
+	defer tx.unlock()
+	return tx.Tx.Commit()
+}
+
+// Rollback aborts the transaction and releases the lock (unless released before, so
+// that Rollback can be deferred right after BeginLocked).
+func (tx *LockedTx) Rollback() error {
+	defer tx.unlock()
+	return tx.Tx.Rollback()
+}
+
+// unlock releases the lock, once.
+func (tx *LockedTx) unlock() {
+	tx.once.Do(func() {
+		if tx.isReadLock {
+			tx.dm.RUnlock()
+		} else {
+			tx.dm.Unlock()
+		}
+	})
+}
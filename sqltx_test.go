@@ -0,0 +1,94 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	. "github.com/minio/dsync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Minimal database/sql driver counting the transactions committed and rolled back.
+type countingDriver struct{ commits, rollbacks int64 }
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) { return &countingConn{d}, nil }
+
+type countingConn struct{ d *countingDriver }
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *countingConn) Close() error              { return nil }
+func (c *countingConn) Begin() (driver.Tx, error) { return &countingTx{c.d}, nil }
+
+type countingTx struct{ d *countingDriver }
+
+func (tx *countingTx) Commit() error   { atomic.AddInt64(&tx.d.commits, 1); return nil }
+func (tx *countingTx) Rollback() error { atomic.AddInt64(&tx.d.rollbacks, 1); return nil }
+
+func TestLockedTx(t *testing.T) {
+
+	d := &countingDriver{}
+	sql.Register("dsync-counting", d)
+	db, err := sql.Open("dsync-counting", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	tx, err := BeginLocked(ctx, db, NewDRWMutex("test-sql", ds), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lock is held for the duration of the transaction
+	ctx2, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err = BeginLocked(ctx2, db, NewDRWMutex("test-sql", ds), nil); err != context.DeadlineExceeded {
+		t.Fatalf("expected lock to be held during transaction, got %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Rollback(); err != sql.ErrTxDone {
+		t.Fatalf("expected deferred rollback after commit to be a no-op, got %v", err)
+	}
+
+	// Released by the commit (and only once)
+	tx, err = BeginRLocked(ctx, db, NewDRWMutex("test-sql", ds), nil)
+	if err != nil {
+		t.Fatalf("expected lock to be released by commit, got %v", err)
+	}
+	tx.Rollback()
+
+	// Released by the rollback
+	if tx, err = BeginLocked(ctx, db, NewDRWMutex("test-sql", ds), nil); err != nil {
+		t.Fatalf("expected lock to be released by rollback, got %v", err)
+	}
+	tx.Commit()
+
+	if atomic.LoadInt64(&d.commits) != 2 || atomic.LoadInt64(&d.rollbacks) != 1 {
+		t.Fatalf("expected 2 commits and 1 rollback, got %d and %d", d.commits, d.rollbacks)
+	}
+}
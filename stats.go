@@ -0,0 +1,96 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientStats - statistics of the RPC calls to a single lock server.
+type ClientStats struct {
+	Calls         int64     // RPC calls made
+	Errors        int64     // RPC calls that failed
+	Reconnects    int64     // Connections established after the first one
+	BytesSent     int64     // Bytes written to the connections
+	BytesReceived int64     // Bytes read from the connections
+	LastCall      time.Time // Time of the last call, zero when none was made
+	LastError     string    // Error of the last call that failed, empty when none did
+	LastErrorTime time.Time // Time of the last call that failed
+}
+
+// StatsReporter - RPC client that reports statistics of its transport. The reconnects and
+// bytes transferred reported by the RPC clients of a Dsync are included in its Status;
+// the calls and errors are counted by dsync itself.
+type StatsReporter interface {
+	Stats() ClientStats
+}
+
+// NodeStatus - status of the RPC client of a single lock server, see Status.
+type NodeStatus struct {
+	Node          string
+	RPCPath       string
+	CallsInFlight int64
+	Paused        bool // Granting is paused at the node as last reported by it (see Dsync.Pause)
+	ClientStats
+}
+
+// callStats - statistics of the calls made through a nodeClient.
+type callStats struct {
+	calls         int64
+	errors        int64
+	mutex         sync.Mutex
+	lastCall      time.Time
+	lastError     string
+	lastErrorTime time.Time
+}
+
+// record records a call that completed with err at now.
+func (s *callStats) record(err error, now time.Time) {
+	atomic.AddInt64(&s.calls, 1)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastCall = now
+	if err != nil {
+		atomic.AddInt64(&s.errors, 1)
+		s.lastError, s.lastErrorTime = err.Error(), now
+	}
+}
+
+// Status returns a snapshot of the statistics of the RPC clients of all lock servers, so
+// that operational tooling can inspect the connectivity of the cluster from this process.
+// It is safe to call concurrently with lock operations. Reconnects and bytes transferred
+// are only known when the RPC client implements StatsReporter.
+func (ds *Dsync) Status() []NodeStatus {
+	var status []NodeStatus
+	m := ds.membership()
+	for _, index := range m.nodes() {
+		c := m.clnts[index]
+		s := NodeStatus{Node: c.Node(), RPCPath: c.RPCPath(), CallsInFlight: atomic.LoadInt64(&c.calls), Paused: atomic.LoadInt32(&c.paused) == 1}
+		if r, ok := c.rpc().(StatsReporter); ok {
+			transport := r.Stats()
+			s.Reconnects, s.BytesSent, s.BytesReceived = transport.Reconnects, transport.BytesSent, transport.BytesReceived
+		}
+		s.Calls, s.Errors = atomic.LoadInt64(&c.stats.calls), atomic.LoadInt64(&c.stats.errors)
+		c.stats.mutex.Lock()
+		s.LastCall, s.LastError, s.LastErrorTime = c.stats.lastCall, c.stats.lastError, c.stats.lastErrorTime
+		c.stats.mutex.Unlock()
+		status = append(status, s)
+	}
+	return status
+}
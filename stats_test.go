@@ -0,0 +1,78 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/minio/dsync"
+)
+
+// statsClient - RPC client reporting transport statistics, failing all calls when down.
+type statsClient struct {
+	RPC
+	down bool
+}
+
+func (c *statsClient) Call(serviceMethod string, args interface {
+	SetToken(token string)
+	SetTimestamp(tstamp time.Time)
+}, reply interface{}) error {
+	if c.down {
+		return errors.New("connection refused")
+	}
+	return c.RPC.Call(serviceMethod, args, reply)
+}
+
+func (c *statsClient) Stats() ClientStats {
+	return ClientStats{Reconnects: 2, BytesSent: 100, BytesReceived: 200}
+}
+
+func TestStatus(t *testing.T) {
+
+	var clnts []RPC
+	for i := range nodes {
+		clnts = append(clnts, &statsClient{RPC: newClient(nodes[i], rpcPaths[i]), down: i == N-1})
+	}
+	cluster, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Calls without releases, which would be retried for the node that is down
+	if _, err = cluster.NextSequence("test-status"); err != nil {
+		t.Fatal(err)
+	}
+
+	status := cluster.Status()
+	if len(status) != N {
+		t.Fatalf("expected status of %d nodes, got %d", N, len(status))
+	}
+	for i, s := range status {
+		if s.Node != nodes[i] || s.Calls == 0 || s.LastCall.IsZero() {
+			t.Errorf("expected calls to %s, got %+v", nodes[i], s)
+		}
+		if s.Reconnects != 2 || s.BytesSent != 100 || s.BytesReceived != 200 {
+			t.Errorf("expected transport statistics of the client, got %+v", s)
+		}
+		if down := i == N-1; down != (s.Errors > 0) || down != (s.LastError == "connection refused") {
+			t.Errorf("expected errors only for the node that is down, got %+v", s)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Tracer - creates a span per lock operation, eg. with OpenTelemetry (see the oteltrace
+// package), set with SetTracer.
+type Tracer interface {
+	// Start starts the span of operation ("Lock", "RLock", "Unlock" or "RUnlock") on name,
+	// as a child of the span of ctx (if any). Unlock and RUnlock take no context, so their
+	// spans are started with context.Background(). The acquisitions of a MultiMutex are
+	// traced as "Lock" on its names joined by commas.
+	Start(ctx context.Context, operation, name string) Span
+}
+
+// Span - span of a single lock operation. Its methods are called concurrently, and Call
+// can be called after End for responses that came in after the outcome was decided.
+type Span interface {
+	// Call records an RPC serviceMethod to node as a child span, from start until start+latency,
+	// with its outcome and error (if any).
+	Call(node, serviceMethod string, start time.Time, latency time.Duration, outcome Outcome, err error)
+
+	// Round records the outcome of a round of an acquisition: the number of nodes that granted
+	// the lock out of the nodes requested and whether the quorum was met.
+	Round(granted, nodes int, quorum bool)
+
+	// End ends the span with whether the lock was acquired (or the release acknowledged by a
+	// quorum of the nodes), the number of rounds and the error that made the operation fail.
+	End(ok bool, rounds int, err error)
+}
+
+// tracerValue wraps the tracer of the lock operations (see SetTracer).
+type tracerValue struct {
+	t Tracer
+}
+
+// SetTracer sets the tracer that is called with a span for every acquisition and release
+// of a lock from the lock servers of ds, with child spans for the RPCs to the nodes. Passing
+// nil removes the tracer.
+func (ds *Dsync) SetTracer(t Tracer) {
+	ds.tracer.Store(tracerValue{t})
+}
+
+// startSpan starts the span of operation on name, or returns nil when no tracer is set.
+func (ds *Dsync) startSpan(ctx context.Context, operation, name string) Span {
+	if v, ok := ds.tracer.Load().(tracerValue); ok && v.t != nil {
+		return v.t.Start(ctx, operation, name)
+	}
+	return nil
+}
+
+// releaseSpan traces the releases of the locks of an unlock, ending the span once the
+// outcome of the first attempt of every release is known.
+type releaseSpan struct {
+	ds            *Dsync
+	span          Span
+	m             *members
+	serviceMethod string
+	quorum        int
+	start         time.Time
+
+	mutex   sync.Mutex
+	pending int
+	acked   int
+	err     error // Last error of a release, if any
+}
+
+// traceRelease starts the span of the release of locks, or returns nil when no tracer is set.
+func (ds *Dsync) traceRelease(locks []string, name string, isReadLock bool) *releaseSpan {
+	operation, serviceMethod := "Unlock", "Dsync.Unlock"
+	if isReadLock {
+		operation, serviceMethod = "RUnlock", "Dsync.RUnlock"
+	}
+	span := ds.startSpan(context.Background(), operation, name)
+	if span == nil {
+		return nil
+	}
+	m := ds.membership()
+	r := &releaseSpan{ds: ds, span: span, m: m, serviceMethod: serviceMethod, quorum: ds.lockQuorum(m, isReadLock), start: ds.clock().Now()}
+	for _, uid := range locks {
+		if isLocked(uid) {
+			r.pending++
+		}
+	}
+	if r.pending == 0 {
+		span.End(true, 1, nil)
+	}
+	return r
+}
+
+// done wraps next (if any), the function called with the outcome of the first attempt of
+// the release at the node at index, recording the release in the span.
+func (r *releaseSpan) done(index int, next func(err error)) func(err error) {
+	if r == nil {
+		return next
+	}
+	return func(err error) {
+		outcome := OutcomeGranted
+		if err != nil {
+			outcome = OutcomeError
+		}
+		r.span.Call(r.m.node(index), r.serviceMethod, r.start, r.ds.clock().Now().Sub(r.start), outcome, err)
+
+		r.mutex.Lock()
+		if err == nil {
+			r.acked++
+		} else {
+			r.err = err
+		}
+		r.pending--
+		if r.pending == 0 {
+			ok, err := r.acked >= r.quorum, error(nil)
+			if !ok {
+				err = fmt.Errorf("Release acknowledged by %d nodes, %d needed: %v", r.acked, r.quorum, r.err)
+			}
+			r.span.End(ok, 1, err)
+		}
+		r.mutex.Unlock()
+
+		if next != nil {
+			next(err)
+		}
+	}
+}
+
+// traceCall records an RPC of an acquisition in span (when set).
+func traceCall(span Span, node, serviceMethod string, start time.Time, g Granted) {
+	if span != nil {
+		span.Call(node, serviceMethod, start, g.latency, g.outcome(), g.err)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/minio/dsync"
+	"github.com/minio/dsync/lockserver"
+)
+
+// recordingTracer - Tracer recording the spans started.
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, operation, name string) Span {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s := &recordedSpan{operation: operation, name: name, rounds: -1}
+	t.spans = append(t.spans, s)
+	return s
+}
+
+// ended returns the spans ended so far.
+func (t *recordingTracer) ended() []recordedSpan {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var spans []recordedSpan
+	for _, s := range t.spans {
+		s.mutex.Lock()
+		if s.rounds >= 0 {
+			spans = append(spans, recordedSpan{operation: s.operation, name: s.name, calls: append([]string(nil), s.calls...),
+				quorums: append([]bool(nil), s.quorums...), ok: s.ok, rounds: s.rounds, err: s.err})
+		}
+		s.mutex.Unlock()
+	}
+	return spans
+}
+
+// recordedSpan - Span recording the calls, the rounds and its end.
+type recordedSpan struct {
+	mutex     sync.Mutex
+	operation string
+	name      string
+	calls     []string // Service method and outcome of the calls
+	quorums   []bool   // Quorum met per round
+	ok        bool
+	rounds    int // -1 until ended
+	err       error
+}
+
+func (s *recordedSpan) Call(node, serviceMethod string, start time.Time, latency time.Duration, outcome Outcome, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls = append(s.calls, serviceMethod+" "+string(outcome))
+}
+
+func (s *recordedSpan) Round(granted, nodes int, quorum bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.quorums = append(s.quorums, quorum)
+}
+
+func (s *recordedSpan) End(ok bool, rounds int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ok, s.rounds, s.err = ok, rounds, err
+}
+
+func TestTracer(t *testing.T) {
+
+	clnts, stop, _ := newLockServers(4, func(l *lockserver.LockServer, node string) RPC {
+		return NewLocalClient(node, l)
+	})
+	defer stop()
+	tds, err := New(clnts, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := &recordingTracer{}
+	tds.SetTracer(tracer)
+
+	// A span per acquisition, with a child span per node
+	dm := NewDRWMutex("test-tracer", tds)
+	dm.Lock()
+	spans := tracer.ended()
+	if len(spans) != 1 || spans[0].operation != "Lock" || spans[0].name != "test-tracer" || !spans[0].ok || spans[0].rounds != 1 {
+		t.Fatalf("expected span of acquisition in a single round, got %+v", spans)
+	}
+	if len(spans[0].quorums) != 1 || !spans[0].quorums[0] {
+		t.Fatalf("expected round meeting the quorum, got %v", spans[0].quorums)
+	}
+
+	// Failed acquisitions record the rounds missing the quorum
+	if NewDRWMutex("test-tracer", tds).TryLock() {
+		t.Fatal("expected lock to be denied")
+	}
+	spans = tracer.ended()
+	if len(spans) != 2 || spans[1].ok || spans[1].rounds != 1 || spans[1].err == nil ||
+		len(spans[1].quorums) != 1 || spans[1].quorums[0] {
+		t.Fatalf("expected span of failed acquisition, got %+v", spans)
+	}
+
+	// The release is traced asynchronously
+	dm.Unlock()
+	deadline := time.Now().Add(time.Second)
+	for len(spans) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		spans = tracer.ended()
+	}
+	if len(spans) != 3 || spans[2].operation != "Unlock" || !spans[2].ok || len(spans[2].calls) != 4 {
+		t.Fatalf("expected span of release at all nodes, got %+v", spans)
+	}
+	for _, call := range spans[2].calls {
+		if call != "Dsync.Unlock granted" {
+			t.Fatalf("expected release acknowledged, got %v", spans[2].calls)
+		}
+	}
+
+	// Calls of the acquisition that came in after the round was decided are recorded as well
+	for len(tracer.ended()[0].calls) < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for _, call := range tracer.ended()[0].calls {
+		if call != "Dsync.Lock granted" {
+			t.Fatalf("expected lock granted by all nodes, got %v", tracer.ended()[0].calls)
+		}
+	}
+
+	// No spans once the tracer is removed
+	tds.SetTracer(nil)
+	dm.Lock()
+	dm.Unlock()
+	if spans := tracer.ended(); len(spans) != 3 {
+		t.Fatalf("expected no more spans, got %+v", spans)
+	}
+}
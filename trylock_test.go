@@ -0,0 +1,91 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"testing"
+	"time"
+)
+
+// eventually retries try until it succeeds, as releases are sent asynchronously.
+func eventually(t *testing.T, try func() bool) {
+	for start := time.Now(); !try(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("expected lock to be acquired once released")
+		}
+	}
+}
+
+func testTryLock(t *testing.T, ds *Dsync) {
+
+	dm1 := NewDRWMutex("test-try-lock", ds)
+	dm2 := NewDRWMutex("test-try-lock", ds)
+
+	if !dm1.TryLock() {
+		t.Fatal("expected lock to be acquired when available")
+	}
+	start := time.Now()
+	if dm2.TryLock() || dm2.TryRLock() {
+		t.Fatal("expected lock not to be acquired while write locked")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expected attempts to return right away, took %v", d)
+	}
+	dm1.Unlock()
+
+	eventually(t, dm1.TryRLock)
+	eventually(t, dm2.TryRLock)
+	if dm2.TryLock() {
+		t.Fatal("expected lock not to be acquired while read locked")
+	}
+	dm1.RUnlock()
+	dm2.RUnlock()
+	eventually(t, dm2.TryLock)
+	dm2.Unlock()
+}
+
+func TestTryLock(t *testing.T) {
+	testTryLock(t, ds)
+}
+
+func TestTryLockSingleNode(t *testing.T) {
+	testTryLock(t, newSingleNode(t))
+}
+
+func TestLockWithTimeout(t *testing.T) {
+
+	dm1 := NewDRWMutex("test-lock-with-timeout", ds)
+	dm2 := NewDRWMutex("test-lock-with-timeout", ds)
+
+	if !dm1.LockWithTimeout(5 * time.Second) {
+		t.Fatal("expected lock to be acquired when available")
+	}
+	start := time.Now()
+	if dm2.LockWithTimeout(100*time.Millisecond) || dm2.RLockWithTimeout(100*time.Millisecond) {
+		t.Fatal("expected lock not to be acquired while write locked")
+	}
+	dm1.Unlock()
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("expected attempts to give up within their timeouts, took %v", d)
+	}
+
+	if !dm2.RLockWithTimeout(5 * time.Second) {
+		t.Fatal("expected read lock to be acquired once released")
+	}
+	dm2.RUnlock()
+}
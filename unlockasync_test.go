@@ -0,0 +1,116 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	"errors"
+	. "github.com/minio/dsync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUnlockAsync(t *testing.T) {
+
+	dm := NewDRWMutex("test-unlock-async", ds)
+	dm.Lock()
+	if err := <-dm.UnlockAsync(); err != nil {
+		t.Fatalf("expected release to be acknowledged, got %v", err)
+	}
+
+	var failing, retried int64
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && a.Name == "test-unlock-async" && serviceMethod == "Dsync.Unlock" &&
+			(c.Node() == nodes[N-1] || c.Node() == nodes[N-2]) {
+			if atomic.LoadInt64(&failing) == 1 {
+				return errors.New("unreachable")
+			}
+			atomic.AddInt64(&retried, 1)
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	dm.Lock()
+	fc := NewFakeClock(time.Now())
+	ds.SetClock(fc)
+	defer ds.SetClock(nil)
+
+	// Less than a quorum of the nodes acknowledges the release
+	atomic.StoreInt64(&failing, 1)
+	err := <-dm.UnlockAsync()
+	if mErr, ok := err.(*MultiNodeError); !ok || mErr.Count(OutcomeError) != 2 {
+		t.Fatalf("expected release to fail at 2 nodes, got %v", err)
+	}
+
+	// The release worker retries the failed releases
+	atomic.StoreInt64(&failing, 0)
+	waitForWaiters(t, fc, 1)
+	for i := 0; atomic.LoadInt64(&retried) < 2; i++ {
+		if i == 100 {
+			t.Fatalf("expected failed releases to be retried, got %d retries", atomic.LoadInt64(&retried))
+		}
+		fc.Advance(30 * time.Second)
+		time.Sleep(10 * time.Millisecond)
+	}
+	ds.SetClock(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !dm.LockContext(ctx) {
+		t.Fatal("expected lock to be available once the releases are retried")
+	}
+	dm.Unlock()
+}
+
+func TestUnlockContext(t *testing.T) {
+
+	dm := NewDRWMutex("test-unlock-context", ds)
+	dm.Lock()
+	if err := dm.UnlockContext(context.Background()); err != nil {
+		t.Fatalf("expected release to be acknowledged, got %v", err)
+	}
+	if !dm.TryLock() {
+		t.Fatal("expected lock to be available once the release was acknowledged")
+	}
+
+	// The releases of a quorum of the nodes hang beyond the deadline
+	release := make(chan struct{})
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if a, ok := args.(*LockArgs); ok && a.Name == "test-unlock-context" && serviceMethod == "Dsync.Unlock" && c.Node() != nodes[0] {
+			<-release
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := dm.UnlockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline to be exceeded, got %v", err)
+	}
+
+	// The releases complete in the background
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !dm.LockContext(ctx) {
+		t.Fatal("expected lock to be available once the releases completed")
+	}
+	dm.Unlock()
+}
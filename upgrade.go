@@ -0,0 +1,363 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"fmt"
+	"sync/atomic"
+)
+
+// Upgrade tries to convert the read lock held on dm into a write lock in a single round,
+// without releasing the read lock in between, so that no other writer can get hold of the
+// lock in between (as with RUnlock followed by Lock). The lock servers that granted the
+// read lock convert it provided that no other read locks are held there (Upgrade RPC), the
+// other lock servers are asked for a write lock.
+//
+// True is returned once a quorum of the nodes holds the write lock, which is then released
+// with Unlock. Otherwise the round is undone and false is returned with the read lock still
+// held, eg. while other readers hold the lock. As two readers upgrading at the same time
+// would wait for each other, retrying is left to the caller (or RUnlock and Lock instead).
+// The most recent read lock of dm is upgraded, unless it is shared through the read cache
+// (see SetReadCache) or requests are forwarded (see SetForwarding) in which case false is
+// returned right away.
+//
+// It is a run-time error if dm is not read locked on entry to Upgrade.
+func (dm *DRWMutex) Upgrade() bool {
+	return dm.UpgradeContext(context.Background())
+}
+
+// UpgradeContext converts the read lock held on dm into a write lock like Upgrade, giving
+// up on the round once ctx is done. The metadata of ctx (eg. TagsKey and LeaseTTLKey)
+// applies to the write lock like for LockContext.
+//
+// It is a run-time error if dm is not read locked on entry to UpgradeContext.
+func (dm *DRWMutex) UpgradeContext(ctx context.Context) bool {
+
+	dm.m.Lock()
+	if len(dm.readersLocks) == 0 {
+		dm.m.Unlock()
+		panic("Trying to Upgrade() while no RLock() is active")
+	}
+	read := append([]string(nil), dm.readersLocks[len(dm.readersLocks)-1]...)
+	dm.m.Unlock()
+
+	if dm.ds.cachedLocks(dm.Name, read) {
+		return false
+	}
+	if _, ok := dm.ds.forwardingNode(); ok {
+		return false
+	}
+
+	var locks []string
+	if dm.ds.singleNode {
+		if !dm.ds.localUpgrade(dm.Name) {
+			return false
+		}
+		locks = read
+	} else {
+		meta := metadataFromContext(ctx)
+		meta.owner, meta.source = dm.owner, callerSource()
+		var ok bool
+		if locks, ok = dm.ds.upgrade(ctx, dm.ds.membership(), dm.Name, read, meta); !ok {
+			return false
+		}
+	}
+
+	dm.m.Lock()
+	defer dm.m.Unlock()
+	dm.dropReadLock(read)
+	// sized anew, as nodes may have been added since dm was created
+	dm.writeLocks = make([]string, len(locks))
+	copy(dm.writeLocks, locks)
+	dm.ds.metrics.held(true, -1)
+	dm.ds.metrics.held(false, 1)
+	dm.ds.unregisterHolder(dm.Name, read)
+	dm.ds.registerHolder(dm, locks)
+	return true
+}
+
+// Downgrade converts the write lock held on dm into a read lock without releasing it in
+// between, so that no writer can get hold of the lock before the read lock is released
+// with RUnlock (Downgrade RPC). The write lock is released by the lock servers that fail
+// to convert it, as with Unlock. False is returned, with the write lock still held, when
+// requests are forwarded (see SetForwarding).
+//
+// It is a run-time error if dm is not locked on entry to Downgrade, or if dm is Reentrant
+// and holds nested write locks.
+func (dm *DRWMutex) Downgrade() bool {
+	return dm.DowngradeContext(context.Background())
+}
+
+// DowngradeContext converts the write lock held on dm into a read lock like Downgrade,
+// no longer waiting for the lock servers to convert it once ctx is done: the read lock
+// is then held at the lock servers that converted it so far. The metadata of ctx (eg.
+// TagsKey) applies to the read lock like for RLockContext.
+//
+// It is a run-time error if dm is not locked on entry to DowngradeContext, or if dm is
+// Reentrant and holds nested write locks.
+func (dm *DRWMutex) DowngradeContext(ctx context.Context) bool {
+
+	if _, ok := dm.ds.forwardingNode(); ok {
+		return false
+	}
+	dm.m.Lock()
+	holds := dm.holds
+	dm.m.Unlock()
+	if holds > 0 {
+		panic("Trying to Downgrade() while nested Lock() is active")
+	}
+
+	locks := dm.takeWriteLocks()
+	if dm.ds.singleNode {
+		dm.ds.localDowngrade(dm.Name)
+	} else {
+		meta := metadataFromContext(ctx)
+		meta.owner, meta.source = dm.owner, callerSource()
+		locks = dm.ds.downgrade(ctx, locks, dm.Name, meta)
+	}
+
+	dm.m.Lock()
+	defer dm.m.Unlock()
+	dm.readersLocks = append(dm.readersLocks, locks)
+	dm.ds.metrics.held(true, 1)
+	dm.ds.registerHolder(dm, locks)
+	return true
+}
+
+// dropReadLock removes the read lock granted with locks from dm, the caller must hold dm.m.
+func (dm *DRWMutex) dropReadLock(locks []string) {
+	for i := len(dm.readersLocks) - 1; i >= 0; i-- {
+		if sameLocks(dm.readersLocks[i], locks) {
+			dm.readersLocks = append(dm.readersLocks[:i], dm.readersLocks[i+1:]...)
+			return
+		}
+	}
+}
+
+// upgradeGrant is the response of a node to the conversion of a read lock into a write
+// lock (or the request of a write lock, at nodes not holding the read lock).
+type upgradeGrant struct {
+	index    int
+	uid      string // Uid of the write lock, empty when not granted
+	upgraded bool   // Whether the read lock was converted (Upgrade RPC)
+}
+
+// upgrade converts the read lock granted with read on name into a write lock at the nodes
+// that granted it and requests a write lock from the other nodes, returning the locks of
+// the write lock when a quorum of the nodes granted it within the round. Otherwise the
+// conversions are undone and the locks granted are released again, as are those of the
+// nodes responding too late.
+func (ds *Dsync) upgrade(ctx context.Context, m *members, name string, read []string, meta lockMetadata) ([]string, bool) {
+
+	deadline, _ := ctx.Deadline()
+	timeout, ok := roundTimeout(ds.clock().Now(), deadline)
+	if !ok {
+		return nil, false
+	}
+
+	isReadLock := false
+	node, rpcPath := m.clnts[m.ownNode].Node(), m.clnts[m.ownNode].RPCPath()
+	placements := ds.lockPlacements(m, name, isReadLock)
+	nodes := placementNodes(placements)
+	ttl := meta.ttl
+	if ttl == 0 {
+		ttl = ds.requestedLeaseTTL()
+	}
+
+	ch := make(chan upgradeGrant, len(nodes))
+	for _, index := range nodes {
+		atomic.AddInt64(&ds.lockRequests, 1)
+		go func(index int) {
+			defer atomic.AddInt64(&ds.lockRequests, -1)
+
+			serviceMethod := "Dsync.Lock"
+			args := LockArgs{Name: name, Node: node, RPCPath: rpcPath,
+				Priority: meta.priority, Tenant: meta.tenant, TTL: ttl, Wait: timeout,
+				Intent: ds.writeIntent(isReadLock), Mode: Exclusive,
+				Owner: meta.owner, Source: meta.source, Tags: meta.tags}
+			if index < len(read) && isLocked(read[index]) {
+				serviceMethod, args.UID = "Dsync.Upgrade", read[index]
+			} else {
+				bytesUid := [16]byte{}
+				cryptorand.Read(bytesUid[:])
+				args.UID = fmt.Sprintf("%X", bytesUid[:])
+			}
+			g := upgradeGrant{index: index, upgraded: serviceMethod == "Dsync.Upgrade"}
+			var resp LockResp
+			if err := ds.call(index, serviceMethod, &args, &resp); err != nil {
+				ds.logMessage(dsyncLog, LevelDebug, "Unable to call "+serviceMethod, Fields{"name": name, "node": m.node(index), "error": err})
+			} else if resp.Granted {
+				g.uid = args.UID
+				ds.checkView(index, name, isReadLock, resp.View)
+				if !g.upgraded && resp.TTL > 0 {
+					// Keep the lease alive until the lock is released
+					ds.startLease(index, name, args.UID, args.TTL, resp.TTL)
+				}
+			}
+			ch <- g
+		}(index)
+	}
+
+	// Wait until all nodes responded, a quorum can no longer be had, the round timed out
+	// or the caller gave up
+	locks := make([]string, len(m.clnts))
+	upgraded := make([]bool, len(m.clnts))
+	responded := make([]bool, len(m.clnts))
+	denied := make([]bool, len(m.clnts))
+	expired := ds.clock().After(timeout)
+	received := 0
+collect:
+	for ; received < len(nodes); received++ {
+		select {
+		case g := <-ch:
+			responded[g.index] = true
+			if g.uid != "" {
+				locks[g.index], upgraded[g.index] = g.uid, g.upgraded
+			} else if denied[g.index] = true; quorumLost(denied, placements) {
+				received++
+				break collect
+			}
+		case <-expired:
+			break collect
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	// Verify that localhost server is actively participating in the lock (the lock maintenance
+	// relies on this fact), unless it is not among the nodes the lock is placed on
+	granted := ctx.Err() == nil && quorumMet(&locks, placements) && (!isReplica(nodes, m.ownNode) || isLocked(locks[m.ownNode]))
+	for index := range m.clnts {
+		if granted && !upgraded[index] && index < len(read) && isLocked(read[index]) && (responded[index] || !isReplica(nodes, index)) {
+			// Release the read locks that were not converted
+			ds.sendRelease(index, name, read[index], true)
+		} else if !granted && isLocked(locks[index]) {
+			ds.undoUpgrade(m, index, name, locks[index], upgraded[index])
+		}
+	}
+
+	// Settle the responses of the nodes that responded too late
+	atomic.AddInt64(&ds.lockCollectors, 1)
+	go func(pending int) {
+		defer atomic.AddInt64(&ds.lockCollectors, -1)
+		for ; pending > 0; pending-- {
+			g := <-ch
+			switch {
+			case granted && g.uid != "":
+				// Write lock (converted or not) that is not part of the write lock held
+				ds.sendRelease(g.index, name, g.uid, false)
+			case granted && g.index < len(read) && isLocked(read[g.index]):
+				ds.sendRelease(g.index, name, read[g.index], true)
+			case !granted && g.uid != "":
+				ds.undoUpgrade(m, g.index, name, g.uid, g.upgraded)
+			}
+		}
+	}(len(nodes) - received)
+
+	if !granted {
+		return nil, false
+	}
+	return locks, true
+}
+
+// undoUpgrade undoes the write lock the node at index granted with uid during a round of
+// upgrade that failed: a converted read lock is converted back, so that the read lock is
+// held as before, and a write lock requested anew is released.
+func (ds *Dsync) undoUpgrade(m *members, index int, name, uid string, upgraded bool) {
+	if !upgraded {
+		ds.sendRelease(index, name, uid, false)
+		return
+	}
+	var resp LockResp
+	if err := ds.call(index, "Dsync.Downgrade", &LockArgs{Name: name, UID: uid, Mode: Shared}, &resp); err != nil {
+		ds.logMessage(dsyncLog, LevelDebug, "Unable to call Dsync.Downgrade", Fields{"name": name, "node": m.node(index), "error": err})
+	}
+}
+
+// downgrade converts the write lock granted with locks on name into a read lock, returning
+// the locks of the read lock once all nodes responded, the round timed out or ctx is done.
+// The write lock is released at the nodes failing to convert it, and the read lock at the
+// nodes converting it too late.
+func (ds *Dsync) downgrade(ctx context.Context, locks []string, name string, meta lockMetadata) []string {
+
+	deadline, _ := ctx.Deadline()
+	timeout, ok := roundTimeout(ds.clock().Now(), deadline)
+	if !ok {
+		timeout = 0 // Convert what can be converted right away, the rest is released
+	}
+	m := ds.membership()
+	node, rpcPath := m.clnts[m.ownNode].Node(), m.clnts[m.ownNode].RPCPath()
+
+	type downgradeGrant struct {
+		index   int
+		uid     string
+		granted bool
+	}
+	ch := make(chan downgradeGrant, len(locks))
+	requested := 0
+	for index, uid := range locks {
+		if !isLocked(uid) {
+			continue
+		}
+		requested++
+		atomic.AddInt64(&ds.lockRequests, 1)
+		go func(index int, uid string) {
+			defer atomic.AddInt64(&ds.lockRequests, -1)
+			args := LockArgs{Name: name, Node: node, RPCPath: rpcPath, UID: uid, Wait: timeout, Mode: Shared,
+				Priority: meta.priority, Tenant: meta.tenant, Owner: meta.owner, Source: meta.source, Tags: meta.tags}
+			var resp LockResp
+			err := ds.call(index, "Dsync.Downgrade", &args, &resp)
+			if err != nil || !resp.Granted {
+				ds.logMessage(dsyncLog, LevelDebug, "Unable to call Dsync.Downgrade", Fields{"name": name, "node": m.node(index), "error": err})
+				ds.sendRelease(index, name, uid, false)
+			}
+			ch <- downgradeGrant{index: index, uid: uid, granted: err == nil && resp.Granted}
+		}(index, uid)
+	}
+
+	read := make([]string, len(locks))
+	expired := ds.clock().After(timeout)
+	received := 0
+collect:
+	for ; received < requested; received++ {
+		select {
+		case g := <-ch:
+			if g.granted {
+				read[g.index] = g.uid
+			}
+		case <-expired:
+			break collect
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	// Release the read locks converted too late
+	atomic.AddInt64(&ds.lockCollectors, 1)
+	go func(pending int) {
+		defer atomic.AddInt64(&ds.lockCollectors, -1)
+		for ; pending > 0; pending-- {
+			if g := <-ch; g.granted {
+				ds.sendRelease(g.index, name, g.uid, true)
+			}
+		}
+	}(requested - received)
+
+	return read
+}
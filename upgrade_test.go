@@ -0,0 +1,136 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/minio/dsync"
+)
+
+func TestUpgrade(t *testing.T) {
+
+	dm := NewDRWMutex("test-upgrade", ds)
+	other := NewDRWMutex("test-upgrade", ds)
+
+	// Not upgraded while another reader holds the lock
+	dm.RLock()
+	other.RLock()
+	if dm.Upgrade() {
+		t.Fatal("expected upgrade to fail while read locked by another mutex")
+	}
+	other.RUnlock()
+
+	// Upgraded without releasing the read lock, so that no writer slips in (once the
+	// release of the other read lock has been delivered)
+	for i := 0; !dm.Upgrade(); i++ {
+		if i == 100 {
+			t.Fatal("expected upgrade to succeed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if other.TryLock() || other.TryRLock() {
+		t.Fatal("expected lock to be held for writing after upgrade")
+	}
+
+	// Downgraded, after which other readers share the lock but writers still wait
+	if !dm.Downgrade() {
+		t.Fatal("expected downgrade to succeed")
+	}
+	if other.TryLock() {
+		t.Fatal("expected write lock to be denied after downgrade")
+	}
+	if !other.TryRLock() {
+		t.Fatal("expected read lock to be granted after downgrade")
+	}
+	other.RUnlock()
+	dm.RUnlock()
+
+	if !other.LockWithTimeout(time.Second) {
+		t.Fatal("expected lock to be released")
+	}
+	other.Unlock()
+}
+
+func TestUpgradeContext(t *testing.T) {
+
+	var mutex sync.Mutex
+	var slow bool
+	requests := make(map[string]LockArgs)
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		a, ok := args.(*LockArgs)
+		if !ok || a.Name != "test-upgrade-context" {
+			return invoke(c, serviceMethod, args, reply)
+		}
+		mutex.Lock()
+		requests[serviceMethod] = *a
+		delay := slow && serviceMethod == "Dsync.Upgrade" && c.Node() != nodes[0]
+		mutex.Unlock()
+		if delay {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	tags := map[string]string{"job": "compaction"}
+	ctx := context.WithValue(context.Background(), TagsKey, tags)
+	dm := NewDRWMutex("test-upgrade-context", ds)
+	dm.RLock()
+
+	// A round is given up on once it timed out, with the read lock still held
+	mutex.Lock()
+	slow = true
+	mutex.Unlock()
+	start := time.Now()
+	if dm.UpgradeContext(ctx) {
+		t.Fatal("expected upgrade to fail while the lock servers are slow")
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Fatalf("expected upgrade to give up after the round timeout, took %v", d)
+	}
+	mutex.Lock()
+	slow = false
+	mutex.Unlock()
+
+	// Upgraded once the conversions of the failed round have been undone
+	for i := 0; !dm.UpgradeContext(ctx); i++ {
+		if i == 100 {
+			t.Fatal("expected upgrade to succeed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !dm.DowngradeContext(ctx) {
+		t.Fatal("expected downgrade to succeed")
+	}
+	dm.RUnlock()
+
+	// The requests carry the metadata of the lock like those of LockContext
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, serviceMethod := range []string{"Dsync.Upgrade", "Dsync.Downgrade"} {
+		a := requests[serviceMethod]
+		if a.Owner == "" || !strings.HasPrefix(a.Source, "dsync/upgrade_test.go:") || !reflect.DeepEqual(a.Tags, tags) || a.Wait <= 0 {
+			t.Fatalf("expected %s to carry owner, source, tags and wait, got %+v", serviceMethod, a)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"sync"
+	"time"
+)
+
+// SetValidation makes the clients of ds check every interval whether the locks they hold
+// are still held by the lock servers (Validate RPC), eg. to detect that a majority of the
+// lock servers restarted and thereby forgot a lock. A lock is lost once the lock servers no
+// longer holding it could grant it to a writer: it is then reported through Revoked and the
+// handler set with SetLostHandler, and the application should stop mutating the protected
+// resource and unlock. Lock servers that cannot be reached are assumed to still hold the
+// lock. Zero (the default) disables validation.
+func (ds *Dsync) SetValidation(interval time.Duration) {
+	ds.validationMutex.Lock()
+	defer ds.validationMutex.Unlock()
+
+	if ds.validationStop != nil {
+		close(ds.validationStop)
+		ds.validationStop = nil
+	}
+	if interval > 0 && !ds.singleNode {
+		ds.validationStop = make(chan struct{})
+		go ds.validationLoop(interval, ds.validationStop)
+	}
+}
+
+// lostHandler wraps the handler of lost locks (see SetLostHandler).
+type lostHandler struct{ fn func(name string) }
+
+// SetLostHandler sets a function that is called with the name of every lock held by a client
+// of ds that is lost: revoked by a lock server, expired because its lease could not be
+// refreshed or found no longer held by validation (see SetValidation). Passing nil removes
+// the handler. Lost locks are reported through Revoked regardless.
+func (ds *Dsync) SetLostHandler(fn func(name string)) {
+	ds.lostHandler.Store(lostHandler{fn})
+}
+
+func (ds *Dsync) validationLoop(interval time.Duration, stop chan struct{}) {
+	for {
+		select {
+		case <-ds.clock().After(interval):
+			ds.validateLocks()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// heldLock - locks of a single acquisition held by dm.
+type heldLock struct {
+	dm         *DRWMutex
+	locks      []string
+	isReadLock bool
+}
+
+// heldLocks returns the locks held by the clients of ds, except those already lost.
+func (ds *Dsync) heldLocks() []heldLock {
+	ds.holdersMutex.Lock()
+	holders := make(map[*DRWMutex]bool)
+	for _, names := range ds.holders {
+		for _, dm := range names {
+			holders[dm] = true
+		}
+	}
+	ds.holdersMutex.Unlock()
+
+	var held []heldLock
+	for dm := range holders {
+		dm.m.Lock()
+		if ds.HoldsLock(firstLock(dm.writeLocks)) {
+			held = append(held, heldLock{dm, append([]string(nil), dm.writeLocks...), false})
+		}
+		for _, locks := range dm.readersLocks {
+			if ds.HoldsLock(firstLock(locks)) {
+				held = append(held, heldLock{dm, append([]string(nil), locks...), true})
+			}
+		}
+		dm.m.Unlock()
+	}
+	return held
+}
+
+// firstLock returns the first uid granted in locks, empty when none was.
+func firstLock(locks []string) string {
+	for _, uid := range locks {
+		if isLocked(uid) {
+			return uid
+		}
+	}
+	return ""
+}
+
+// validateLocks validates all locks held by the clients of ds, notifying the holders of
+// the locks that were lost.
+func (ds *Dsync) validateLocks() {
+	for _, h := range ds.heldLocks() {
+		if h.isReadLock && ds.localReadsEnabled() {
+			continue // Held by the own node only, see SetLocalReads
+		}
+		if !ds.lockHeld(h.dm.Name, h.locks) {
+			ds.NotifyRevoked(h.dm.Name, firstLock(h.locks))
+			// No longer reported as held, so that lock maintenance removes what is left
+			ds.unregisterHolder(h.dm.Name, h.locks)
+		}
+	}
+}
+
+// lockHeld returns false when the nodes no longer holding the lock on name could grant
+// it to a writer, that is a quorum of the nodes of any placement of the lock.
+func (ds *Dsync) lockHeld(name string, locks []string) bool {
+	held := make([]bool, len(locks))
+	var wg sync.WaitGroup
+	for index, uid := range locks {
+		if !isLocked(uid) {
+			continue
+		}
+		wg.Add(1)
+		go func(index int, uid string) {
+			defer wg.Done()
+			var resp LockResp
+			err := ds.call(index, "Dsync.Validate", &LockArgs{Name: name, UID: uid}, &resp)
+			held[index] = err != nil || resp.Granted
+		}(index, uid)
+	}
+	wg.Wait()
+
+	isReadLock := false
+	for _, p := range ds.lockPlacements(ds.membership(), name, isReadLock) {
+		count := 0
+		for _, index := range p.nodes {
+			if index >= len(held) || !held[index] {
+				count++
+			}
+		}
+		if count >= p.quorum {
+			return false
+		}
+	}
+	return true
+}
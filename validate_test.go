@@ -0,0 +1,88 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/minio/dsync"
+)
+
+func TestValidation(t *testing.T) {
+
+	// Number of nodes replying that they no longer hold the lock, eg. after a restart
+	var forgotten int32
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		if serviceMethod == "Dsync.Validate" {
+			for i := 0; i < int(atomic.LoadInt32(&forgotten)); i++ {
+				if c.Node() == nodes[i] {
+					return nil
+				}
+			}
+		}
+		return invoke(c, serviceMethod, args, reply)
+	})
+	defer ds.SetInterceptors()
+
+	var mutex sync.Mutex
+	var lost []string
+	ds.SetLostHandler(func(name string) {
+		// Locks left held by other tests are lost as well
+		if name == "test-validation" {
+			mutex.Lock()
+			lost = append(lost, name)
+			mutex.Unlock()
+		}
+	})
+	defer ds.SetLostHandler(nil)
+
+	ds.SetValidation(10 * time.Millisecond)
+	defer ds.SetValidation(0)
+
+	dm := NewDRWMutex("test-validation", ds)
+	dm.Lock()
+	revoked := dm.Revoked()
+
+	// Still held as long as the other nodes cannot grant it to a writer
+	atomic.StoreInt32(&forgotten, N/2)
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-revoked:
+		t.Fatal("expected lock to remain held")
+	default:
+	}
+
+	// Lost once a quorum of the nodes no longer holds it
+	atomic.StoreInt32(&forgotten, N/2+1)
+	select {
+	case <-revoked:
+	case <-time.After(time.Second):
+		t.Fatal("expected lock to be lost")
+	}
+
+	// Reported once only
+	time.Sleep(50 * time.Millisecond)
+	mutex.Lock()
+	if len(lost) != 1 {
+		t.Fatalf("expected lost lock to be reported once, got %v", lost)
+	}
+	mutex.Unlock()
+	dm.Unlock()
+}
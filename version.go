@@ -0,0 +1,106 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProtocolVersion - version of the lock protocol spoken between clients and lock servers.
+// Bump whenever the (semantics of the) RPC messages change.
+const ProtocolVersion = 1
+
+// BuildCommit - commit the binary was built from, set at build time using
+//
+//	go build -ldflags "-X github.com/minio/dsync.BuildCommit=$(git rev-parse HEAD)"
+var BuildCommit = "unknown"
+
+// VersionArgs - arguments for the Version RPC.
+type VersionArgs struct {
+	AuthArgs
+	Features Features `json:"features"` // Features supported by the client
+}
+
+// VersionInfo - reply for the Version RPC.
+type VersionInfo struct {
+	ProtocolVersion int       `json:"protocolVersion"`
+	Commit          string    `json:"commit"`
+	Features        Features  `json:"features"` // Features supported by the lock server
+	Time            time.Time `json:"time"`     // Time at the lock server when replying, eg. to estimate clock skew
+}
+
+// LocalVersion returns the version information of this binary, to be returned
+// by the Version RPC handler of a lock server.
+func LocalVersion() VersionInfo {
+	return VersionInfo{
+		ProtocolVersion: ProtocolVersion,
+		Commit:          BuildCommit,
+		Features:        supportedFeatures,
+		Time:            time.Now().UTC(),
+	}
+}
+
+// NodeVersion - version information (or the error retrieving it) for a single node.
+type NodeVersion struct {
+	Node string
+	VersionInfo
+	Skew time.Duration // Estimated clock skew of the node relative to this client
+	Err  error
+}
+
+// Versions queries all nodes for their version information.
+func (ds *Dsync) Versions() []NodeVersion {
+
+	m := ds.membership()
+	nodes := m.nodes()
+	versions := make([]NodeVersion, len(nodes))
+
+	ch := make(chan int, len(nodes))
+	for i, index := range nodes {
+		go func(i, index int) {
+			versions[i].Node = m.node(index)
+			start := time.Now()
+			versions[i].Err = ds.call(index, "Dsync.Version", &VersionArgs{Features: supportedFeatures}, &versions[i].VersionInfo)
+			if versions[i].Err == nil {
+				ds.setNodeFeatures(index, versions[i].Features)
+				if t := versions[i].Time; !t.IsZero() {
+					// Assume the reply was sent halfway the round trip
+					versions[i].Skew = t.Sub(start.Add(time.Since(start) / 2))
+				}
+			}
+			ch <- i
+		}(i, index)
+	}
+	for range nodes {
+		<-ch
+	}
+
+	return versions
+}
+
+// CheckVersions returns an error when the nodes that could be reached do not all
+// speak the same protocol version as this client.
+func (ds *Dsync) CheckVersions() error {
+	for _, v := range ds.Versions() {
+		if v.Err == nil && v.ProtocolVersion != ProtocolVersion {
+			return fmt.Errorf("Mixed-version cluster: node %s speaks protocol version %d, client speaks version %d",
+				v.Node, v.ProtocolVersion, ProtocolVersion)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	"testing"
+	"time"
+	. "github.com/minio/dsync"
+)
+
+func TestVersions(t *testing.T) {
+
+	versions := ds.Versions()
+	if len(versions) != N {
+		t.Fatalf("expected %d versions, got %d", N, len(versions))
+	}
+	for _, v := range versions {
+		if v.Err != nil {
+			t.Fatalf("node %s: %v", v.Node, v.Err)
+		}
+		if v.ProtocolVersion != ProtocolVersion {
+			t.Fatalf("node %s: expected protocol version %d, got %d", v.Node, ProtocolVersion, v.ProtocolVersion)
+		}
+		if v.Time.IsZero() || v.Skew > time.Second || v.Skew < -time.Second {
+			t.Fatalf("node %s: expected time without clock skew, got %v (skew %v)", v.Node, v.Time, v.Skew)
+		}
+	}
+
+	if err := ds.CheckVersions(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Violation - protocol violation detected in the view a lock server returned with a grant
+// (see LockView), eg. a write lock granted while read locks are held.
+type Violation struct {
+	Node      string   // Network address of the lock server
+	Name      string   // Name of the lock
+	Operation string   // "Lock" or "RLock"
+	Mode      LockMode // Mode of the lock granted
+	View      LockView // View returned by the lock server
+	Reason    string
+}
+
+type violationHandler struct{ fn func(v Violation) }
+
+// SetViolationHandler sets a function that is called for every protocol violation
+// detected by ds, eg. to count them in the metrics of the application. Passing nil
+// removes the handler. Violations are counted (see Debug) regardless.
+func (ds *Dsync) SetViolationHandler(fn func(v Violation)) {
+	ds.violationHandler.Store(violationHandler{fn})
+}
+
+// checkView checks the view the lock server at index returned with a grant for name.
+func (ds *Dsync) checkView(index int, name string, isReadLock bool, view *LockView) {
+	if view == nil {
+		return // Older lock server
+	}
+	v := Violation{Node: ds.membership().node(index), Name: name, Operation: "Lock", Mode: ModeOf(!isReadLock), View: *view}
+	switch {
+	case isReadLock && view.Writer:
+		v.Operation, v.Reason = "RLock", "read lock granted while write locked"
+	case isReadLock && view.Readers == 0:
+		v.Operation, v.Reason = "RLock", "read lock granted without being counted as reader"
+	case !isReadLock && view.Readers > 0:
+		v.Reason = "write lock granted while read locked"
+	case !isReadLock && !view.Writer:
+		v.Reason = "write lock granted without being recorded as writer"
+	default:
+		return
+	}
+
+	atomic.AddInt64(&ds.violations, 1)
+	ds.logMessage(dsyncLog, LevelError, "Protocol violation", Fields{"node": v.Node, "name": v.Name, "reason": v.Reason, "view": fmt.Sprintf("%+v", v.View)})
+	if h, ok := ds.violationHandler.Load().(violationHandler); ok && h.fn != nil {
+		h.fn(v)
+	}
+}
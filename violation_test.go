@@ -0,0 +1,67 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync_test
+
+import (
+	. "github.com/minio/dsync"
+	"sync"
+	"testing"
+)
+
+func TestViolationHandler(t *testing.T) {
+
+	var mutex sync.Mutex
+	var violations []Violation
+	ds.SetViolationHandler(func(v Violation) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		violations = append(violations, v)
+	})
+	defer ds.SetViolationHandler(nil)
+
+	ds.SetInterceptors(func(c RPC, serviceMethod string, args RPCArgs, reply interface{}, invoke Invoker) error {
+		err := invoke(c, serviceMethod, args, reply)
+		if a, ok := args.(*LockArgs); ok && a.Name == "test-violation" && serviceMethod == "Dsync.Lock" && c.Node() == nodes[N-1] {
+			// Lock server that grants a write lock while read locked
+			reply.(*LockResp).View = &LockView{Writer: true, Readers: 1}
+		} else if a, ok := args.(*LockArgs); ok && a.Name == "test-violation" && reply.(*LockResp).Granted {
+			if serviceMethod == "Dsync.Lock" {
+				reply.(*LockResp).View = &LockView{Writer: true}
+			} else {
+				reply.(*LockResp).View = &LockView{Readers: 1}
+			}
+		}
+		return err
+	})
+	defer ds.SetInterceptors()
+
+	before := ds.Debug().Violations
+	dm := NewDRWMutex("test-violation", ds)
+	dm.Lock()
+	dm.Unlock()
+	dm.RLock()
+	dm.RUnlock()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(violations) != 1 || violations[0].Node != nodes[N-1] || violations[0].Name != "test-violation" {
+		t.Fatalf("expected a single violation by %s, got %+v", nodes[N-1], violations)
+	}
+	if n := ds.Debug().Violations - before; n != 1 {
+		t.Fatalf("expected 1 violation to be counted, got %d", n)
+	}
+}